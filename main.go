@@ -33,10 +33,14 @@ import (
 
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/antiabuse" // 违禁词
 
+	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/alias" // 指令别名与宏
+
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/chat" // 基础词库
 
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/chatcount" // 聊天时长统计
 
+	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/msgarchive" // 群聊记录存档
+
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/sleepmanage" // 统计睡眠时间
 
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/airecord" // 群应用：AI声聊
@@ -0,0 +1,133 @@
+package aichat
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	bm25K1 = 1.5
+	bm25B  = 0.75
+)
+
+// tokenize 切分文本用于检索: 汉字等按相邻两字切分, 字母与数字按单词切分并转为小写
+func tokenize(s string) []string {
+	var (
+		tokens []string
+		word   []rune
+		han    []rune
+	)
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		switch len(han) {
+		case 0:
+		case 1:
+			tokens = append(tokens, string(han))
+		default:
+			for i := 0; i+1 < len(han); i++ {
+				tokens = append(tokens, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return tokens
+}
+
+// bm25doc 索引中的一段文字
+type bm25doc struct {
+	p   *passage
+	tf  map[string]int
+	len int
+}
+
+// bm25 一个群的知识库索引
+type bm25 struct {
+	docs  []bm25doc
+	df    map[string]int
+	avgdl float64
+}
+
+// hit 检索结果
+type hit struct {
+	p     *passage
+	score float64
+}
+
+func newBM25(ps []*passage) *bm25 {
+	idx := &bm25{docs: make([]bm25doc, 0, len(ps)), df: make(map[string]int, 1024)}
+	total := 0
+	for _, p := range ps {
+		tokens := tokenize(p.Title + "\n" + p.Text)
+		tf := make(map[string]int, len(tokens))
+		for _, t := range tokens {
+			tf[t]++
+		}
+		for t := range tf {
+			idx.df[t]++
+		}
+		idx.docs = append(idx.docs, bm25doc{p: p, tf: tf, len: len(tokens)})
+		total += len(tokens)
+	}
+	if len(idx.docs) > 0 {
+		idx.avgdl = float64(total) / float64(len(idx.docs))
+	}
+	return idx
+}
+
+// search 返回得分最高的 k 段, 只保留至少命中四分之一检索词的段落
+func (idx *bm25) search(query string, k int) []hit {
+	terms := make(map[string]struct{}, 16)
+	for _, t := range tokenize(query) {
+		terms[t] = struct{}{}
+	}
+	if len(terms) == 0 || len(idx.docs) == 0 {
+		return nil
+	}
+	need := (len(terms) + 3) / 4
+	n := float64(len(idx.docs))
+	hits := make([]hit, 0, k)
+	for i := range idx.docs {
+		d := &idx.docs[i]
+		score, matched := 0.0, 0
+		for t := range terms {
+			f := float64(d.tf[t])
+			if f == 0 {
+				continue
+			}
+			matched++
+			df := float64(idx.df[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(d.len)/idx.avgdl))
+		}
+		if matched >= need && score > 0 {
+			hits = append(hits, hit{p: d.p, score: score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
@@ -0,0 +1,430 @@
+package aichat
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/floatbox/web"
+	sql "github.com/FloatTech/sqlite"
+	"github.com/RomiChan/syncx"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/zbputils/ctxext"
+)
+
+const (
+	// passageSize 每段的最大字数
+	passageSize = 300
+	// maxKnowledgeSize 单条知识的最大字数
+	maxKnowledgeSize = 50000
+	// maxUploadSize 上传文件的最大字节数
+	maxUploadSize = 1 << 20
+	// topPassages 每次注入提示词的段落数
+	topPassages  = 3
+	uploadWait   = 2 * time.Minute
+	listPageSize = 10
+)
+
+var errEmptyKnowledge = errors.New("知识内容为空")
+
+// knowledgedb 各群的知识库
+type knowledgedb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// entry 一条知识
+type entry struct {
+	ID      int64  `db:"id"`
+	GroupID int64  `db:"gid"`
+	Title   string `db:"title"`
+	Source  string `db:"source"` // 手动添加 或 文件名
+	Creator int64  `db:"creator"`
+	Time    int64  `db:"time"`
+	Length  int    `db:"length"` // 字数
+}
+
+// passage 知识切分后的一段, 检索与注入提示词都以段为单位
+type passage struct {
+	ID      int64  `db:"id"`
+	EntryID int64  `db:"eid"`
+	GroupID int64  `db:"gid"`
+	Seq     int    `db:"seq"`
+	Title   string `db:"title"`
+	Text    string `db:"text"`
+}
+
+var (
+	kdb = &knowledgedb{}
+	// indexes 群号到索引的缓存, 知识库变化时删除
+	indexes syncx.Map[int64, *bm25]
+	// uploads 等待上传知识文件的管理员, 值为截止时间
+	uploads syncx.Map[string, int64]
+)
+
+func initKnowledge(dbpath string) error {
+	kdb.Sqlite = sql.New(dbpath)
+	err := kdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = kdb.Create("entry", &entry{})
+	if err != nil {
+		return err
+	}
+	err = kdb.Create("passage", &passage{})
+	if err != nil {
+		return err
+	}
+	_, err = kdb.Exec("CREATE INDEX IF NOT EXISTS idx_passage_gid ON [passage](gid);")
+	return err
+}
+
+func (db *knowledgedb) nextID(table string) (int64, error) {
+	var next struct {
+		ID int64 `db:"id"`
+	}
+	err := db.Query("SELECT IFNULL(MAX(id), 0) + 1 FROM ["+table+"];", &next)
+	return next.ID, err
+}
+
+// splitPassages 按段落切分知识, Markdown 标题另起一段, 过长的段落按字数硬切
+func splitPassages(content string) []string {
+	var (
+		parts []string
+		cur   strings.Builder
+		n     int
+	)
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			parts = append(parts, s)
+		}
+		cur.Reset()
+		n = 0
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r", ""), "\n") {
+		line = strings.TrimRight(line, " \t")
+		if strings.HasPrefix(line, "#") || (line == "" && n > passageSize/2) {
+			flush()
+		}
+		if line == "" {
+			if n > 0 {
+				cur.WriteByte('\n')
+				n++
+			}
+			continue
+		}
+		r := []rune(line)
+		if n+len(r) > passageSize && n > passageSize/2 {
+			flush()
+		}
+		for n+len(r) > passageSize {
+			cur.WriteString(string(r[:passageSize-n]))
+			r = r[passageSize-n:]
+			flush()
+		}
+		cur.WriteString(string(r))
+		cur.WriteByte('\n')
+		n += len(r) + 1
+	}
+	flush()
+	return parts
+}
+
+// addKnowledge 添加一条知识并切分为段落
+func addKnowledge(e *entry, content string) error {
+	parts := splitPassages(content)
+	if len(parts) == 0 {
+		return errEmptyKnowledge
+	}
+	kdb.Lock()
+	defer kdb.Unlock()
+	var err error
+	e.ID, err = kdb.nextID("entry")
+	if err != nil {
+		return err
+	}
+	e.Length = utf8.RuneCountInString(content)
+	pid, err := kdb.nextID("passage")
+	if err != nil {
+		return err
+	}
+	for i, text := range parts {
+		err = kdb.Insert("passage", &passage{ID: pid + int64(i), EntryID: e.ID, GroupID: e.GroupID, Seq: i, Title: e.Title, Text: text})
+		if err != nil {
+			_ = kdb.Del("passage", "WHERE eid = ?", e.ID)
+			return err
+		}
+	}
+	indexes.Delete(e.GroupID)
+	return kdb.Insert("entry", e)
+}
+
+// delKnowledge 删除本群的一条知识
+func delKnowledge(gid, id int64) (bool, error) {
+	kdb.Lock()
+	defer kdb.Unlock()
+	if !kdb.CanFind("entry", "WHERE id = ? AND gid = ?", id, gid) {
+		return false, nil
+	}
+	err := kdb.Del("passage", "WHERE eid = ?", id)
+	if err != nil {
+		return true, err
+	}
+	indexes.Delete(gid)
+	return true, kdb.Del("entry", "WHERE id = ?", id)
+}
+
+// listKnowledge 本群的知识, 按编号排列
+func listKnowledge(gid int64, page int) ([]*entry, int, error) {
+	kdb.RLock()
+	defer kdb.RUnlock()
+	var c struct {
+		N int `db:"n"`
+	}
+	err := kdb.Query("SELECT COUNT(*) FROM [entry] WHERE gid = ?;", &c, gid)
+	if err != nil {
+		return nil, 0, err
+	}
+	es, err := sql.FindAll[entry](&kdb.Sqlite, "entry", "WHERE gid = ? ORDER BY id LIMIT ? OFFSET ?",
+		gid, listPageSize, (page-1)*listPageSize)
+	if err == sql.ErrNullResult {
+		return nil, c.N, nil
+	}
+	return es, c.N, err
+}
+
+// getKnowledge 本群的一条知识及其全文
+func getKnowledge(gid, id int64) (*entry, string, error) {
+	kdb.RLock()
+	defer kdb.RUnlock()
+	e := &entry{}
+	err := kdb.Find("entry", e, "WHERE id = ? AND gid = ?", id, gid)
+	if err == sql.ErrNullResult {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	ps, err := sql.FindAll[passage](&kdb.Sqlite, "passage", "WHERE eid = ? ORDER BY seq", id)
+	if err != nil && err != sql.ErrNullResult {
+		return nil, "", err
+	}
+	texts := make([]string, len(ps))
+	for i, p := range ps {
+		texts[i] = p.Text
+	}
+	return e, strings.Join(texts, "\n"), nil
+}
+
+// indexOf 本群的检索索引, 没有缓存时从数据库构建
+func indexOf(gid int64) (*bm25, error) {
+	if idx, ok := indexes.Load(gid); ok {
+		return idx, nil
+	}
+	// 在写锁内构建并缓存, 以免期间增删的知识被旧索引覆盖
+	kdb.Lock()
+	defer kdb.Unlock()
+	if idx, ok := indexes.Load(gid); ok {
+		return idx, nil
+	}
+	ps, err := sql.FindAll[passage](&kdb.Sqlite, "passage", "WHERE gid = ?", gid)
+	if err != nil && err != sql.ErrNullResult {
+		return nil, err
+	}
+	idx := newBM25(ps)
+	indexes.Store(gid, idx)
+	return idx, nil
+}
+
+// retrieve 检索与问题最相关的段落
+func retrieve(gid int64, query string, k int) ([]hit, error) {
+	idx, err := indexOf(gid)
+	if err != nil {
+		return nil, err
+	}
+	return idx.search(query, k), nil
+}
+
+// knowledgePrompt 把检索到的段落附加到系统提示词后
+func knowledgePrompt(hits []hit) string {
+	var sb strings.Builder
+	sb.WriteString("\n\n以下是本群知识库中与当前话题相关的资料, 每段以【#编号 标题】开头。" +
+		"回答时优先依据这些资料, 并在用到的内容后用【#编号 标题】注明出处; 资料与问题无关时忽略它们, 不要编造出处。\n")
+	for _, h := range hits {
+		sb.WriteString("\n【#")
+		sb.WriteString(strconv.FormatInt(h.p.EntryID, 10))
+		sb.WriteString(" ")
+		sb.WriteString(h.p.Title)
+		sb.WriteString("】\n")
+		sb.WriteString(h.p.Text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func uploadKey(gid, uid int64) string {
+	return strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10)
+}
+
+// titleOf 取首行作为标题, 只有一行时取前 20 字
+func titleOf(content string) (title, body string) {
+	content = strings.TrimSpace(content)
+	first, rest, ok := strings.Cut(content, "\n")
+	first = strings.TrimLeft(strings.TrimSpace(first), "# ")
+	if ok && strings.TrimSpace(rest) != "" && utf8.RuneCountInString(first) <= 50 {
+		return first, rest
+	}
+	r := []rune(first)
+	if len(r) > 20 {
+		r = append(r[:20], '…')
+	}
+	return string(r), content
+}
+
+func registerKnowledge() {
+	en.OnRegex(`^添加知识\s*([\s\S]+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			content := ctx.State["regex_matched"].([]string)[1]
+			if utf8.RuneCountInString(content) > maxKnowledgeSize {
+				ctx.SendChain(message.Text("ERROR: 单条知识不能超过", maxKnowledgeSize, "字, 请分多次添加"))
+				return
+			}
+			title, body := titleOf(content)
+			e := &entry{GroupID: ctx.Event.GroupID, Title: title, Source: "手动添加", Creator: ctx.Event.UserID, Time: time.Now().Unix()}
+			if err := addKnowledge(e, body); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已添加知识 #", e.ID, " ", e.Title))
+		})
+	en.OnFullMatch("上传知识", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			uploads.Store(uploadKey(ctx.Event.GroupID, ctx.Event.UserID), time.Now().Add(uploadWait).Unix())
+			ctx.SendChain(message.Text("请在", int(uploadWait/time.Minute), "分钟内上传 txt 或 md 文件, 文件名将作为标题"))
+		})
+	en.On("notice/group_upload", func(ctx *zero.Ctx) bool {
+		ext := strings.ToLower(path.Ext(ctx.Event.File.Name))
+		if ext != ".txt" && ext != ".md" {
+			return false
+		}
+		deadline, ok := uploads.LoadAndDelete(uploadKey(ctx.Event.GroupID, ctx.Event.UserID))
+		return ok && time.Now().Unix() <= deadline
+	}).SetBlock(false).Handle(func(ctx *zero.Ctx) {
+		f := ctx.Event.File
+		if f.Size > maxUploadSize {
+			ctx.SendChain(message.Text("ERROR: 文件不能超过", maxUploadSize>>10, "KB"))
+			return
+		}
+		data, err := web.GetData(ctx.GetThisGroupFileURL(f.BusID, f.ID))
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if !utf8.Valid(data) {
+			ctx.SendChain(message.Text("ERROR: 文件需为 UTF-8 编码的文本"))
+			return
+		}
+		if utf8.RuneCount(data) > maxKnowledgeSize {
+			ctx.SendChain(message.Text("ERROR: 单条知识不能超过", maxKnowledgeSize, "字, 请拆分后上传"))
+			return
+		}
+		e := &entry{
+			GroupID: ctx.Event.GroupID,
+			Title:   strings.TrimSuffix(f.Name, path.Ext(f.Name)),
+			Source:  f.Name,
+			Creator: ctx.Event.UserID,
+			Time:    time.Now().Unix(),
+		}
+		if err = addKnowledge(e, binary.BytesToString(data)); err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.At(ctx.Event.UserID), message.Text("已添加知识 #", e.ID, " ", e.Title, ", 共", e.Length, "字"))
+	})
+	en.OnRegex(`^删除知识\s*#?(\d+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			ok, err := delKnowledge(ctx.Event.GroupID, id)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if !ok {
+				ctx.SendChain(message.Text("本群没有编号为 #", id, " 的知识"))
+				return
+			}
+			ctx.SendChain(message.Text("已删除知识 #", id))
+		})
+	en.OnRegex(`^知识列表\s*(\d*)$`, zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			page, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			if page <= 0 {
+				page = 1
+			}
+			es, total, err := listKnowledge(ctx.Event.GroupID, page)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if total == 0 {
+				ctx.SendChain(message.Text("本群知识库为空, 管理员可以发送「添加知识 标题\\n内容」或「上传知识」添加"))
+				return
+			}
+			pages := (total + listPageSize - 1) / listPageSize
+			if len(es) == 0 {
+				ctx.SendChain(message.Text("知识库只有", pages, "页"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("本群知识库 (第" + strconv.Itoa(page) + "/" + strconv.Itoa(pages) + "页, 共" + strconv.Itoa(total) + "条):")
+			for _, e := range es {
+				sb.WriteString("\n#" + strconv.FormatInt(e.ID, 10) + " " + e.Title + " (" + strconv.Itoa(e.Length) + "字, " + e.Source + ")")
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	en.OnRegex(`^查看知识\s*#?(\d+)$`, zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			e, content, err := getKnowledge(ctx.Event.GroupID, id)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if e == nil {
+				ctx.SendChain(message.Text("本群没有编号为 #", id, " 的知识"))
+				return
+			}
+			head := "#" + strconv.FormatInt(e.ID, 10) + " " + e.Title + "\n来源: " + e.Source +
+				"\n添加于: " + time.Unix(e.Time, 0).Format("2006-01-02 15:04")
+			ctx.Send(message.Message{
+				ctxext.FakeSenderForwardNode(ctx, message.Text(head)),
+				ctxext.FakeSenderForwardNode(ctx, message.Text(content)),
+			})
+		})
+	en.OnRegex(`^搜索知识\s*(.+)$`, zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			hits, err := retrieve(ctx.Event.GroupID, ctx.State["regex_matched"].([]string)[1], topPassages)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(hits) == 0 {
+				ctx.SendChain(message.Text("知识库中没有相关内容"))
+				return
+			}
+			msg := make(message.Message, 0, len(hits))
+			for _, h := range hits {
+				msg = append(msg, ctxext.FakeSenderForwardNode(ctx, message.Text(
+					"#", h.p.EntryID, " ", h.p.Title, " (相关度 ", strconv.FormatFloat(h.score, 'f', 2, 64), ")\n", h.p.Text)))
+			}
+			ctx.Send(msg)
+		})
+}
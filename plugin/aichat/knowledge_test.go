@@ -0,0 +1,94 @@
+package aichat
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitPassages(t *testing.T) {
+	ps := splitPassages("# 规则\n第一条\n\n# 作息\n" + strings.Repeat("早睡早起。", 100))
+	if len(ps) != 3 || ps[0] != "# 规则\n第一条" || !strings.HasPrefix(ps[1], "# 作息") {
+		t.Fatal(len(ps), ps)
+	}
+	for _, p := range ps {
+		if n := utf8.RuneCountInString(p); n > passageSize {
+			t.Fatal("passage too long", n)
+		}
+	}
+	if ps = splitPassages(" \n\n "); len(ps) != 0 {
+		t.Fatal(ps)
+	}
+}
+
+func TestTitleOf(t *testing.T) {
+	for _, c := range []struct {
+		content, title, body string
+	}{
+		{"# 群规\n不许刷屏", "群规", "不许刷屏"},
+		{"不许刷屏", "不许刷屏", "不许刷屏"},
+		{strings.Repeat("长", 30), strings.Repeat("长", 20) + "…", strings.Repeat("长", 30)},
+	} {
+		title, body := titleOf(c.content)
+		if title != c.title || body != c.body {
+			t.Fatal(c, "got", title, body)
+		}
+	}
+}
+
+func TestKnowledge(t *testing.T) {
+	if err := initKnowledge(t.TempDir() + "/knowledge.db"); err != nil {
+		t.Fatal(err)
+	}
+	gid := int64(1)
+	add := func(title, content string) *entry {
+		t.Helper()
+		e := &entry{GroupID: gid, Title: title, Source: "手动添加"}
+		if err := addKnowledge(e, content); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	rules := add("群规", "禁止在群里刷屏, 违者禁言一天")
+	if err := addKnowledge(&entry{GroupID: gid}, " \n "); err != errEmptyKnowledge {
+		t.Fatal(err)
+	}
+	hits, err := retrieve(gid, "刷屏会怎样", 3)
+	if err != nil || len(hits) != 1 || hits[0].p.EntryID != rules.ID {
+		t.Fatal(hits, err)
+	}
+	// 索引已缓存, 新增与删除知识后重新构建
+	hits, err = retrieve(gid, "服务器地址", 3)
+	if err != nil || len(hits) != 0 {
+		t.Fatal(hits, err)
+	}
+	server := add("服务器", "服务器地址是 mc.example.com")
+	if hits, err = retrieve(gid, "服务器地址", 3); err != nil || len(hits) != 1 || hits[0].p.EntryID != server.ID {
+		t.Fatal(hits, err)
+	}
+	if hits, err = retrieve(2, "服务器地址", 3); err != nil || len(hits) != 0 {
+		t.Fatal("other group", hits, err)
+	}
+	if ok, err := delKnowledge(gid, rules.ID); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	if hits, err = retrieve(gid, "刷屏会怎样", 3); err != nil || len(hits) != 0 {
+		t.Fatal(hits, err)
+	}
+
+	// 并发检索与添加时, 添加之后的检索总能找到新知识
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = retrieve(gid, "服务器", 3)
+		}()
+	}
+	add("端口", "端口是 25565")
+	wg.Wait()
+	if hits, err = retrieve(gid, "端口", 3); err != nil || len(hits) != 1 {
+		t.Fatal(hits, err)
+	}
+}
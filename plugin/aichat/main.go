@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"math/rand"
 	"strings"
+	"time"
 
 	"github.com/RomiChan/syncx"
 	"github.com/fumiama/deepinfra"
@@ -20,6 +21,8 @@ import (
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/chat"
 	"github.com/FloatTech/zbputils/control"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aichatcfg/usage"
 )
 
 var (
@@ -28,7 +31,15 @@ var (
 		DisableOnDefault: false,
 		Extra:            control.ExtraFromString("aichat"),
 		Brief:            "大模型聊天和Agent",
-		Help:             "- (随意聊天, 概率匹配)",
+		Help: "- (随意聊天, 概率匹配)\n" +
+			"- 添加知识 标题\n内容 (仅管理员)\n" +
+			"- 上传知识 (仅管理员, 随后上传 txt 或 md 文件)\n" +
+			"- 删除知识 #1 (仅管理员)\n" +
+			"- 知识列表 [页]\n" +
+			"- 查看知识 #1\n" +
+			"- 搜索知识 xxx\n" +
+			"Tips: 聊天时会检索本群知识库, 把最相关的几段资料附在提示词中, 并要求回答注明出处\n" +
+			"Tips: 超出 aichatcfg 中设置的额度后不再回复",
 
 		PrivateDataFolder: "aichat",
 	}).ApplySingle(single.New(
@@ -47,6 +58,11 @@ var (
 )
 
 func init() {
+	if err := initKnowledge(en.DataFolder() + "knowledge.db"); err != nil {
+		panic(err)
+	}
+	// 指令需要先于聊天注册, 以免被当作聊天内容
+	registerKnowledge()
 	en.OnMessage(chat.EnsureConfig, func(ctx *zero.Ctx) bool {
 		stor, ok := ctx.State[zero.StateKeyPrefixKeep+"aichatcfg_stor__"].(chat.Storage)
 		if !ok {
@@ -79,11 +95,19 @@ func init() {
 		temperature := stor.Temp()
 		topp, maxn := chat.AC.MParams()
 		mp := ctx.State[control.StateKeySyncxState].(*syncx.Map[string, any])
+		if err := usage.Check(gid, ctx.Event.UserID, time.Now()); err != nil {
+			// 额度用完时不再请求接口, 只在被@时告知
+			if ctx.Event.IsToMe {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(err))
+			}
+			return
+		}
 
 		logrus.Debugln("[aichat] agent mode test: noagent", stor.NoAgent(), "hasapi", chat.AC.AgentAPI != "", "hasmodel", chat.AC.AgentModelName != "")
 		if !stor.NoAgent() && chat.AC.AgentAPI != "" && chat.AC.AgentModelName != "" && chat.AC.Key != "" {
 			logrus.Debugln("[aichat] enter agent mode")
 			x := deepinfra.NewAPI(chat.AC.AgentAPI, string(chat.AC.AgentKey))
+			x.SetHTTPClient(usage.Client(usage.Call{Plugin: "aichat", GroupID: gid, UserID: ctx.Event.UserID, Model: chat.AC.AgentModelName}))
 			mod, err := chat.AC.Type.Protocol(chat.AC.AgentModelName, temperature, topp, maxn)
 			if err != nil {
 				logrus.Warnln("ERROR: ", err)
@@ -163,12 +187,21 @@ func init() {
 		}
 
 		x := deepinfra.NewAPI(chat.AC.API, string(chat.AC.Key))
+		x.SetHTTPClient(usage.Client(usage.Call{Plugin: "aichat", GroupID: gid, UserID: ctx.Event.UserID, Model: chat.AC.ModelName}))
 		mod, err := chat.AC.Type.Protocol(chat.AC.ModelName, temperature, topp, maxn)
 		if err != nil {
 			logrus.Warnln("ERROR: ", err)
 			return
 		}
-		data, err := x.Request(chat.GetChatContext(mod, gid, chat.AC.SystemP, bool(chat.AC.NoSystemP)))
+		sysp := chat.AC.SystemP
+		hits, err := retrieve(gid, ctx.ExtractPlainText(), topPassages)
+		if err != nil {
+			logrus.Warnln("[aichat] 检索知识库失败:", err)
+		}
+		if len(hits) > 0 {
+			sysp += knowledgePrompt(hits)
+		}
+		data, err := x.Request(chat.GetChatContext(mod, gid, sysp, bool(chat.AC.NoSystemP)))
 		if err != nil {
 			logrus.Warnln("[aichat] post err:", err)
 			return
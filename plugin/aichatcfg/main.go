@@ -41,7 +41,12 @@ var (
 			"- 设置AI聊天(不)以AI语音输出\n" +
 			"- 查看AI聊天配置\n" +
 			"- 重置AI聊天Agent\n" +
-			"- 重置AI聊天\n",
+			"- 重置AI聊天\n" +
+			"- 设置AI聊天(每日|每月)额度 群[群号|默认] 50000 (0 为取消)\n" +
+			"- 设置AI聊天(每日|每月)额度 用户[@xxx|QQ号] 5000 (不指定用户时为每个用户的默认额度)\n" +
+			"- 查看AI聊天额度\n" +
+			"- AI用量\n",
+		PrivateDataFolder: "aichatcfg",
 	})
 )
 
@@ -180,4 +185,5 @@ func init() {
 		chat.ResetChat()
 		ctx.SendChain(message.Text("成功"))
 	})
+	registerUsage()
 }
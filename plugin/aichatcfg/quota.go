@@ -0,0 +1,304 @@
+package aichatcfg
+
+import (
+	"image"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/imgfactory"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aichatcfg/usage"
+)
+
+const (
+	// reportDays 用量图中显示的天数
+	reportDays = 14
+	// reportTop 排行显示的数量
+	reportTop = 5
+)
+
+// registerUsage 注册用量与额度相关的指令
+func registerUsage() {
+	if err := usage.Open(en.DataFolder() + "usage.db"); err != nil {
+		panic(err)
+	}
+	en.OnRegex(`^设置AI聊天(每日|每月)额度\s*(群|用户)\s*(默认|\[CQ:at,qq=(\d+)\]|\d*)\s+(\d+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			period := usage.PeriodDay
+			if matched[1] == "每月" {
+				period = usage.PeriodMonth
+			}
+			scope := usage.ScopeGroup
+			if matched[2] == "用户" {
+				scope = usage.ScopeUser
+			}
+			var target int64
+			switch {
+			case matched[4] != "":
+				target, _ = strconv.ParseInt(matched[4], 10, 64)
+			case matched[3] != "" && matched[3] != "默认":
+				target, _ = strconv.ParseInt(matched[3], 10, 64)
+			case matched[3] == "" && scope == usage.ScopeGroup:
+				target = ctx.Event.GroupID
+				if target == 0 {
+					ctx.SendChain(message.Text("ERROR: 私聊时请指定群号或默认"))
+					return
+				}
+			}
+			tokens, _ := strconv.ParseInt(matched[5], 10, 64)
+			if err := usage.SetQuota(scope, period, target, tokens); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			who := quotaTarget(scope, target)
+			if tokens == 0 {
+				ctx.SendChain(message.Text("已取消", who, "的", matched[1], "额度"))
+				return
+			}
+			ctx.SendChain(message.Text("已设置", who, "的", matched[1], "额度为 ", tokens, " tokens"))
+		})
+	en.OnFullMatch("查看AI聊天额度", zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			qs, err := usage.Quotas()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(qs) == 0 {
+				ctx.SendChain(message.Text("没有设置任何AI聊天额度"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("【AI聊天额度】")
+			for _, q := range qs {
+				sb.WriteString("\n• ")
+				sb.WriteString(quotaTarget(q.Scope, q.Target))
+				if q.Period == usage.PeriodMonth {
+					sb.WriteString(" 每月 ")
+				} else {
+					sb.WriteString(" 每日 ")
+				}
+				sb.WriteString(strconv.FormatInt(q.Tokens, 10))
+				sb.WriteString(" tokens")
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	en.OnFullMatch("AI用量").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			if gid == 0 && !zero.SuperUserPermission(ctx) {
+				ctx.SendChain(message.Text("请在群内查看本群的AI用量"))
+				return
+			}
+			img, err := drawUsage(ctx, gid, time.Now())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			sendimg, err := imgfactory.ToBytes(img)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if id := ctx.SendChain(message.ImageBytes(sendimg)); id.ID() == 0 {
+				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			}
+		})
+}
+
+// quotaTarget 额度设置对象的说明
+func quotaTarget(scope string, target int64) string {
+	switch {
+	case scope == usage.ScopeUser && target == 0:
+		return "每个用户"
+	case scope == usage.ScopeUser:
+		return "用户" + strconv.FormatInt(target, 10)
+	case target == 0:
+		return "每个群"
+	default:
+		return "群" + strconv.FormatInt(target, 10)
+	}
+}
+
+// usageLine 今日或本月的用量说明
+func usageLine(name string, s *usage.Stat, limit int64) string {
+	line := name + " " + strconv.FormatInt(s.Total(), 10) + " tokens (输入 " + strconv.FormatInt(s.Prompt, 10) +
+		" / 输出 " + strconv.FormatInt(s.Completion, 10) + ", " + strconv.FormatInt(s.Calls, 10) + " 次调用)"
+	if limit > 0 {
+		line += ", 额度 " + strconv.FormatInt(limit, 10)
+	}
+	return line
+}
+
+// sum 合计
+func sum(ss []*usage.Stat) *usage.Stat {
+	t := &usage.Stat{}
+	for _, s := range ss {
+		t.Calls += s.Calls
+		t.Prompt += s.Prompt
+		t.Completion += s.Completion
+	}
+	return t
+}
+
+// drawUsage 绘制本群 (gid 为 0 时为全部) 的用量图: 今日与本月合计, 近两周每日用量, 本月排行与模型
+func drawUsage(ctx *zero.Ctx, gid int64, now time.Time) (image.Image, error) {
+	today := usage.Start(usage.PeriodDay, now)
+	month := usage.Start(usage.PeriodMonth, now)
+	end := today.AddDate(0, 0, 1)
+	days, err := usage.ByDay(gid, today.AddDate(0, 0, 1-reportDays), end)
+	if err != nil {
+		return nil, err
+	}
+	monthDays, err := usage.ByDay(gid, month, end)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		tops  []*usage.Stat
+		title string
+	)
+	if gid == 0 {
+		title = "全部群的AI用量"
+		tops, err = usage.ByGroup(month, end, reportTop)
+	} else {
+		title = ctx.GetGroupInfo(gid, false).Name + " 的AI用量"
+		tops, err = usage.ByUser(gid, month, end, reportTop)
+	}
+	if err != nil {
+		return nil, err
+	}
+	models, err := usage.ByModel(gid, month, end, reportTop)
+	if err != nil {
+		return nil, err
+	}
+	var dayLimit, monthLimit int64
+	if gid != 0 {
+		dayLimit = usage.Limit(usage.ScopeGroup, usage.PeriodDay, gid)
+		monthLimit = usage.Limit(usage.ScopeGroup, usage.PeriodMonth, gid)
+	}
+	todayStat := &usage.Stat{}
+	if len(days) > 0 && days[len(days)-1].Key == today.Format("2006-01-02") {
+		todayStat = days[len(days)-1]
+	}
+
+	b, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	const (
+		w       = 900.0
+		margin  = 40.0
+		chartT  = 190.0
+		chartH  = 260.0
+		lineH   = 30.0
+		barGap  = 10.0
+		listTop = chartT + chartH + 70
+	)
+	h := listTop + float64(len(tops)+len(models)+2)*lineH + 2*margin
+	canvas := gg.NewContext(int(w), int(h))
+	canvas.SetRGB(1, 1, 1)
+	canvas.Clear()
+
+	if err = canvas.ParseFontFace(b, 28); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB(0.2, 0.2, 0.2)
+	canvas.DrawStringAnchored(title, w/2, 45, 0.5, 0.5)
+
+	if err = canvas.ParseFontFace(b, 18); err != nil {
+		return nil, err
+	}
+	canvas.DrawString(usageLine("今日", todayStat, dayLimit), margin, 100)
+	canvas.DrawString(usageLine("本月", sum(monthDays), monthLimit), margin, 100+lineH)
+
+	// 近两周每日用量, 输入与输出叠在一起
+	byKey := make(map[string]*usage.Stat, len(days))
+	var peak int64
+	for _, d := range days {
+		byKey[d.Key] = d
+		if d.Total() > peak {
+			peak = d.Total()
+		}
+	}
+	if peak == 0 {
+		peak = 1
+	}
+	if err = canvas.ParseFontFace(b, 14); err != nil {
+		return nil, err
+	}
+	barW := (w-2*margin)/reportDays - barGap
+	bottom := chartT + chartH
+	canvas.SetRGB(0.5, 0.5, 0.5)
+	canvas.DrawStringAnchored("峰值 "+strconv.FormatInt(peak, 10)+" tokens/天", w-margin, chartT-20, 1, 0.5)
+	canvas.SetRGB(0.2, 0.4, 0.8)
+	canvas.DrawRectangle(margin, chartT-28, 14, 14)
+	canvas.Fill()
+	canvas.SetRGB(0.3, 0.3, 0.3)
+	canvas.DrawString("输入", margin+20, chartT-16)
+	canvas.SetRGB(0.95, 0.6, 0.2)
+	canvas.DrawRectangle(margin+70, chartT-28, 14, 14)
+	canvas.Fill()
+	canvas.SetRGB(0.3, 0.3, 0.3)
+	canvas.DrawString("输出", margin+90, chartT-16)
+	for i := 0; i < reportDays; i++ {
+		day := today.AddDate(0, 0, i+1-reportDays)
+		x := margin + float64(i)*(barW+barGap) + barGap/2
+		if d, ok := byKey[day.Format("2006-01-02")]; ok {
+			ph := chartH * float64(d.Prompt) / float64(peak)
+			chh := chartH * float64(d.Completion) / float64(peak)
+			canvas.SetRGB(0.2, 0.4, 0.8)
+			canvas.DrawRectangle(x, bottom-ph, barW, ph)
+			canvas.Fill()
+			canvas.SetRGB(0.95, 0.6, 0.2)
+			canvas.DrawRectangle(x, bottom-ph-chh, barW, chh)
+			canvas.Fill()
+		}
+		canvas.SetRGB(0.3, 0.3, 0.3)
+		canvas.DrawStringAnchored(day.Format("01-02"), x+barW/2, bottom+18, 0.5, 0.5)
+	}
+	canvas.SetRGB(0.7, 0.7, 0.7)
+	canvas.DrawLine(margin, bottom, w-margin, bottom)
+	canvas.Stroke()
+
+	if err = canvas.ParseFontFace(b, 18); err != nil {
+		return nil, err
+	}
+	y := listTop
+	canvas.SetRGB(0.2, 0.2, 0.2)
+	if gid == 0 {
+		canvas.DrawString("本月用量最多的群", margin, y)
+	} else {
+		canvas.DrawString("本月用量最多的成员", margin, y)
+	}
+	canvas.SetRGB(0.35, 0.35, 0.35)
+	for i, s := range tops {
+		y += lineH
+		name := s.Key
+		if id, _ := strconv.ParseInt(s.Key, 10, 64); id > 0 && gid != 0 {
+			name = ctx.CardOrNickName(id) + "(" + s.Key + ")"
+		} else if id == 0 && gid != 0 {
+			name = "定时任务"
+		}
+		canvas.DrawString(strconv.Itoa(i+1)+". "+name, margin+20, y)
+		canvas.DrawStringAnchored(strconv.FormatInt(s.Total(), 10)+" tokens / "+strconv.FormatInt(s.Calls, 10)+" 次", w-margin, y, 1, 0)
+	}
+	y += lineH
+	canvas.SetRGB(0.2, 0.2, 0.2)
+	canvas.DrawString("本月各模型用量", margin, y)
+	canvas.SetRGB(0.35, 0.35, 0.35)
+	for _, s := range models {
+		y += lineH
+		canvas.DrawString(s.Key, margin+20, y)
+		canvas.DrawStringAnchored(strconv.FormatInt(s.Total(), 10)+" tokens / "+strconv.FormatInt(s.Calls, 10)+" 次", w-margin, y, 1, 0)
+	}
+	return canvas.Image(), nil
+}
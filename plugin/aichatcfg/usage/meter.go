@@ -0,0 +1,112 @@
+package usage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// Call 一次调用的来源
+type Call struct {
+	Plugin  string
+	GroupID int64
+	UserID  int64
+	Model   string
+}
+
+// Client 返回记录用量的 http.Client, 交给 deepinfra.API.SetHTTPClient 使用.
+// 用量数据库未打开时返回 nil, 即使用默认的 http.DefaultClient
+func Client(c Call) *http.Client {
+	udb.RLock()
+	defer udb.RUnlock()
+	if !udb.ready {
+		return nil
+	}
+	return &http.Client{Transport: &meter{call: c, base: http.DefaultTransport}}
+}
+
+// meter 读取应答中的用量并记录
+type meter struct {
+	call Call
+	base http.RoundTripper
+}
+
+func (m *meter) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := m.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	r := parse(body, data)
+	r.Time = time.Now().Unix()
+	r.GroupID = m.call.GroupID
+	r.UserID = m.call.UserID
+	r.Plugin = m.call.Plugin
+	if m.call.Model != "" {
+		r.Model = m.call.Model
+	}
+	if err := Save(r); err != nil {
+		logrus.Warnln("[usage] 记录AI用量失败:", err)
+	}
+	return resp, nil
+}
+
+// parse 从应答中读取用量, 依次尝试 OpenAI, OLLaMA, GenAI 的格式, 都没有时按字数估算
+func parse(req, resp []byte) *Record {
+	r := &Record{Model: gjson.GetBytes(req, "model").String()}
+	u := gjson.GetManyBytes(resp,
+		"usage.prompt_tokens", "usage.completion_tokens",
+		"prompt_eval_count", "eval_count",
+		"usageMetadata.promptTokenCount", "usageMetadata.candidatesTokenCount",
+	)
+	for i := 0; i < len(u); i += 2 {
+		if u[i].Exists() || u[i+1].Exists() {
+			r.Prompt, r.Completion = u[i].Int(), u[i+1].Int()
+			return r
+		}
+	}
+	r.Estimated = true
+	r.Prompt = Estimate(string(req))
+	out := gjson.GetManyBytes(resp, "choices.0.message.content", "message.content", "candidates.0.content.parts.0.text")
+	for _, o := range out {
+		if o.Exists() {
+			r.Completion = Estimate(o.String())
+			return r
+		}
+	}
+	r.Completion = Estimate(string(resp))
+	return r
+}
+
+// Estimate 粗略估算 token 数: 汉字等每字约 1 个, 其余每 4 个字符约 1 个
+func Estimate(s string) int64 {
+	var wide, narrow int64
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			wide++
+		} else {
+			narrow++
+		}
+	}
+	return wide + (narrow+3)/4
+}
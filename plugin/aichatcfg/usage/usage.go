@@ -0,0 +1,296 @@
+// Package usage 大模型调用的 token 用量记录与额度限制, 供 aichat 与 llm 共用
+package usage
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	// ScopeGroup 按群限制
+	ScopeGroup = "group"
+	// ScopeUser 按用户限制
+	ScopeUser = "user"
+	// PeriodDay 每日额度
+	PeriodDay = "day"
+	// PeriodMonth 每月额度
+	PeriodMonth = "month"
+)
+
+// ErrNotReady 用量数据库尚未打开
+var ErrNotReady = errors.New("AI用量记录未启用")
+
+// Record 一次调用的用量
+type Record struct {
+	ID         int64  `db:"id"`
+	Time       int64  `db:"time"`
+	GroupID    int64  `db:"gid"` // 私聊时为 -uid, 定时任务为群号
+	UserID     int64  `db:"uid"` // 定时任务为 0
+	Plugin     string `db:"plugin"`
+	Model      string `db:"model"`
+	Prompt     int64  `db:"prompt"`
+	Completion int64  `db:"completion"`
+	// Estimated 接口没有返回用量, 按字数估算
+	Estimated bool `db:"estimated"`
+}
+
+// Quota 额度设置, Target 为 0 时是所有群或所有用户的默认额度
+type Quota struct {
+	ID     string `db:"id"` // scope_period_target
+	Scope  string `db:"scope"`
+	Period string `db:"period"`
+	Target int64  `db:"target"`
+	Tokens int64  `db:"tokens"`
+}
+
+// Stat 按某一维度汇总的用量
+type Stat struct {
+	Key        string `db:"key"`
+	Calls      int64  `db:"calls"`
+	Prompt     int64  `db:"prompt"`
+	Completion int64  `db:"completion"`
+}
+
+// Total 总 token 数
+func (s *Stat) Total() int64 {
+	return s.Prompt + s.Completion
+}
+
+// ExceededError 额度已用完
+type ExceededError struct {
+	Scope  string
+	Period string
+	Tokens int64
+}
+
+func (e *ExceededError) Error() string {
+	who, when, next := "本群", "今天", "明天"
+	if e.Scope == ScopeUser {
+		who = "你"
+	}
+	if e.Period == PeriodMonth {
+		when, next = "本月", "下个月"
+	}
+	return who + when + "的AI聊天额度(" + strconv.FormatInt(e.Tokens, 10) + " tokens)已经用完啦, " + next + "再来找我吧~"
+}
+
+type usagedb struct {
+	sync.RWMutex
+	sql.Sqlite
+	lastID int64
+	ready  bool
+}
+
+var udb = &usagedb{}
+
+// Open 打开用量数据库, 未打开时不记录也不限制
+func Open(path string) error {
+	udb.Lock()
+	defer udb.Unlock()
+	udb.Sqlite = sql.New(path)
+	err := udb.Sqlite.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = udb.Create("record", &Record{})
+	if err != nil {
+		return err
+	}
+	err = udb.Create("quota", &Quota{})
+	if err != nil {
+		return err
+	}
+	for _, q := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_record_gid_time ON [record](gid, time);",
+		"CREATE INDEX IF NOT EXISTS idx_record_uid_time ON [record](uid, time);",
+	} {
+		if _, err = udb.Exec(q); err != nil {
+			return err
+		}
+	}
+	var last struct {
+		ID int64 `db:"id"`
+	}
+	err = udb.Query("SELECT IFNULL(MAX(id), 0) FROM [record];", &last)
+	if err != nil {
+		return err
+	}
+	udb.lastID = last.ID
+	udb.ready = true
+	return nil
+}
+
+// Save 保存一次调用的用量
+func Save(r *Record) error {
+	udb.Lock()
+	defer udb.Unlock()
+	if !udb.ready {
+		return ErrNotReady
+	}
+	udb.lastID++
+	r.ID = udb.lastID
+	return udb.Insert("record", r)
+}
+
+// Start 周期的开始时间
+func Start(period string, now time.Time) time.Time {
+	y, m, d := now.Date()
+	if period == PeriodMonth {
+		d = 1
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
+
+func quotaKey(scope, period string, target int64) string {
+	return scope + "_" + period + "_" + strconv.FormatInt(target, 10)
+}
+
+// SetQuota 设置额度, tokens 为 0 时取消
+func SetQuota(scope, period string, target, tokens int64) error {
+	udb.Lock()
+	defer udb.Unlock()
+	if !udb.ready {
+		return ErrNotReady
+	}
+	id := quotaKey(scope, period, target)
+	if tokens <= 0 {
+		return udb.Del("quota", "WHERE id = ?", id)
+	}
+	return udb.Insert("quota", &Quota{ID: id, Scope: scope, Period: period, Target: target, Tokens: tokens})
+}
+
+// Quotas 所有额度设置
+func Quotas() ([]*Quota, error) {
+	udb.RLock()
+	defer udb.RUnlock()
+	if !udb.ready {
+		return nil, ErrNotReady
+	}
+	qs, err := sql.FindAll[Quota](&udb.Sqlite, "quota", "ORDER BY scope, period, target")
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return qs, err
+}
+
+// limit 生效的额度, 单独设置优先于默认额度, 为 0 时不限制
+func (db *usagedb) limit(scope, period string, target int64) int64 {
+	q := &Quota{}
+	if db.Find("quota", q, "WHERE id = ?", quotaKey(scope, period, target)) == nil {
+		return q.Tokens
+	}
+	if db.Find("quota", q, "WHERE id = ?", quotaKey(scope, period, 0)) == nil {
+		return q.Tokens
+	}
+	return 0
+}
+
+// used 自 from 起 col 为 target 的总用量
+func (db *usagedb) used(col string, target int64, from time.Time) int64 {
+	var s struct {
+		N int64 `db:"n"`
+	}
+	_ = db.Query("SELECT IFNULL(SUM(prompt + completion), 0) FROM [record] WHERE "+col+" = ? AND time >= ?;",
+		&s, target, from.Unix())
+	return s.N
+}
+
+// Limit 生效的额度, 为 0 时不限制
+func Limit(scope, period string, target int64) int64 {
+	udb.RLock()
+	defer udb.RUnlock()
+	if !udb.ready {
+		return 0
+	}
+	return udb.limit(scope, period, target)
+}
+
+// Check 调用前检查群与用户的额度, 用完时返回 *ExceededError.
+// gid 小于等于 0 (私聊或无群) 时不检查群额度, uid 为 0 时不检查用户额度
+func Check(gid, uid int64, now time.Time) error {
+	udb.RLock()
+	defer udb.RUnlock()
+	if !udb.ready {
+		return nil
+	}
+	for _, period := range []string{PeriodDay, PeriodMonth} {
+		from := Start(period, now)
+		if gid > 0 {
+			if n := udb.limit(ScopeGroup, period, gid); n > 0 && udb.used("gid", gid, from) >= n {
+				return &ExceededError{Scope: ScopeGroup, Period: period, Tokens: n}
+			}
+		}
+		if uid > 0 {
+			if n := udb.limit(ScopeUser, period, uid); n > 0 && udb.used("uid", uid, from) >= n {
+				return &ExceededError{Scope: ScopeUser, Period: period, Tokens: n}
+			}
+		}
+	}
+	return nil
+}
+
+// Used 自 from 起群 (scope 为 ScopeGroup) 或用户的总用量
+func Used(scope string, target int64, from time.Time) int64 {
+	udb.RLock()
+	defer udb.RUnlock()
+	if !udb.ready {
+		return 0
+	}
+	col := "gid"
+	if scope == ScopeUser {
+		col = "uid"
+	}
+	return udb.used(col, target, from)
+}
+
+// stats 按 key 汇总 [from, to) 的用量, gid 为 0 时汇总所有群, 按总量从大到小排列
+func stats(key string, gid int64, from, to time.Time, n int, byKey bool) ([]*Stat, error) {
+	udb.RLock()
+	defer udb.RUnlock()
+	if !udb.ready {
+		return nil, ErrNotReady
+	}
+	q := "SELECT " + key + " AS k, COUNT(*), SUM(prompt), SUM(completion) FROM [record] WHERE time >= ? AND time < ?"
+	args := []any{from.Unix(), to.Unix()}
+	if gid != 0 {
+		q += " AND gid = ?"
+		args = append(args, gid)
+	}
+	q += " GROUP BY k"
+	if byKey {
+		q += " ORDER BY k"
+	} else {
+		q += " ORDER BY SUM(prompt + completion) DESC"
+	}
+	q += " LIMIT ?;"
+	args = append(args, n)
+	ss, err := sql.QueryAll[Stat](&udb.Sqlite, q, args...)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return ss, err
+}
+
+// ByUser 用量最多的 n 个用户
+func ByUser(gid int64, from, to time.Time, n int) ([]*Stat, error) {
+	return stats("CAST(uid AS TEXT)", gid, from, to, n, false)
+}
+
+// ByGroup 用量最多的 n 个群
+func ByGroup(from, to time.Time, n int) ([]*Stat, error) {
+	return stats("CAST(gid AS TEXT)", 0, from, to, n, false)
+}
+
+// ByModel 各模型的用量
+func ByModel(gid int64, from, to time.Time, n int) ([]*Stat, error) {
+	return stats("model", gid, from, to, n, false)
+}
+
+// ByDay 每天的用量, Key 为 2006-01-02 形式的日期, 按日期先后排列, 没有调用的日期不返回
+func ByDay(gid int64, from, to time.Time) ([]*Stat, error) {
+	return stats("strftime('%Y-%m-%d', time, 'unixepoch', 'localtime')", gid, from, to, 366, true)
+}
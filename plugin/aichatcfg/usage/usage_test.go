@@ -0,0 +1,98 @@
+package usage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	req := []byte(`{"model":"Qwen/Qwen3-8B","messages":[{"role":"user","content":"你好"}]}`)
+	for _, c := range []struct {
+		name     string
+		resp     string
+		p, c     int64
+		estimate bool
+	}{
+		{"openai", `{"choices":[{"message":{"content":"hi"}}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`, 12, 3, false},
+		{"ollama", `{"message":{"content":"hi"},"prompt_eval_count":20,"eval_count":5}`, 20, 5, false},
+		{"genai", `{"candidates":[],"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":9}}`, 7, 9, false},
+		{"none", `{"choices":[{"message":{"content":"你好呀abcd"}}]}`, Estimate(string(req)), 4, true},
+	} {
+		r := parse(req, []byte(c.resp))
+		if r.Prompt != c.p || r.Completion != c.c || r.Estimated != c.estimate {
+			t.Fatal(c.name, "got", r.Prompt, r.Completion, r.Estimated)
+		}
+		if r.Model != "Qwen/Qwen3-8B" {
+			t.Fatal(c.name, "got model", r.Model)
+		}
+	}
+}
+
+func TestQuota(t *testing.T) {
+	if err := Check(1, 10, time.Now()); err != nil {
+		t.Fatal("not opened:", err)
+	}
+	err := Open(t.TempDir() + "/usage.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, r := range []Record{
+		{Time: now.Unix(), GroupID: 1, UserID: 10, Model: "a", Prompt: 100, Completion: 50},
+		{Time: now.Unix(), GroupID: 1, UserID: 11, Model: "b", Prompt: 300, Completion: 10},
+		{Time: now.Unix(), GroupID: 2, UserID: 10, Model: "a", Prompt: 20, Completion: 20},
+		{Time: Start(PeriodMonth, now).Add(-time.Hour).Unix(), GroupID: 1, UserID: 10, Model: "a", Prompt: 1000, Completion: 0},
+	} {
+		if err = Save(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = Check(1, 10, now); err != nil {
+		t.Fatal("no quota:", err)
+	}
+	if err = SetQuota(ScopeGroup, PeriodDay, 0, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err = SetQuota(ScopeGroup, PeriodDay, 1, 400); err != nil {
+		t.Fatal(err)
+	}
+	var e *ExceededError
+	if err = Check(1, 0, now); !errors.As(err, &e) || e.Scope != ScopeGroup || e.Tokens != 400 {
+		t.Fatal("group 1 should use its own quota:", err)
+	}
+	if err = Check(2, 0, now); err != nil {
+		t.Fatal("group 2 should use default quota:", err)
+	}
+	if err = SetQuota(ScopeUser, PeriodMonth, 0, 180); err != nil {
+		t.Fatal(err)
+	}
+	if err = Check(2, 10, now); !errors.As(err, &e) || e.Scope != ScopeUser || e.Period != PeriodMonth {
+		t.Fatal("user 10 should exceed monthly quota:", err)
+	}
+	if err = SetQuota(ScopeUser, PeriodMonth, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = Check(2, 10, now); err != nil {
+		t.Fatal("quota should be removed:", err)
+	}
+	qs, err := Quotas()
+	if err != nil || len(qs) != 2 {
+		t.Fatal("got", len(qs), "quotas", err)
+	}
+
+	ss, err := ByUser(1, Start(PeriodDay, now), now.Add(time.Second), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 2 || ss[0].Key != "11" || ss[0].Total() != 310 || ss[1].Calls != 1 {
+		t.Fatal("unexpected user stats:", ss)
+	}
+	ss, err = ByDay(0, Start(PeriodDay, now), now.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].Key != now.Format("2006-01-02") || ss[0].Total() != 500 {
+		t.Fatal("unexpected day stats:", ss)
+	}
+}
@@ -0,0 +1,175 @@
+package alias
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	kindAlias = "alias"
+	kindMacro = "macro"
+)
+
+// entry 群内的一个别名或宏
+type entry struct {
+	ID      string `db:"id"` // gid_kind_name
+	GroupID int64  `db:"gid"`
+	Kind    string `db:"kind"`
+	Name    string `db:"name"`
+	// Target 别名为替换后的指令, 宏为依次执行的指令, 以换行分隔
+	Target  string `db:"target"`
+	Creator int64  `db:"creator"`
+	Time    int64  `db:"time"`
+}
+
+// steps 宏依次执行的指令
+func (e *entry) steps() []string {
+	return strings.Split(e.Target, "\n")
+}
+
+type aliasdb struct {
+	sync.RWMutex
+	sql.Sqlite
+	// groups 各群的别名与宏, 按名称索引
+	groups map[int64]map[string]*entry
+}
+
+var adb = &aliasdb{groups: make(map[int64]map[string]*entry, 64)}
+
+func initDatabase(path string) error {
+	adb.Lock()
+	defer adb.Unlock()
+	adb.Sqlite = sql.New(path)
+	err := adb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = adb.Create("entry", &entry{})
+	if err != nil {
+		return err
+	}
+	es, err := sql.FindAll[entry](&adb.Sqlite, "entry", "")
+	if err == sql.ErrNullResult {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range es {
+		adb.cache(e)
+	}
+	return nil
+}
+
+func (db *aliasdb) cache(e *entry) {
+	m, ok := db.groups[e.GroupID]
+	if !ok {
+		m = make(map[string]*entry, 8)
+		db.groups[e.GroupID] = m
+	}
+	m[e.Name] = e
+}
+
+// matches msg 是否以 name 触发: 完全相同, 或以 name 加空白开头
+func matches(name, msg string) bool {
+	if !strings.HasPrefix(msg, name) {
+		return false
+	}
+	rest := msg[len(name):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\n' || rest[0] == '\t' || strings.HasPrefix(rest, "　")
+}
+
+// lookup 找到 msg 触发的别名或宏
+func lookup(gid int64, msg string) *entry {
+	adb.RLock()
+	defer adb.RUnlock()
+	var found *entry
+	for name, e := range adb.groups[gid] {
+		// 名称互为前缀时取最长的
+		if matches(name, msg) && (found == nil || len(name) > len(found.Name)) {
+			found = e
+		}
+	}
+	return found
+}
+
+// loops 加入 e 后是否会循环触发, 此前本群的别名与宏不会构成循环, 只需检查经过 e 的
+func loops(e *entry) bool {
+	adb.RLock()
+	defer adb.RUnlock()
+	es := make(map[string]*entry, len(adb.groups[e.GroupID])+1)
+	for name, o := range adb.groups[e.GroupID] {
+		es[name] = o
+	}
+	es[e.Name] = e
+	seen := make(map[string]bool, len(es))
+	var reaches func(from *entry) bool
+	reaches = func(from *entry) bool {
+		for _, s := range from.steps() {
+			for name, o := range es {
+				if !matches(name, s) {
+					continue
+				}
+				if name == e.Name {
+					return true
+				}
+				if !seen[name] {
+					seen[name] = true
+					if reaches(o) {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+	return reaches(e)
+}
+
+// save 保存别名或宏, 同名的会被覆盖
+func save(e *entry) error {
+	adb.Lock()
+	defer adb.Unlock()
+	e.ID = strconv.FormatInt(e.GroupID, 10) + "_" + e.Kind + "_" + e.Name
+	// 同名的别名与宏只保留一个
+	if old, ok := adb.groups[e.GroupID][e.Name]; ok && old.Kind != e.Kind {
+		if err := adb.Del("entry", "WHERE id = ?", old.ID); err != nil {
+			return err
+		}
+	}
+	if err := adb.Insert("entry", e); err != nil {
+		return err
+	}
+	adb.cache(e)
+	return nil
+}
+
+// remove 删除别名或宏, 不存在时返回 false
+func remove(gid int64, kind, name string) (bool, error) {
+	adb.Lock()
+	defer adb.Unlock()
+	e, ok := adb.groups[gid][name]
+	if !ok || e.Kind != kind {
+		return false, nil
+	}
+	if err := adb.Del("entry", "WHERE id = ?", e.ID); err != nil {
+		return false, err
+	}
+	delete(adb.groups[gid], name)
+	return true, nil
+}
+
+// list 本群某类的所有别名或宏, 按名称排列
+func list(gid int64, kind string) ([]*entry, error) {
+	adb.RLock()
+	defer adb.RUnlock()
+	es, err := sql.FindAll[entry](&adb.Sqlite, "entry", "WHERE gid = ? AND kind = ? ORDER BY name", gid, kind)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return es, err
+}
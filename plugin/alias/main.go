@@ -0,0 +1,191 @@
+// Package alias 群内的指令别名与宏
+package alias
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/floatbox/process"
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// maxSteps 一个宏最多的指令数
+const maxSteps = 10
+
+// reserved 管理指令本身不能被设为别名或宏
+var reserved = []string{"设置别名", "设置宏", "删除别名", "删除宏", "查看别名", "查看宏"}
+
+func init() {
+	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+		DisableOnDefault: false,
+		Brief:            "指令别名与宏",
+		Help: "- 设置别名 打卡 = 签到 (仅管理员)\n" +
+			"- 设置宏 早 = 早安; 今日早报; 运势 (仅管理员)\n" +
+			"- 删除别名 打卡 (仅管理员)\n" +
+			"- 删除宏 早 (仅管理员)\n" +
+			"- 查看别名\n" +
+			"- 查看宏\n" +
+			"Tips: 别名只替换消息开头的指令, 其后的参数保留; 宏依次执行每条指令, 每条间隔1~2秒",
+		PrivateDataFolder: "alias",
+	})
+	err := initDatabase(engine.DataFolder() + "alias.db")
+	if err != nil {
+		panic(err)
+	}
+	engine.OnRegex(`^设置(别名|宏)\s*(\S+)\s*[=＝]\s*([\s\S]+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			name := matched[2]
+			for _, r := range reserved {
+				if strings.HasPrefix(name, r) || strings.HasPrefix(r, name) {
+					ctx.SendChain(message.Text("ERROR: 不能覆盖管理指令 ", r))
+					return
+				}
+			}
+			e := &entry{
+				GroupID: ctx.Event.GroupID,
+				Kind:    kindAlias,
+				Name:    name,
+				Creator: ctx.Event.UserID,
+				Time:    time.Now().Unix(),
+			}
+			if matched[1] == "宏" {
+				e.Kind = kindMacro
+				steps := strings.FieldsFunc(matched[3], func(r rune) bool {
+					return r == ';' || r == '；' || r == '\n'
+				})
+				for i := 0; i < len(steps); i++ {
+					steps[i] = strings.TrimSpace(steps[i])
+					if steps[i] == "" {
+						steps = append(steps[:i], steps[i+1:]...)
+						i--
+					}
+				}
+				if len(steps) == 0 || len(steps) > maxSteps {
+					ctx.SendChain(message.Text("ERROR: 宏应包含 1~", maxSteps, " 条指令, 以分号分隔"))
+					return
+				}
+				e.Target = strings.Join(steps, "\n")
+			} else {
+				e.Target = strings.TrimSpace(matched[3])
+			}
+			if loops(e) {
+				ctx.SendChain(message.Text("ERROR: ", name, " 会与本群已有的别名或宏循环触发"))
+				return
+			}
+			if err := save(e); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if e.Kind == kindMacro {
+				ctx.SendChain(message.Text("已设置宏 ", name, ", 将依次执行:\n", e.Target))
+				return
+			}
+			ctx.SendChain(message.Text("已设置别名 ", name, " = ", e.Target))
+		})
+	engine.OnRegex(`^删除(别名|宏)\s*(\S+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			kind := kindAlias
+			if matched[1] == "宏" {
+				kind = kindMacro
+			}
+			ok, err := remove(ctx.Event.GroupID, kind, matched[2])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if !ok {
+				ctx.SendChain(message.Text("本群没有", matched[1], " ", matched[2]))
+				return
+			}
+			ctx.SendChain(message.Text("已删除", matched[1], " ", matched[2]))
+		})
+	engine.OnRegex(`^查看(别名|宏)$`, zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			what := ctx.State["regex_matched"].([]string)[1]
+			kind := kindAlias
+			if what == "宏" {
+				kind = kindMacro
+			}
+			es, err := list(ctx.Event.GroupID, kind)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(es) == 0 {
+				ctx.SendChain(message.Text("本群还没有设置", what))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("本群的")
+			sb.WriteString(what)
+			sb.WriteString(":")
+			for _, e := range es {
+				sb.WriteString("\n• ")
+				sb.WriteString(e.Name)
+				sb.WriteString(" = ")
+				sb.WriteString(strings.Join(e.steps(), "; "))
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	// 在其它插件之前改写消息, 改写后的消息作为新事件重新处理
+	engine.On("message/group", func(ctx *zero.Ctx) bool {
+		e := lookup(ctx.Event.GroupID, strings.TrimSpace(ctx.MessageString()))
+		if e == nil {
+			return false
+		}
+		ctx.State["alias_entry"] = e
+		return true
+	}).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		e := ctx.State["alias_entry"].(*entry)
+		msg := strings.TrimSpace(ctx.MessageString())
+		if e.Kind == kindAlias {
+			inject(ctx, e.Target+msg[len(e.Name):])
+			return
+		}
+		for i, step := range e.steps() {
+			if i > 0 {
+				process.SleepAbout1sTo2s() // 保证顺序, 并防止风控
+			}
+			inject(ctx, step)
+		}
+	})
+}
+
+// inject 以 raw 为消息内容重新处理当前事件
+func inject(ctx *zero.Ctx, raw string) {
+	if ctx.Event.IsToMe {
+		raw = "[CQ:at,qq=" + strconv.FormatInt(ctx.Event.SelfID, 10) + "] " + raw
+	}
+	native, err := json.Marshal(raw)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	ctx.Event.NativeMessage = native
+	ctx.Event.RawMessage = raw
+	ctx.Event.Time = time.Now().Unix()
+	vev, cl := binary.OpenWriterF(func(w *binary.Writer) {
+		err = json.NewEncoder(w).Encode(ctx.Event)
+	})
+	if err != nil {
+		cl()
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	logrus.Debugln("[alias] inject:", binary.BytesToString(vev))
+	defer func() {
+		_ = recover()
+		cl()
+	}()
+	ctx.Echo(vev)
+}
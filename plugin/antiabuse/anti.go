@@ -2,12 +2,18 @@
 package antiabuse
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/FloatTech/floatbox/binary"
 	fcext "github.com/FloatTech/floatbox/ctxext"
+	"github.com/FloatTech/floatbox/file"
 	"github.com/FloatTech/ttl"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
@@ -22,8 +28,13 @@ const (
 	add                  = "添加违禁词"
 	del                  = "删除违禁词"
 	list                 = "查看违禁词"
+	hits                 = "违禁记录"
+	pardon               = "赦免"
+	export               = "导出违禁记录"
 )
 
+const maxListHits = 20
+
 var (
 	managers *ctrl.Manager[*zero.Ctx] // managers lazy load
 	cache    = ttl.NewCacheOn(bandur, [4]func(int64, struct{}){nil, nil, onDel, nil})
@@ -44,9 +55,14 @@ func onDel(uid int64, _ struct{}) {
 
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
-		DisableOnDefault:  false,
-		Brief:             "违禁词检测",
-		Help:              "- [添加|删除|查看]违禁词",
+		DisableOnDefault: false,
+		Brief:            "违禁词检测",
+		Help: "- 添加违禁词 XXX [警告 | 撤回 | 禁言N分钟 | 踢出]\n" +
+			"- [删除|查看]违禁词\n" +
+			"- 违禁记录 [@xxx]\n" +
+			"- 赦免@xxx\n" +
+			"- 导出违禁记录\n" +
+			"Tips: 不指定处罚时默认禁言, 重复违规的禁言时长逐次翻倍, 违规计数每天衰减一次",
 		PrivateDataFolder: "anti_abuse",
 	})
 
@@ -61,51 +77,39 @@ func init() {
 		return true
 	})
 
+	// 管理员的违禁词指令本身会带有违禁词, 不做检查; 其他人以这些前缀开头的消息照常检查
 	notAntiabuse := func(ctx *zero.Ctx) bool {
-		if zero.PrefixRule(add)(ctx) || zero.PrefixRule(del)(ctx) || zero.PrefixRule(list)(ctx) {
+		if !zero.AdminPermission(ctx) {
+			return true
+		}
+		if zero.PrefixRule(add)(ctx) || zero.PrefixRule(del)(ctx) || zero.PrefixRule(list)(ctx) ||
+			zero.PrefixRule(hits)(ctx) || zero.PrefixRule(pardon)(ctx) || zero.PrefixRule(export)(ctx) {
 			return false
 		}
 		return true
 	}
 
 	engine.OnMessage(onceRule, notAntiabuse, zero.OnlyGroup, func(ctx *zero.Ctx) bool {
-		uid := ctx.Event.UserID
-		gid := ctx.Event.GroupID
-		msg := strings.ReplaceAll(ctx.MessageString(), "\n", "")
-		msg = strings.ReplaceAll(msg, "\r", "")
-		msg = strings.ReplaceAll(msg, "\t", "")
-		msg = strings.ReplaceAll(msg, ";", "")
-		if db.isInAntiList(gid, msg) {
-			if err := ctx.State["manager"].(*ctrl.Control[*zero.Ctx]).Manager.DoBlock(uid); err == nil {
-				t := time.Now().Unix()
-				cache.Set(uid, struct{}{})
-				ctx.SetThisGroupBan(uid, int64(bandur.Seconds()))
-				ctx.DeleteMessage(ctx.Event.MessageID)
-				ctx.SendChain(message.Text("检测到违禁词, 已封禁/屏蔽", bandur))
-				db.Lock()
-				defer db.Unlock()
-				err := db.Create("__bantime__", nilbt)
-				if err != nil {
-					ctx.SendChain(message.Text("ERROR: ", err))
-					return false
-				}
-				err = db.Insert("__bantime__", &banTime{ID: uid, Time: t})
-				if err != nil {
-					ctx.SendChain(message.Text("ERROR: ", err))
-					return false
-				}
-			} else {
-				ctx.SendChain(message.Text("ERROR: block user: ", err))
-			}
+		w, ok := db.match(ctx.Event.GroupID, ctx.MessageString())
+		if !ok {
+			return true
+		}
+		act, err := punish(ctx, w)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
 			return false
 		}
-		return true
+		err = db.logHit(ctx.Event.GroupID, ctx.Event.UserID, w.Word, ctx.MessageString(), act)
+		if err != nil {
+			logrus.Errorln("[antiabuse] log hit:", err)
+		}
+		return false
 	})
 
 	engine.OnPrefix(add, zero.OnlyGroup, zero.AdminPermission, onceRule).SetBlock(true).Handle(
 		func(ctx *zero.Ctx) {
 			args := strings.TrimSpace(ctx.State["args"].(string))
-			if err := db.insertWord(ctx.Event.GroupID, args); err != nil {
+			if err := db.insertWord(ctx.Event.GroupID, parseWord(args)); err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 			} else {
 				ctx.SendChain(message.Text("成功"))
@@ -131,4 +135,141 @@ func init() {
 			}
 			ctx.SendChain(message.Text("本群违禁词有\n"), message.Image("base64://"+binary.BytesToString(b)))
 		})
+
+	engine.OnRegex(`^`+hits+`\s*(?:\[CQ:at,qq=(\d+).*\]|(\d+))?\s*$`, zero.OnlyGroup, zero.AdminPermission, onceRule).SetBlock(true).Handle(
+		func(ctx *zero.Ctx) {
+			uid := targetOf(ctx.State["regex_matched"].([]string))
+			logs, err := db.listHits(ctx.Event.GroupID, uid, maxListHits)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(logs) == 0 {
+				ctx.SendChain(message.Text("没有违禁记录~"))
+				return
+			}
+			sb := strings.Builder{}
+			for _, l := range logs {
+				sb.WriteString(time.Unix(0, l.ID).Format("01-02 15:04:05"))
+				sb.WriteString(fmt.Sprintf(" %d 触发[%s] %s\n  %s\n", l.UserID, l.Word, l.Action, l.Msg))
+			}
+			b, err := text.RenderToBase64(sb.String(), text.FontFile, 600, 20)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("最近", len(logs), "条违禁记录\n"), message.Image("base64://"+binary.BytesToString(b)))
+		})
+
+	engine.OnRegex(`^`+pardon+`\s*(?:\[CQ:at,qq=(\d+).*\]|(\d+))\s*$`, zero.OnlyGroup, zero.AdminPermission, onceRule).SetBlock(true).Handle(
+		func(ctx *zero.Ctx) {
+			uid := targetOf(ctx.State["regex_matched"].([]string))
+			// 仍在封禁期内时由 onDel 解除屏蔽并清除记录
+			if _, deleted := cache.GetAndDelete(uid); !deleted {
+				_ = managers.DoUnblock(uid)
+			}
+			ctx.SetThisGroupBan(uid, 0)
+			ctx.SendChain(message.Text("已赦免 ", ctx.CardOrNickName(uid), "(", uid, ")"))
+		})
+
+	engine.OnFullMatch(export, zero.OnlyGroup, zero.AdminPermission, onceRule).SetBlock(true).Handle(
+		func(ctx *zero.Ctx) {
+			logs, err := db.listHits(ctx.Event.GroupID, 0, 0)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(logs) == 0 {
+				ctx.SendChain(message.Text("没有违禁记录~"))
+				return
+			}
+			name := "违禁记录_" + strconv.FormatInt(ctx.Event.GroupID, 10) + ".csv"
+			path := engine.DataFolder() + name
+			err = writeHitsCSV(path, logs)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.UploadThisGroupFile(filepath.Join(file.BOTPATH, path), name, "")
+		})
+}
+
+// targetOf 从 "(@xxx | QQ号)" 的匹配中取出 QQ 号, 均未匹配时为 0
+func targetOf(matched []string) int64 {
+	for _, s := range matched[1:] {
+		if s != "" {
+			uid, _ := strconv.ParseInt(s, 10, 64)
+			return uid
+		}
+	}
+	return 0
+}
+
+// writeHitsCSV 将命中记录写为 csv 文件
+func writeHitsCSV(path string, logs []*hitLog) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// 写入 BOM 以便 Excel 正确识别 UTF-8
+	_, err = f.WriteString("\ufeff")
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{"时间", "群号", "QQ", "违禁词", "处罚", "消息"})
+	for _, l := range logs {
+		_ = w.Write([]string{
+			time.Unix(0, l.ID).Format("2006-01-02 15:04:05"),
+			strconv.FormatInt(l.GrpID, 10),
+			strconv.FormatInt(l.UserID, 10),
+			l.Word,
+			l.Action,
+			l.Msg,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// punish 按违禁词的处罚方式处理发送者并记一次违规, 返回所采取的处罚
+func punish(ctx *zero.Ctx, w *banWord) (string, error) {
+	uid := ctx.Event.UserID
+	strikes, err := db.addStrike(ctx.Event.GroupID, uid)
+	if err != nil {
+		return "", err
+	}
+	hint := fmt.Sprintf(" (第%d次违规)", strikes)
+	switch w.Action {
+	case actwarn:
+		ctx.SendChain(message.At(uid), message.Text(" 检测到违禁词, 警告一次", hint))
+		return "警告", nil
+	case actrecall:
+		ctx.DeleteMessage(ctx.Event.MessageID)
+		ctx.SendChain(message.At(uid), message.Text(" 检测到违禁词, 已撤回", hint))
+		return "撤回", nil
+	case actkick:
+		ctx.DeleteMessage(ctx.Event.MessageID)
+		ctx.SetThisGroupKick(uid, false)
+		ctx.SendChain(message.Text("检测到违禁词, 已踢出 ", uid, hint))
+		return "踢出", nil
+	}
+	dur := w.muteDuration(strikes)
+	if err := ctx.State["manager"].(*ctrl.Control[*zero.Ctx]).Manager.DoBlock(uid); err != nil {
+		return "", errors.New("block user: " + err.Error())
+	}
+	t := time.Now().Unix()
+	cache.Set(uid, struct{}{})
+	cache.Touch(uid, dur-bandur)
+	ctx.SetThisGroupBan(uid, int64(dur.Seconds()))
+	ctx.DeleteMessage(ctx.Event.MessageID)
+	ctx.SendChain(message.Text("检测到违禁词, 已封禁/屏蔽", dur, hint))
+	db.Lock()
+	defer db.Unlock()
+	err = db.Insert("__bantime__", &banTime{ID: uid, Time: t, Dur: int64(dur / time.Second)})
+	if err != nil {
+		return "", err
+	}
+	return "禁言" + dur.String(), nil
 }
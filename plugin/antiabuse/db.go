@@ -8,20 +8,51 @@ import (
 	"time"
 
 	sqlite "github.com/FloatTech/sqlite"
+	"github.com/RomiChan/syncx"
 )
 
 type antidb struct {
 	sync.RWMutex
 	sqlite.Sqlite
+	matchers syncx.Map[int64, *wordset]
+	migrated map[string]struct{} // 已补齐处罚列的群违禁词表, 由写锁保护
 }
 
 type banWord struct {
-	Word string `db:"word"`
+	Word    string `db:"word"`
+	Action  action `db:"act"`
+	Minutes int64  `db:"mins"` // 禁言基础时长, 为 0 时使用 bandur
 }
 
 type banTime struct {
 	ID   int64 `db:"id"`
 	Time int64 `db:"time"`
+	Dur  int64 `db:"dur"` // 封禁秒数, 为 0 时为 bandur
+}
+
+// strike 某人在某群的违规计数
+type strike struct {
+	ID     string `db:"id"` // gid_uid
+	GrpID  int64  `db:"gid"`
+	UserID int64  `db:"uid"`
+	Count  int64  `db:"count"`
+	Last   int64  `db:"last"` // 最后一次违规的 unix 时间
+}
+
+// hitLog 一次违禁词命中记录
+type hitLog struct {
+	ID     int64  `db:"id"` // unix nano
+	GrpID  int64  `db:"gid"`
+	UserID int64  `db:"uid"`
+	Word   string `db:"word"`
+	Msg    string `db:"msg"`
+	Action string `db:"act"`
+}
+
+// wordset 一个群的违禁词及其自动机
+type wordset struct {
+	*acmatcher
+	words map[string]*banWord
 }
 
 var (
@@ -30,34 +61,98 @@ var (
 )
 
 func newantidb(path string) (*antidb, error) {
-	db := &antidb{Sqlite: sqlite.New(path)}
+	db := &antidb{Sqlite: sqlite.New(path), migrated: make(map[string]struct{}, 64)}
 	err := db.Open(bandur)
 	if err != nil {
 		return nil, err
 	}
+	err = db.Create("__bantime__", nilbt)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = db.Exec("ALTER TABLE __bantime__ ADD COLUMN dur BIGINT NOT NULL DEFAULT 0;")
+	err = db.Create("__strike__", &strike{})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Create("__hitlog__", &hitLog{})
+	if err != nil {
+		return nil, err
+	}
+	expired := make([]int64, 0, 16)
 	_ = db.FindFor("__bantime__", nilbt, "", func() error {
 		t := time.Unix(nilbt.Time, 0)
-		ttl := time.Until(t.Add(bandur))
+		dur := nilbt.duration()
+		ttl := time.Until(t.Add(dur))
 		if ttl < time.Minute {
 			_ = managers.DoUnblock(nilbt.ID)
+			expired = append(expired, nilbt.ID)
 			return nil
 		}
 		cache.Set(nilbt.ID, struct{}{})
-		cache.Touch(nilbt.ID, -time.Since(t))
+		cache.Touch(nilbt.ID, dur-bandur-time.Since(t))
 		return nil
 	})
-	_ = db.Del("__bantime__", "WHERE time <= ?", strconv.FormatInt(time.Now().Add(time.Minute-bandur).Unix(), 10))
+	for _, id := range expired {
+		_ = db.Del("__bantime__", "WHERE id = ?", id)
+	}
 	return db, nil
 }
 
-func (db *antidb) isInAntiList(gid int64, msg string) bool {
+func (bt *banTime) duration() time.Duration {
+	if bt.Dur <= 0 {
+		return bandur
+	}
+	return time.Duration(bt.Dur) * time.Second
+}
+
+// match 返回 msg 命中的本群违禁词
+func (db *antidb) match(gid int64, msg string) (*banWord, bool) {
+	ws, ok := db.matchers.Load(gid)
+	if !ok {
+		db.Lock()
+		ws, ok = db.matchers.Load(gid)
+		if !ok {
+			db.migrateWordTable(strconv.FormatInt(gid, 36))
+			ws = db.loadMatcher(gid)
+		}
+		db.Unlock()
+	}
+	w, ok := ws.find(normalize(msg))
+	if !ok {
+		return nil, false
+	}
+	return ws.words[w], true
+}
+
+// loadMatcher 从数据库重建本群自动机, 调用者需持有锁
+func (db *antidb) loadMatcher(gid int64) *wordset {
 	grp := strconv.FormatInt(gid, 36)
-	db.RLock()
-	defer db.RUnlock()
-	return db.CanFind(grp, "WHERE instr('"+msg+"', word)>0")
+	word := &banWord{}
+	ws := &wordset{words: make(map[string]*banWord, 64)}
+	words := make([]string, 0, 64)
+	_ = db.FindFor(grp, word, "", func() error {
+		w := *word
+		ws.words[w.Word] = &w
+		words = append(words, w.Word)
+		return nil
+	})
+	ws.acmatcher = newacmatcher(words)
+	db.matchers.Store(gid, ws)
+	return ws
 }
 
-func (db *antidb) insertWord(gid int64, word string) error {
+// migrateWordTable 为旧版本的违禁词表补齐处罚列, 每张表只执行一次, 调用者需持有写锁
+func (db *antidb) migrateWordTable(grp string) {
+	if _, ok := db.migrated[grp]; ok {
+		return
+	}
+	db.migrated[grp] = struct{}{}
+	_, _ = db.Exec("ALTER TABLE [" + grp + "] ADD COLUMN act UNSIGNED TINYINT NOT NULL DEFAULT 0;")
+	_, _ = db.Exec("ALTER TABLE [" + grp + "] ADD COLUMN mins BIGINT NOT NULL DEFAULT 0;")
+}
+
+func (db *antidb) insertWord(gid int64, word *banWord) error {
 	grp := strconv.FormatInt(gid, 36)
 	db.Lock()
 	defer db.Unlock()
@@ -65,7 +160,13 @@ func (db *antidb) insertWord(gid int64, word string) error {
 	if err != nil {
 		return err
 	}
-	return db.Insert(grp, &banWord{Word: word})
+	db.migrateWordTable(grp)
+	err = db.Insert(grp, word)
+	if err != nil {
+		return err
+	}
+	_ = db.loadMatcher(gid)
+	return nil
 }
 
 func (db *antidb) deleteWord(gid int64, word string) error {
@@ -75,7 +176,13 @@ func (db *antidb) deleteWord(gid int64, word string) error {
 	if n, _ := db.Count(grp); n == 0 {
 		return errors.New("本群还没有违禁词~")
 	}
-	return db.Del(grp, "WHERE word='"+word+"'")
+	err := db.Del(grp, "WHERE word=?", word)
+	if err != nil {
+		return err
+	}
+	db.migrateWordTable(grp)
+	_ = db.loadMatcher(gid)
+	return nil
 }
 
 func (db *antidb) listWords(gid int64) string {
@@ -84,19 +191,106 @@ func (db *antidb) listWords(gid int64) string {
 	sb := strings.Builder{}
 	sb.WriteByte('[')
 	i := 0
-	db.RLock()
-	defer db.RUnlock()
+	db.Lock()
+	defer db.Unlock()
+	db.migrateWordTable(grp)
 	_ = db.FindFor(grp, word, "", func() error {
 		if i > 0 {
 			sb.WriteString(" | ")
 		}
 		sb.WriteString(word.Word)
+		sb.WriteByte('(')
+		sb.WriteString(word.describe())
+		sb.WriteByte(')')
 		i++
 		return nil
 	})
-	if sb.Len() <= 4 {
-		return "[]"
+	if i == 0 {
+		sb.Reset()
+		sb.WriteString("[]")
+	} else {
+		sb.WriteByte(']')
+	}
+	sb.WriteString("\n\n违规计数(每")
+	sb.WriteString(strikeDecay.String())
+	sb.WriteString("无违规减一次, 禁言时长按次数翻倍):\n")
+	st := &strike{}
+	now := time.Now()
+	n := 0
+	_ = db.FindFor("__strike__", st, "WHERE gid = ? ORDER BY count DESC", func() error {
+		if c := st.current(now); c > 0 {
+			sb.WriteString(strconv.FormatInt(st.UserID, 10))
+			sb.WriteString(": ")
+			sb.WriteString(strconv.FormatInt(c, 10))
+			sb.WriteString("次\n")
+			n++
+		}
+		return nil
+	}, gid)
+	if n == 0 {
+		sb.WriteString("无\n")
 	}
-	sb.WriteByte(']')
 	return sb.String()
 }
+
+// addStrike 为某人在某群记一次违规并返回衰减后的当前计数
+func (db *antidb) addStrike(gid, uid int64) (int64, error) {
+	id := strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10)
+	now := time.Now()
+	db.Lock()
+	defer db.Unlock()
+	st := &strike{}
+	if err := db.Find("__strike__", st, "WHERE id = ?", id); err != nil {
+		st = &strike{ID: id, GrpID: gid, UserID: uid}
+	}
+	st.Count = st.current(now) + 1
+	st.Last = now.Unix()
+	return st.Count, db.Insert("__strike__", st)
+}
+
+// current 返回衰减后的违规计数
+func (st *strike) current(now time.Time) int64 {
+	if st.Last == 0 {
+		return 0
+	}
+	c := st.Count - int64(now.Sub(time.Unix(st.Last, 0))/strikeDecay)
+	if c < 0 {
+		return 0
+	}
+	return c
+}
+
+// logHit 记录一次命中
+func (db *antidb) logHit(gid, uid int64, word, msg, act string) error {
+	db.Lock()
+	defer db.Unlock()
+	return db.Insert("__hitlog__", &hitLog{
+		ID:     time.Now().UnixNano(),
+		GrpID:  gid,
+		UserID: uid,
+		Word:   word,
+		Msg:    msg,
+		Action: act,
+	})
+}
+
+// listHits 按时间倒序列出本群命中记录, uid 为 0 时不限用户, limit 为 0 时不限条数
+func (db *antidb) listHits(gid, uid int64, limit int) ([]*hitLog, error) {
+	q := "WHERE gid = ?"
+	args := []any{gid}
+	if uid != 0 {
+		q += " AND uid = ?"
+		args = append(args, uid)
+	}
+	q += " ORDER BY id DESC"
+	if limit > 0 {
+		q += " LIMIT " + strconv.Itoa(limit)
+	}
+	db.RLock()
+	defer db.RUnlock()
+	logs, err := sqlite.FindAll[hitLog](&db.Sqlite, "__hitlog__", q, args...)
+	if err == sqlite.ErrNullResult {
+		return nil, nil
+	}
+	return logs, err
+}
@@ -0,0 +1,94 @@
+package antiabuse
+
+// acnode Aho-Corasick 自动机节点
+type acnode struct {
+	next map[rune]int32
+	fail int32
+	word int32 // 以此节点结尾(含 fail 链)的违禁词下标, -1 表示无
+}
+
+// acmatcher 一个群的违禁词多模匹配自动机, 构建后只读
+type acmatcher struct {
+	nodes []acnode
+	words []string // 违禁词原文
+}
+
+// newacmatcher 以违禁词原文构建自动机, 词会先经过 normalize
+func newacmatcher(words []string) *acmatcher {
+	m := &acmatcher{
+		nodes: make([]acnode, 1, 64),
+		words: make([]string, 0, len(words)),
+	}
+	m.nodes[0] = acnode{next: map[rune]int32{}, word: -1}
+	for _, w := range words {
+		nw := normalize(w)
+		if nw == "" {
+			continue
+		}
+		cur := int32(0)
+		for _, r := range nw {
+			nxt, ok := m.nodes[cur].next[r]
+			if !ok {
+				nxt = int32(len(m.nodes))
+				m.nodes = append(m.nodes, acnode{next: map[rune]int32{}, word: -1})
+				m.nodes[cur].next[r] = nxt
+			}
+			cur = nxt
+		}
+		if m.nodes[cur].word < 0 {
+			m.nodes[cur].word = int32(len(m.words))
+		}
+		m.words = append(m.words, w)
+	}
+	// BFS 建立 fail 指针, 并沿 fail 链继承输出
+	queue := make([]int32, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[cur].next {
+			f := m.nodes[cur].fail
+			for {
+				if nxt, ok := m.nodes[f].next[r]; ok {
+					m.nodes[child].fail = nxt
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			if m.nodes[child].word < 0 {
+				m.nodes[child].word = m.nodes[m.nodes[child].fail].word
+			}
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// find 在已 normalize 的文本中查找, 返回命中的第一个违禁词原文
+func (m *acmatcher) find(s string) (string, bool) {
+	if m == nil || len(m.words) == 0 {
+		return "", false
+	}
+	cur := int32(0)
+	for _, r := range s {
+		for {
+			if nxt, ok := m.nodes[cur].next[r]; ok {
+				cur = nxt
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = m.nodes[cur].fail
+		}
+		if w := m.nodes[cur].word; w >= 0 {
+			return m.words[w], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,46 @@
+package antiabuse
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"违 禁 词", "违禁词"},
+		{"違禁詞", "违禁词"},
+		{"违​禁‍词", "违禁词"},
+		{"违*禁-词!!", "违禁词"},
+		{"ＡＢＣ１２３", "abc123"},
+		{"рaу", "pay"},
+	}
+	for _, tt := range tests {
+		if got := normalize(tt.input); got != tt.expected {
+			t.Errorf("normalize(%q) = %q, 期望 %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestACMatcher(t *testing.T) {
+	m := newacmatcher([]string{"违禁词", "he", "she", "hers", "違規"})
+	tests := []struct {
+		input string
+		word  string
+		ok    bool
+	}{
+		{"这是一个 违 禁 詞 哦", "违禁词", true},
+		{"ushers", "she", true},
+		{"这里有违规内容", "違規", true},
+		{"正常的消息", "", false},
+		{"违禁", "", false},
+	}
+	for _, tt := range tests {
+		word, ok := m.find(normalize(tt.input))
+		if ok != tt.ok || word != tt.word {
+			t.Errorf("find(%q) = (%q, %v), 期望 (%q, %v)", tt.input, word, ok, tt.word, tt.ok)
+		}
+	}
+	if _, ok := newacmatcher(nil).find("任何消息"); ok {
+		t.Error("空自动机不应命中")
+	}
+}
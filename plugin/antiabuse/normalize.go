@@ -0,0 +1,50 @@
+package antiabuse
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 常见繁体字 -> 简体字, 每项为 "繁简" 两个字
+const tradsimp = "違违 詞词 語语 説说 說说 話话 請请 讓让 認认 識识 這这 個个 們们 來来 時时 會会 為为 對对 學学 國国 與与 過过 還还 後后 從从 發发 當当 開开 關关 無无 麼么 經经 應应 實实 現现 點点 見见 頭头 長长 問问 間间 門门 聽听 親亲 愛爱 錢钱 買买 賣卖 貨货 黃黄 網网 號号 碼码 車车 馬马 鳥鸟 魚鱼 龍龙 東东 動动 機机 電电 腦脑 視视 覺觉 氣气 熱热 燒烧 給给 紅红 綠绿 藍蓝 結结 約约 級级 線线 細细 組组 終终 總总 縣县 區区 醫医 藥药 賭赌 殺杀 槍枪 彈弹 黨党 帶带 幫帮 務务 戰战 盜盗 騙骗 詐诈 訊讯 傳传 廣广 廠厂 莊庄 場场 壞坏 塊块 牆墙 聲声 處处 備备 復复 複复 夠够 頁页 顯显 願愿 風风 飛飞 飯饭 餓饿 館馆 體体 髮发 鬥斗 雞鸡 難难 離离 雲云 靈灵 韓韩 順顺 題题 類类 顏颜 額额 領领 單单 嚴严 團团 圖图 園园 圓圆 夢梦 奪夺 奮奋 婦妇 媽妈 孫孙 寶宝 寫写 專专 將将 導导 層层 屬属 歲岁 島岛 幣币 幹干 幾几 庫库 廳厅 張张 強强 彎弯 徑径 徵征 憂忧 戲戏 戶户 掃扫 掛挂 換换 據据 擊击 擔担 擇择 擁拥 擴扩 攝摄 敵敌 數数 斷断 條条 極极 樂乐 樓楼 標标 樣样 權权 歡欢 歷历 歸归 殘残 決决 沒没 況况 測测 淚泪 湯汤 滅灭 滿满 漢汉 漲涨 潔洁 濕湿 灣湾 災灾 烏乌 煙烟 爺爷 犧牺 獄狱 獨独 獲获 獎奖 環环 產产 畫画 異异 療疗 盡尽 監监 盤盘 眾众 確确 禮礼 禍祸 稅税 穩稳 窮穷 競竞 筆笔 節节 範范 簡简 糧粮 緊紧 練练 縮缩 績绩 續续 罰罚 羅罗 習习 聯联 職职 腳脚 臉脸 興兴 舊旧 藝艺 蘇苏 蘭兰 蟲虫 術术 衛卫 衝冲 補补 裝装 製制 規规 觀观 計计 訂订 記记 許许 設设 訪访 評评 試试 詳详 誠诚 誤误 課课 調调 談谈 論论 謝谢 證证 護护 讀读 變变 貝贝 負负 財财 責责 貧贫 費费 資资 賊贼 賞赏 賠赔 賴赖 贊赞 贏赢 趕赶 跡迹 躍跃 軍军 軟软 較较 載载 輕轻 輛辆 輪轮 輸输 轉转 辦办 辭辞 農农 運运 達达 遠远 遲迟 選选 遺遗 邊边 郵邮 鄉乡 醜丑 釋释 針针 銀银 銷销 鋼钢 錄录 錯错 鍵键 鎖锁 鏡镜 鐘钟 鐵铁 閃闪 閉闭 閱阅 陣阵 陰阴 陳陈 陸陆 陽阳 隊队 階阶 際际 隨随 險险 隱隐 雙双 雜杂 雖虽 須须 預预 頓顿 頻频 餘余 駕驾 騎骑 驗验 驚惊 髒脏 鬧闹 鮮鲜 麗丽 麥麦 齊齐 齒齿 妳你 廢废 癡痴 嗎吗 屍尸 姦奸 騷骚 褲裤 腸肠 膽胆 膚肤 蕩荡 燈灯 賤贱 傑杰 侖仑 倫伦 偽伪 傷伤 億亿 僅仅 價价 優优 兒儿 內内 兩两 冊册 劃划 劇剧 勞劳 勝胜 勢势 華华 協协 卻却 參参 雙双 嘆叹 嚇吓 噴喷 塵尘 壓压 夾夹 奧奥 姊姐 學学 寧宁 尋寻 尷尴 屆届 嶺岭 帥帅 師师 廟庙 彥彦 徹彻 恥耻 惡恶 慘惨 慶庆 懶懒 懷怀 戀恋 撥拨 擠挤 攤摊 敗败 斬斩 暈晕 暫暂 曆历 書书 朧胧 橋桥 殼壳 毀毁 漁渔 濃浓 瀏浏 煩烦 爛烂 牽牵 猶犹 獸兽 瑪玛 瘋疯 皺皱 睜睁 矯矫 碼码 磚砖 禦御 穢秽 筍笋 紀纪 紙纸 紛纷 純纯 絕绝 絲丝 綁绑 維维 緣缘 縱纵 織织 繩绳 繼继 罵骂 聖圣 聞闻 肅肃 脫脱 蔔卜 處处 號号 蝦虾 蠻蛮 裏里 裡里 褻亵 親亲 訴诉 詛诅 詭诡 誘诱 誰谁 謊谎 譜谱 豐丰 貓猫 貪贪 賽赛 趙赵 蹤踪 軀躯 輯辑 邏逻 醬酱 釣钓 鈔钞 鋪铺 鎮镇 閒闲 闖闯 陝陕 隸隶 雜杂 靜静 頸颈 顧顾 飄飘 養养 騰腾 騷骚 髮发 鬆松 魯鲁 鴨鸭 鵝鹅 鹽盐 麵面 黴霉 點点 龜龟"
+
+// 常见形近字母 -> 拉丁字母, 每项为 "形近字母 拉丁字母" 两个字
+const homoglyphs = "аa вb еe зz кk мm нh оo рp сc тt уy хx ѕs іi јj ԁd ԛq ԝw ѵv ьb αa βb γy εe ηn ιi κk μu νv οo ρp τt υu χx ωw ɡg ɑa ʀr ᴀa ʙb ᴄc ᴅd ᴇe ɢg ʜh ɪi ᴊj ᴋk ʟl ᴍm ɴn ᴏo ᴘp ʀr ᴛt ᴜu ᴠv ᴡw ʏy ᴢz"
+
+// confusables 繁体字与形近字的归一映射
+var confusables = func() map[rune]rune {
+	m := make(map[rune]rune, 1024)
+	for _, tab := range [...]string{tradsimp, homoglyphs} {
+		for _, pair := range strings.Fields(tab) {
+			rs := []rune(pair)
+			if len(rs) != 2 {
+				panic("antiabuse: invalid confusable pair " + pair)
+			}
+			m[rs[0]] = rs[1]
+		}
+	}
+	return m
+}()
+
+// normalize 将消息归一化以便匹配:
+// NFKC 折叠全角与兼容字符, 转为小写, 映射繁体与形近字,
+// 并去除零宽字符、组合符号、空白、标点与符号等填充物
+func normalize(s string) string {
+	s = norm.NFKC.String(s)
+	sb := strings.Builder{}
+	sb.Grow(len(s))
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) ||
+			unicode.In(r, unicode.Cf, unicode.Cc, unicode.Mn, unicode.Me) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
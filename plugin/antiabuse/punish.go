@@ -0,0 +1,85 @@
+package antiabuse
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// action 违禁词命中后的处罚
+type action uint8
+
+const (
+	actmute   action = iota // 撤回并禁言, 重复违规时禁言时长翻倍
+	actwarn                 // 仅警告
+	actrecall               // 撤回并警告
+	actkick                 // 撤回并踢出
+)
+
+const (
+	strikeDecay    = time.Hour * 24 // 每隔该时长无违规则计数减一
+	maxMuteMinutes = 43199          // 群禁言上限不足 30 天
+	maxMuteShift   = 16             // 翻倍次数上限, 防止溢出
+	defaultMuteMin = int64(bandur / time.Minute)
+)
+
+var addre = regexp.MustCompile(`^(.+?)\s+(警告|撤回|踢出|禁言(\d*)(?:分钟)?)$`)
+
+// parseWord 解析 "词 [警告|撤回|禁言N分钟|踢出]", 不带处罚时默认禁言
+func parseWord(args string) *banWord {
+	w := &banWord{Word: args}
+	m := addre.FindStringSubmatch(args)
+	if m == nil {
+		return w
+	}
+	w.Word = m[1]
+	switch m[2] {
+	case "警告":
+		w.Action = actwarn
+	case "撤回":
+		w.Action = actrecall
+	case "踢出":
+		w.Action = actkick
+	default:
+		w.Action = actmute
+		w.Minutes, _ = strconv.ParseInt(m[3], 10, 64)
+	}
+	return w
+}
+
+// describe 处罚的可读描述
+func (w *banWord) describe() string {
+	switch w.Action {
+	case actwarn:
+		return "警告"
+	case actrecall:
+		return "撤回"
+	case actkick:
+		return "踢出"
+	default:
+		return "禁言" + strconv.FormatInt(w.baseMinutes(), 10) + "分钟起"
+	}
+}
+
+func (w *banWord) baseMinutes() int64 {
+	if w.Minutes <= 0 {
+		return defaultMuteMin
+	}
+	return w.Minutes
+}
+
+// muteDuration 第 strikes 次违规时的禁言时长, 每次翻倍
+func (w *banWord) muteDuration(strikes int64) time.Duration {
+	shift := strikes - 1
+	if shift < 0 {
+		shift = 0
+	}
+	if shift > maxMuteShift {
+		shift = maxMuteShift
+	}
+	mins := w.baseMinutes() << shift
+	if mins > maxMuteMinutes || mins <= 0 {
+		mins = maxMuteMinutes
+	}
+	return time.Duration(mins) * time.Minute
+}
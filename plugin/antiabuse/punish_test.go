@@ -0,0 +1,49 @@
+package antiabuse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWord(t *testing.T) {
+	tests := []struct {
+		args    string
+		word    string
+		act     action
+		minutes int64
+	}{
+		{"违禁词", "违禁词", actmute, 0},
+		{"违禁词 警告", "违禁词", actwarn, 0},
+		{"违 禁 词 撤回", "违 禁 词", actrecall, 0},
+		{"违禁词 禁言10分钟", "违禁词", actmute, 10},
+		{"违禁词 踢出", "违禁词", actkick, 0},
+	}
+	for _, tt := range tests {
+		w := parseWord(tt.args)
+		if w.Word != tt.word || w.Action != tt.act || w.Minutes != tt.minutes {
+			t.Errorf("parseWord(%q) = %+v, 期望 {%s %d %d}", tt.args, *w, tt.word, tt.act, tt.minutes)
+		}
+	}
+}
+
+func TestStrikeEscalation(t *testing.T) {
+	w := &banWord{Minutes: 5}
+	for i, expected := range []time.Duration{5, 5, 10, 20, 40} {
+		if d := w.muteDuration(int64(i)); d != expected*time.Minute {
+			t.Errorf("muteDuration(%d) = %v, 期望 %v", i, d, expected*time.Minute)
+		}
+	}
+	if d := w.muteDuration(100); d != maxMuteMinutes*time.Minute {
+		t.Errorf("muteDuration 未封顶: %v", d)
+	}
+
+	now := time.Now()
+	st := &strike{Count: 3, Last: now.Add(-strikeDecay*2 - time.Minute).Unix()}
+	if c := st.current(now); c != 1 {
+		t.Errorf("衰减后计数 = %d, 期望 1", c)
+	}
+	st.Last = now.Add(-strikeDecay * 10).Unix()
+	if c := st.current(now); c != 0 {
+		t.Errorf("衰减后计数 = %d, 期望 0", c)
+	}
+}
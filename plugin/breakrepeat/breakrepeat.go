@@ -2,49 +2,364 @@
 package breakrepeat
 
 import (
+	"errors"
 	"math/rand"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/floatbox/web"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/imgfactory"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
-	"github.com/RomiChan/syncx"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
 )
 
-const throttle = 3 // 不可超过 9
+const (
+	// defaultThrottle 未设置时, 超过 3 次复读后打断
+	defaultThrottle = 3
+	// muteSeconds 禁言复读者的时长
+	muteSeconds = 60
+	// rankLimit 复读排行显示的人数
+	rankLimit = 10
+)
+
+// 打断方式, 存于群数据的第 8~15 位, 第 0~7 位为阈值
+const (
+	strategyShuffle = iota // 打乱
+	strategyJoin           // 跟读
+	strategyMute           // 禁言
+	strategyImage          // 图片
+)
 
-var sm syncx.Map[int64, string]
+var strategyNames = [...]string{"打乱", "跟读", "禁言", "图片"}
+
+// chain 群内正在进行的复读
+type chain struct {
+	key   string
+	msg   message.Message
+	users []int64 // 依次参与复读的人, 第一个是原消息的发送者
+}
+
+var (
+	mu     sync.Mutex
+	chains = make(map[int64]*chain, 64)
+	// stopImage 默认的打断图片, 第一次使用时绘制
+	stopImage []byte
+	imgmu     sync.Mutex
+
+	errNoManager = errors.New("找不到服务")
+)
 
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "打断复读",
-		Help:             "- 打断" + strconv.Itoa(throttle) + "次以上复读\n",
+		Help: "- 打断" + strconv.Itoa(defaultThrottle) + "次以上复读 (图片与表情相同也算复读)\n" +
+			"- 设置复读阈值 3 (仅管理员)\n" +
+			"- 设置打断复读方式 [打乱|跟读|禁言|图片] (仅管理员)\n" +
+			"- 设置打断复读图片[图片] (仅管理员)\n" +
+			"- 重置打断复读图片 (仅管理员)\n" +
+			"- 查看复读设置\n" +
+			"- 复读排行",
+		PrivateDataFolder: "breakrepeat",
 	})
-	engine.On("message/group", zero.OnlyGroup, func(ctx *zero.Ctx) bool {
-		return !zero.HasPicture(ctx)
-	}).SetBlock(false).
+	err := initDatabase(engine.DataFolder() + "repeat.db")
+	if err != nil {
+		panic(err)
+	}
+	imagePath := func(gid int64) string {
+		return engine.DataFolder() + strconv.FormatInt(gid, 10) + ".img"
+	}
+
+	engine.OnRegex(`^设置复读阈值\s*(\d+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			gid := ctx.Event.GroupID
-			raw := ctx.Event.RawMessage
-			r, ok := sm.Load(gid)
-			if !ok || len(r) <= 3 || r[3:] != raw {
-				sm.Store(gid, "0: "+raw)
+			n, err := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			if err != nil || n < 1 || n > 0xff {
+				ctx.SendChain(message.Text("ERROR: 阈值应在 1~255 之间"))
 				return
 			}
-			c := int(r[0] - '0')
-			if c < throttle {
-				sm.Store(gid, strconv.Itoa(c+1)+": "+raw)
+			if err = setConfig(ctx, func(_, strategy int) (int, int) { return n, strategy }); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			sm.Delete(gid)
-			if len(r) > 5 {
-				ru := []rune(r[3:])
-				rand.Shuffle(len(ru), func(i, j int) {
-					ru[i], ru[j] = ru[j], ru[i]
-				})
-				r = string(ru)
+			ctx.SendChain(message.Text("本群将打断", n, "次以上的复读"))
+		})
+	engine.OnRegex(`^设置打断复读方式\s*(打乱|跟读|\+1|禁言|图片)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			name := ctx.State["regex_matched"].([]string)[1]
+			if name == "+1" {
+				name = "跟读"
+			}
+			s := 0
+			for i, n := range strategyNames {
+				if n == name {
+					s = i
+				}
+			}
+			if err := setConfig(ctx, func(throttle, _ int) (int, int) { return throttle, s }); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
 			}
-			ctx.Send(r)
+			ctx.SendChain(message.Text("本群打断复读的方式已设为", name))
 		})
+	engine.OnPrefix("设置打断复读图片", zero.OnlyGroup, zero.AdminPermission, zero.MustProvidePicture).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			data, err := web.GetData(ctx.State["image_url"].([]string)[0])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if err = os.WriteFile(imagePath(ctx.Event.GroupID), data, 0644); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已设置本群的打断复读图片"))
+		})
+	engine.OnFullMatch("重置打断复读图片", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			_ = os.Remove(imagePath(ctx.Event.GroupID))
+			ctx.SendChain(message.Text("已恢复默认的打断复读图片"))
+		})
+	engine.OnFullMatch("查看复读设置", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			throttle, strategy := getConfig(ctx)
+			ctx.SendChain(message.Text("本群打断", throttle, "次以上的复读, 打断方式: ", strategyNames[strategy]))
+		})
+	engine.OnFullMatch("复读排行", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			rs, err := topRepeaters(ctx.Event.GroupID, rankLimit)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(rs) == 0 {
+				ctx.SendChain(message.Text("本群还没有人复读过"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("本群复读排行:")
+			for i, r := range rs {
+				sb.WriteString("\n")
+				sb.WriteString(strconv.Itoa(i + 1))
+				sb.WriteString(". ")
+				sb.WriteString(ctx.CardOrNickName(r.UserID))
+				sb.WriteString(" 复读了 ")
+				sb.WriteString(strconv.FormatInt(r.Count, 10))
+				sb.WriteString(" 次")
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	// 需在指令之后注册, 设置指令不计入复读
+	engine.On("message/group", zero.OnlyGroup).SetBlock(false).
+		Handle(func(ctx *zero.Ctx) {
+			key := keyOf(ctx.Event.Message)
+			if key == "" {
+				return
+			}
+			gid, uid := ctx.Event.GroupID, ctx.Event.UserID
+			throttle, strategy := getConfig(ctx)
+			mu.Lock()
+			c, ok := chains[gid]
+			if !ok || c.key != key {
+				chains[gid] = &chain{key: key, msg: ctx.Event.Message, users: []int64{uid}}
+				mu.Unlock()
+				return
+			}
+			// 同一个人重复发送不算复读
+			for _, u := range c.users {
+				if u == uid {
+					mu.Unlock()
+					return
+				}
+			}
+			c.users = append(c.users, uid)
+			triggered := len(c.users)-1 > throttle
+			if triggered {
+				delete(chains, gid)
+			}
+			mu.Unlock()
+			if err := addRepeat(gid, uid, time.Now()); err != nil {
+				logrus.Warnln("[breakrepeat] 记录复读失败:", err)
+			}
+			if !triggered {
+				return
+			}
+			switch strategy {
+			case strategyJoin:
+				ctx.Send(echo(c.msg))
+				return
+			case strategyMute:
+				ctx.SetThisGroupBan(uid, muteSeconds)
+				ctx.SendChain(message.At(uid), message.Text(" 复读到此为止!"))
+				return
+			case strategyShuffle:
+				if s, ok := shuffle(c.msg); ok {
+					ctx.Send(s)
+					return
+				}
+			}
+			// 图片方式, 或无法打乱的非文字消息
+			if p := imagePath(gid); file.IsExist(p) {
+				ctx.SendChain(message.Image("file:///" + file.BOTPATH + "/" + p))
+				return
+			}
+			data, err := defaultImage()
+			if err != nil {
+				logrus.Warnln("[breakrepeat] 生成打断图片失败:", err)
+				return
+			}
+			ctx.SendChain(message.ImageBytes(data))
+		})
+}
+
+// getConfig 本群的阈值与打断方式
+func getConfig(ctx *zero.Ctx) (throttle, strategy int) {
+	throttle, strategy = defaultThrottle, strategyShuffle
+	c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+	if !ok {
+		return
+	}
+	data := c.GetData(ctx.Event.GroupID)
+	if t := int(data & 0xff); t > 0 {
+		throttle = t
+	}
+	if s := int(data>>8) & 0xff; s < len(strategyNames) {
+		strategy = s
+	}
+	return
+}
+
+// setConfig 修改本群的阈值与打断方式
+func setConfig(ctx *zero.Ctx, f func(throttle, strategy int) (int, int)) error {
+	c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+	if !ok {
+		return errNoManager
+	}
+	throttle, strategy := f(getConfig(ctx))
+	data := c.GetData(ctx.Event.GroupID) &^ 0xffff
+	data |= int64(throttle&0xff) | int64(strategy&0xff)<<8
+	return c.SetData(ctx.Event.GroupID, data)
+}
+
+// keyOf 判断复读用的消息特征: 文字按内容, 图片按文件名 (即哈希), 表情按编号, 回复不计入
+func keyOf(msg message.Message) string {
+	var sb strings.Builder
+	for _, seg := range msg {
+		switch seg.Type {
+		case "reply":
+			continue
+		case "text":
+			sb.WriteString(strings.TrimSpace(seg.Data["text"]))
+			continue
+		case "image":
+			sb.WriteString("[image:")
+			if f := seg.Data["file"]; f != "" {
+				sb.WriteString(f)
+			} else {
+				sb.WriteString(seg.Data["url"])
+			}
+		case "face":
+			sb.WriteString("[face:")
+			sb.WriteString(seg.Data["id"])
+		case "mface":
+			sb.WriteString("[mface:")
+			sb.WriteString(seg.Data["emoji_id"])
+		case "at":
+			sb.WriteString("[at:")
+			sb.WriteString(seg.Data["qq"])
+		default:
+			// 参数顺序不固定, 排序后再比较
+			keys := make([]string, 0, len(seg.Data))
+			for k := range seg.Data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			sb.WriteString("[")
+			sb.WriteString(seg.Type)
+			for _, k := range keys {
+				sb.WriteString(",")
+				sb.WriteString(k)
+				sb.WriteString("=")
+				sb.WriteString(seg.Data[k])
+			}
+		}
+		sb.WriteString("]")
+	}
+	return sb.String()
+}
+
+// echo 跟读时发送的消息, 图片使用链接重新发送
+func echo(msg message.Message) message.Message {
+	m := make(message.Message, 0, len(msg))
+	for _, seg := range msg {
+		switch {
+		case seg.Type == "reply":
+		case seg.Type == "image" && seg.Data["url"] != "":
+			m = append(m, message.Image(seg.Data["url"]))
+		default:
+			m = append(m, seg)
+		}
+	}
+	return m
+}
+
+// shuffle 打乱纯文字消息, 消息含有其它内容或太短时返回 false
+func shuffle(msg message.Message) (string, bool) {
+	var sb strings.Builder
+	for _, seg := range msg {
+		switch seg.Type {
+		case "reply":
+		case "text":
+			sb.WriteString(seg.Data["text"])
+		default:
+			return "", false
+		}
+	}
+	ru := []rune(strings.TrimSpace(sb.String()))
+	if len(ru) < 2 {
+		return "", false
+	}
+	rand.Shuffle(len(ru), func(i, j int) {
+		ru[i], ru[j] = ru[j], ru[i]
+	})
+	return string(ru), true
+}
+
+// defaultImage 绘制默认的打断图片
+func defaultImage() ([]byte, error) {
+	imgmu.Lock()
+	defer imgmu.Unlock()
+	if stopImage != nil {
+		return stopImage, nil
+	}
+	b, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	canvas := gg.NewContext(480, 240)
+	canvas.SetRGB(1, 1, 1)
+	canvas.Clear()
+	canvas.SetRGB(0.85, 0.15, 0.15)
+	canvas.SetLineWidth(12)
+	canvas.DrawRectangle(12, 12, 456, 216)
+	canvas.Stroke()
+	if err = canvas.ParseFontFace(b, 80); err != nil {
+		return nil, err
+	}
+	canvas.DrawStringAnchored("禁止复读", 240, 120, 0.5, 0.5)
+	data, err := imgfactory.ToBytes(canvas.Image())
+	if err != nil {
+		return nil, err
+	}
+	stopImage = data
+	return data, nil
 }
@@ -0,0 +1,55 @@
+package breakrepeat
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+// repeater 群员参与复读的次数
+type repeater struct {
+	ID      string `db:"id"` // gid_uid
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Count   int64  `db:"count"`
+	Last    int64  `db:"last"` // 最近一次复读的时间
+}
+
+type repeatdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+var rdb = &repeatdb{}
+
+func initDatabase(path string) error {
+	rdb.Sqlite = sql.New(path)
+	err := rdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	return rdb.Create("repeater", &repeater{})
+}
+
+// addRepeat 记一次复读
+func addRepeat(gid, uid int64, t time.Time) error {
+	rdb.Lock()
+	defer rdb.Unlock()
+	_, err := rdb.Exec("INSERT INTO [repeater](id, gid, uid, count, last) VALUES (?, ?, ?, 1, ?) "+
+		"ON CONFLICT(id) DO UPDATE SET count = count + 1, last = excluded.last;",
+		strconv.FormatInt(gid, 10)+"_"+strconv.FormatInt(uid, 10), gid, uid, t.Unix())
+	return err
+}
+
+// topRepeaters 本群复读最多的 n 人
+func topRepeaters(gid int64, n int) ([]*repeater, error) {
+	rdb.RLock()
+	defer rdb.RUnlock()
+	rs, err := sql.FindAll[repeater](&rdb.Sqlite, "repeater", "WHERE gid = ? ORDER BY count DESC, last DESC LIMIT ?", gid, n)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return rs, err
+}
@@ -17,6 +17,8 @@ var (
 			"- 恶魔轮盘.对战信息\n" +
 			"- 恶魔轮盘.道具说明 [道具名]\n" +
 			"- 恶魔轮盘.结束游戏\n" +
+			"- 恶魔轮盘.战绩 [@xxx]\n" +
+			"- 恶魔轮盘.排行榜\n" +
 			"- 恶魔轮盘.设置禁言开启 [时长] (仅管理员)\n" +
 			"- 恶魔轮盘.设置禁言关闭 (仅管理员)\n" +
 			"- 恶魔轮盘.禁言设置 (仅管理员)\n" +
@@ -28,6 +30,9 @@ var (
 
 func init() {
 	itemList = getItemList()
+	if err := initDatabase(engine.DataFolder() + "bsr.db"); err != nil {
+		panic(err)
+	}
 	engine.OnPrefix("恶魔轮盘.创建游戏").SetBlock(true).Handle(handleCreateGame)
 	engine.OnPrefix("恶魔轮盘.加入游戏").SetBlock(true).Handle(handleJoinGame)
 	engine.OnPrefix("恶魔轮盘.开始游戏").SetBlock(true).Handle(handleStartGame)
@@ -36,8 +41,10 @@ func init() {
 	engine.OnPrefix("恶魔轮盘.结束游戏").SetBlock(true).Handle(handleEndGame)
 	engine.OnRegex(`^(自己|对方)$`).SetBlock(true).Handle(handleShoot)
 	engine.OnMessage().SetBlock(false).Handle(handleUseItem)
-	engine.OnPrefix("恶魔轮盘.设置禁言").SetBlock(true).Handle(handleSetMuteConfig)
-	engine.OnPrefix("恶魔轮盘.禁言设置").SetBlock(true).Handle(handleSetMuteConfig)
+	engine.OnPrefix("恶魔轮盘.设置禁言", zero.OnlyGroup).SetBlock(true).Handle(handleSetMuteConfig)
+	engine.OnPrefix("恶魔轮盘.禁言设置", zero.OnlyGroup).SetBlock(true).Handle(handleSetMuteConfig)
+	engine.OnRegex(`^恶魔轮盘\.战绩\s*(?:\[CQ:at,qq=(\d+)\])?$`).SetBlock(true).Handle(handleRecord)
+	engine.OnPrefix("恶魔轮盘.排行榜", zero.OnlyGroup).SetBlock(true).Handle(handleLeaderboard)
 }
 
 func isAdmin(ctx *zero.Ctx) bool {
@@ -0,0 +1,268 @@
+package buckshot
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+// bsrdb 对局存档、禁言设置与战绩
+type bsrdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// savedGame 进行中的对局存档
+type savedGame struct {
+	GID     int64  `db:"gid"`
+	Data    string `db:"data"` // gameState 的 json
+	Updated int64  `db:"updated"`
+}
+
+// gameState Game 中需要持久化的部分
+type gameState struct {
+	Player1      *playerState `json:"player1"`
+	Player2      *playerState `json:"player2,omitempty"`
+	Status       string       `json:"status"`
+	Bullet       []string     `json:"bullet"`
+	CurrentTurn  int          `json:"current_turn"`
+	Double       bool         `json:"double"`
+	Round        int          `json:"round"`
+	UsedHandcuff bool         `json:"used_handcuff"`
+}
+
+type playerState struct {
+	Name     string   `json:"name"`
+	ID       int64    `json:"id"`
+	HP       int      `json:"hp"`
+	Items    []string `json:"items"`
+	Handcuff bool     `json:"handcuff"`
+}
+
+// matchRecord 一局已结束的对局
+type matchRecord struct {
+	ID         int64  `db:"id"` // unix nano
+	GID        int64  `db:"gid"`
+	WinnerID   int64  `db:"winner"`
+	WinnerName string `db:"wname"`
+	LoserID    int64  `db:"loser"`
+	LoserName  string `db:"lname"`
+	Rounds     int    `db:"rounds"`
+}
+
+// itemUsage 某人在某频道使用某道具的次数
+type itemUsage struct {
+	ID    string `db:"id"` // gid_uid_item
+	GID   int64  `db:"gid"`
+	UID   int64  `db:"uid"`
+	Item  string `db:"item"`
+	Count int64  `db:"count"`
+}
+
+// playerStat 玩家胜负统计
+type playerStat struct {
+	UID    int64  `db:"uid"`
+	Name   string `db:"name"`
+	Wins   int64  `db:"wins"`
+	Losses int64  `db:"losses"`
+}
+
+// itemStat 道具使用统计
+type itemStat struct {
+	Item  string `db:"item"`
+	Count int64  `db:"count"`
+}
+
+var bdb = &bsrdb{}
+
+// initDatabase 打开数据库, 恢复进行中的对局与各群禁言设置
+func initDatabase(path string) error {
+	bdb.Sqlite = sql.New(path)
+	err := bdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = bdb.Create("game", &savedGame{})
+	if err != nil {
+		return err
+	}
+	err = bdb.Create("mute", &MuteConfig{})
+	if err != nil {
+		return err
+	}
+	err = bdb.Create("match", &matchRecord{})
+	if err != nil {
+		return err
+	}
+	err = bdb.Create("item", &itemUsage{})
+	if err != nil {
+		return err
+	}
+	mc := &MuteConfig{}
+	muteConfigMutex.Lock()
+	_ = bdb.FindFor("mute", mc, "", func() error {
+		muteConfigs[mc.GID] = *mc
+		return nil
+	})
+	muteConfigMutex.Unlock()
+	sg := &savedGame{}
+	broken := make([]int64, 0, 4)
+	_ = bdb.FindFor("game", sg, "", func() error {
+		var st gameState
+		if json.Unmarshal([]byte(sg.Data), &st) != nil || st.Player1 == nil {
+			broken = append(broken, sg.GID)
+			return nil
+		}
+		setGame(sg.GID, st.restore())
+		return nil
+	})
+	for _, gid := range broken {
+		_ = bdb.Del("game", "WHERE gid = ?", gid)
+	}
+	return nil
+}
+
+func (p *Player) state() *playerState {
+	if p == nil {
+		return nil
+	}
+	return &playerState{Name: p.name, ID: p.id, HP: p.hp, Items: p.items, Handcuff: p.handcuff}
+}
+
+func (s *playerState) restore() *Player {
+	if s == nil {
+		return nil
+	}
+	return &Player{name: s.Name, id: s.ID, hp: s.HP, items: s.Items, handcuff: s.Handcuff}
+}
+
+func (g *Game) state() *gameState {
+	return &gameState{
+		Player1:      g.player1.state(),
+		Player2:      g.player2.state(),
+		Status:       g.status,
+		Bullet:       g.bullet,
+		CurrentTurn:  g.currentTurn,
+		Double:       g.double,
+		Round:        g.round,
+		UsedHandcuff: g.usedHandcuff,
+	}
+}
+
+// restore 由存档恢复对局, 等待肾上腺素选择的状态不会保留
+func (s *gameState) restore() *Game {
+	return &Game{
+		player1:      s.Player1.restore(),
+		player2:      s.Player2.restore(),
+		status:       s.Status,
+		bullet:       s.Bullet,
+		currentTurn:  s.CurrentTurn,
+		double:       s.Double,
+		round:        s.Round,
+		usedHandcuff: s.UsedHandcuff,
+	}
+}
+
+// saveGame 保存对局, 调用者需持有 game.mu
+func saveGame(gid int64, game *Game) error {
+	data, err := json.Marshal(game.state())
+	if err != nil {
+		return err
+	}
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.Insert("game", &savedGame{GID: gid, Data: string(data), Updated: time.Now().Unix()})
+}
+
+// removeSavedGame 删除对局存档
+func removeSavedGame(gid int64) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.Del("game", "WHERE gid = ?", gid)
+}
+
+// saveMuteConfig 保存本群禁言设置
+func saveMuteConfig(mc *MuteConfig) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.Insert("mute", mc)
+}
+
+// recordMatch 记录一局结果
+func recordMatch(gid int64, winner, loser *Player, rounds int) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.Insert("match", &matchRecord{
+		ID:         time.Now().UnixNano(),
+		GID:        gid,
+		WinnerID:   winner.id,
+		WinnerName: winner.name,
+		LoserID:    loser.id,
+		LoserName:  loser.name,
+		Rounds:     rounds,
+	})
+}
+
+// recordItemUse 道具使用次数加一
+func recordItemUse(gid, uid int64, item string) error {
+	id := strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10) + "_" + item
+	bdb.Lock()
+	defer bdb.Unlock()
+	u := &itemUsage{}
+	if bdb.Find("item", u, "WHERE id = ?", id) != nil {
+		u = &itemUsage{ID: id, GID: gid, UID: uid, Item: item}
+	}
+	u.Count++
+	return bdb.Insert("item", u)
+}
+
+// getPlayerStat 玩家的总胜负
+func getPlayerStat(uid int64) (*playerStat, error) {
+	bdb.RLock()
+	defer bdb.RUnlock()
+	st, err := sql.Query[playerStat](&bdb.Sqlite,
+		"SELECT ?, '', (SELECT COUNT(1) FROM [match] WHERE winner = ?), (SELECT COUNT(1) FROM [match] WHERE loser = ?);",
+		uid, uid, uid)
+	return &st, err
+}
+
+// getTopItems 最常用的道具, gid 为 0 时不限频道, uid 为 0 时不限玩家
+func getTopItems(gid, uid int64, limit int) ([]*itemStat, error) {
+	q := "SELECT item, SUM(count) AS total FROM [item] WHERE 1"
+	args := make([]any, 0, 3)
+	if gid != 0 {
+		q += " AND gid = ?"
+		args = append(args, gid)
+	}
+	if uid != 0 {
+		q += " AND uid = ?"
+		args = append(args, uid)
+	}
+	q += " GROUP BY item ORDER BY total DESC LIMIT ?;"
+	args = append(args, limit)
+	bdb.RLock()
+	defer bdb.RUnlock()
+	items, err := sql.QueryAll[itemStat](&bdb.Sqlite, q, args...)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return items, err
+}
+
+// getLeaderboard 本群胜场排行
+func getLeaderboard(gid int64, limit int) ([]*playerStat, error) {
+	bdb.RLock()
+	defer bdb.RUnlock()
+	stats, err := sql.QueryAll[playerStat](&bdb.Sqlite, `SELECT uid, MAX(name), SUM(w), SUM(l) FROM (
+	SELECT winner AS uid, wname AS name, 1 AS w, 0 AS l FROM [match] WHERE gid = ?
+	UNION ALL
+	SELECT loser AS uid, lname AS name, 0 AS w, 1 AS l FROM [match] WHERE gid = ?
+) GROUP BY uid ORDER BY SUM(w) DESC, SUM(l) ASC LIMIT ?;`, gid, gid, limit)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return stats, err
+}
@@ -28,8 +28,9 @@ type Game struct {
 }
 
 type MuteConfig struct {
-	enabled  bool
-	duration int
+	GID      int64 `db:"gid"`
+	Enabled  bool  `db:"enabled"`
+	Duration int   `db:"duration"`
 }
 
 var (
@@ -37,7 +38,7 @@ var (
 	gamesMutex          sync.RWMutex
 	dontDispose         = make(map[int64]func())
 	epinephrineTimeouts = make(map[int64]chan struct{})
-	muteConfig          = MuteConfig{enabled: false, duration: 0}
+	muteConfigs         = make(map[int64]MuteConfig)
 	muteConfigMutex     sync.RWMutex
 )
 
@@ -74,6 +75,7 @@ func deleteGame(gid int64) {
 	gamesMutex.Lock()
 	defer gamesMutex.Unlock()
 	delete(games, gid)
+	_ = removeSavedGame(gid)
 }
 
 func getChannelIDFromEvent(groupID, userID int64) int64 {
@@ -83,15 +85,19 @@ func getChannelIDFromEvent(groupID, userID int64) int64 {
 	return groupID
 }
 
-func getMuteConfig() MuteConfig {
+func getMuteConfig(gid int64) MuteConfig {
 	muteConfigMutex.RLock()
 	defer muteConfigMutex.RUnlock()
-	return muteConfig
+	return muteConfigs[gid]
 }
 
-func setMuteConfig(enabled bool, duration int) {
+func setMuteConfig(gid int64, enabled bool, duration int) error {
 	muteConfigMutex.Lock()
 	defer muteConfigMutex.Unlock()
-	muteConfig.enabled = enabled
-	muteConfig.duration = duration
+	mc := MuteConfig{GID: gid, Enabled: enabled, Duration: duration}
+	if err := saveMuteConfig(&mc); err != nil {
+		return err
+	}
+	muteConfigs[gid] = mc
+	return nil
 }
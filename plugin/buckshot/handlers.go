@@ -22,6 +22,9 @@ func handleCreateGame(ctx *zero.Ctx) {
 			status: "waiting",
 		}
 		setGame(gid, newGame)
+		if err := saveGame(gid, newGame); err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+		}
 		ctx.SendChain(message.Text("══恶魔轮盘══\n游戏创建成功\n玩家1：", ctx.CardOrNickName(ctx.Event.UserID), "(", ctx.Event.UserID, ")\n玩家2：等待中\n发送\"恶魔轮盘.加入游戏\"以加入游戏"))
 	} else if game.status == "waiting" {
 		ctx.SendChain(message.Text("══恶魔轮盘══\n当前频道已有游戏正在等待玩家\n发送\"恶魔轮盘.加入游戏\"以加入游戏"))
@@ -57,6 +60,9 @@ func handleJoinGame(ctx *zero.Ctx) {
 		hp:   6,
 	}
 	game.status = "full"
+	if err := saveGame(gid, game); err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+	}
 	ctx.SendChain(message.Text("══恶魔轮盘══\n游戏开始\n玩家1：", game.player1.name, "(", game.player1.id, ")\n玩家2：", ctx.CardOrNickName(ctx.Event.UserID), "(", ctx.Event.UserID, ")\n由玩家1@", game.player1.id, "发送\"恶魔轮盘.开始游戏\"以开始游戏"))
 }
 
@@ -90,6 +96,9 @@ func handleStartGame(ctx *zero.Ctx) {
 	for i := 0; i < itemCount; i++ {
 		game.getPlayer(3 - game.currentTurn).items = append(game.getPlayer(3-game.currentTurn).items, getRandomItem(game.round))
 	}
+	if err := saveGame(gid, game); err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+	}
 	firstPlayer := game.getPlayer(game.currentTurn)
 	ctx.SendChain(message.Text("══恶魔轮盘══\n游戏开始\n玩家1：@", game.player1.id, "\n玩家2：@", game.player2.id, "\n@", firstPlayer.id, "先手\n先手方获得", strconv.Itoa(itemCount-1), "个道具，后手方获得", strconv.Itoa(itemCount), "个道具\n枪内目前有", strconv.Itoa(countBullets(game.bullet, "实弹")), "发实弹和", strconv.Itoa(countBullets(game.bullet, "空包弹")), "发空包弹\n发送\"恶魔轮盘.对战信息\"以查看当前对战的游戏信息（如血量，道具等）"))
 }
@@ -209,11 +218,7 @@ func handleShoot(ctx *zero.Ctx) {
 			result += "你损失了" + strconv.Itoa(damage) + "点生命值"
 			if player.hp <= 0 {
 				dead = true
-				deleteGame(gid)
-				muteConfig := getMuteConfig()
-				if muteConfig.enabled && ctx.Event.GroupID != 0 {
-					ctx.SetGroupBan(ctx.Event.GroupID, player.id, int64(muteConfig.duration*60))
-				}
+				settleGame(ctx, gid, game, player, game.getPlayer(3-game.currentTurn))
 				ctx.SendChain(message.Text(result), message.Text("\n══恶魔轮盘══\n@", player.id, "倒在了桌前\n@", game.getPlayer(3-game.currentTurn).id, "获得了胜利\n游戏结束"))
 				return
 			}
@@ -223,11 +228,7 @@ func handleShoot(ctx *zero.Ctx) {
 			result += "对方损失了" + strconv.Itoa(damage) + "点生命值"
 			if other.hp <= 0 {
 				dead = true
-				deleteGame(gid)
-				muteConfig := getMuteConfig()
-				if muteConfig.enabled && ctx.Event.GroupID != 0 {
-					ctx.SetGroupBan(ctx.Event.GroupID, other.id, int64(muteConfig.duration*60))
-				}
+				settleGame(ctx, gid, game, other, game.getPlayer(game.currentTurn))
 				ctx.SendChain(message.Text(result), message.Text("\n══恶魔轮盘══\n@", other.id, "倒在了桌前\n@", game.getPlayer(game.currentTurn).id, "获得了胜利\n游戏结束"))
 				return
 			}
@@ -256,6 +257,9 @@ func handleShoot(ctx *zero.Ctx) {
 			}
 		}
 		game.double = false
+		if err := saveGame(gid, game); err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+		}
 	}
 }
 
@@ -311,17 +315,17 @@ func handleUseItem(ctx *zero.Ctx) {
 				success, result := item.use(game, game.waitingPlayer, itemList)
 				if success {
 					otherPlayer.removeItem(msg)
+					_ = recordItemUse(gid, waitingPlayer.id, msg)
+				}
+				if otherPlayer.hp > 0 {
+					_ = saveGame(gid, game)
 				}
 				game.mu.Unlock()
 				for _, r := range result {
 					ctx.SendChain(message.Text(r))
 				}
 				if otherPlayer.hp <= 0 {
-					deleteGame(gid)
-					muteConfig := getMuteConfig()
-					if muteConfig.enabled && ctx.Event.GroupID != 0 {
-						ctx.SetGroupBan(ctx.Event.GroupID, otherPlayer.id, int64(muteConfig.duration*60))
-					}
+					settleGame(ctx, gid, game, otherPlayer, waitingPlayer)
 					ctx.SendChain(message.Text("\n══恶魔轮盘══\n@", otherPlayer.id, "倒在了桌前\n@", waitingPlayer.id, "获得了胜利\n游戏结束"))
 				}
 				return
@@ -355,6 +359,8 @@ func handleUseItem(ctx *zero.Ctx) {
 
 	if msg == "肾上腺素" {
 		player.removeItem(msg)
+		_ = recordItemUse(gid, player.id, msg)
+		_ = saveGame(gid, game)
 		game.waitingForItem = true
 		game.waitingPlayer = game.currentTurn
 		initialTurn := game.currentTurn
@@ -393,17 +399,17 @@ func handleUseItem(ctx *zero.Ctx) {
 		success, result := item.use(game, game.currentTurn, itemList)
 		if success {
 			player.removeItem(msg)
+			_ = recordItemUse(gid, player.id, msg)
+		}
+		if player.hp > 0 {
+			_ = saveGame(gid, game)
 		}
 		game.mu.Unlock()
 		for _, r := range result {
 			ctx.SendChain(message.Text(r))
 		}
 		if player.hp <= 0 {
-			deleteGame(gid)
-			muteConfig := getMuteConfig()
-			if muteConfig.enabled && ctx.Event.GroupID != 0 {
-				ctx.SetGroupBan(ctx.Event.GroupID, player.id, int64(muteConfig.duration*60))
-			}
+			settleGame(ctx, gid, game, player, game.getPlayer(3-game.currentTurn))
 			ctx.SendChain(message.Text("\n══恶魔轮盘══\n@", player.id, "倒在了桌前\n@", game.getPlayer(3-game.currentTurn).id, "获得了胜利\n游戏结束"))
 		}
 		return
@@ -411,6 +417,18 @@ func handleUseItem(ctx *zero.Ctx) {
 	game.mu.Unlock()
 }
 
+// settleGame 结算一局: 删除对局, 按本群设置禁言输家, 并记录战绩
+func settleGame(ctx *zero.Ctx, gid int64, game *Game, loser, winner *Player) {
+	deleteGame(gid)
+	muteConfig := getMuteConfig(ctx.Event.GroupID)
+	if muteConfig.Enabled && ctx.Event.GroupID != 0 {
+		ctx.SetGroupBan(ctx.Event.GroupID, loser.id, int64(muteConfig.Duration*60))
+	}
+	if err := recordMatch(gid, winner, loser, game.round+1); err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+	}
+}
+
 func isCurrentPlayer(game *Game, ctx *zero.Ctx) bool {
 	game.mu.Lock()
 	defer game.mu.Unlock()
@@ -452,18 +470,24 @@ func handleSetMuteConfig(ctx *zero.Ctx) {
 					}
 				}
 			}
-			setMuteConfig(true, duration)
+			if err := setMuteConfig(ctx.Event.GroupID, true, duration); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
 			ctx.SendChain(message.Text("══恶魔轮盘══\n禁言惩罚已开启，输家将被禁言", strconv.Itoa(duration), "秒"))
 		} else if strings.Contains(msgStr, "关闭") {
-			setMuteConfig(false, 0)
+			if err := setMuteConfig(ctx.Event.GroupID, false, 0); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
 			ctx.SendChain(message.Text("══恶魔轮盘══\n禁言惩罚已关闭"))
 		}
 	} else if strings.Contains(msgStr, "恶魔轮盘.禁言设置") {
-		config := getMuteConfig()
+		config := getMuteConfig(ctx.Event.GroupID)
 		status := "关闭"
-		if config.enabled {
+		if config.Enabled {
 			status = "开启"
 		}
-		ctx.SendChain(message.Text("══恶魔轮盘══\n当前禁言设置：", status, "\n禁言时长：", strconv.Itoa(config.duration), "秒\n\n使用\"恶魔轮盘.设置禁言开启 [时长]\"开启禁言\n使用\"恶魔轮盘.设置禁言关闭\"关闭禁言"))
+		ctx.SendChain(message.Text("══恶魔轮盘══\n当前禁言设置：", status, "\n禁言时长：", strconv.Itoa(config.Duration), "秒\n\n使用\"恶魔轮盘.设置禁言开启 [时长]\"开启禁言\n使用\"恶魔轮盘.设置禁言关闭\"关闭禁言"))
 	}
 }
@@ -0,0 +1,81 @@
+package buckshot
+
+import (
+	"strconv"
+	"strings"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	leaderboardSize = 10
+	topItemsSize    = 3
+)
+
+func handleRecord(ctx *zero.Ctx) {
+	uid := ctx.Event.UserID
+	if matched := ctx.State["regex_matched"].([]string); matched[1] != "" {
+		uid, _ = strconv.ParseInt(matched[1], 10, 64)
+	}
+	st, err := getPlayerStat(uid)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	items, err := getTopItems(0, uid, topItemsSize)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	var result strings.Builder
+	result.WriteString("══恶魔轮盘══\n" + ctx.CardOrNickName(uid) + "(" + strconv.FormatInt(uid, 10) + ")的战绩\n")
+	total := st.Wins + st.Losses
+	if total == 0 {
+		result.WriteString("还没有完成过对局")
+		ctx.SendChain(message.Text(result.String()))
+		return
+	}
+	result.WriteString("胜场：" + strconv.FormatInt(st.Wins, 10) + "\n")
+	result.WriteString("败场：" + strconv.FormatInt(st.Losses, 10) + "\n")
+	result.WriteString("胜率：" + strconv.FormatFloat(float64(st.Wins)*100/float64(total), 'f', 1, 64) + "%\n")
+	result.WriteString("最常用的道具：" + formatItemStats(items))
+	ctx.SendChain(message.Text(result.String()))
+}
+
+func handleLeaderboard(ctx *zero.Ctx) {
+	gid := ctx.Event.GroupID
+	stats, err := getLeaderboard(gid, leaderboardSize)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	if len(stats) == 0 {
+		ctx.SendChain(message.Text("══恶魔轮盘══\n本群还没有完成过对局"))
+		return
+	}
+	items, err := getTopItems(gid, 0, topItemsSize)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	var result strings.Builder
+	result.WriteString("══恶魔轮盘══\n--本群排行榜--\n")
+	for i, st := range stats {
+		result.WriteString(strconv.Itoa(i+1) + ". " + st.Name + "(" + strconv.FormatInt(st.UID, 10) + ")：" +
+			strconv.FormatInt(st.Wins, 10) + "胜" + strconv.FormatInt(st.Losses, 10) + "负\n")
+	}
+	result.WriteString("\n--本群最常用的道具--\n" + formatItemStats(items))
+	ctx.SendChain(message.Text(result.String()))
+}
+
+func formatItemStats(items []*itemStat) string {
+	if len(items) == 0 {
+		return "无"
+	}
+	s := make([]string, len(items))
+	for i, it := range items {
+		s[i] = it.Item + "(" + strconv.FormatInt(it.Count, 10) + "次)"
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,181 @@
+package chatcount
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/golang/freetype"
+	"github.com/wcharczuk/go-chart/v2"
+)
+
+const (
+	heatCell    = 28.0
+	heatMarginL = 120.0
+	heatMarginT = 110.0
+	heatMarginR = 30.0
+	heatMarginB = 40.0
+)
+
+// axisMax 坐标轴上限, 数据全为 0 时也保证范围不为空
+func axisMax(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	return math.Ceil(v*1.1) + 1
+}
+
+// intFormatter 坐标轴刻度取整
+func intFormatter(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(math.Round(f), 'f', 0, 64)
+	}
+	return ""
+}
+
+// drawTrend 绘制每日消息数与水群时长(分钟)的折线图
+func drawTrend(title string, trend []dayStat) ([]byte, error) {
+	b, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	font, err := freetype.ParseFont(b)
+	if err != nil {
+		return nil, err
+	}
+	xs := make([]float64, len(trend))
+	msgs := make([]float64, len(trend))
+	mins := make([]float64, len(trend))
+	ticks := make([]chart.Tick, 0, len(trend))
+	step := (len(trend) + 9) / 10
+	var maxMsg, maxMin float64
+	for i, d := range trend {
+		xs[i] = float64(i)
+		msgs[i] = float64(d.Message)
+		mins[i] = float64(d.Time) / 60
+		maxMsg = math.Max(maxMsg, msgs[i])
+		maxMin = math.Max(maxMin, mins[i])
+		if i%step == 0 || i == len(trend)-1 {
+			ticks = append(ticks, chart.Tick{Value: xs[i], Label: d.Day[5:]})
+		}
+	}
+	graph := chart.Chart{
+		Font:   font,
+		Title:  title,
+		Width:  1000,
+		Height: 500,
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:  60,
+				Left: 20,
+			},
+		},
+		XAxis: chart.XAxis{
+			Ticks: ticks,
+		},
+		YAxis: chart.YAxis{
+			Name:           "消息数",
+			Range:          &chart.ContinuousRange{Min: 0, Max: axisMax(maxMsg)},
+			ValueFormatter: intFormatter,
+		},
+		YAxisSecondary: chart.YAxis{
+			Name:           "时长(分)",
+			Range:          &chart.ContinuousRange{Min: 0, Max: axisMax(maxMin)},
+			ValueFormatter: intFormatter,
+		},
+		Series: []chart.Series{
+			chart.ContinuousSeries{
+				Name:    "消息数",
+				XValues: xs,
+				YValues: msgs,
+				Style: chart.Style{
+					StrokeColor: chart.ColorBlue,
+					StrokeWidth: 3,
+					DotColor:    chart.ColorBlue,
+					DotWidth:    4,
+				},
+			},
+			chart.ContinuousSeries{
+				Name:    "时长(分)",
+				YAxis:   chart.YAxisSecondary,
+				XValues: xs,
+				YValues: mins,
+				Style: chart.Style{
+					StrokeColor: chart.ColorOrange,
+					StrokeWidth: 3,
+					DotColor:    chart.ColorOrange,
+					DotWidth:    4,
+				},
+			},
+		},
+	}
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+	var buf bytes.Buffer
+	err = graph.Render(chart.PNG, &buf)
+	return buf.Bytes(), err
+}
+
+// drawHeatmap 绘制每天每小时消息数的热力图
+func drawHeatmap(title string, dates []string, counts [][24]int64) (image.Image, error) {
+	b, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	var peak int64
+	for _, row := range counts {
+		for _, n := range row {
+			if n > peak {
+				peak = n
+			}
+		}
+	}
+	w := heatMarginL + 24*heatCell + heatMarginR
+	h := heatMarginT + float64(len(dates))*heatCell + heatMarginB
+	canvas := gg.NewContext(int(w), int(h))
+	canvas.SetRGB(1, 1, 1)
+	canvas.Clear()
+
+	if err = canvas.ParseFontFace(b, 28); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB(0.2, 0.2, 0.2)
+	canvas.DrawStringAnchored(title, w/2, 40, 0.5, 0.5)
+
+	if err = canvas.ParseFontFace(b, 14); err != nil {
+		return nil, err
+	}
+	canvas.DrawStringAnchored("峰值 "+strconv.FormatInt(peak, 10)+" 条/小时", w-heatMarginR, 72, 1, 0.5)
+	for hour := 0; hour < 24; hour += 2 {
+		canvas.DrawStringAnchored(strconv.Itoa(hour), heatMarginL+(float64(hour)+0.5)*heatCell, heatMarginT-14, 0.5, 0.5)
+	}
+	for i, day := range dates {
+		y := heatMarginT + float64(i)*heatCell
+		canvas.SetRGB(0.2, 0.2, 0.2)
+		canvas.DrawStringAnchored(day, heatMarginL-10, y+heatCell/2, 1, 0.5)
+		for hour, n := range counts[i] {
+			canvas.SetColor(heatColor(n, peak))
+			canvas.DrawRectangle(heatMarginL+float64(hour)*heatCell+1, y+1, heatCell-2, heatCell-2)
+			canvas.Fill()
+		}
+	}
+	return canvas.Image(), nil
+}
+
+// heatColor 消息越多颜色越深, 没有消息时为浅灰
+func heatColor(n, peak int64) color.RGBA {
+	if n == 0 || peak == 0 {
+		return color.RGBA{R: 235, G: 237, B: 240, A: 255}
+	}
+	// 取平方根, 避免少数高峰让其余时段都接近白色
+	t := math.Sqrt(float64(n) / float64(peak))
+	lerp := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*t)
+	}
+	return color.RGBA{R: lerp(198, 33), G: lerp(228, 110), B: lerp(139, 57), A: 255}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
@@ -26,13 +27,16 @@ const (
 
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
-		DisableOnDefault:  false,
-		Brief:             "聊天时长统计",
-		Help:              "- 查询水群@xxx\n- 查看水群排名",
+		DisableOnDefault: false,
+		Brief:            "聊天时长统计",
+		Help: "- 查询水群@xxx\n- 查看水群排名\n" +
+			"- 水群趋势 [@xxx] [7|30]天 (不@时为全群, 默认7天)\n" +
+			"- 水群热力图 [7|30]天 (默认7天)",
 		PrivateDataFolder: "chatcount",
 	})
 	go func() {
 		ctdb = initialize(engine.DataFolder() + "chatcount.db")
+		ctdb.runFlush()
 	}()
 	engine.OnMessage(zero.OnlyGroup).SetBlock(false).
 		Handle(func(ctx *zero.Ctx) {
@@ -105,4 +109,65 @@ func init() {
 				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
 			}
 		})
+	engine.OnRegex(`^水群趋势\s*(?:\[CQ:at,qq=(\d+)\])?\s*(?:(7|30)天)?$`, zero.OnlyGroup).Limit(ctxext.LimitByGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			uid, _ := strconv.ParseInt(matched[1], 10, 64)
+			days := trendDays(matched[2])
+			trend, err := ctdb.getTrend(ctx.Event.GroupID, uid, days, time.Now())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			var total int64
+			for _, d := range trend {
+				total += d.Message
+			}
+			if total == 0 {
+				ctx.SendChain(message.Text("ERROR: 没有水群数据"))
+				return
+			}
+			title := fmt.Sprintf("本群近%d天水群趋势", days)
+			if uid != 0 {
+				title = fmt.Sprintf("%s近%d天水群趋势", ctx.CardOrNickName(uid), days)
+			}
+			sendimg, err := drawTrend(title, trend)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if id := ctx.SendChain(message.ImageBytes(sendimg)); id.ID() == 0 {
+				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			}
+		})
+	engine.OnRegex(`^水群热力图\s*(?:(7|30)天)?$`, zero.OnlyGroup).Limit(ctxext.LimitByGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			days := trendDays(ctx.State["regex_matched"].([]string)[1])
+			dates, counts, err := ctdb.getHeatmap(ctx.Event.GroupID, days, time.Now())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			img, err := drawHeatmap(fmt.Sprintf("本群近%d天每小时消息数", days), dates, counts)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			sendimg, err := imgfactory.ToBytes(img)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if id := ctx.SendChain(message.ImageBytes(sendimg)); id.ID() == 0 {
+				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			}
+		})
+}
+
+// trendDays 统计天数, 默认 7 天
+func trendDays(s string) int {
+	if s == "30" {
+		return 30
+	}
+	return 7
 }
@@ -0,0 +1,254 @@
+package chatcount
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dayLayout     = "2006-01-02"
+	flushInterval = 5 * time.Minute
+	// hourlyKeepDays 按小时统计的保留天数
+	hourlyKeepDays = 60
+)
+
+// chatDaily 每人每天的聊天时长与消息数，时间的单位是秒
+type chatDaily struct {
+	ID      uint   `gorm:"primary_key"`
+	GroupID int64  `gorm:"column:group_id;unique_index:idx_chat_daily"`
+	UserID  int64  `gorm:"column:user_id;unique_index:idx_chat_daily"`
+	Day     string `gorm:"column:day;unique_index:idx_chat_daily"`
+	Time    int64  `gorm:"column:time;default:0"`
+	Message int64  `gorm:"column:message;default:0"`
+	// LastAt 当天最后一次发言的时间戳
+	LastAt int64 `gorm:"column:last_at;default:0"`
+	// Folded 是否已计入 chat_time 的总计
+	Folded bool `gorm:"column:folded;default:false"`
+}
+
+// TableName 表名
+func (chatDaily) TableName() string {
+	return "chat_daily"
+}
+
+// chatHourly 每群每小时的消息数
+type chatHourly struct {
+	ID      uint   `gorm:"primary_key"`
+	GroupID int64  `gorm:"column:group_id;unique_index:idx_chat_hourly"`
+	Day     string `gorm:"column:day;unique_index:idx_chat_hourly"`
+	Hour    int    `gorm:"column:hour;unique_index:idx_chat_hourly"`
+	Message int64  `gorm:"column:message;default:0"`
+}
+
+// TableName 表名
+func (chatHourly) TableName() string {
+	return "chat_hourly"
+}
+
+// hourKey 按小时统计的内存缓存 key
+type hourKey struct {
+	gid  int64
+	day  string
+	hour int
+}
+
+// dayStat 一天的统计
+type dayStat struct {
+	Day     string
+	Time    int64
+	Message int64
+}
+
+// splitKey 拆分 groupID_userID
+func splitKey(key string) (gid, uid int64) {
+	a, b, _ := strings.Cut(key, "_")
+	gid, _ = strconv.ParseInt(a, 10, 64)
+	uid, _ = strconv.ParseInt(b, 10, 64)
+	return
+}
+
+// restore 恢复今天已落盘的数据, 并把之前未计入总计的日统计计入 chat_time
+func (ctdb *chattimedb) restore(now time.Time) error {
+	ctdb.chatmu.Lock()
+	defer ctdb.chatmu.Unlock()
+	today := now.Format(dayLayout)
+	var rows []chatDaily
+	err := ctdb.db.Where("folded = ?", false).Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		d := &rows[i]
+		if d.Day == today {
+			keyword := strconv.FormatInt(d.GroupID, 10) + "_" + strconv.FormatInt(d.UserID, 10)
+			ctdb.userTimestampMap.Store(keyword, d.LastAt)
+			ctdb.userTodayTimeMap.Store(keyword, d.Time)
+			ctdb.userTodayMessageMap.Store(keyword, d.Message)
+			continue
+		}
+		err = ctdb.fold(d)
+		if err != nil {
+			return err
+		}
+	}
+	return ctdb.db.Where("day < ?", now.AddDate(0, 0, -hourlyKeepDays).Format(dayLayout)).Delete(&chatHourly{}).Error
+}
+
+// fold 把一天的统计计入 chat_time 的总计, 并标记为已计入, 调用者需持有 chatmu
+func (ctdb *chattimedb) fold(d *chatDaily) error {
+	db := ctdb.db
+	st := chatTime{
+		GroupID:      d.GroupID,
+		UserID:       d.UserID,
+		TotalTime:    d.Time,
+		TotalMessage: d.Message,
+	}
+	if err := db.Model(&st).Where("group_id = ? and user_id = ?", d.GroupID, d.UserID).First(&st).Error; err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+		if err = db.Model(&st).Create(&st).Error; err != nil {
+			return err
+		}
+	} else {
+		err = db.Model(&st).Where("group_id = ? and user_id = ?", d.GroupID, d.UserID).Update(
+			map[string]any{
+				"total_time":    st.TotalTime + d.Time,
+				"total_message": st.TotalMessage + d.Message,
+			}).Error
+		if err != nil {
+			return err
+		}
+	}
+	d.Folded = true
+	return saveDaily(db, d)
+}
+
+// saveDaily 写入一天的统计
+func saveDaily(db *gorm.DB, d *chatDaily) error {
+	return db.Where(chatDaily{GroupID: d.GroupID, UserID: d.UserID, Day: d.Day}).
+		Assign(map[string]any{
+			"time":    d.Time,
+			"message": d.Message,
+			"last_at": d.LastAt,
+			"folded":  d.Folded,
+		}).FirstOrCreate(&chatDaily{}).Error
+}
+
+// flush 把内存中今天的统计与按小时的消息数写入数据库
+func (ctdb *chattimedb) flush() error {
+	ctdb.chatmu.Lock()
+	defer ctdb.chatmu.Unlock()
+	if len(ctdb.dirty) == 0 && len(ctdb.hourly) == 0 {
+		return nil
+	}
+	tx := ctdb.db.Begin()
+	for keyword := range ctdb.dirty {
+		ts, ok := ctdb.userTimestampMap.Load(keyword)
+		if !ok {
+			continue
+		}
+		gid, uid := splitKey(keyword)
+		todayTime, _ := ctdb.userTodayTimeMap.Load(keyword)
+		todayMessage, _ := ctdb.userTodayMessageMap.Load(keyword)
+		err := saveDaily(tx, &chatDaily{
+			GroupID: gid,
+			UserID:  uid,
+			Day:     time.Unix(ts, 0).Format(dayLayout),
+			Time:    todayTime,
+			Message: todayMessage,
+			LastAt:  ts,
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for k, n := range ctdb.hourly {
+		h := chatHourly{}
+		err := tx.Where(chatHourly{GroupID: k.gid, Day: k.day, Hour: k.hour}).
+			Attrs(chatHourly{Message: 0}).FirstOrCreate(&h).Error
+		if err == nil {
+			err = tx.Model(&h).UpdateColumn("message", gorm.Expr("message + ?", n)).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	ctdb.dirty = make(map[string]struct{}, len(ctdb.dirty))
+	ctdb.hourly = make(map[hourKey]int64, len(ctdb.hourly))
+	return nil
+}
+
+// runFlush 定时落盘
+func (ctdb *chattimedb) runFlush() {
+	for range time.NewTicker(flushInterval).C {
+		if err := ctdb.flush(); err != nil {
+			logrus.Warnln("[chatcount] 保存水群数据失败:", err)
+		}
+	}
+}
+
+// getTrend 获得最近 days 天每天的统计, uid 为 0 时统计全群, 没有数据的日期补 0
+func (ctdb *chattimedb) getTrend(gid, uid int64, days int, now time.Time) ([]dayStat, error) {
+	if err := ctdb.flush(); err != nil {
+		return nil, err
+	}
+	since := now.AddDate(0, 0, 1-days).Format(dayLayout)
+	db := ctdb.db.Model(&chatDaily{}).
+		Select("day, SUM(time) AS time, SUM(message) AS message").
+		Where("group_id = ? AND day >= ?", gid, since)
+	if uid != 0 {
+		db = db.Where("user_id = ?", uid)
+	}
+	var rows []dayStat
+	err := db.Group("day").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]dayStat, len(rows))
+	for _, r := range rows {
+		m[r.Day] = r
+	}
+	trend := make([]dayStat, days)
+	for i := range trend {
+		day := now.AddDate(0, 0, i+1-days).Format(dayLayout)
+		trend[i] = m[day]
+		trend[i].Day = day
+	}
+	return trend, nil
+}
+
+// getHeatmap 获得最近 days 天每小时的消息数, 第一维为日期, 第二维为小时
+func (ctdb *chattimedb) getHeatmap(gid int64, days int, now time.Time) (dates []string, counts [][24]int64, err error) {
+	if err = ctdb.flush(); err != nil {
+		return
+	}
+	since := now.AddDate(0, 0, 1-days).Format(dayLayout)
+	var rows []chatHourly
+	err = ctdb.db.Where("group_id = ? AND day >= ?", gid, since).Find(&rows).Error
+	if err != nil {
+		return
+	}
+	dates = make([]string, days)
+	index := make(map[string]int, days)
+	for i := range dates {
+		dates[i] = now.AddDate(0, 0, i+1-days).Format(dayLayout)
+		index[dates[i]] = i
+	}
+	counts = make([][24]int64, days)
+	for _, r := range rows {
+		if i, ok := index[r.Day]; ok && r.Hour >= 0 && r.Hour < 24 {
+			counts[i][r.Hour] += r.Message
+		}
+	}
+	return
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/RomiChan/syncx"
+	"github.com/sirupsen/logrus"
 
 	"github.com/jinzhu/gorm"
 )
@@ -33,6 +34,10 @@ type chattimedb struct {
 	userTodayTimeMap syncx.Map[string, int64]
 	// ctdb.userTodayMessageMap 每个人今日水群次数 key=groupID_userID
 	userTodayMessageMap syncx.Map[string, int64]
+	// dirty 上次落盘后有变化的 key=groupID_userID
+	dirty map[string]struct{}
+	// hourly 上次落盘后每群每小时新增的消息数
+	hourly map[hourKey]int64
 	// db 数据库
 	db *gorm.DB
 	// chatmu 读写添加锁
@@ -54,10 +59,16 @@ func initialize(dbpath string) *chattimedb {
 	if err != nil {
 		panic(err)
 	}
-	gdb.AutoMigrate(&chatTime{})
-	return &chattimedb{
-		db: gdb,
+	gdb.AutoMigrate(&chatTime{}, &chatDaily{}, &chatHourly{})
+	ctdb := &chattimedb{
+		dirty:  make(map[string]struct{}, 64),
+		hourly: make(map[hourKey]int64, 64),
+		db:     gdb,
 	}
+	if err = ctdb.restore(time.Now()); err != nil {
+		panic(err)
+	}
+	return ctdb
 }
 
 // Close 关闭
@@ -86,9 +97,10 @@ func (chatTime) TableName() string {
 func (ctdb *chattimedb) updateChatTime(gid, uid int64) (remindTime int64, remindFlag bool) {
 	ctdb.chatmu.Lock()
 	defer ctdb.chatmu.Unlock()
-	db := ctdb.db
 	now := time.Now()
 	keyword := fmt.Sprintf("%v_%v", gid, uid)
+	ctdb.dirty[keyword] = struct{}{}
+	ctdb.hourly[hourKey{gid: gid, day: now.Format(dayLayout), hour: now.Hour()}]++
 	ts, ok := ctdb.userTimestampMap.Load(keyword)
 	if !ok {
 		ctdb.userTimestampMap.Store(keyword, now.Unix())
@@ -98,33 +110,27 @@ func (ctdb *chattimedb) updateChatTime(gid, uid int64) (remindTime int64, remind
 	lastTime := time.Unix(ts, 0)
 	todayTime, _ := ctdb.userTodayTimeMap.Load(keyword)
 	totayMessage, _ := ctdb.userTodayMessageMap.Load(keyword)
-	// 这个消息数是必须统计的
-	ctdb.userTodayMessageMap.Store(keyword, totayMessage+1)
-	st := chatTime{
-		GroupID:      gid,
-		UserID:       uid,
-		TotalTime:    todayTime,
-		TotalMessage: totayMessage,
-	}
 
-	// 如果不是同一天，把TotalTime,TotalMessage重置
-	if lastTime.YearDay() != now.YearDay() {
-		if err := db.Model(&st).Where("group_id = ? and user_id = ?", gid, uid).First(&st).Error; err != nil {
-			if gorm.IsRecordNotFoundError(err) {
-				db.Model(&st).Create(&st)
-			}
-		} else {
-			db.Model(&st).Where("group_id = ? and user_id = ?", gid, uid).Update(
-				map[string]any{
-					"total_time":    st.TotalTime + todayTime,
-					"total_message": st.TotalMessage + totayMessage,
-				})
+	// 如果不是同一天，把前一天的数据计入总计，再从这条消息开始重新统计
+	if lastTime.Format(dayLayout) != now.Format(dayLayout) {
+		err := ctdb.fold(&chatDaily{
+			GroupID: gid,
+			UserID:  uid,
+			Day:     lastTime.Format(dayLayout),
+			Time:    todayTime,
+			Message: totayMessage,
+			LastAt:  ts,
+		})
+		if err != nil {
+			logrus.Warnln("[chatcount] 保存水群数据失败:", err)
 		}
 		ctdb.userTimestampMap.Store(keyword, now.Unix())
 		ctdb.userTodayTimeMap.Delete(keyword)
-		ctdb.userTodayMessageMap.Delete(keyword)
+		ctdb.userTodayMessageMap.Store(keyword, 1)
 		return
 	}
+	// 这个消息数是必须统计的
+	ctdb.userTodayMessageMap.Store(keyword, totayMessage+1)
 
 	userChatTime := int64(now.Sub(lastTime).Seconds())
 	// 当聊天时间在一定范围内的话，则计入时长
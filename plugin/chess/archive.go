@@ -0,0 +1,192 @@
+package chess
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/FloatTech/imgfactory"
+	"github.com/jinzhu/gorm"
+	"github.com/notnil/chess"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	archivePageSize = 10
+	maxReplayPlies  = 200 // 复盘动图最多渲染的半回合数
+	replayDelay     = 100 // 复盘每帧间隔, 1=10毫秒
+	replayLastDelay = 400
+)
+
+var errArchiveNotFound = errors.New("没有找到该对局, 请检查对局编号。")
+
+// listArchive 分页列出用户参与过的对局
+func listArchive(uin int64, page int) (message.Message, error) {
+	if page < 1 {
+		page = 1
+	}
+	dbService := newDBService()
+	total, err := dbService.countPGNByUin(uin)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return message.Message{message.Text("没有查找到对局记录, 有效对局结束后会自动存档。")}, nil
+	}
+	pages := (total + archivePageSize - 1) / archivePageSize
+	if page > pages {
+		page = pages
+	}
+	pgnList, err := dbService.getPGNListByUin(uin, (page-1)*archivePageSize, archivePageSize)
+	if err != nil {
+		return nil, err
+	}
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString(fmt.Sprintf("玩家「%d」的对局记录 (第 %d/%d 页, 共 %d 局): \n\n", uin, page, pages, total))
+	for _, p := range pgnList {
+		result := "未知"
+		if game, err := parseArchive(p.Data); err == nil {
+			result = outcomeString(game.Outcome())
+		}
+		msgBuilder.WriteString(fmt.Sprintf("#%d %s %s vs %s %s\n", p.ID, p.CreatedAt.Format("2006-01-02 15:04"), p.WhiteName, p.BlackName, result))
+	}
+	msgBuilder.WriteString("\n发送「查看对局 #编号」查看详情, 「复盘 #编号」查看复盘动图。")
+	return message.Message{message.Text(msgBuilder.String())}, nil
+}
+
+// showArchive 查看对局详情
+func showArchive(id uint) (message.Message, error) {
+	p, err := getArchive(id)
+	if err != nil {
+		return nil, err
+	}
+	game, err := parseArchive(p.Data)
+	if err != nil {
+		return nil, err
+	}
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString(fmt.Sprintf("对局 #%d\n", p.ID))
+	msgBuilder.WriteString(fmt.Sprintf("时间: %s\n", p.CreatedAt.Format("2006-01-02 15:04:05")))
+	msgBuilder.WriteString(fmt.Sprintf("白方: %s (%d)\n", p.WhiteName, p.WhiteUin))
+	msgBuilder.WriteString(fmt.Sprintf("黑方: %s (%d)\n", p.BlackName, p.BlackUin))
+	msgBuilder.WriteString(fmt.Sprintf("结果: %s\n", outcomeString(game.Outcome())))
+	msgBuilder.WriteString(fmt.Sprintf("回合数: %d\n\n", (len(game.Moves())+1)/2))
+	msgBuilder.WriteString(moveText(p.Data))
+	return message.Message{message.Text(msgBuilder.String())}, nil
+}
+
+// exportArchive 将对局 PGN 写入临时文件, 返回文件路径与文件名
+func exportArchive(id uint) (filePath, fileName string, err error) {
+	p, err := getArchive(id)
+	if err != nil {
+		return
+	}
+	fileName = fmt.Sprintf("chess_%d.pgn", p.ID)
+	filePath = path.Join(tempFileDir, fileName)
+	err = os.WriteFile(filePath, []byte(p.Data), 0644)
+	return
+}
+
+// replayArchive 将对局逐步渲染为动图
+func replayArchive(id uint) (message.Message, error) {
+	p, err := getArchive(id)
+	if err != nil {
+		return nil, err
+	}
+	game, err := parseArchive(p.Data)
+	if err != nil {
+		return nil, err
+	}
+	positions := game.Positions()
+	moves := game.Moves()
+	truncated := len(moves) > maxReplayPlies
+	if truncated {
+		moves = moves[:maxReplayPlies]
+	}
+	frames := make([]boardFrame, 0, len(moves)+1)
+	frames = append(frames, boardFrame{board: positions[0].Board(), perspective: chess.White})
+	for i, m := range moves {
+		frames = append(frames, boardFrame{
+			board:       positions[i+1].Board(),
+			perspective: chess.White,
+			highlight:   []chess.Square{m.S1(), m.S2()},
+		})
+	}
+	pngs, err := renderBoards(frames, 1)
+	if err != nil {
+		return nil, err
+	}
+	g := &gif.GIF{
+		Image: make([]*image.Paletted, 0, len(pngs)),
+		Delay: make([]int, 0, len(pngs)),
+	}
+	for _, data := range pngs {
+		im, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		g.Image = append(g.Image, imgfactory.GetPaletted(im))
+		g.Delay = append(g.Delay, replayDelay)
+	}
+	g.Delay[len(g.Delay)-1] = replayLastDelay
+	var buf bytes.Buffer
+	if err = gif.EncodeAll(&buf, g); err != nil {
+		return nil, err
+	}
+	hint := fmt.Sprintf("对局 #%d 复盘: %s vs %s, %s", p.ID, p.WhiteName, p.BlackName, outcomeString(game.Outcome()))
+	if truncated {
+		hint += fmt.Sprintf(" (仅展示前 %d 步)", maxReplayPlies)
+	}
+	return message.Message{message.Text(hint), message.ImageBytes(buf.Bytes())}, nil
+}
+
+// getArchive 按编号获取对局存档
+func getArchive(id uint) (pgn, error) {
+	p, err := newDBService().getPGNByID(id)
+	if err == gorm.ErrRecordNotFound {
+		err = errArchiveNotFound
+	}
+	return p, err
+}
+
+// parseArchive 解析存档中的 PGN
+func parseArchive(data string) (*chess.Game, error) {
+	opt, err := chess.PGN(strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(opt), nil
+}
+
+// moveText 去除 PGN 的标签行, 只保留着法
+func moveText(data string) string {
+	lines := strings.Split(data, "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "[") {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// outcomeString 对局结果的中文描述
+func outcomeString(o chess.Outcome) string {
+	switch o {
+	case chess.WhiteWon:
+		return "白方胜"
+	case chess.BlackWon:
+		return "黑方胜"
+	case chess.Draw:
+		return "和棋"
+	default:
+		return "未完成"
+	}
+}
@@ -0,0 +1,30 @@
+package chess
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestParseArchive(t *testing.T) {
+	game := chess.NewGame()
+	for _, m := range []string{"e4", "e5", "Qh5", "Nc6", "Bc4", "Nf6", "Qxf7#"} {
+		if err := game.MoveStr(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := getChessString(chessRoom{chessGame: game, whiteName: "白", blackName: "黑"})
+	parsed, err := parseArchive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Moves()) != 7 || len(parsed.Positions()) != 8 {
+		t.Fatalf("unexpected moves %d positions %d", len(parsed.Moves()), len(parsed.Positions()))
+	}
+	if got := outcomeString(parsed.Outcome()); got != "白方胜" {
+		t.Fatalf("outcome %s", got)
+	}
+	if mt := moveText(data); mt == "" || mt[0] == '[' {
+		t.Fatalf("unexpected move text %q", mt)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/FloatTech/floatbox/file"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
@@ -18,13 +20,19 @@ import (
 
 const helpString = `- 参与/创建一盘游戏：「下棋」(chess)
 - 参与/创建一盘盲棋：「盲棋」(blind)
+- 创建限时对局：「下棋 10+5」即每方 10 分钟、每步加 5 秒，盲棋同理，超时判负
+- 与电脑对战：「人机对战 [入门|简单|普通|困难]」，也可用 1~4 表示难度，人机对局不计入等级分
 - 投降认输：「认输」 (resign)
 - 请求、接受和棋：「和棋」 (draw)
 - 走棋：!Nxf3 中英文感叹号均可，格式请参考“代数记谱法”(Algebraic notation)
 - 中断对局：「中断」 (abort)（仅群主/管理员有效）
 - 查看等级分排行榜：「排行榜」(ranking)
 - 查看自己的等级分：「等级分」(rate)
-- 清空等级分：「清空等级分 QQ号」(.clean.rate) （仅超管有效）`
+- 清空等级分：「清空等级分 QQ号」(.clean.rate) （仅超管有效）
+- 查看对局记录：「对局记录 [@xxx] [页码]」
+- 查看对局详情：「查看对局 #编号」
+- 导出对局 PGN 文件：「导出对局 #编号」
+- 生成复盘动图：「复盘 #编号」`
 
 var (
 	limit       = ctxext.NewLimiterManager(time.Microsecond*2500, 1)
@@ -48,20 +56,27 @@ func init() {
 	dbFilePath := engine.DataFolder() + "chess.db"
 	initDatabase(dbFilePath)
 	// 注册指令
-	engine.OnFullMatchGroup([]string{"下棋", "chess"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+	engine.OnRegex(`^(?:下棋|chess)\s*(?:(\d+)\s*\+\s*(\d+))?$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			if ctx.Event.Sender == nil {
 				return
 			}
+			matched := ctx.State["regex_matched"].([]string)
+			tc, err := parseTimeControl(matched[1], matched[2])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
 			userUin := ctx.Event.UserID
 			userName := ctx.Event.Sender.NickName
 			groupCode := ctx.Event.GroupID
-			replyMessage, err := game(groupCode, userUin, userName)
+			replyMessage, err := game(groupCode, userUin, userName, tc)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
 			ctx.Send(replyMessage)
+			startClock(ctx, groupCode)
 		})
 
 	engine.OnFullMatchGroup([]string{"认输", "resign"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
@@ -99,15 +114,40 @@ func init() {
 			ctx.Send(replyMessage)
 		})
 
-	engine.OnFullMatchGroup([]string{"盲棋", "blind"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+	engine.OnRegex(`^(?:盲棋|blind)\s*(?:(\d+)\s*\+\s*(\d+))?$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			if ctx.Event.Sender == nil {
 				return
 			}
+			matched := ctx.State["regex_matched"].([]string)
+			tc, err := parseTimeControl(matched[1], matched[2])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
 			userUin := ctx.Event.UserID
 			userName := ctx.Event.Sender.NickName
 			groupCode := ctx.Event.GroupID
-			replyMessage, err := blindfold(groupCode, userUin, userName)
+			replyMessage, err := blindfold(groupCode, userUin, userName, tc)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+			startClock(ctx, groupCode)
+		})
+
+	engine.OnRegex(`^人机对战\s*(.*)$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			level, ok := parseAILevel(ctx.State["regex_matched"].([]string)[1])
+			if !ok {
+				ctx.SendChain(message.Text("ERROR: 难度应为 入门/简单/普通/困难 或 1~4"))
+				return
+			}
+			replyMessage, err := botGame(ctx.Event.GroupID, ctx.Event.UserID, ctx.Event.Sender.NickName, ctx.Event.SelfID, zero.BotConfig.NickName[0], level)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
@@ -170,4 +210,53 @@ func init() {
 			}
 			ctx.Send(replyMessage)
 		})
+	engine.OnRegex(`^对局记录\s*(?:\[CQ:at,qq=(\d+)\])?\s*(\d*)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			userUin := ctx.Event.UserID
+			if matched[1] != "" {
+				userUin, _ = strconv.ParseInt(matched[1], 10, 64)
+			}
+			page, _ := strconv.Atoi(matched[2])
+			replyMessage, err := listArchive(userUin, page)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^查看对局\s*#?(\d+)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseUint(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			replyMessage, err := showArchive(uint(id))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^导出对局\s*#?(\d+)$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseUint(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			filePath, fileName, err := exportArchive(uint(id))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.UploadThisGroupFile(filepath.Join(file.BOTPATH, filePath), fileName, "")
+		})
+
+	engine.OnRegex(`^复盘\s*#?(\d+)$`).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseUint(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			ctx.SendChain(message.Text("少女祈祷中..."))
+			replyMessage, err := replayArchive(uint(id))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
 }
@@ -0,0 +1,185 @@
+package chess
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	maxBaseMinutes   = 180
+	maxIncrementSecs = 60
+	clockTick        = time.Second
+)
+
+var errTimeControl = fmt.Errorf("时限格式应为「分钟+每步加秒」, 如 10+5, 分钟 1~%d, 加秒 0~%d", maxBaseMinutes, maxIncrementSecs)
+
+// timeControl 时限, 每方基础用时与每步加秒
+type timeControl struct {
+	base time.Duration
+	inc  time.Duration
+}
+
+// parseTimeControl 解析 "10+5" 形式的时限, 两者都为空时表示不限时
+func parseTimeControl(minutes, increment string) (*timeControl, error) {
+	if minutes == "" && increment == "" {
+		return nil, nil
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 1 || m > maxBaseMinutes {
+		return nil, errTimeControl
+	}
+	s, err := strconv.Atoi(increment)
+	if err != nil || s < 0 || s > maxIncrementSecs {
+		return nil, errTimeControl
+	}
+	return &timeControl{base: time.Duration(m) * time.Minute, inc: time.Duration(s) * time.Second}, nil
+}
+
+func (tc *timeControl) String() string {
+	return strconv.Itoa(int(tc.base/time.Minute)) + "+" + strconv.Itoa(int(tc.inc/time.Second))
+}
+
+// pgnTag PGN 中 TimeControl 标签的值
+func (tc *timeControl) pgnTag() string {
+	return strconv.Itoa(int(tc.base/time.Second)) + "+" + strconv.Itoa(int(tc.inc/time.Second))
+}
+
+// chessClock 对局双方的棋钟
+//
+// 锁同时保护对局本身, 使后台计时与玩家指令互斥
+type chessClock struct {
+	sync.Mutex
+	tc        timeControl
+	white     time.Duration // 白方剩余时间, 不含当前步已用时
+	black     time.Duration
+	turn      chess.Color // 正在计时的一方, NoColor 表示未开始
+	turnStart time.Time
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newChessClock(tc *timeControl) *chessClock {
+	return &chessClock{
+		tc:    *tc,
+		white: tc.base,
+		black: tc.base,
+		stop:  make(chan struct{}),
+	}
+}
+
+// start 开始为白方计时, 已开始时返回 false
+func (c *chessClock) start(now time.Time) bool {
+	if c.turn != chess.NoColor {
+		return false
+	}
+	c.turn = chess.White
+	c.turnStart = now
+	return true
+}
+
+// remaining 返回 color 方在 now 时刻的剩余时间
+func (c *chessClock) remaining(color chess.Color, now time.Time) time.Duration {
+	left := c.white
+	if color == chess.Black {
+		left = c.black
+	}
+	if c.turn == color {
+		left -= now.Sub(c.turnStart)
+	}
+	return left
+}
+
+// flagged 返回正在计时的一方是否已超时
+func (c *chessClock) flagged(now time.Time) bool {
+	return c.turn != chess.NoColor && c.remaining(c.turn, now) <= 0
+}
+
+// punch 当前方走子完毕, 扣除用时并加秒, 转为对方计时
+func (c *chessClock) punch(now time.Time) {
+	if c.turn == chess.NoColor {
+		return
+	}
+	left := c.remaining(c.turn, now) + c.tc.inc
+	if c.turn == chess.White {
+		c.white = left
+	} else {
+		c.black = left
+	}
+	c.turn = c.turn.Other()
+	c.turnStart = now
+}
+
+// halt 停止后台计时
+func (c *chessClock) halt() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// String 双方剩余时间
+func (c *chessClock) String() string {
+	now := time.Now()
+	return "白方 " + formatClock(c.remaining(chess.White, now)) + " | 黑方 " + formatClock(c.remaining(chess.Black, now))
+}
+
+// formatClock 将剩余时间格式化为 [h:]mm:ss
+func formatClock(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	sec := int(d / time.Second)
+	if sec >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+	}
+	return fmt.Sprintf("%02d:%02d", sec/60, sec%60)
+}
+
+// startClock 双方就位后开始计时, 并为该对局启动后台计时器, 超时后自动结束对局
+func startClock(ctx *zero.Ctx, groupCode int64) {
+	room, ok := lockRoom(groupCode)
+	if !ok {
+		return
+	}
+	defer room.unlock()
+	if room.clock == nil || room.whitePlayer == 0 || room.blackPlayer == 0 || !room.clock.start(time.Now()) {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(clockTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-room.clock.stop:
+				return
+			case <-ticker.C:
+			}
+			if msg, ended := checkFlag(groupCode, room); ended {
+				if msg != nil {
+					ctx.SendGroupMessage(groupCode, msg)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// checkFlag 检查对局是否有一方超时, 超时则结束对局
+func checkFlag(groupCode int64, room *chessRoom) (message.Message, bool) {
+	room.clock.Lock()
+	defer room.clock.Unlock()
+	if cur, ok := chessRoomMap.Load(groupCode); !ok || cur != room {
+		return nil, true
+	}
+	if !room.clock.flagged(time.Now()) {
+		return nil, false
+	}
+	msg, err := flagFall(groupCode, room, room.clock.turn)
+	if err != nil {
+		return message.Message{message.Text("ERROR: ", err)}, true
+	}
+	return msg, true
+}
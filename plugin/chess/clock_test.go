@@ -0,0 +1,55 @@
+package chess
+
+import (
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+func TestParseTimeControl(t *testing.T) {
+	tc, err := parseTimeControl("", "")
+	if err != nil || tc != nil {
+		t.Fatal("empty time control should mean unlimited")
+	}
+	tc, err = parseTimeControl("10", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.base != 10*time.Minute || tc.inc != 5*time.Second || tc.pgnTag() != "600+5" {
+		t.Fatalf("unexpected time control %+v", tc)
+	}
+	for _, c := range [][2]string{{"0", "5"}, {"181", "0"}, {"10", "61"}} {
+		if _, err := parseTimeControl(c[0], c[1]); err == nil {
+			t.Fatalf("%s+%s should be rejected", c[0], c[1])
+		}
+	}
+}
+
+func TestChessClock(t *testing.T) {
+	c := newChessClock(&timeControl{base: time.Minute, inc: 5 * time.Second})
+	now := time.Unix(0, 0)
+	if c.flagged(now.Add(time.Hour)) {
+		t.Fatal("clock should not run before start")
+	}
+	if !c.start(now) || c.start(now) {
+		t.Fatal("clock should start exactly once")
+	}
+	now = now.Add(20 * time.Second)
+	c.punch(now)
+	if got := c.remaining(chess.White, now); got != 45*time.Second {
+		t.Fatalf("white remaining %v", got)
+	}
+	if c.turn != chess.Black {
+		t.Fatal("turn should pass to black")
+	}
+	if got := c.remaining(chess.Black, now.Add(30*time.Second)); got != 30*time.Second {
+		t.Fatalf("black remaining %v", got)
+	}
+	if c.flagged(now.Add(59*time.Second)) || !c.flagged(now.Add(time.Minute)) {
+		t.Fatal("black should flag after one minute")
+	}
+	if formatClock(45*time.Second) != "00:45" || formatClock(3725*time.Second) != "1:02:05" || formatClock(-time.Second) != "00:00" {
+		t.Fatal("unexpected clock format")
+	}
+}
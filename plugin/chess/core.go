@@ -41,21 +41,57 @@ type chessRoom struct {
 	isBlindfold  bool
 	whiteErr     bool // 违例记录（盲棋用）
 	blackErr     bool
+	botColor     chess.Color // 电脑执子颜色, NoColor 表示非人机对局
+	botLevel     int
+	clock        *chessClock // 棋钟, nil 表示不限时
 }
 
-// game 下棋
-func game(groupCode, senderUin int64, senderName string) (message.Message, error) {
-	return createGame(false, groupCode, senderUin, senderName)
+// game 下棋, tc 为 nil 时不限时
+func game(groupCode, senderUin int64, senderName string, tc *timeControl) (message.Message, error) {
+	return createGame(false, groupCode, senderUin, senderName, tc)
 }
 
-// blindfold 盲棋
-func blindfold(groupCode, senderUin int64, senderName string) (message.Message, error) {
-	return createGame(true, groupCode, senderUin, senderName)
+// blindfold 盲棋, tc 为 nil 时不限时
+func blindfold(groupCode, senderUin int64, senderName string, tc *timeControl) (message.Message, error) {
+	return createGame(true, groupCode, senderUin, senderName, tc)
+}
+
+// botGame 人机对战, 玩家执白, 电脑执黑
+func botGame(groupCode, senderUin int64, senderName string, botUin int64, botName string, level int) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	if room, ok := chessRoomMap.Load(groupCode); ok {
+		msg = append(msg, message.Text("对局已在进行中, 无法创建人机对局, 当前对局玩家为: "))
+		if room.whitePlayer != 0 {
+			msg = append(msg, message.At(room.whitePlayer))
+		}
+		if room.blackPlayer != 0 {
+			msg = append(msg, message.At(room.blackPlayer))
+		}
+		return
+	}
+	chessRoomMap.Store(groupCode, &chessRoom{
+		chessGame:    chess.NewGame(),
+		whitePlayer:  senderUin,
+		whiteName:    senderName,
+		blackPlayer:  botUin,
+		blackName:    botName,
+		lastMoveTime: time.Now().Unix(),
+		botColor:     chess.Black,
+		botLevel:     level,
+	})
+	boardImgEle, err := getBoardElement(groupCode)
+	if err != nil {
+		deleteRoom(groupCode)
+		return
+	}
+	msg = append(msg, message.Text("已创建人机对局, 难度「", aiLevels[level].name, "」, 人机对局不计入等级分。请白方下棋。"), boardImgEle)
+	return
 }
 
 // abort 中断对局
 func abort(groupCode int64) (message.Message, error) {
-	if room, ok := chessRoomMap.Load(groupCode); ok {
+	if room, ok := lockRoom(groupCode); ok {
+		defer room.unlock()
 		return abortGame(*room, groupCode, "对局已被管理员中断, 游戏结束。")
 	}
 	return nil, errNotExist
@@ -65,16 +101,25 @@ func abort(groupCode int64) (message.Message, error) {
 func draw(groupCode, senderUin int64) (msg message.Message, err error) {
 	msg = message.Message{message.At(senderUin)}
 	// 检查对局是否存在
-	room, ok := chessRoomMap.Load(groupCode)
+	room, ok := lockRoom(groupCode)
 	if !ok {
 		return nil, errNotExist
 	}
+	defer room.unlock()
 	// 检查消息发送者是否为对局中的玩家
 	if senderUin != room.whitePlayer && senderUin != room.blackPlayer {
 		return
 	}
 	// 处理和棋逻辑
 	room.lastMoveTime = time.Now().Unix()
+	if room.isBotGame() {
+		// 电脑仅在局面不占优时接受和棋
+		if evaluateFor(room.chessGame.Position(), room.botColor) > botDrawMargin {
+			msg = append(msg, message.Text("电脑拒绝和棋, 游戏继续。"))
+			return
+		}
+		room.drawPlayer = room.whitePlayer + room.blackPlayer - senderUin
+	}
 	if room.drawPlayer == 0 {
 		room.drawPlayer = senderUin
 		chessRoomMap.Store(groupCode, room)
@@ -103,7 +148,7 @@ func draw(groupCode, senderUin int64) (msg message.Message, err error) {
 		}
 	}
 	msg = append(msg, message.Text("接受和棋, 游戏结束。\n", eloString, chessString))
-	chessRoomMap.Delete(groupCode)
+	deleteRoom(groupCode)
 	return
 }
 
@@ -111,17 +156,18 @@ func draw(groupCode, senderUin int64) (msg message.Message, err error) {
 func resign(groupCode, senderUin int64) (msg message.Message, err error) {
 	msg = message.Message{message.At(senderUin)}
 	// 检查对局是否存在
-	room, ok := chessRoomMap.Load(groupCode)
+	room, ok := lockRoom(groupCode)
 	if !ok {
 		return nil, errNotExist
 	}
+	defer room.unlock()
 	// 检查是否是当前游戏玩家
 	if senderUin != room.whitePlayer && senderUin != room.blackPlayer {
 		return
 	}
 	// 如果对局未建立, 中断对局
 	if room.whitePlayer == 0 || room.blackPlayer == 0 {
-		chessRoomMap.Delete(groupCode)
+		deleteRoom(groupCode)
 		msg = append(msg, message.Text("对局结束"))
 		return
 	}
@@ -163,7 +209,7 @@ func resign(groupCode, senderUin int64) (msg message.Message, err error) {
 	if isAprilFoolsDay() {
 		msg = append(msg, message.Text("对手认输, 游戏结束, 你胜利了。\n", eloString, chessString))
 	}
-	chessRoomMap.Delete(groupCode)
+	deleteRoom(groupCode)
 	return
 }
 
@@ -171,10 +217,11 @@ func resign(groupCode, senderUin int64) (msg message.Message, err error) {
 func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err error) {
 	msg = message.Message{message.At(senderUin)}
 	// 检查对局是否存在
-	room, ok := chessRoomMap.Load(groupCode)
+	room, ok := lockRoom(groupCode)
 	if !ok {
 		return nil, errNotExist
 	}
+	defer room.unlock()
 	// 不是对局中的玩家, 忽略消息
 	if (senderUin != room.whitePlayer) && (senderUin != room.blackPlayer) && !isAprilFoolsDay() {
 		return
@@ -189,7 +236,12 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 		msg = append(msg, message.Text("请等待对手走棋。"))
 		return
 	}
-	room.lastMoveTime = time.Now().Unix()
+	now := time.Now()
+	room.lastMoveTime = now.Unix()
+	// 已超时则判负
+	if room.clock != nil && room.clock.flagged(now) {
+		return flagFall(groupCode, room, room.clock.turn)
+	}
 	// 走棋
 	if err = room.chessGame.MoveStr(moveStr); err != nil {
 		// 指令错误时检查
@@ -226,14 +278,28 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 		chessString := getChessString(*room)
 		msg = append(msg, message.Text("违规两次,游戏结束。\n", chessString))
 
-		chessRoomMap.Delete(groupCode)
+		deleteRoom(groupCode)
 		return
 	}
+	if room.clock != nil {
+		room.clock.punch(now)
+	}
 	// 走子之后, 视为拒绝和棋
 	if room.drawPlayer != 0 {
 		room.drawPlayer = 0
 		chessRoomMap.Store(groupCode, room)
 	}
+	// 人机对局, 轮到电脑时自动应着
+	botMoveStr := ""
+	if room.isBotGame() && room.chessGame.Method() == chess.NoMethod && room.chessGame.Position().Turn() == room.botColor {
+		pos := room.chessGame.Position()
+		if m := bestMove(pos, room.botLevel); m != nil {
+			botMoveStr = chess.AlgebraicNotation{}.Encode(pos, m)
+			if err = room.chessGame.Move(m); err != nil {
+				return
+			}
+		}
+	}
 	// 生成棋盘图片
 	var boardImgEle message.Segment
 	if !room.isBlindfold {
@@ -297,7 +363,7 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 			msg = append(msg, boardImgEle)
 		}
 
-		chessRoomMap.Delete(groupCode)
+		deleteRoom(groupCode)
 		return
 	}
 	// 提示玩家继续游戏
@@ -307,7 +373,14 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 	} else {
 		currentPlayer = room.blackPlayer
 	}
+	if botMoveStr != "" {
+		msg = message.Message{message.At(currentPlayer), message.Text("电脑走子「", botMoveStr, "」, 游戏继续。"), boardImgEle}
+		return
+	}
 	msg = message.Message{message.At(currentPlayer), message.Text("对手已走子, 游戏继续。"), boardImgEle}
+	if room.clock != nil {
+		msg = append(msg, message.Text("剩余时间: ", room.clock.String()))
+	}
 	return
 }
 
@@ -343,9 +416,13 @@ func cleanUserRate(senderUin int64) (msg message.Message, err error) {
 }
 
 // createGame 创建游戏
-func createGame(isBlindfold bool, groupCode, senderUin int64, senderName string) (msg message.Message, err error) {
+func createGame(isBlindfold bool, groupCode, senderUin int64, senderName string, tc *timeControl) (msg message.Message, err error) {
 	room, ok := chessRoomMap.Load(groupCode)
 	if !ok {
+		var clock *chessClock
+		if tc != nil {
+			clock = newChessClock(tc)
+		}
 		chessRoomMap.Store(groupCode, &chessRoom{
 			chessGame:    chess.NewGame(),
 			whitePlayer:  senderUin,
@@ -357,11 +434,15 @@ func createGame(isBlindfold bool, groupCode, senderUin int64, senderName string)
 			isBlindfold:  isBlindfold,
 			whiteErr:     false,
 			blackErr:     false,
+			clock:        clock,
 		})
 		text := "已创建新的对局, 发送「下棋」或「chess」可加入对局。"
 		if isBlindfold {
 			text = "已创建新的盲棋对局, 发送「盲棋」或「blind」可加入对局。"
 		}
+		if tc != nil {
+			text += "\n时限: 每方 " + tc.String() + " (分钟+每步加秒), 超时判负。"
+		}
 		msg = append(msg, message.Text(text))
 		return
 	}
@@ -411,6 +492,9 @@ func createGame(isBlindfold bool, groupCode, senderUin int64, senderName string)
 	if !isBlindfold {
 		msg = append(msg, boardImgEle)
 	}
+	if room.clock != nil {
+		msg = append(msg, message.Text("剩余时间: ", room.clock.String()))
+	}
 	return
 }
 
@@ -429,7 +513,7 @@ func abortGame(room chessRoom, groupCode int64, hint string) (message.Message, e
 		}
 	}
 
-	chessRoomMap.Delete(groupCode)
+	deleteRoom(groupCode)
 	msg = append(msg, message.Text(hint))
 	if room.whitePlayer != 0 {
 		msg = append(msg, message.At(room.whitePlayer))
@@ -443,10 +527,6 @@ func abortGame(room chessRoom, groupCode int64, hint string) (message.Message, e
 
 // getBoardElement 获取棋盘图片的消息内容
 func getBoardElement(groupCode int64) (imgMsg message.Segment, err error) {
-	fontdata, err := file.GetLazyData(text.GNUUnifontFontFile, control.Md5File, true)
-	if err != nil {
-		return
-	}
 	room, ok := chessRoomMap.Load(groupCode)
 	if !ok {
 		return imgMsg, errNotExist
@@ -459,73 +539,104 @@ func getBoardElement(groupCode int64) (imgMsg message.Segment, err error) {
 		highlightSquare = append(highlightSquare, lastMove.S1())
 		highlightSquare = append(highlightSquare, lastMove.S2())
 	}
-	// 生成棋盘 svg 文件
-	buf := bytes.NewBuffer([]byte{})
 	fenStr := room.chessGame.FEN()
 	gameTurn := room.chessGame.Position().Turn()
 	pos := &chess.Position{}
 	if err = pos.UnmarshalText(binary.StringToBytes(fenStr)); err != nil {
 		return
 	}
-	yellow := color.RGBA{255, 255, 0, 1}
-	mark := cimage.MarkSquares(yellow, highlightSquare...)
-	board := pos.Board()
-	fromBlack := cimage.Perspective(gameTurn)
-	err = cimage.SVG(buf, board, fromBlack, mark)
+	out, err := renderBoards([]boardFrame{{
+		board:       pos.Board(),
+		perspective: gameTurn,
+		highlight:   highlightSquare,
+	}}, 2)
 	if err != nil {
 		return
 	}
+	imgMsg = message.ImageBytes(out[0])
+	return imgMsg, nil
+}
 
-	worker, err := resvg.NewDefaultWorker(context.Background())
+// boardFrame 一帧棋盘
+type boardFrame struct {
+	board       *chess.Board
+	perspective chess.Color
+	highlight   []chess.Square
+}
+
+// renderBoards 将棋盘依次渲染为 png, scale 为相对 360 像素的缩放倍数
+func renderBoards(frames []boardFrame, scale uint32) ([][]byte, error) {
+	fontdata, err := file.GetLazyData(text.GNUUnifontFontFile, control.Md5File, true)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer worker.Close()
-
-	tree, err := worker.NewTreeFromData(buf.Bytes(), &resvg.Options{
-		Dpi:        96,
-		FontFamily: "Unifont",
-		FontSize:   24.0,
-	})
+	worker, err := resvg.NewDefaultWorker(context.Background())
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer tree.Close()
+	defer worker.Close()
 
 	fontdb, err := worker.NewFontDBDefault()
 	if err != nil {
-		return
+		return nil, err
 	}
 	defer fontdb.Close()
 
 	err = fontdb.LoadFontData(fontdata)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	err = tree.ConvertText(fontdb)
+	yellow := color.RGBA{255, 255, 0, 1}
+	outs := make([][]byte, 0, len(frames))
+	buf := bytes.NewBuffer([]byte{})
+	for _, f := range frames {
+		// 生成棋盘 svg 文件
+		buf.Reset()
+		mark := cimage.MarkSquares(yellow, f.highlight...)
+		err = cimage.SVG(buf, f.board, cimage.Perspective(f.perspective), mark)
+		if err != nil {
+			return nil, err
+		}
+		var out []byte
+		out, err = renderSVG(worker, fontdb, buf.Bytes(), scale)
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, out)
+	}
+	return outs, nil
+}
+
+// renderSVG 将 svg 渲染为 png
+func renderSVG(worker *resvg.Worker, fontdb *resvg.FontDB, svg []byte, scale uint32) ([]byte, error) {
+	tree, err := worker.NewTreeFromData(svg, &resvg.Options{
+		Dpi:        96,
+		FontFamily: "Unifont",
+		FontSize:   24.0,
+	})
 	if err != nil {
-		return
+		return nil, err
 	}
+	defer tree.Close()
 
-	pixmap, err := worker.NewPixmap(720, 720)
+	err = tree.ConvertText(fontdb)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer pixmap.Close()
 
-	err = tree.Render(resvg.TransformFromScale(2, 2), pixmap)
+	pixmap, err := worker.NewPixmap(360*scale, 360*scale)
 	if err != nil {
-		return
+		return nil, err
 	}
+	defer pixmap.Close()
 
-	out, err := pixmap.EncodePNG()
+	err = tree.Render(resvg.TransformFromScale(float32(scale), float32(scale)), pixmap)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	imgMsg = message.ImageBytes(out)
-	return imgMsg, nil
+	return pixmap.EncodePNG()
 }
 
 // getELOString 获得玩家等级分的文本内容
@@ -533,6 +644,9 @@ func getELOString(room chessRoom, whiteScore, blackScore float64) (string, error
 	if room.whitePlayer == 0 || room.blackPlayer == 0 {
 		return "", nil
 	}
+	if room.isBotGame() {
+		return "人机对局不计入等级分。\n\n", nil
+	}
 	var msgBuilder strings.Builder
 	msgBuilder.WriteString("玩家等级分: \n")
 	dbService := newDBService()
@@ -612,6 +726,9 @@ func getChessString(room chessRoom) string {
 	dataString := fmt.Sprintf("[Date \"%s\"]\n", time.Now().Format("2006-01-02"))
 	whiteString := fmt.Sprintf("[White \"%s\"]\n", room.whiteName)
 	blackString := fmt.Sprintf("[Black \"%s\"]\n", room.blackName)
+	if room.clock != nil {
+		blackString += fmt.Sprintf("[TimeControl \"%s\"]\n", room.clock.tc.pgnTag())
+	}
 	chessString := game.String()
 
 	return dataString + whiteString + blackString + chessString
@@ -630,6 +747,73 @@ func getELORate(whiteUin, blackUin int64, dbService *chessDBService) (whiteRate
 	return
 }
 
+// flagFall 超时判负, loser 为超时的一方
+func flagFall(groupCode int64, room *chessRoom, loser chess.Color) (msg message.Message, err error) {
+	room.chessGame.Resign(loser)
+	loserName, winnerName := room.whiteName, room.blackName
+	whiteScore, blackScore := 0.0, 1.0
+	if loser == chess.Black {
+		loserName, winnerName = winnerName, loserName
+		whiteScore, blackScore = blackScore, whiteScore
+	}
+	chessString := getChessString(*room)
+	eloString := ""
+	if len(room.chessGame.Moves()) > 4 {
+		// 若走子次数超过 4 认为是有效对局, 存入数据库
+		dbService := newDBService()
+		if err = dbService.createPGN(chessString, room.whitePlayer, room.blackPlayer, room.whiteName, room.blackName); err != nil {
+			return
+		}
+		eloString, err = getELOString(*room, whiteScore, blackScore)
+		if err != nil {
+			return
+		}
+	}
+	msg = message.Message{message.At(room.whitePlayer), message.At(room.blackPlayer),
+		message.Text("\n「", loserName, "」超时, 「", winnerName, "」获胜, 游戏结束。\n", eloString, chessString)}
+	deleteRoom(groupCode)
+	return
+}
+
+// lockRoom 获取并锁定对局, 计时对局的后台计时器与玩家指令由此互斥
+func lockRoom(groupCode int64) (*chessRoom, bool) {
+	room, ok := chessRoomMap.Load(groupCode)
+	if !ok {
+		return nil, false
+	}
+	room.lock()
+	// 等待锁期间对局可能已被结束
+	if cur, ok := chessRoomMap.Load(groupCode); !ok || cur != room {
+		room.unlock()
+		return nil, false
+	}
+	return room, true
+}
+
+func (room *chessRoom) lock() {
+	if room.clock != nil {
+		room.clock.Lock()
+	}
+}
+
+func (room *chessRoom) unlock() {
+	if room.clock != nil {
+		room.clock.Unlock()
+	}
+}
+
+// deleteRoom 移除对局并停止计时
+func deleteRoom(groupCode int64) {
+	if room, ok := chessRoomMap.LoadAndDelete(groupCode); ok && room.clock != nil {
+		room.clock.halt()
+	}
+}
+
+// isBotGame 是否为人机对局
+func (room *chessRoom) isBotGame() bool {
+	return room.botColor != chess.NoColor
+}
+
 // isAprilFoolsDay 判断当前时间是否为愚人节期间
 func isAprilFoolsDay() bool {
 	now := time.Now()
@@ -98,3 +98,23 @@ func (s *chessDBService) createPGN(data string, whiteUin int64, blackUin int64,
 		BlackName: blackName,
 	}).Error
 }
+
+// countPGNByUin 获取用户参与的对局数
+func (s *chessDBService) countPGNByUin(uin int64) (n int, err error) {
+	err = s.db.Model(&pgn{}).Where("white_uin = ? OR black_uin = ?", uin, uin).Count(&n).Error
+	return
+}
+
+// getPGNListByUin 按时间倒序分页获取用户参与的对局
+func (s *chessDBService) getPGNListByUin(uin int64, offset, limit int) ([]pgn, error) {
+	var pgnList []pgn
+	err := s.db.Where("white_uin = ? OR black_uin = ?", uin, uin).Order("id desc").Offset(offset).Limit(limit).Find(&pgnList).Error
+	return pgnList, err
+}
+
+// getPGNByID 按编号获取对局
+func (s *chessDBService) getPGNByID(id uint) (pgn, error) {
+	var p pgn
+	err := s.db.Where("id = ?", id).First(&p).Error
+	return p, err
+}
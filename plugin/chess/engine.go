@@ -0,0 +1,313 @@
+package chess
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// aiLevel 电脑难度
+type aiLevel struct {
+	name  string
+	depth int           // 最大搜索深度(半回合)
+	limit time.Duration // 单步思考时间上限
+}
+
+var aiLevels = [...]aiLevel{
+	{name: "入门", depth: 1, limit: time.Second},
+	{name: "简单", depth: 2, limit: time.Second * 2},
+	{name: "普通", depth: 3, limit: time.Second * 4},
+	{name: "困难", depth: 5, limit: time.Second * 8},
+}
+
+const (
+	defaultAILevel = 1
+	botDrawMargin  = 100 // 电脑视角局面分不高于此值时接受和棋
+)
+
+// parseAILevel 解析难度, 支持名称或 1~4 的数字, 为空时使用默认难度
+func parseAILevel(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return defaultAILevel, true
+	}
+	for i, l := range aiLevels {
+		if s == l.name {
+			return i, true
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > len(aiLevels) {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+const (
+	scoreInf    = 1 << 20
+	scoreMate   = 1 << 16
+	maxQuiesce  = 4    // 静态搜索最大深度
+	checkPeriod = 1023 // 每隔多少节点检查一次超时
+)
+
+var pieceValues = [...]int{
+	chess.King:   0,
+	chess.Queen:  900,
+	chess.Rook:   500,
+	chess.Bishop: 330,
+	chess.Knight: 320,
+	chess.Pawn:   100,
+}
+
+// 位置分表, 以白方视角从第 8 行到第 1 行排列
+var pieceSquareTables = [...][64]int{
+	chess.King: {
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	},
+	chess.Queen: {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+	chess.Rook: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	},
+	chess.Bishop: {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+	chess.Knight: {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+	chess.Pawn: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+}
+
+// evaluate 静态评估, 返回行棋方视角的分数
+func evaluate(pos *chess.Position) int {
+	board := pos.Board()
+	score := 0
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		p := board.Piece(sq)
+		if p == chess.NoPiece {
+			continue
+		}
+		t := p.Type()
+		file, rank := int(sq.File()), int(sq.Rank())
+		if p.Color() == chess.White {
+			score += pieceValues[t] + pieceSquareTables[t][(7-rank)*8+file]
+		} else {
+			score -= pieceValues[t] + pieceSquareTables[t][rank*8+file]
+		}
+	}
+	if pos.Turn() == chess.Black {
+		return -score
+	}
+	return score
+}
+
+// evaluateFor 返回 c 方视角的静态评估
+func evaluateFor(pos *chess.Position, c chess.Color) int {
+	if pos.Turn() == c {
+		return evaluate(pos)
+	}
+	return -evaluate(pos)
+}
+
+// searcher 一次 alpha-beta 搜索的状态
+type searcher struct {
+	deadline time.Time
+	nodes    int
+	stopped  bool
+}
+
+// bestMove 在给定难度下为行棋方选择着法, 采用迭代加深的 negamax alpha-beta 搜索
+func bestMove(pos *chess.Position, level int) *chess.Move {
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		return nil
+	}
+	l := aiLevels[level]
+	s := &searcher{deadline: time.Now().Add(l.limit)}
+	orderMoves(pos, moves)
+	best := moves[0]
+	for depth := 1; depth <= l.depth; depth++ {
+		alpha := -scoreInf
+		var iterBest *chess.Move
+		for _, m := range moves {
+			v := -s.negamax(pos.Update(m), depth-1, 1, -scoreInf, -alpha)
+			if s.stopped {
+				break
+			}
+			if v > alpha {
+				alpha = v
+				iterBest = m
+			}
+		}
+		if s.stopped || iterBest == nil {
+			break
+		}
+		best = iterBest
+		// 将本轮最佳着法提前, 以便下一轮更快剪枝
+		for i, m := range moves {
+			if m == best {
+				copy(moves[1:i+1], moves[:i])
+				moves[0] = best
+				break
+			}
+		}
+	}
+	return best
+}
+
+func (s *searcher) timeout() bool {
+	s.nodes++
+	if s.nodes&checkPeriod == 0 && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	return s.stopped
+}
+
+func (s *searcher) negamax(pos *chess.Position, depth, ply, alpha, beta int) int {
+	if s.timeout() {
+		return 0
+	}
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		if pos.Status() == chess.Checkmate {
+			return -scoreMate + ply
+		}
+		return 0
+	}
+	if pos.HalfMoveClock() >= 100 {
+		return 0
+	}
+	if depth <= 0 {
+		return s.quiesce(pos, moves, 0, alpha, beta)
+	}
+	orderMoves(pos, moves)
+	for _, m := range moves {
+		v := -s.negamax(pos.Update(m), depth-1, ply+1, -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if v >= beta {
+			return beta
+		}
+		if v > alpha {
+			alpha = v
+		}
+	}
+	return alpha
+}
+
+// quiesce 只搜索吃子着法, 避免在交换中途停止评估
+func (s *searcher) quiesce(pos *chess.Position, moves []*chess.Move, qdepth, alpha, beta int) int {
+	standPat := evaluate(pos)
+	if standPat >= beta {
+		return beta
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+	if qdepth >= maxQuiesce {
+		return alpha
+	}
+	captures := moves[:0:0]
+	for _, m := range moves {
+		if m.HasTag(chess.Capture) || m.Promo() != chess.NoPieceType {
+			captures = append(captures, m)
+		}
+	}
+	orderMoves(pos, captures)
+	for _, m := range captures {
+		if s.timeout() {
+			return 0
+		}
+		next := pos.Update(m)
+		nextMoves := next.ValidMoves()
+		var v int
+		if len(nextMoves) == 0 {
+			if next.Status() == chess.Checkmate {
+				v = scoreMate
+			}
+		} else {
+			v = -s.quiesce(next, nextMoves, qdepth+1, -beta, -alpha)
+		}
+		if s.stopped {
+			return 0
+		}
+		if v >= beta {
+			return beta
+		}
+		if v > alpha {
+			alpha = v
+		}
+	}
+	return alpha
+}
+
+// orderMoves 按 MVV-LVA 排序, 吃子与升变优先
+func orderMoves(pos *chess.Position, moves []*chess.Move) {
+	board := pos.Board()
+	keys := make(map[*chess.Move]int, len(moves))
+	for _, m := range moves {
+		k := 0
+		if m.HasTag(chess.Capture) {
+			k += 10*pieceValues[board.Piece(m.S2()).Type()] - pieceValues[board.Piece(m.S1()).Type()]/10 + 10000
+		}
+		if m.Promo() != chess.NoPieceType {
+			k += pieceValues[m.Promo()] + 5000
+		}
+		if m.HasTag(chess.Check) {
+			k += 500
+		}
+		keys[m] = k
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		return keys[moves[i]] > keys[moves[j]]
+	})
+}
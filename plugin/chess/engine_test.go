@@ -0,0 +1,45 @@
+package chess
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestBestMoveMateInOne(t *testing.T) {
+	// 白方 Qh5xf7# 一步杀
+	fen, err := chess.FEN("r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := chess.NewGame(fen)
+	for level := range aiLevels {
+		m := bestMove(game.Position(), level)
+		if m == nil || m.String() != "h5f7" {
+			t.Errorf("难度 %d 未找到一步杀, 得到 %v", level, m)
+		}
+	}
+}
+
+func TestBestMoveWinsMaterial(t *testing.T) {
+	// 黑后无保护, 白方应吃后
+	fen, err := chess.FEN("4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := bestMove(chess.NewGame(fen).Position(), defaultAILevel)
+	if m == nil || m.String() != "d2d5" {
+		t.Errorf("未吃掉无保护的后, 得到 %v", m)
+	}
+}
+
+func TestParseAILevel(t *testing.T) {
+	for s, expected := range map[string]int{"": defaultAILevel, "入门": 0, "困难": 3, "2": 1} {
+		if l, ok := parseAILevel(s); !ok || l != expected {
+			t.Errorf("parseAILevel(%q) = %d, %v, 期望 %d", s, l, ok, expected)
+		}
+	}
+	if _, ok := parseAILevel("9"); ok {
+		t.Error("难度 9 应当非法")
+	}
+}
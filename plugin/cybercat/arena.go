@@ -8,7 +8,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	zbmath "github.com/FloatTech/floatbox/math"
 	"github.com/FloatTech/zbputils/ctxext"
 	"github.com/FloatTech/zbputils/img/text"
@@ -100,7 +100,7 @@ func init() {
 		if mood {
 			ctx.SendChain(message.Text(loser.Name, "好像并没有心情PK\n", winer.Name, "获得了比赛胜利"))
 			money := 10 + rand.Intn(int(winer.Weight))
-			if wallet.InsertWalletOf(winer.User, money) == nil {
+			if ledger.InsertWalletOf(winer.User, money, "cybercat", winer.Name+"PK获胜", ctx.Event.GroupID) == nil {
 				ctx.SendChain(message.At(winer.User), message.Text("你家的喵喵为你赢得了", money))
 			}
 			winer.ArenaTime = now
@@ -145,7 +145,7 @@ func init() {
 				"利用了PK地形,让", strconv.FormatFloat(loser.Weight, 'f', 2, 64), "kg的", loser.Name, "认输了"))
 		}
 		money := 10 + rand.Intn(int(winer.Weight))
-		if wallet.InsertWalletOf(winer.User, money) == nil {
+		if ledger.InsertWalletOf(winer.User, money, "cybercat", winer.Name+"PK获胜", ctx.Event.GroupID) == nil {
 			messageText = append(messageText, message.Text("\n"), message.At(winer.User), message.Text("\n", winer.Name, "为你赢得了", money))
 		} else {
 			messageText = append(messageText, message.Text("\n"), message.At(winer.User), message.Text("\n", winer.Name, "受伤了,所赚的钱全拿来疗伤了"))
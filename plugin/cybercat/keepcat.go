@@ -5,9 +5,10 @@ import (
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	zbmath "github.com/FloatTech/floatbox/math"
 	"github.com/FloatTech/zbputils/ctxext"
 	zero "github.com/wdvxdr1123/ZeroBot"
@@ -364,7 +365,8 @@ func (inf *catInfo) settleOfWork(gid string) (int, bool) {
 		return 0, true
 	}
 	getmoney := 10 + rand.Intn(10*int(workTime))
-	if wallet.InsertWalletOf(inf.User, getmoney) != nil {
+	groupID, _ := strconv.ParseInt(strings.TrimPrefix(gid, "group"), 10, 64)
+	if ledger.InsertWalletOf(inf.User, getmoney, "cybercat", inf.Name+"打工", groupID) != nil {
 		return 0, true
 	}
 	return getmoney, true
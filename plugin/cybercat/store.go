@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	"github.com/FloatTech/floatbox/process"
 	"github.com/FloatTech/zbputils/ctxext"
 	zero "github.com/wdvxdr1123/ZeroBot"
@@ -190,7 +191,7 @@ func init() {
 		userInfo.LastTime = 0
 		userInfo.Work = 0
 		userInfo.Picurl = picurl
-		if err = wallet.InsertWalletOf(ctx.Event.UserID, -money); err != nil {
+		if err = ledger.InsertWalletOf(ctx.Event.UserID, -money, "cybercat", "买猫", ctx.Event.GroupID); err != nil {
 			ctx.SendChain(message.Text("[ERROR]:", err))
 			return
 		}
@@ -249,7 +250,7 @@ func init() {
 		}
 		foodmoney *= int(mun)
 		userInfo.Food += 5 * mun
-		if wallet.InsertWalletOf(ctx.Event.UserID, -foodmoney) != nil {
+		if ledger.InsertWalletOf(ctx.Event.UserID, -foodmoney, "cybercat", "买"+strconv.Itoa(int(mun))+"袋猫粮", ctx.Event.GroupID) != nil {
 			ctx.SendChain(message.Text("[ERROR]:", err))
 			return
 		}
@@ -0,0 +1,206 @@
+package event
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	kindFriend = "申请"
+	kindInvite = "邀请"
+
+	// requestTTL 待处理申请的有效期, 过期后不再能处理
+	requestTTL = 72 * time.Hour
+)
+
+// eventdb 待处理申请与自动处理规则
+type eventdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// pendingRequest 待处理的好友申请或群聊邀请
+type pendingRequest struct {
+	ID        int64  `db:"id"`
+	Kind      string `db:"kind"` // 申请 或 邀请
+	Flag      string `db:"flag"`
+	SelfID    int64  `db:"selfid"`
+	UserID    int64  `db:"uid"`
+	UserName  string `db:"uname"`
+	GroupID   int64  `db:"gid"`
+	GroupName string `db:"gname"`
+	Comment   string `db:"comment"`
+	Time      int64  `db:"time"`
+	Expire    int64  `db:"expire"`
+}
+
+// rule 自动处理规则
+type rule struct {
+	ID      int64  `db:"id"`
+	Approve bool   `db:"approve"` // true 自动同意, false 自动拒绝
+	Type    string `db:"type"`    // 关键词、邀请人 或 群
+	Value   string `db:"value"`
+}
+
+// sequence 各表已分配的最大编号
+type sequence struct {
+	Table string `db:"tbl"`
+	Last  int64  `db:"last"`
+}
+
+var edb = &eventdb{}
+
+func initDatabase(path string) error {
+	edb.Sqlite = sql.New(path)
+	err := edb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = edb.Create("pending", &pendingRequest{})
+	if err != nil {
+		return err
+	}
+	err = edb.Create("seq", &sequence{})
+	if err != nil {
+		return err
+	}
+	return edb.Create("rule", &rule{})
+}
+
+// nextID 表中已分配的最大编号加一, 删除的编号不再复用, 以免迟到的 "同意 N" 处理了别的申请
+func (db *eventdb) nextID(table string) (int64, error) {
+	seq := sequence{Table: table}
+	_ = db.Find("seq", &seq, "WHERE tbl = ?", table)
+	var last struct {
+		ID int64 `db:"id"`
+	}
+	// 兼容计数表出现之前的记录
+	err := db.Query("SELECT IFNULL(MAX(id), 0) FROM ["+table+"];", &last)
+	if err != nil {
+		return 0, err
+	}
+	seq.Last = max(seq.Last, last.ID) + 1
+	return seq.Last, db.Insert("seq", &seq)
+}
+
+// addPending 记录待处理申请并分配编号, 同时清理过期的申请
+func addPending(p *pendingRequest) error {
+	edb.Lock()
+	defer edb.Unlock()
+	err := edb.Del("pending", "WHERE expire < ?", time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	p.ID, err = edb.nextID("pending")
+	if err != nil {
+		return err
+	}
+	return edb.Insert("pending", p)
+}
+
+// listPending 未过期的待处理申请
+func listPending() ([]*pendingRequest, error) {
+	edb.RLock()
+	defer edb.RUnlock()
+	ps, err := sql.FindAll[pendingRequest](&edb.Sqlite, "pending", "WHERE expire >= ? ORDER BY id", time.Now().Unix())
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return ps, err
+}
+
+// takePending 取出并删除待处理申请, 已过期或不存在时返回 false
+func takePending(id int64) (*pendingRequest, bool, error) {
+	edb.Lock()
+	defer edb.Unlock()
+	p := &pendingRequest{}
+	err := edb.Find("pending", p, "WHERE id = ?", id)
+	if err == sql.ErrNullResult {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	err = edb.Del("pending", "WHERE id = ?", id)
+	return p, p.Expire >= time.Now().Unix(), err
+}
+
+// removePendingByFlag 用 flag 处理后删除对应的待处理申请
+func removePendingByFlag(flag string) error {
+	edb.Lock()
+	defer edb.Unlock()
+	return edb.Del("pending", "WHERE flag = ?", flag)
+}
+
+// addRule 添加自动处理规则
+func addRule(r *rule) error {
+	edb.Lock()
+	defer edb.Unlock()
+	if edb.CanFind("rule", "WHERE approve = ? AND type = ? AND value = ?", r.Approve, r.Type, r.Value) {
+		return nil
+	}
+	var err error
+	r.ID, err = edb.nextID("rule")
+	if err != nil {
+		return err
+	}
+	return edb.Insert("rule", r)
+}
+
+// delRule 删除自动处理规则
+func delRule(id int64) (bool, error) {
+	edb.Lock()
+	defer edb.Unlock()
+	if !edb.CanFind("rule", "WHERE id = ?", id) {
+		return false, nil
+	}
+	return true, edb.Del("rule", "WHERE id = ?", id)
+}
+
+// listRules 全部自动处理规则
+func listRules() ([]*rule, error) {
+	edb.RLock()
+	defer edb.RUnlock()
+	rs, err := sql.FindAll[rule](&edb.Sqlite, "rule", "ORDER BY id")
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return rs, err
+}
+
+// matchRules 找到适用于申请的规则, 拒绝规则优先于同意规则, 没有时返回 nil
+func matchRules(rs []*rule, p *pendingRequest) *rule {
+	for _, approve := range [...]bool{false, true} {
+		for _, r := range rs {
+			if r.Approve == approve && r.match(p) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// match 规则是否适用于该申请
+func (r *rule) match(p *pendingRequest) bool {
+	switch r.Type {
+	case "关键词":
+		return p.Comment != "" && strings.Contains(p.Comment, r.Value)
+	case "邀请人":
+		return strconv.FormatInt(p.UserID, 10) == r.Value
+	case "群":
+		return p.Kind == kindInvite && strconv.FormatInt(p.GroupID, 10) == r.Value
+	}
+	return false
+}
+
+func (r *rule) String() string {
+	action := "自动拒绝"
+	if r.Approve {
+		action = "自动同意"
+	}
+	return "#" + strconv.FormatInt(r.ID, 10) + " " + action + r.Type + " " + r.Value
+}
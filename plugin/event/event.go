@@ -4,6 +4,7 @@ package event
 import (
 	"encoding/binary"
 	"strconv"
+	"strings"
 	"time"
 
 	ctrl "github.com/FloatTech/zbpctrl"
@@ -19,89 +20,154 @@ func init() {
 		DisableOnDefault: false,
 		Brief:            "好友申请和群聊邀请事件处理",
 		Help: "- [开启|关闭]自动同意[申请|邀请|主人]\n" +
+			"- 待处理申请\n" +
+			"- [同意|拒绝] 3 [理由]\n" +
 			"- [同意|拒绝][申请|邀请][flag]\n" +
-			"Tips: 信息默认发送给主人列表第一位, 默认同意所有主人的事件, flag跟随事件一起发送",
+			"- 添加[自动同意|自动拒绝][关键词|邀请人|群] xxx\n" +
+			"- 删除规则 #1\n" +
+			"- 查看规则\n" +
+			"Tips: 信息发送给所有主人, 默认同意所有主人的事件, 待处理申请" + strconv.Itoa(int(requestTTL/time.Hour)) + "小时后过期;\n" +
+			"关键词匹配申请的验证信息, 邀请人匹配申请人或邀请人的QQ, 群只对群聊邀请生效; 拒绝规则优先于同意规则",
+		PrivateDataFolder: "event",
 	})
+	if err := initDatabase(engine.DataFolder() + "event.db"); err != nil {
+		panic(err)
+	}
 	engine.On("request/group/invite").SetBlock(false).
 		Handle(func(ctx *zero.Ctx) {
 			c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
 			if ok {
-				su := zero.BotConfig.SuperUsers[0]
-				now := time.Unix(ctx.Event.Time, 0).Format("2006-01-02 15:04:05")
-				flag, err := strconv.ParseInt(ctx.Event.Flag, 10, 64)
-				if err != nil {
-					ctx.SendChain(message.Text("ERROR: ", err))
-					return
-				}
-				var buf [8]byte
-				binary.BigEndian.PutUint64(buf[:], uint64(flag))
-				es := base14.EncodeToString(buf[1:])
-				userid := ctx.Event.UserID
-				username := ctx.CardOrNickName(userid)
-				data := (storage)(c.GetData(-su))
-				groupname := ctx.GetThisGroupInfo(true).Name
-				groupid := ctx.Event.GroupID
-				logrus.Info("[event]收到来自[", username, "](", userid, ")的群聊邀请，群:[", groupname, "](", groupid, ")")
-				if data.isinviteon() || (!data.ismasteroff() && zero.SuperUserPermission(ctx)) {
-					ctx.SetGroupAddRequest(ctx.Event.Flag, "invite", true, "")
-					ctx.SendPrivateForwardMessage(su, message.Message{message.CustomNode(username, userid,
-						"已自动同意在"+now+"收到来自"+
-							"\n用户:["+username+"]("+strconv.FormatInt(userid, 10)+")的群聊邀请"+
-							"\n群聊:["+groupname+"]("+strconv.FormatInt(groupid, 10)+")"+
-							"\nflag:"+es)})
-					return
+				p := &pendingRequest{
+					Kind:      kindInvite,
+					Flag:      ctx.Event.Flag,
+					SelfID:    ctx.Event.SelfID,
+					UserID:    ctx.Event.UserID,
+					UserName:  ctx.CardOrNickName(ctx.Event.UserID),
+					GroupID:   ctx.Event.GroupID,
+					GroupName: ctx.GetThisGroupInfo(true).Name,
+					Comment:   ctx.Event.Comment,
+					Time:      ctx.Event.Time,
 				}
-				ctx.SendPrivateForwardMessage(su,
-					message.Message{message.CustomNode(username, userid,
-						"在"+now+"收到来自"+
-							"\n用户:["+username+"]("+strconv.FormatInt(userid, 10)+")的群聊邀请"+
-							"\n群聊:["+groupname+"]("+strconv.FormatInt(groupid, 10)+")"+
-							"\n请在下方复制flag并在前面加上:"+
-							"\n同意/拒绝邀请，来决定同意还是拒绝"),
-						message.CustomNode(username, userid, es)})
+				data := (storage)(c.GetData(-zero.BotConfig.SuperUsers[0]))
+				logrus.Info("[event]收到来自[", p.UserName, "](", p.UserID, ")的群聊邀请，群:[", p.GroupName, "](", p.GroupID, ")")
+				dispatch(ctx, p, !data.ismasteroff() && zero.SuperUserPermission(ctx), data.isinviteon())
 			}
 		})
 	engine.On("request/friend").SetBlock(false).
 		Handle(func(ctx *zero.Ctx) {
 			c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
 			if ok {
-				su := zero.BotConfig.SuperUsers[0]
-				now := time.Unix(ctx.Event.Time, 0).Format("2006-01-02 15:04:05")
-				flag, err := strconv.ParseInt(ctx.Event.Flag, 10, 64)
-				if err != nil {
-					ctx.SendChain(message.Text("ERROR: ", err))
-					return
+				p := &pendingRequest{
+					Kind:     kindFriend,
+					Flag:     ctx.Event.Flag,
+					SelfID:   ctx.Event.SelfID,
+					UserID:   ctx.Event.UserID,
+					UserName: ctx.CardOrNickName(ctx.Event.UserID),
+					Comment:  ctx.Event.Comment,
+					Time:     ctx.Event.Time,
 				}
-				var buf [8]byte
-				binary.BigEndian.PutUint64(buf[:], uint64(flag))
-				es := base14.EncodeToString(buf[1:])
-				comment := ctx.Event.Comment
-				userid := ctx.Event.UserID
-				username := ctx.CardOrNickName(userid)
-				data := (storage)(c.GetData(-su))
-				logrus.Info("[event]收到来自[", username, "](", userid, ")的好友申请")
-				if data.isapplyon() || (!data.ismasteroff() && zero.SuperUserPermission(ctx)) {
-					ctx.SetFriendAddRequest(ctx.Event.Flag, true, "")
-					ctx.SendPrivateForwardMessage(su, message.Message{message.CustomNode(username, userid,
-						"已自动同意在"+now+"收到来自"+
-							"\n用户:["+username+"]("+strconv.FormatInt(userid, 10)+")"+
-							"\n的好友请求:"+comment+
-							"\nflag:"+es)})
+				data := (storage)(c.GetData(-zero.BotConfig.SuperUsers[0]))
+				logrus.Info("[event]收到来自[", p.UserName, "](", p.UserID, ")的好友申请")
+				dispatch(ctx, p, !data.ismasteroff() && zero.SuperUserPermission(ctx), data.isapplyon())
+			}
+		})
+	engine.OnFullMatch("待处理申请", zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ps, err := listPending()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ps) == 0 {
+				ctx.SendChain(message.Text("没有待处理的申请"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("待处理申请:")
+			for _, p := range ps {
+				sb.WriteString("\n\n#")
+				sb.WriteString(strconv.FormatInt(p.ID, 10))
+				sb.WriteString(" ")
+				sb.WriteString(p.describe())
+				sb.WriteString("\n过期时间: ")
+				sb.WriteString(time.Unix(p.Expire, 0).Format("2006-01-02 15:04"))
+			}
+			sb.WriteString("\n\n发送「同意 编号」或「拒绝 编号 [理由]」处理")
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^(同意|拒绝)\s*#?(\d+)\s*(.*)$`, zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			id, _ := strconv.ParseInt(matched[2], 10, 64)
+			p, valid, err := takePending(id)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if p == nil {
+				ctx.SendChain(message.Text("没有编号为 #", id, " 的待处理申请"))
+				return
+			}
+			if !valid {
+				ctx.SendChain(message.Text("申请 #", id, " 已过期"))
+				return
+			}
+			bot := zero.GetBot(p.SelfID)
+			if bot == nil {
+				bot = ctx
+			}
+			p.set(bot, matched[1] == "同意", matched[3])
+			notifySuperUsers(ctx, p, "["+ctx.CardOrNickName(ctx.Event.UserID)+"]已"+matched[1]+"#"+matched[2]+" "+p.describe())
+		})
+	engine.OnRegex(`^添加(自动同意|自动拒绝)(关键词|邀请人|群)\s*(.+)$`, zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			r := &rule{Approve: matched[1] == "自动同意", Type: matched[2], Value: strings.TrimSpace(matched[3])}
+			if r.Type != "关键词" {
+				if _, err := strconv.ParseInt(r.Value, 10, 64); err != nil {
+					ctx.SendChain(message.Text("ERROR: ", r.Type, "应为QQ号或群号"))
 					return
 				}
-				ctx.SendPrivateForwardMessage(su,
-					message.Message{message.CustomNode(username, userid,
-						"在"+now+"收到来自"+
-							"\n用户:["+username+"]("+strconv.FormatInt(userid, 10)+")"+
-							"\n的好友请求:"+comment+
-							"\n请在下方复制flag并在前面加上:"+
-							"\n同意/拒绝申请，来决定同意还是拒绝"),
-						message.CustomNode(username, userid, es)})
 			}
+			if err := addRule(r); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已添加规则 ", r))
+		})
+	engine.OnRegex(`^删除规则\s*#?(\d+)$`, zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			ok, err := delRule(id)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if !ok {
+				ctx.SendChain(message.Text("没有编号为 #", id, " 的规则"))
+				return
+			}
+			ctx.SendChain(message.Text("已删除规则 #", id))
+		})
+	engine.OnFullMatch("查看规则", zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			rs, err := listRules()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(rs) == 0 {
+				ctx.SendChain(message.Text("还没有自动处理规则"))
+				return
+			}
+			lines := make([]string, len(rs))
+			for i, r := range rs {
+				lines[i] = r.String()
+			}
+			ctx.SendChain(message.Text("自动处理规则:\n", strings.Join(lines, "\n")))
 		})
 	engine.OnRegex(`^(同意|拒绝)(申请|邀请)\s*([一-踀]{4})\s*(.*)$`, zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			su := zero.BotConfig.SuperUsers[0]
 			cmd := ctx.State["regex_matched"].([]string)[1]
 			org := ctx.State["regex_matched"].([]string)[2]
 			es := ctx.State["regex_matched"].([]string)[3]
@@ -113,11 +179,13 @@ func init() {
 			switch org {
 			case "申请":
 				ctx.SetFriendAddRequest(flag, ok, other)
-				ctx.SendPrivateMessage(su, message.Text("已", cmd, org))
 			case "邀请":
 				ctx.SetGroupAddRequest(flag, "invite", ok, other)
-				ctx.SendPrivateMessage(su, message.Text("已", cmd, org))
 			}
+			if err := removePendingByFlag(flag); err != nil {
+				logrus.Warnln("[event] 删除待处理申请失败:", err)
+			}
+			ctx.SendChain(message.Text("已", cmd, org))
 		})
 	engine.OnRegex(`^(开启|关闭)自动同意(申请|邀请|主人)$`, zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
@@ -142,3 +210,64 @@ func init() {
 			ctx.SendChain(message.Text("已设置自动同意" + from + "为" + option))
 		})
 }
+
+// describe 申请的描述
+func (p *pendingRequest) describe() string {
+	now := time.Unix(p.Time, 0).Format("2006-01-02 15:04:05")
+	if p.Kind == kindInvite {
+		return "在" + now + "收到来自" +
+			"\n用户:[" + p.UserName + "](" + strconv.FormatInt(p.UserID, 10) + ")的群聊邀请" +
+			"\n群聊:[" + p.GroupName + "](" + strconv.FormatInt(p.GroupID, 10) + ")"
+	}
+	return "在" + now + "收到来自" +
+		"\n用户:[" + p.UserName + "](" + strconv.FormatInt(p.UserID, 10) + ")" +
+		"\n的好友请求:" + p.Comment
+}
+
+// set 同意或拒绝申请
+func (p *pendingRequest) set(ctx *zero.Ctx, approve bool, reason string) {
+	if p.Kind == kindInvite {
+		ctx.SetGroupAddRequest(p.Flag, "invite", approve, reason)
+		return
+	}
+	ctx.SetFriendAddRequest(p.Flag, approve, reason)
+}
+
+// dispatch 按主人、规则与自动同意设置处理申请, 都不满足时加入待处理列表
+func dispatch(ctx *zero.Ctx, p *pendingRequest, fromMaster, autoApprove bool) {
+	if fromMaster {
+		p.set(ctx, true, "")
+		notifySuperUsers(ctx, p, "已自动同意"+p.describe())
+		return
+	}
+	rs, err := listRules()
+	if err != nil {
+		logrus.Warnln("[event] 读取自动处理规则失败:", err)
+	}
+	if r := matchRules(rs, p); r != nil {
+		p.set(ctx, r.Approve, "")
+		notifySuperUsers(ctx, p, "已按规则 "+r.String()+" 处理\n"+p.describe())
+		return
+	}
+	if autoApprove {
+		p.set(ctx, true, "")
+		notifySuperUsers(ctx, p, "已自动同意"+p.describe())
+		return
+	}
+	p.Expire = p.Time + int64(requestTTL/time.Second)
+	if err = addPending(p); err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	notifySuperUsers(ctx, p, p.describe()+
+		"\n编号: #"+strconv.FormatInt(p.ID, 10)+
+		"\n请发送「同意 "+strconv.FormatInt(p.ID, 10)+"」或「拒绝 "+strconv.FormatInt(p.ID, 10)+" [理由]」处理, "+
+		time.Unix(p.Expire, 0).Format("01-02 15:04")+"前有效")
+}
+
+// notifySuperUsers 向所有主人发送申请的处理情况
+func notifySuperUsers(ctx *zero.Ctx, p *pendingRequest, text string) {
+	for _, su := range zero.BotConfig.SuperUsers {
+		ctx.SendPrivateForwardMessage(su, message.Message{message.CustomNode(p.UserName, p.UserID, text)})
+	}
+}
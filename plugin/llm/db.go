@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	kindDaily  = "day"
+	kindWeekly = "week"
+	dateLayout = "2006-01-02"
+)
+
+// digestdb 每日总结的设置与历史
+type digestdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// schedule 每日总结的时间, Minute 为当天的第几分钟
+type schedule struct {
+	GroupID int64 `db:"gid"`
+	Minute  int   `db:"minute"`
+}
+
+// digest 保存的总结
+type digest struct {
+	ID      string `db:"id"` // kind_gid_date
+	GroupID int64  `db:"gid"`
+	Kind    string `db:"kind"`
+	Date    string `db:"date"` // 每日总结为当天, 每周总结为周一
+	// Count 每日总结为消息数, 每周总结为所用的每日总结数
+	Count   int    `db:"count"`
+	Summary string `db:"summary"`
+	Time    int64  `db:"time"`
+}
+
+var ddb = &digestdb{}
+
+func initDatabase(path string) error {
+	ddb.Sqlite = sql.New(path)
+	err := ddb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = ddb.Create("schedule", &schedule{})
+	if err != nil {
+		return err
+	}
+	return ddb.Create("digest", &digest{})
+}
+
+func digestKey(kind string, gid int64, date string) string {
+	return kind + "_" + strconv.FormatInt(gid, 10) + "_" + date
+}
+
+// setSchedule 设置本群每日总结的时间
+func setSchedule(gid int64, minute int) error {
+	ddb.Lock()
+	defer ddb.Unlock()
+	return ddb.Insert("schedule", &schedule{GroupID: gid, Minute: minute})
+}
+
+// delSchedule 关闭本群的每日总结
+func delSchedule(gid int64) (bool, error) {
+	ddb.Lock()
+	defer ddb.Unlock()
+	if !ddb.CanFind("schedule", "WHERE gid = ?", gid) {
+		return false, nil
+	}
+	return true, ddb.Del("schedule", "WHERE gid = ?", gid)
+}
+
+// dueSchedules 在当天第 minute 分钟需要总结的群
+func dueSchedules(minute int) ([]*schedule, error) {
+	ddb.RLock()
+	defer ddb.RUnlock()
+	ss, err := sql.FindAll[schedule](&ddb.Sqlite, "schedule", "WHERE minute = ?", minute)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return ss, err
+}
+
+// saveDigest 保存总结, 同一天的同类总结会被覆盖
+func saveDigest(d *digest) error {
+	ddb.Lock()
+	defer ddb.Unlock()
+	d.ID = digestKey(d.Kind, d.GroupID, d.Date)
+	return ddb.Insert("digest", d)
+}
+
+// getDigest 读取总结, 没有时返回 nil
+func getDigest(kind string, gid int64, date string) (*digest, error) {
+	ddb.RLock()
+	defer ddb.RUnlock()
+	d := &digest{}
+	err := ddb.Find("digest", d, "WHERE id = ?", digestKey(kind, gid, date))
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return d, err
+}
+
+// listDailies 本群 [from, to] 之间的每日总结, 按日期先后排列
+func listDailies(gid int64, from, to string) ([]*digest, error) {
+	ddb.RLock()
+	defer ddb.RUnlock()
+	ds, err := sql.FindAll[digest](&ddb.Sqlite, "digest", "WHERE gid = ? AND kind = ? AND date >= ? AND date <= ? ORDER BY date",
+		gid, kindDaily, from, to)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return ds, err
+}
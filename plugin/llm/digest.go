@@ -0,0 +1,262 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/zbputils/chat"
+	"github.com/FloatTech/zbputils/control"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aichatcfg/usage"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/msgarchive/archive"
+)
+
+const (
+	// digestLimit 每日总结最多读取的消息数
+	digestLimit = 2000
+	// defaultDigestMinute 未指定时间时默认在 22:00 总结
+	defaultDigestMinute = 22 * 60
+	// chunkSize 合并转发中每段的最大长度
+	chunkSize = 1000
+)
+
+var (
+	errNoMessage = errors.New("没有可以总结的消息")
+	errNoDaily   = errors.New("本周还没有每日总结, 请先开启每日总结")
+)
+
+// summaryPrompt 群聊总结的提示词 (通用版省流提示词)
+const summaryPrompt = `请对以下群聊对话进行【极简总结】。
+要求：
+1. 剔除客套与废话，直击主题。
+2. 使用 Markdown 列表格式。
+3. 按以下结构输出：
+   - 🎯 核心议题：(一句话概括)
+   - 💡 关键观点/结论：(提取3-5个重点)
+   - ✅ 下一步/待办：(如果有，明确谁做什么)
+
+群聊对话内容如下：
+`
+
+// weeklyPrompt 由每日总结合成周总结的提示词
+const weeklyPrompt = `以下是一个群聊在本周每一天的聊天总结，请合并为一份【本周总结】。
+要求：
+1. 合并不同日期中重复的话题，突出持续讨论的内容。
+2. 使用 Markdown 列表格式。
+3. 按以下结构输出：
+   - 🗓️ 本周概览：(一两句话概括)
+   - 🔥 热门话题：(按热度列出3-5个, 注明大致日期)
+   - ✅ 结论与待办：(如果有)
+
+每日总结如下：
+`
+
+// splitText 按长度切分文本, 尽量在换行处切分
+func splitText(s string, n int) []string {
+	var parts []string
+	for len(s) > n {
+		chunk := s[:n]
+		if i := strings.LastIndex(chunk, "\n"); i > 0 {
+			chunk = s[:i+1]
+		}
+		parts = append(parts, chunk)
+		s = s[len(chunk):]
+	}
+	if s != "" {
+		parts = append(parts, s)
+	}
+	return parts
+}
+
+// digestNodes 把总结转为 bot 自己发送的合并转发消息
+func digestNodes(selfID int64, title, summary string) message.Message {
+	msg := make(message.Message, 0, 4)
+	for _, chunk := range splitText(title+"\n\n"+summary, chunkSize) {
+		msg = append(msg, message.CustomNode(zero.BotConfig.NickName[0], selfID, chunk))
+	}
+	return msg
+}
+
+// dayStart 当天零点
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// weekStart 本周一零点
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return dayStart(t).AddDate(0, 0, -offset)
+}
+
+// dayMessages 群内 [from, to) 的消息
+func dayMessages(ctx *zero.Ctx, gid int64, from, to time.Time) (messages []string) {
+	for _, m := range archive.HistoryBetween(ctx, gid, from, to, digestLimit) {
+		if m.Text != "" {
+			messages = append(messages, m.Name+": "+m.Text)
+		}
+	}
+	return
+}
+
+// makeDaily 总结 day 当天到 now 为止的消息并保存, 用量计入 uid
+func makeDaily(ctx *zero.Ctx, gid, uid int64, day, now time.Time, temp float32) (*digest, error) {
+	from := dayStart(day)
+	to := from.AddDate(0, 0, 1)
+	if to.After(now) {
+		to = now
+	}
+	messages := dayMessages(ctx, gid, from, to)
+	if len(messages) == 0 {
+		return nil, errNoMessage
+	}
+	summary, err := llmchat(summaryPrompt+strings.Join(messages, "\n"), temp, gid, uid)
+	if err != nil {
+		return nil, err
+	}
+	d := &digest{
+		GroupID: gid,
+		Kind:    kindDaily,
+		Date:    from.Format(dateLayout),
+		Count:   len(messages),
+		Summary: summary,
+		Time:    now.Unix(),
+	}
+	return d, saveDigest(d)
+}
+
+// makeWeekly 由本周的每日总结生成周总结, 每日总结没有变化时直接使用保存的结果, 用量计入 uid
+func makeWeekly(gid, uid int64, now time.Time, temp float32) (*digest, error) {
+	monday := weekStart(now)
+	from := monday.Format(dateLayout)
+	dailies, err := listDailies(gid, from, monday.AddDate(0, 0, 6).Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	if len(dailies) == 0 {
+		return nil, errNoDaily
+	}
+	d, err := getDigest(kindWeekly, gid, from)
+	if err != nil {
+		return nil, err
+	}
+	if d != nil && d.Count == len(dailies) && d.Time >= dailies[len(dailies)-1].Time {
+		return d, nil
+	}
+	var sb strings.Builder
+	sb.WriteString(weeklyPrompt)
+	for _, daily := range dailies {
+		sb.WriteString("\n## ")
+		sb.WriteString(daily.Date)
+		sb.WriteString("\n")
+		sb.WriteString(daily.Summary)
+		sb.WriteString("\n")
+	}
+	summary, err := llmchat(sb.String(), temp, gid, uid)
+	if err != nil {
+		return nil, err
+	}
+	d = &digest{
+		GroupID: gid,
+		Kind:    kindWeekly,
+		Date:    from,
+		Count:   len(dailies),
+		Summary: summary,
+		Time:    now.Unix(),
+	}
+	return d, saveDigest(d)
+}
+
+// dailyTitle 每日总结的标题
+func dailyTitle(d *digest) string {
+	return d.Date + " 的群聊总结 (" + strconv.Itoa(d.Count) + " 条消息):"
+}
+
+// weeklyTitle 每周总结的标题
+func weeklyTitle(d *digest) string {
+	return d.Date + " 起的本周总结 (基于 " + strconv.Itoa(d.Count) + " 天的每日总结):"
+}
+
+// parseClock 解析 22:00 形式的时间为当天的第几分钟
+func parseClock(h, m string) (int, bool) {
+	if h == "" {
+		return defaultDigestMinute, true
+	}
+	hour, _ := strconv.Atoi(h)
+	minute, _ := strconv.Atoi(m)
+	if hour > 23 || minute > 59 {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
+
+// formatClock 把当天的第几分钟转为 22:00 形式
+func formatClock(minute int) string {
+	return fmt.Sprintf("%d:%02d", minute/60, minute%60)
+}
+
+// ensureConfig 定时任务没有触发的消息, 需要自行读取大模型配置
+func ensureConfig() bool {
+	if chat.AC.Key == "" {
+		if c, ok := control.Lookup("aichat"); ok {
+			_ = c.GetExtra(&chat.AC)
+		}
+	}
+	return chat.AC.Key != ""
+}
+
+// groupTemp 群设置的温度
+func groupTemp(gid int64) float32 {
+	var data int64
+	if c, ok := control.Lookup("llm"); ok {
+		data = c.GetData(gid)
+	}
+	return chat.Storage(data).Temp()
+}
+
+// runDigest 每分钟检查一次需要发送每日总结的群
+func runDigest() {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		now = time.Now()
+		ss, err := dueSchedules(now.Hour()*60 + now.Minute())
+		if err != nil {
+			logrus.Warnln("[llm] 读取每日总结设置失败:", err)
+			continue
+		}
+		if len(ss) == 0 {
+			continue
+		}
+		if !ensureConfig() {
+			logrus.Warnln("[llm] 未配置大模型, 跳过每日总结")
+			continue
+		}
+		for _, s := range ss {
+			if !en.IsEnabledIn(s.GroupID) {
+				continue
+			}
+			zero.RangeBot(func(id int64, ctx *zero.Ctx) bool {
+				d, err := makeDaily(ctx, s.GroupID, 0, now, now, groupTemp(s.GroupID))
+				if err != nil {
+					var e *usage.ExceededError
+					if errors.As(err, &e) {
+						ctx.SendGroupMessage(s.GroupID, message.Text("今天的群聊总结没有生成: ", err))
+					} else if err != errNoMessage {
+						logrus.Warnln("[llm] 生成群", s.GroupID, "的每日总结失败:", err)
+					}
+					return false
+				}
+				ctx.SendGroupForwardMessage(s.GroupID, digestNodes(id, dailyTitle(d), d.Summary))
+				return false
+			})
+		}
+	}
+}
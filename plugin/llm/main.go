@@ -2,13 +2,13 @@
 package llm
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/fumiama/deepinfra"
 	"github.com/fumiama/deepinfra/model"
-	"github.com/tidwall/gjson"
 
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/extension/single"
@@ -18,6 +18,9 @@ import (
 	"github.com/FloatTech/zbputils/chat"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aichatcfg/usage"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/msgarchive/archive"
 )
 
 var (
@@ -26,7 +29,13 @@ var (
 		DisableOnDefault: false,
 		Brief:            "大模型聊天和群聊总结",
 		Help: "- 群聊总结 [消息数目]|群聊总结 1000\n" +
-			"- /gpt [内容] （使用大模型聊天）\n",
+			"- /gpt [内容] （使用大模型聊天）\n" +
+			"- 开启每日总结 [22:00] (仅管理员)\n" +
+			"- 关闭每日总结 (仅管理员)\n" +
+			"- 查看昨日总结\n" +
+			"- 本周总结 (由本周的每日总结合成)\n" +
+			"Tips: 用量计入 aichatcfg 中设置的AI聊天额度, 用完后不再调用大模型\n",
+		PrivateDataFolder: "llm",
 	}).ApplySingle(single.New(
 		single.WithKeyFn(func(ctx *zero.Ctx) int64 {
 			if ctx.Event.GroupID == 0 {
@@ -43,13 +52,22 @@ var (
 )
 
 func init() {
+	if err := initDatabase(en.DataFolder() + "digest.db"); err != nil {
+		panic(err)
+	}
+	go runDigest()
+
 	// 添加群聊总结功能
 	en.OnRegex(`^群聊总结\s?(\d*)$`, chat.EnsureConfig, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Limit(limit.LimitByGroup).Handle(func(ctx *zero.Ctx) {
-		ctx.SendChain(message.Text("少女思考中..."))
 		gid := ctx.Event.GroupID
 		if gid == 0 {
 			gid = -ctx.Event.UserID
 		}
+		if err := usage.Check(gid, ctx.Event.UserID, time.Now()); err != nil {
+			ctx.SendChain(message.Text(err))
+			return
+		}
+		ctx.SendChain(message.Text("少女思考中..."))
 		p, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
 		if p > 1000 {
 			p = 1000
@@ -63,48 +81,23 @@ func init() {
 			return
 		}
 
-		var messages []string
-
-		h := ctx.GetGroupMessageHistory(gid, 0, p, false)
-		h.Get("messages").ForEach(func(_, msgObj gjson.Result) bool {
-			nickname := msgObj.Get("sender.nickname").Str
-			text := strings.TrimSpace(message.ParseMessageFromString(msgObj.Get("raw_message").Str).ExtractPlainText())
-			if text != "" {
-				messages = append(messages, nickname+": "+text)
-			}
-			return true
-		})
+		messages := history(ctx, gid, p)
 
 		if len(messages) == 0 {
 			ctx.SendChain(message.Text("ERROR: 历史消息为空或者无法获得历史消息"))
 			return
 		}
 
-		// 构造总结请求提示 (使用通用版省流提示词)
-		// 使用反引号定义多行字符串，更清晰
-		promptTemplate := `请对以下群聊对话进行【极简总结】。
-要求：
-1. 剔除客套与废话，直击主题。
-2. 使用 Markdown 列表格式。
-3. 按以下结构输出：
-   - 🎯 核心议题：(一句话概括)
-   - 💡 关键观点/结论：(提取3-5个重点)
-   - ✅ 下一步/待办：(如果有，明确谁做什么)
-
-群聊对话内容如下：
-`
-		summaryPrompt := promptTemplate + strings.Join(messages, "\n")
-
 		stor, err := chat.NewStorage(ctx, gid)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return
 		}
 		// 调用大模型API进行总结
-		summary, err := llmchat(summaryPrompt, stor.Temp())
+		summary, err := llmchat(summaryPrompt+strings.Join(messages, "\n"), stor.Temp(), gid, ctx.Event.UserID)
 
 		if err != nil {
-			ctx.SendChain(message.Text("ERROR: ", err))
+			sendErr(ctx, err)
 			return
 		}
 
@@ -119,29 +112,89 @@ func init() {
 		b.WriteString(summary)
 
 		// 分割总结内容为多段（按1000字符长度切割）
-		summaryText := b.String()
 		msg := make(message.Message, 0)
-		for len(summaryText) > 0 {
-			if len(summaryText) <= 1000 {
-				msg = append(msg, ctxext.FakeSenderForwardNode(ctx, message.Text(summaryText)))
-				break
-			}
-
-			// 查找1000字符内的最后一个换行符，尽量在换行处分割
-			chunk := summaryText[:1000]
-			lastNewline := strings.LastIndex(chunk, "\n")
-			if lastNewline > 0 {
-				chunk = summaryText[:lastNewline+1]
-			}
-
+		for _, chunk := range splitText(b.String(), chunkSize) {
 			msg = append(msg, ctxext.FakeSenderForwardNode(ctx, message.Text(chunk)))
-			summaryText = summaryText[len(chunk):]
 		}
 		if len(msg) > 0 {
 			ctx.Send(msg)
 		}
 	})
 
+	en.OnRegex(`^开启每日总结\s*(?:(\d{1,2})[:：](\d{2}))?$`, chat.EnsureConfig, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			minute, ok := parseClock(matched[1], matched[2])
+			if !ok {
+				ctx.SendChain(message.Text("ERROR: 时间格式应为 22:00"))
+				return
+			}
+			if err := setSchedule(ctx.Event.GroupID, minute); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已开启每日总结, 每天 ", formatClock(minute), " 总结当天的群聊"))
+		})
+	en.OnFullMatch("关闭每日总结", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ok, err := delSchedule(ctx.Event.GroupID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if !ok {
+				ctx.SendChain(message.Text("本群没有开启每日总结"))
+				return
+			}
+			ctx.SendChain(message.Text("已关闭每日总结"))
+		})
+	en.OnFullMatch("查看昨日总结", chat.EnsureConfig, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			now := time.Now()
+			yesterday := dayStart(now).AddDate(0, 0, -1)
+			d, err := getDigest(kindDaily, gid, yesterday.Format(dateLayout))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if d == nil {
+				// 没有保存的总结时, 只能从本地存档补做, 网络历史无法按日期读取
+				if !archive.Covered(gid) {
+					ctx.SendChain(message.Text("没有昨日的总结, 请先开启每日总结"))
+					return
+				}
+				ctx.SendChain(message.Text("少女思考中..."))
+				stor, err := chat.NewStorage(ctx, gid)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				d, err = makeDaily(ctx, gid, ctx.Event.UserID, yesterday, now, stor.Temp())
+				if err != nil {
+					sendErr(ctx, err)
+					return
+				}
+			}
+			ctx.Send(digestNodes(ctx.Event.SelfID, dailyTitle(d), d.Summary))
+		})
+	en.OnFullMatch("本周总结", chat.EnsureConfig, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			stor, err := chat.NewStorage(ctx, gid)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("少女思考中..."))
+			d, err := makeWeekly(gid, ctx.Event.UserID, time.Now(), stor.Temp())
+			if err != nil {
+				sendErr(ctx, err)
+				return
+			}
+			ctx.Send(digestNodes(ctx.Event.SelfID, weeklyTitle(d), d.Summary))
+		})
+
 	// 添加 /gpt 命令处理（同时支持回复消息和直接使用）
 	en.OnKeyword("/gpt", chat.EnsureConfig).SetBlock(true).Handle(func(ctx *zero.Ctx) {
 		gid := ctx.Event.GroupID
@@ -196,29 +249,16 @@ func init() {
 			return
 		}
 		// 调用大模型API进行聊天
-		reply, err := llmchat(query, stor.Temp())
+		reply, err := llmchat(query, stor.Temp(), gid, ctx.Event.UserID)
 		if err != nil {
-			ctx.SendChain(message.Text("ERROR: ", err))
+			sendErr(ctx, err)
 			return
 		}
 
 		// 分割总结内容为多段（按1000字符长度切割）
 		msg := make(message.Message, 0)
-		for len(reply) > 0 {
-			if len(reply) <= 1000 {
-				msg = append(msg, ctxext.FakeSenderForwardNode(ctx, message.Text(reply)))
-				break
-			}
-
-			// 查找1000字符内的最后一个换行符，尽量在换行处分割
-			chunk := reply[:1000]
-			lastNewline := strings.LastIndex(chunk, "\n")
-			if lastNewline > 0 {
-				chunk = reply[:lastNewline+1]
-			}
-
+		for _, chunk := range splitText(reply, chunkSize) {
 			msg = append(msg, ctxext.FakeSenderForwardNode(ctx, message.Text(chunk)))
-			reply = reply[len(chunk):]
 		}
 		if len(msg) > 0 {
 			ctx.Send(msg)
@@ -226,15 +266,19 @@ func init() {
 	})
 }
 
-// llmchat 调用大模型API包装
-func llmchat(prompt string, temp float32) (string, error) {
+// llmchat 调用大模型API包装, 并记录 gid 与 uid 的用量, 额度用完时返回 *usage.ExceededError
+func llmchat(prompt string, temp float32, gid, uid int64) (string, error) {
+	if err := usage.Check(gid, uid, time.Now()); err != nil {
+		return "", err
+	}
 	topp, maxn := chat.AC.MParams()
 
 	x := deepinfra.NewAPI(chat.AC.API, string(chat.AC.Key))
+	x.SetHTTPClient(usage.Client(usage.Call{Plugin: "llm", GroupID: gid, UserID: uid, Model: chat.AC.ModelName}))
 
 	mod, err := chat.AC.Type.Protocol(chat.AC.ModelName, temp, topp, maxn)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
 	data, err := x.Request(mod.User(model.NewContentText(prompt)))
@@ -244,3 +288,23 @@ func llmchat(prompt string, temp float32) (string, error) {
 
 	return strings.TrimSpace(data), nil
 }
+
+// sendErr 发送错误, 额度用完时只发送提示
+func sendErr(ctx *zero.Ctx, err error) {
+	var e *usage.ExceededError
+	if errors.As(err, &e) {
+		ctx.SendChain(message.Text(err))
+		return
+	}
+	ctx.SendChain(message.Text("ERROR: ", err))
+}
+
+// history 群内最近 n 条消息的文字部分
+func history(ctx *zero.Ctx, gid, n int64) (messages []string) {
+	for _, m := range archive.History(ctx, gid, int(n)) {
+		if m.Text != "" {
+			messages = append(messages, m.Name+": "+m.Text)
+		}
+	}
+	return
+}
@@ -48,6 +48,11 @@ const (
 		"- 在\"cron\"时(用[url])提醒大家[xxx]\n" +
 		"- 取消在\"cron\"的提醒\n" +
 		"- 列出所有提醒\n" +
+		"- 30分钟后(私聊)提醒我XXX\n" +
+		"- 明天早上8点(半)(私聊)提醒我XXX\n" +
+		"- 稍后提醒 [10分钟]\n" +
+		"- 我的提醒\n" +
+		"- 取消提醒 [提醒ID]\n" +
 		"- 翻牌\n" +
 		"- 赞我\n" +
 		"- 群签到\n" +
@@ -67,6 +72,8 @@ const (
 	verifyTimeout    = 60
 	maxBanMinutes    = 43199
 	banMultiplierDay = 60 * 24
+	maxUserReminders = 16
+	defaultSnooze    = time.Minute * 10
 )
 
 var (
@@ -300,6 +307,75 @@ func init() { // 插件主体
 		Handle(func(ctx *zero.Ctx) {
 			ctx.SendChain(message.Text(clock.ListTimers(ctx.Event.GroupID)))
 		})
+	// 相对时间提醒
+	engine.OnRegex(`^(\d{1,3}|半|两|[一二三四五六七八九十]{1,3})(分钟|个?小时|天)后(私聊)?提醒我(.+)$`).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			d, err := timer.ParseAfter(args[1], args[2])
+			if err != nil {
+				ctx.SendChain(message.Text("参数非法:", err))
+				return
+			}
+			registerReminder(ctx, time.Now().Add(d), args[3] != "", args[4])
+		})
+	// 指定日期时刻提醒
+	engine.OnRegex(`^(今天|明天|后天)(凌晨|早上|上午|中午|下午|晚上|夜里)?(\d{1,2}|[零一二三四五六七八九十]{1,3})点(半|(?:\d{1,2}|[零一二三四五六七八九十]{1,3})分)?(私聊)?提醒我(.+)$`).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			at, err := timer.ParseDayClock(time.Now(), args[1], args[2], args[3], args[4])
+			if err != nil {
+				ctx.SendChain(message.Text("参数非法:", err))
+				return
+			}
+			registerReminder(ctx, at, args[5] != "", args[6])
+		})
+	// 推迟最近一次触发的提醒
+	engine.OnRegex(`^稍后提醒\s*(?:(\d{1,3}|半|两|[一二三四五六七八九十]{1,3})(分钟|个?小时))?$`).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			d := defaultSnooze
+			if args[1] != "" {
+				var err error
+				d, err = timer.ParseAfter(args[1], args[2])
+				if err != nil {
+					ctx.SendChain(message.Text("参数非法:", err))
+					return
+				}
+			}
+			ts, ok := clock.Snooze(ctx.Event.UserID, d)
+			switch {
+			case ts == nil:
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("最近没有可以推迟的提醒哦~"))
+			case ok:
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("好的, ", time.Unix(ts.Once, 0).Format("15:04"), " 再提醒你~"))
+			default:
+				ctx.SendChain(message.Text("出错啦: ", ts.Alert))
+			}
+		})
+	// 列出自己的提醒
+	engine.OnFullMatch("我的提醒").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			list := clock.ListUserTimers(ctx.Event.UserID)
+			if len(list) == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你还没有待触发的提醒哦~"))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(list))
+		})
+	// 取消自己的提醒
+	engine.OnRegex(`^取消提醒\s*\[?([0-9a-fA-F]{1,8})\]?$`).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			key, err := strconv.ParseUint(ctx.State["regex_matched"].([]string)[1], 16, 32)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if clock.CancelUserTimer(ctx.Event.UserID, uint32(key)) {
+				ctx.SendChain(message.Text("取消成功~"))
+			} else {
+				ctx.SendChain(message.Text("没有这个提醒哦~"))
+			}
+		})
 	// 随机点名
 	engine.OnFullMatchGroup([]string{"翻牌"}, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
@@ -689,6 +765,23 @@ func initializeDB(dataFolder string) {
 	}
 }
 
+// registerReminder 为发送者注册一个在 at 时刻触发的单次提醒, 私聊中的提醒总是私聊发送
+func registerReminder(ctx *zero.Ctx, at time.Time, private bool, alert string) {
+	if clock.CountUserTimers(ctx.Event.UserID) >= maxUserReminders {
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你的提醒太多啦, 先取消一些吧~"))
+		return
+	}
+	if ctx.Event.GroupID == 0 {
+		private = true
+	}
+	ts := timer.GetFilledOnceTimer(at, alert, "", ctx.Event.SelfID, ctx.Event.GroupID, ctx.Event.UserID, private)
+	if !clock.RegisterTimer(ts, true, false) {
+		ctx.SendChain(message.Text("出错啦: ", ts.Alert))
+		return
+	}
+	ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("记住了~将在", at.Format("01月02日15:04"), "提醒你\n提醒ID: ", fmt.Sprintf("%08x", ts.ID)))
+}
+
 func getNickname(ctx *zero.Ctx, qq int64) string {
 	return ctx.GetThisGroupMemberInfo(qq, false).Get("nickname").Str
 }
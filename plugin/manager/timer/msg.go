@@ -7,10 +7,23 @@ import (
 
 func (t *Timer) sendmsg(grp int64, ctx *zero.Ctx) {
 	ctx.Event = new(zero.Event)
-	ctx.Event.GroupID = grp
-	if t.URL == "" {
-		ctx.SendChain(atall, message.Text(t.Alert))
-	} else {
-		ctx.SendChain(atall, message.Text(t.Alert), message.Image(t.URL).Add("cache", "0"))
+	msg := make(message.Message, 0, 3)
+	switch {
+	case t.Private:
+		ctx.Event.UserID = t.UserID
+	case t.UserID != 0:
+		ctx.Event.GroupID = grp
+		msg = append(msg, message.At(t.UserID))
+	default:
+		ctx.Event.GroupID = grp
+		msg = append(msg, atall)
 	}
+	msg = append(msg, message.Text(t.Alert))
+	if t.Once != 0 {
+		msg = append(msg, message.Text("\n(发送\"稍后提醒 N分钟\"可推迟)"))
+	}
+	if t.URL != "" {
+		msg = append(msg, message.Image(t.URL).Add("cache", "0"))
+	}
+	ctx.Send(msg)
 }
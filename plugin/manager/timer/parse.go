@@ -17,6 +17,9 @@ func (t *Timer) GetTimerInfo() string {
 	if t.Cron != "" {
 		return fmt.Sprintf("[%d]%s", t.GrpID, t.Cron)
 	}
+	if t.Once != 0 {
+		return fmt.Sprintf("[%d]%d@%d:%s", t.GrpID, t.UserID, t.Once, t.Alert)
+	}
 	return fmt.Sprintf("[%d]%d月%d日%d周%d:%d", t.GrpID, t.Month(), t.Day(), t.Week(), t.Hour(), t.Minute())
 }
 
@@ -0,0 +1,151 @@
+package timer
+
+import (
+	"errors"
+	"time"
+	"unicode"
+)
+
+var (
+	errReminderTooFar  = errors.New("时间太久远啦")
+	errReminderPassed  = errors.New("这个时间已经过去了")
+	errReminderIllegal = errors.New("时间非法")
+)
+
+// GetFilledOnceTimer 获得在 at 时刻触发一次的 ts
+//
+// uid 为提醒对象, private 为真时通过私聊发送, 否则在群 grp 中 @ 提醒对象
+func GetFilledOnceTimer(at time.Time, alert, img string, botqq, grp, uid int64, private bool) *Timer {
+	var t Timer
+	t.Alert = alert
+	t.URL = img
+	t.SelfID = botqq
+	t.GrpID = grp
+	t.UserID = uid
+	t.Private = private
+	t.Once = at.Unix()
+	t.SetEn(true)
+	return &t
+}
+
+// ParseAfter 解析 "30分钟" "半小时" "两天" 形式的相对时间
+func ParseAfter(num, unit string) (time.Duration, error) {
+	var d time.Duration
+	switch unit {
+	case "分钟":
+		d = time.Minute
+	case "小时", "个小时":
+		d = time.Hour
+	case "天":
+		d = time.Hour * 24
+	default:
+		return 0, errReminderIllegal
+	}
+	var n time.Duration
+	switch num {
+	case "半":
+		if d == time.Minute {
+			return 0, errReminderIllegal
+		}
+		d /= 2
+		n = 1
+	case "两":
+		n = 2
+	default:
+		rs := []rune(num)
+		if len(rs) == 0 {
+			return 0, errReminderIllegal
+		}
+		rs = trimChineseTens(rs)
+		n = time.Duration(chineseNum2Int(rs))
+	}
+	if n <= 0 {
+		return 0, errReminderIllegal
+	}
+	d *= n
+	if d > maxTimerDuration {
+		return 0, errReminderTooFar
+	}
+	return d, nil
+}
+
+// ParseDayClock 解析 "明天早上8点半" 形式的时刻, 各参数依次为日、时段、时、分
+//
+// 时段可为空, 分可为空或 "半"/"X分"
+func ParseDayClock(now time.Time, day, period, hour, minute string) (time.Time, error) {
+	offset := 0
+	switch day {
+	case "今天":
+	case "明天":
+		offset = 1
+	case "后天":
+		offset = 2
+	default:
+		return time.Time{}, errReminderIllegal
+	}
+
+	hrs := []rune(hour)
+	if len(hrs) == 0 {
+		return time.Time{}, errReminderIllegal
+	}
+	hrs = trimChineseTens(hrs)
+	h := chineseNum2Int(hrs)
+	switch period {
+	case "晚上", "夜里":
+		// 晚上12点是当天结束, 即次日0点
+		if h == 12 {
+			h = 0
+			offset++
+		} else if h < 12 {
+			h += 12
+		}
+	case "下午":
+		if h < 12 {
+			h += 12
+		}
+	case "中午":
+		if h < 3 {
+			h += 12
+		}
+	case "凌晨", "早上", "上午", "":
+	default:
+		return time.Time{}, errReminderIllegal
+	}
+	if err := validateHour(h); err != nil || h < 0 {
+		return time.Time{}, errReminderIllegal
+	}
+
+	m := 0
+	switch {
+	case minute == "":
+	case minute == "半":
+		m = 30
+	default:
+		mrs := []rune(minute)
+		if mrs[len(mrs)-1] == '分' {
+			mrs = mrs[:len(mrs)-1]
+		}
+		if len(mrs) == 0 {
+			return time.Time{}, errReminderIllegal
+		}
+		mrs = trimChineseTens(mrs)
+		m = chineseNum2Int(mrs)
+		if err := validateMinute(m); err != nil || m < 0 {
+			return time.Time{}, errReminderIllegal
+		}
+	}
+
+	at := time.Date(now.Year(), now.Month(), now.Day()+offset, h, m, 0, 0, now.Location())
+	if !at.After(now) {
+		return time.Time{}, errReminderPassed
+	}
+	return at, nil
+}
+
+// trimChineseTens 将 "二十三" 形式的三位汉字数字化为 chineseNum2Int 可处理的两位
+func trimChineseTens(rs []rune) []rune {
+	if len(rs) == 3 && !unicode.IsDigit(rs[0]) {
+		return []rune{rs[0], rs[2]}
+	}
+	return rs
+}
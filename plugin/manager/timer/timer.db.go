@@ -13,6 +13,16 @@ type Timer struct {
 	Alert                       string `db:"alert"`
 	Cron                        string `db:"cron"`
 	URL                         string `db:"url"`
+	UserID                      int64  `db:"uid"`  // 提醒对象, 为 0 时 @全体
+	Private                     bool   `db:"priv"` // 是否通过私聊发送
+	Once                        int64  `db:"once"` // 单次提醒的 unix 时间戳, 为 0 时为周期提醒
+}
+
+// 旧版本 timer 表缺少的列, 需与 Timer 末尾字段顺序一致
+var timerAppendedColumns = []string{
+	"uid BIGINT NOT NULL DEFAULT 0",
+	"priv BOOLEAN NOT NULL DEFAULT 0",
+	"once BIGINT NOT NULL DEFAULT 0",
 }
 
 // InsertInto 插入自身
@@ -20,6 +30,13 @@ func (t *Timer) InsertInto(db *sql.Sqlite) error {
 	return db.Insert("timer", t)
 }
 
+// migrateTimerTable 为旧表补齐新增的列, 列已存在时忽略错误
+func migrateTimerTable(db *sql.Sqlite) {
+	for _, col := range timerAppendedColumns {
+		_, _ = db.Exec("ALTER TABLE timer ADD COLUMN " + col + ";")
+	}
+}
+
 /*
 func getTimerFrom(db *sql.Sqlite, id uint32) (t Timer, err error) {
 	err = db.Find("timer", &t, "WHERE id = "+strconv.Itoa(int(id)))
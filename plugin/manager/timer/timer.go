@@ -1,6 +1,8 @@
 package timer
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +27,8 @@ type Clock struct {
 	cron     *cron.Cron
 	entries  map[uint32]cron.EntryID
 	entmu    sync.Mutex
+	fired    map[int64]*Timer // 每个用户最近一次触发的单次提醒, 用于稍后提醒
+	firedmu  sync.Mutex
 }
 
 var (
@@ -43,6 +47,7 @@ func NewClock(db *sql.Sqlite) (c *Clock) {
 		timers:  make(map[uint32]*Timer),
 		cron:    cron.New(),
 		entries: make(map[uint32]cron.EntryID),
+		fired:   make(map[int64]*Timer),
 	}
 	c.loadTimers(db)
 	c.cron.Start()
@@ -64,8 +69,11 @@ func (c *Clock) RegisterTimer(ts *Timer, save, isinit bool) bool {
 
 	logrus.Infoln("[群管]注册计时器", key)
 
-	if ts.Cron != "" {
+	switch {
+	case ts.Cron != "":
 		return c.registerCronTimer(ts, save, isinit)
+	case ts.Once != 0:
+		return c.registerOnceTimer(ts, save, isinit)
 	}
 	return c.registerStandardTimer(ts, save)
 }
@@ -105,6 +113,50 @@ func (c *Clock) registerStandardTimer(ts *Timer, save bool) bool {
 	return true
 }
 
+func (c *Clock) registerOnceTimer(ts *Timer, save, isinit bool) bool {
+	if save {
+		if err := c.AddTimerIntoDB(ts); err != nil {
+			ts.Alert = err.Error()
+			return false
+		}
+	}
+	if err := c.AddTimerIntoMap(ts); err != nil {
+		return false
+	}
+
+	go c.runOnceTimer(ts, isinit)
+	return true
+}
+
+func (c *Clock) runOnceTimer(ts *Timer, isinit bool) {
+	duration := time.Until(time.Unix(ts.Once, 0))
+	logrus.Printf("[群管]单次计时器%08x将睡眠%ds", ts.ID, duration/time.Second)
+	if duration > 0 {
+		time.Sleep(duration)
+	}
+	if !ts.En() {
+		return
+	}
+
+	ctx := c.getBotContext(ts, isinit)
+	// 启动时 bot 可能尚未连接, 保留提醒并稍后重试
+	for ctx == nil {
+		logrus.Warnf("[群管]单次计时器%08x没有可用的bot, 1分钟后重试", ts.ID)
+		time.Sleep(time.Minute)
+		if !ts.En() {
+			return
+		}
+		ctx = c.getBotContext(ts, false)
+	}
+	ts.sendmsg(ts.GrpID, ctx)
+
+	// 单次提醒触发后即从数据库移除, 但保留以供稍后提醒
+	_ = c.CancelTimer(ts.ID)
+	c.firedmu.Lock()
+	c.fired[ts.UserID] = ts
+	c.firedmu.Unlock()
+}
+
 func (c *Clock) runStandardTimer(ts *Timer) {
 	for ts.En() {
 		nextdate := ts.nextWakeTime()
@@ -218,6 +270,13 @@ func (c *Clock) ListTimers(grpID int64) []string {
 }
 
 func formatTimerInfo(t *Timer) string {
+	if t.Once != 0 {
+		way := "群聊"
+		if t.Private {
+			way = "私聊"
+		}
+		return fmt.Sprintf("%s %s提醒%d: %s\n", time.Unix(t.Once, 0).Format("01月02日15:04"), way, t.UserID, t.Alert)
+	}
 	k := t.GetTimerInfo()
 	start := strings.Index(k, "]")
 	if start == -1 {
@@ -231,6 +290,63 @@ func formatTimerInfo(t *Timer) string {
 	return msg
 }
 
+// ListUserTimers 列出某人的所有单次提醒
+func (c *Clock) ListUserTimers(uid int64) []string {
+	c.timersmu.RLock()
+	defer c.timersmu.RUnlock()
+
+	ts := make([]*Timer, 0, 8)
+	for _, v := range c.timers {
+		if v.Once != 0 && v.UserID == uid {
+			ts = append(ts, v)
+		}
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].Once < ts[j].Once
+	})
+	keys := make([]string, len(ts))
+	for i, v := range ts {
+		keys[i] = fmt.Sprintf("[%08x]%s", v.ID, formatTimerInfo(v))
+	}
+	return keys
+}
+
+// CountUserTimers 统计某人尚未触发的单次提醒数
+func (c *Clock) CountUserTimers(uid int64) (n int) {
+	c.timersmu.RLock()
+	for _, v := range c.timers {
+		if v.Once != 0 && v.UserID == uid {
+			n++
+		}
+	}
+	c.timersmu.RUnlock()
+	return
+}
+
+// CancelUserTimer 取消某人自己的单次提醒
+func (c *Clock) CancelUserTimer(uid int64, key uint32) bool {
+	t, ok := c.GetTimer(key)
+	if !ok || t.Once == 0 || t.UserID != uid {
+		return false
+	}
+	return c.CancelTimer(key)
+}
+
+// Snooze 将某人最近一次触发的提醒推迟 d 后再次提醒
+func (c *Clock) Snooze(uid int64, d time.Duration) (*Timer, bool) {
+	c.firedmu.Lock()
+	last, ok := c.fired[uid]
+	if ok {
+		delete(c.fired, uid)
+	}
+	c.firedmu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	ts := GetFilledOnceTimer(time.Now().Add(d), last.Alert, last.URL, last.SelfID, last.GrpID, last.UserID, last.Private)
+	return ts, c.RegisterTimer(ts, true, false)
+}
+
 // GetTimer 获得定时器
 func (c *Clock) GetTimer(key uint32) (t *Timer, ok bool) {
 	c.timersmu.RLock()
@@ -260,6 +376,7 @@ func (c *Clock) loadTimers(db *sql.Sqlite) {
 	if err != nil {
 		return
 	}
+	migrateTimerTable(c.db)
 
 	var t Timer
 	_ = c.db.FindFor("timer", &t, "", func() error {
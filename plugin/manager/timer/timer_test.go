@@ -74,3 +74,82 @@ func TestChineseNum2Int(t *testing.T) {
 		}
 	}
 }
+
+func TestParseAfter(t *testing.T) {
+	tests := []struct {
+		num, unit string
+		expected  time.Duration
+	}{
+		{"30", "分钟", time.Minute * 30},
+		{"半", "小时", time.Minute * 30},
+		{"两", "个小时", time.Hour * 2},
+		{"二十五", "分钟", time.Minute * 25},
+		{"120", "分钟", time.Minute * 120},
+		{"三", "天", time.Hour * 72},
+	}
+	for _, tt := range tests {
+		d, err := ParseAfter(tt.num, tt.unit)
+		if err != nil {
+			t.Fatalf("ParseAfter(%q, %q) 出错: %v", tt.num, tt.unit, err)
+		}
+		if d != tt.expected {
+			t.Errorf("ParseAfter(%q, %q) = %v, 期望 %v", tt.num, tt.unit, d, tt.expected)
+		}
+	}
+	if _, err := ParseAfter("半", "分钟"); err == nil {
+		t.Error("半分钟应当非法")
+	}
+	if _, err := ParseAfter("999", "天"); err == nil {
+		t.Error("超过一年应当非法")
+	}
+}
+
+func TestParseDayClock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		day, period, hour, minute string
+		expected                  time.Time
+	}{
+		{"明天", "早上", "8", "", time.Date(2024, 5, 2, 8, 0, 0, 0, time.Local)},
+		{"今天", "晚上", "九", "半", time.Date(2024, 5, 1, 21, 30, 0, 0, time.Local)},
+		{"后天", "", "二十三", "十五分", time.Date(2024, 5, 3, 23, 15, 0, 0, time.Local)},
+		{"今天", "晚上", "12", "", time.Date(2024, 5, 2, 0, 0, 0, 0, time.Local)},
+		{"明天", "夜里", "十二", "半", time.Date(2024, 5, 3, 0, 30, 0, 0, time.Local)},
+		{"明天", "下午", "12", "", time.Date(2024, 5, 2, 12, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		at, err := ParseDayClock(now, tt.day, tt.period, tt.hour, tt.minute)
+		if err != nil {
+			t.Fatalf("ParseDayClock(%q, %q, %q, %q) 出错: %v", tt.day, tt.period, tt.hour, tt.minute, err)
+		}
+		if !at.Equal(tt.expected) {
+			t.Errorf("ParseDayClock(%q, %q, %q, %q) = %v, 期望 %v", tt.day, tt.period, tt.hour, tt.minute, at, tt.expected)
+		}
+	}
+	if _, err := ParseDayClock(now, "今天", "早上", "8", ""); err == nil {
+		t.Error("已过去的时间应当非法")
+	}
+}
+
+func TestOnceTimerPersist(t *testing.T) {
+	db := sql.New(t.TempDir() + "/timer.db")
+	if err := db.Open(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	c := NewClock(&db)
+	ts := GetFilledOnceTimer(time.Now().Add(time.Hour), "test remind", "", 0, 12345, 67890, true)
+	if !c.RegisterTimer(ts, true, false) {
+		t.Fatalf("注册单次提醒失败: %s", ts.Alert)
+	}
+	c.Shutdown()
+
+	var loaded Timer
+	if err := db.Find("timer", &loaded, "WHERE id = ?", ts.ID); err != nil {
+		t.Fatalf("读取单次提醒失败: %v", err)
+	}
+	if loaded.Once != ts.Once || loaded.UserID != 67890 || !loaded.Private {
+		t.Errorf("单次提醒未正确保存: %+v", loaded)
+	}
+}
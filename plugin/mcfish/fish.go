@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	"github.com/FloatTech/zbputils/ctxext"
 	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
@@ -72,7 +73,7 @@ func init() {
 						ctx.SendChain(message.Text("你钱包当前只有", money, wallet.GetWalletName(), ",无法完成支付"))
 						return
 					}
-					err = wallet.InsertWalletOf(uid, -100)
+					err = ledger.InsertWalletOf(uid, -100, "mcfish", "购买木竿", ctx.Event.GroupID)
 					if err != nil {
 						ctx.SendChain(message.Text("[ERROR at fish.go.3]:", err))
 						return
@@ -23,6 +23,8 @@ import (
 type fishdb struct {
 	sync.RWMutex
 	db sql.Sqlite
+	// lastListingID 已分配的最大挂单编号, 见 nextListingID
+	lastListingID int64
 }
 
 // FishLimit 钓鱼次数上限
@@ -141,6 +143,11 @@ var (
 			"- 附魔[诱钓|海之眷顾]\n" +
 			"- 合成[xx竿|三叉戟]\n" +
 			"- 出售所有垃圾\n" +
+			"- 赠送@xxx 物品 [数量]\n" +
+			"- 上架 物品 数量 单价\n" +
+			"- 钓鱼市场\n" +
+			"- 购买挂单 #id [数量]\n" +
+			"- 下架 #id\n" +
 			"- 当前装备概率明细\n" +
 			"- 查看钓鱼规则\n",
 		PublicDataFolder: "McFish",
@@ -0,0 +1,511 @@
+package mcfish
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	// listingDays 挂单有效天数, 过期后物品退回卖家背包
+	listingDays = 3
+	// maxListings 每人同时最多的挂单数
+	maxListings = 10
+	// maxListingNumber 单个挂单最多的物品数量
+	maxListingNumber = 10000
+	// maxListingPrice 挂单单价上限
+	maxListingPrice = 1000000
+)
+
+var (
+	errThingGone     = errors.New("背包里的物品数量不足")
+	errListingGone   = errors.New("挂单不存在或已下架")
+	errListingNumber = errors.New("挂单剩余数量不足")
+	errListingTotal  = errors.New("挂单总价超出范围")
+)
+
+// listing 钓鱼市场的挂单, 上架的物品从卖家背包中取出, 成交或下架前由市场保管
+type listing struct {
+	ID     int64
+	Seller int64
+	Name   string
+	Type   string
+	Other  string // 鱼竿的耐久/维修次数/诱钓/眷顾, 随挂单原样转手
+	Number int
+	Price  int // 单价
+	Expire int64
+}
+
+// listingSeq 已分配的最大挂单编号, 挂单成交或下架后删除, 编号不能由 MAX(ID) 推出
+type listingSeq struct {
+	ID   int64 // 固定为 0
+	Last int64
+}
+
+// isSingle 鱼竿与三叉戟各自带有耐久与附魔, 背包中一把一条
+func isSingle(name string) bool {
+	return strings.Contains(name, "竿") || name == "三叉戟"
+}
+
+// describe 物品名称, 鱼竿附带耐久与附魔
+func describe(name, other string) string {
+	if other != "" && name != "美西螈" {
+		return name + "(" + other + ")"
+	}
+	return name
+}
+
+// takeThing 从背包取出 number 个 thing no lock
+func (sql *fishdb) takeThing(uid int64, thing article, number int) (article, error) {
+	name := strconv.FormatInt(uid, 10) + "Pack"
+	err := sql.db.Create(name, &article{})
+	if err != nil {
+		return thing, err
+	}
+	// 以库中的数量为准, 防止选择物品期间背包已经变动
+	err = sql.db.Find(name, &thing, "WHERE Duration = ?", thing.Duration)
+	if err != nil || thing.Number < number {
+		return thing, errThingGone
+	}
+	thing.Number -= number
+	if thing.Number == 0 {
+		err = sql.db.Del(name, "WHERE Duration = ?", thing.Duration)
+	} else {
+		err = sql.db.Insert(name, &thing)
+	}
+	return thing, err
+}
+
+// putThing 放入背包, 鱼竿保留原有的耐久与附魔, 其余物品与同名物品合并 no lock
+func (sql *fishdb) putThing(uid int64, thing article, number int) error {
+	name := strconv.FormatInt(uid, 10) + "Pack"
+	err := sql.db.Create(name, &article{})
+	if err != nil {
+		return err
+	}
+	if !isSingle(thing.Name) && sql.db.CanFind(name, "WHERE Name = ?", thing.Name) {
+		old := article{}
+		err = sql.db.Find(name, &old, "WHERE Name = ?", thing.Name)
+		if err != nil {
+			return err
+		}
+		old.Number += number
+		return sql.db.Insert(name, &old)
+	}
+	thing.Duration = time.Now().Unix()
+	for sql.db.CanFind(name, "WHERE Duration = ?", thing.Duration) {
+		thing.Duration++
+	}
+	thing.Number = number
+	return sql.db.Insert(name, &thing)
+}
+
+// giveThing 把背包里的物品赠送给别人
+func (sql *fishdb) giveThing(from, to int64, thing article, number int) error {
+	sql.Lock()
+	defer sql.Unlock()
+	thing, err := sql.takeThing(from, thing, number)
+	if err != nil {
+		return err
+	}
+	err = sql.putThing(to, thing, number)
+	if err != nil {
+		// 退回赠送方
+		_ = sql.putThing(from, thing, number)
+	}
+	return err
+}
+
+// nextListingID 单调递增的挂单编号, 已成交或下架的编号不再复用 no lock
+func (sql *fishdb) nextListingID() (int64, error) {
+	if sql.lastListingID == 0 {
+		err := sql.db.Create("marketSeq", &listingSeq{})
+		if err != nil {
+			return 0, err
+		}
+		seq := listingSeq{}
+		_ = sql.db.Find("marketSeq", &seq, "WHERE ID = 0")
+		var last struct {
+			ID int64
+		}
+		// 兼容计数表出现之前的挂单
+		err = sql.db.Query("SELECT IFNULL(MAX(ID), 0) FROM [market];", &last)
+		if err != nil {
+			return 0, err
+		}
+		sql.lastListingID = max(seq.Last, last.ID)
+	}
+	err := sql.db.Insert("marketSeq", &listingSeq{Last: sql.lastListingID + 1})
+	if err != nil {
+		return 0, err
+	}
+	sql.lastListingID++
+	return sql.lastListingID, nil
+}
+
+// expireListings 将过期挂单的物品退回卖家 no lock
+func (sql *fishdb) expireListings(now time.Time) error {
+	err := sql.db.Create("market", &listing{})
+	if err != nil {
+		return err
+	}
+	ls, err := sql.findListings("WHERE Expire <= ?", now.Unix())
+	if err != nil {
+		return err
+	}
+	for _, l := range ls {
+		err = sql.putThing(l.Seller, article{Name: l.Name, Type: l.Type, Other: l.Other}, l.Number)
+		if err != nil {
+			return err
+		}
+		err = sql.db.Del("market", "WHERE ID = ?", l.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findListings 查询挂单 no lock
+func (sql *fishdb) findListings(condition string, args ...any) (ls []*listing, err error) {
+	if !sql.db.CanFind("market", condition, args...) {
+		return
+	}
+	l := listing{}
+	err = sql.db.FindFor("market", &l, condition, func() error {
+		info := l
+		ls = append(ls, &info)
+		return nil
+	}, args...)
+	return
+}
+
+// addListing 上架物品
+func (sql *fishdb) addListing(uid int64, thing article, number, price int, now time.Time) (listing, error) {
+	sql.Lock()
+	defer sql.Unlock()
+	err := sql.expireListings(now)
+	if err != nil {
+		return listing{}, err
+	}
+	mine, err := sql.findListings("WHERE Seller = ?", uid)
+	if err != nil {
+		return listing{}, err
+	}
+	if len(mine) >= maxListings {
+		return listing{}, errors.New("你最多同时挂" + strconv.Itoa(maxListings) + "单")
+	}
+	thing, err = sql.takeThing(uid, thing, number)
+	if err != nil {
+		return listing{}, err
+	}
+	id, err := sql.nextListingID()
+	if err == nil {
+		l := listing{
+			ID:     id,
+			Seller: uid,
+			Name:   thing.Name,
+			Type:   thing.Type,
+			Other:  thing.Other,
+			Number: number,
+			Price:  price,
+			Expire: now.AddDate(0, 0, listingDays).Unix(),
+		}
+		err = sql.db.Insert("market", &l)
+		if err == nil {
+			return l, nil
+		}
+	}
+	_ = sql.putThing(uid, thing, number)
+	return listing{}, err
+}
+
+// getListings 所有未过期的挂单
+func (sql *fishdb) getListings(now time.Time) ([]*listing, error) {
+	sql.Lock()
+	defer sql.Unlock()
+	err := sql.expireListings(now)
+	if err != nil {
+		return nil, err
+	}
+	return sql.findListings("ORDER BY ID ASC")
+}
+
+// buyListing 购买挂单中的 number 个物品, 货款经钱包由买家付给卖家
+func (sql *fishdb) buyListing(uid, gid, id int64, number int, now time.Time) (listing, error) {
+	sql.Lock()
+	defer sql.Unlock()
+	err := sql.expireListings(now)
+	if err != nil {
+		return listing{}, err
+	}
+	l := listing{}
+	if !sql.db.CanFind("market", "WHERE ID = ?", id) {
+		return l, errListingGone
+	}
+	err = sql.db.Find("market", &l, "WHERE ID = ?", id)
+	if err != nil {
+		return l, err
+	}
+	if l.Seller == uid {
+		return l, errors.New("不能购买自己的挂单, 请使用下架")
+	}
+	if number <= 0 {
+		number = l.Number
+	}
+	if number > l.Number {
+		return l, errListingNumber
+	}
+	if l.Price <= 0 || number > math.MaxInt/l.Price {
+		return l, errListingTotal
+	}
+	idstr := strconv.FormatInt(id, 10)
+	total := l.Price * number
+	err = ledger.Debit(uid, total, "mcfish", "钓鱼市场购买#"+idstr+" "+strconv.Itoa(number)+"个"+l.Name, gid)
+	if err != nil {
+		return l, err
+	}
+	refund := func() {
+		_ = ledger.InsertWalletOf(uid, total, "mcfish", "钓鱼市场购买#"+idstr+"失败退回", gid)
+	}
+	thing := article{Name: l.Name, Type: l.Type, Other: l.Other}
+	err = sql.putThing(uid, thing, number)
+	if err != nil {
+		refund()
+		return l, err
+	}
+	l.Number -= number
+	if l.Number == 0 {
+		err = sql.db.Del("market", "WHERE ID = ?", l.ID)
+	} else {
+		err = sql.db.Insert("market", &l)
+	}
+	if err != nil {
+		_, _ = sql.takeThingByName(uid, thing, number)
+		refund()
+		return l, err
+	}
+	err = ledger.InsertWalletOf(l.Seller, total, "mcfish", "钓鱼市场售出#"+idstr+" "+strconv.Itoa(number)+"个"+l.Name, gid)
+	if err != nil {
+		// 物品已经成交, 货款入账失败只记录日志, 可由超级用户按流水补发
+		logrus.Warnln("[mcfish] 挂单", id, "货款入账失败:", err)
+	}
+	l.Number = number
+	return l, nil
+}
+
+// takeThingByName 撤回刚放入背包的物品 no lock
+func (sql *fishdb) takeThingByName(uid int64, thing article, number int) (article, error) {
+	name := strconv.FormatInt(uid, 10) + "Pack"
+	cond, args := "WHERE Name = ?", []any{thing.Name}
+	if isSingle(thing.Name) {
+		cond, args = "WHERE Name = ? AND Other = ? ORDER BY Duration DESC", []any{thing.Name, thing.Other}
+	}
+	err := sql.db.Find(name, &thing, cond, args...)
+	if err != nil {
+		return thing, err
+	}
+	return sql.takeThing(uid, thing, number)
+}
+
+// removeListing 下架挂单, 物品退回卖家背包
+func (sql *fishdb) removeListing(uid, id int64, force bool, now time.Time) (listing, error) {
+	sql.Lock()
+	defer sql.Unlock()
+	err := sql.expireListings(now)
+	if err != nil {
+		return listing{}, err
+	}
+	l := listing{}
+	if !sql.db.CanFind("market", "WHERE ID = ?", id) {
+		return l, errListingGone
+	}
+	err = sql.db.Find("market", &l, "WHERE ID = ?", id)
+	if err != nil {
+		return l, err
+	}
+	if l.Seller != uid && !force {
+		return l, errors.New("这不是你的挂单")
+	}
+	err = sql.db.Del("market", "WHERE ID = ?", l.ID)
+	if err != nil {
+		return l, err
+	}
+	return l, sql.putThing(l.Seller, article{Name: l.Name, Type: l.Type, Other: l.Other}, l.Number)
+}
+
+// chooseArticle 同名物品有多件时让用户选择, 返回 false 表示已取消
+func chooseArticle(ctx *zero.Ctx, articles []article, action string) (int, bool) {
+	if len(articles) == 1 {
+		return 0, true
+	}
+	msg := make(message.Message, 0, 3+len(articles))
+	msg = append(msg, message.Reply(ctx.Event.MessageID), message.Text("找到以下物品:\n"))
+	for i, info := range articles {
+		msg = append(msg, message.Text("[", i, "] ", describe(info.Name, info.Other), "  数量: ", info.Number, "\n"))
+	}
+	msg = append(msg, message.Text("————————\n输入对应序号进行", action, ",或回复“取消”取消"))
+	ctx.Send(msg)
+	recv, cancel := zero.NewFutureEvent("message", 999, false, zero.RegexRule(`^(取消|\d+)$`), zero.CheckUser(ctx.Event.UserID)).Repeat()
+	defer cancel()
+	for {
+		select {
+		case <-time.After(time.Second * 120):
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("等待超时,取消", action)))
+			return 0, false
+		case e := <-recv:
+			nextcmd := e.Event.Message.String()
+			if nextcmd == "取消" {
+				ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("已取消", action)))
+				return 0, false
+			}
+			index, err := strconv.Atoi(nextcmd)
+			if err != nil || index > len(articles)-1 {
+				ctx.SendChain(message.At(ctx.Event.UserID), message.Text("请输入正确的序号"))
+				continue
+			}
+			return index, true
+		}
+	}
+}
+
+func init() {
+	engine.OnRegex(`^赠送\s*\[CQ:at,qq=(\d+)\]\s*(`+strings.Join(thingList, "|")+`)\s*(\d*)$`, zero.OnlyGroup, getdb).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		matched := ctx.State["regex_matched"].([]string)
+		to, _ := strconv.ParseInt(matched[1], 10, 64)
+		if to == uid {
+			ctx.SendChain(message.Text("不能赠送给自己"))
+			return
+		}
+		thingName := matched[2]
+		number, _ := strconv.Atoi(matched[3])
+		if number == 0 || isSingle(thingName) {
+			number = 1
+		}
+		articles, err := dbdata.getUserThingInfo(uid, thingName)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.1]:", err))
+			return
+		}
+		if len(articles) == 0 {
+			ctx.SendChain(message.Text("你的背包不存在该物品"))
+			return
+		}
+		index, ok := chooseArticle(ctx, articles, "赠送")
+		if !ok {
+			return
+		}
+		thing := articles[index]
+		if thing.Number < number {
+			number = thing.Number
+		}
+		err = dbdata.giveThing(uid, to, thing, number)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.2]:", err))
+			return
+		}
+		ctx.SendChain(message.At(to), message.Text("\n", ctx.CardOrNickName(uid), "赠送给你", number, "个", describe(thing.Name, thing.Other), ",已放入钓鱼背包"))
+	})
+	engine.OnRegex(`^上架\s*(`+strings.Join(thingList, "|")+`)\s*(\d+)\s+(\d+)$`, getdb).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		matched := ctx.State["regex_matched"].([]string)
+		thingName := matched[1]
+		// 超出 int 范围时 Atoi 返回错误
+		number, errNumber := strconv.Atoi(matched[2])
+		price, errPrice := strconv.Atoi(matched[3])
+		if isSingle(thingName) {
+			number, errNumber = 1, nil
+		}
+		if errNumber != nil || errPrice != nil || number <= 0 || number > maxListingNumber || price <= 0 || price > maxListingPrice {
+			ctx.SendChain(message.Text("数量要在1~", maxListingNumber, "之间, 单价要在1~", maxListingPrice, "之间"))
+			return
+		}
+		articles, err := dbdata.getUserThingInfo(uid, thingName)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.3]:", err))
+			return
+		}
+		if len(articles) == 0 {
+			ctx.SendChain(message.Text("你的背包不存在该物品"))
+			return
+		}
+		index, ok := chooseArticle(ctx, articles, "上架")
+		if !ok {
+			return
+		}
+		thing := articles[index]
+		if thing.Number < number {
+			ctx.SendChain(message.Text("你只有", thing.Number, "个", thingName))
+			return
+		}
+		l, err := dbdata.addListing(uid, thing, number, price, time.Now())
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.4]:", err))
+			return
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(
+			"已上架#", l.ID, ": ", describe(l.Name, l.Other), " x", l.Number, ", 单价", l.Price, wallet.GetWalletName(),
+			"\n", listingDays, "天内未售出将退回背包")))
+	})
+	engine.OnFullMatch("钓鱼市场", getdb).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+		ls, err := dbdata.getListings(time.Now())
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.5]:", err))
+			return
+		}
+		if len(ls) == 0 {
+			ctx.SendChain(message.Text("钓鱼市场还没有挂单, 发送“上架 物品 数量 单价”出售你的物品"))
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("钓鱼市场:")
+		for _, l := range ls {
+			sb.WriteString("\n#" + strconv.FormatInt(l.ID, 10) + " " + describe(l.Name, l.Other) + " x" + strconv.Itoa(l.Number) +
+				" 单价" + strconv.Itoa(l.Price) + " 卖家" + ctx.CardOrNickName(l.Seller) +
+				" " + time.Unix(l.Expire, 0).Format("01-02 15:04") + "到期")
+		}
+		sb.WriteString("\n————————\n发送“购买挂单 #id [数量]”购买")
+		ctx.SendChain(message.Text(sb.String()))
+	})
+	engine.OnRegex(`^购买挂单\s*#?(\d+)\s*(\d*)$`, getdb).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		matched := ctx.State["regex_matched"].([]string)
+		id, _ := strconv.ParseInt(matched[1], 10, 64)
+		number, _ := strconv.Atoi(matched[2])
+		l, err := dbdata.buyListing(uid, ctx.Event.GroupID, id, number, time.Now())
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.6]:", err))
+			return
+		}
+		if isSingle(l.Name) {
+			// 与商店买卖鱼竿一样计入宝藏诅咒
+			if err = dbdata.updateCurseFor(uid, "buy", 1); err != nil {
+				logrus.Warnln(err)
+			}
+			if err = dbdata.updateCurseFor(l.Seller, "sell", 1); err != nil {
+				logrus.Warnln(err)
+			}
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(
+			"你用", l.Price*l.Number, "购买了", l.Number, "个", describe(l.Name, l.Other), ",已放入钓鱼背包")))
+	})
+	engine.OnRegex(`^下架\s*#?(\d+)$`, getdb).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+		id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+		l, err := dbdata.removeListing(ctx.Event.UserID, id, zero.SuperUserPermission(ctx), time.Now())
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.7]:", err))
+			return
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(
+			"已下架#", l.ID, ", ", l.Number, "个", describe(l.Name, l.Other), "已退回卖家背包")))
+	})
+}
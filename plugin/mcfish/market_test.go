@@ -0,0 +1,128 @@
+package mcfish
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+	sql "github.com/FloatTech/sqlite"
+)
+
+func newFishdb(t *testing.T, file string) *fishdb {
+	db := &fishdb{db: sql.New(file)}
+	if err := db.db.Open(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// pack 背包中名为 name 的物品
+func pack(t *testing.T, db *fishdb, uid int64, name string) []article {
+	things, err := db.getUserThingInfo(uid, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return things
+}
+
+func TestMarket(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/fishdata.db"
+	db := newFishdb(t, file)
+	if err := ledger.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	seller, buyer, other := int64(1), int64(2), int64(3)
+	now := time.Now()
+	rod := article{Duration: 1, Name: "木竿", Number: 1, Other: "30/0/0/0", Type: "pole"}
+	bait := article{Duration: 2, Name: "海之眷顾", Number: 5, Type: "article"}
+	for _, a := range []article{rod, bait} {
+		if err := db.putThing(seller, a, a.Number); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 上架后物品由市场保管
+	l1, err := db.addListing(seller, pack(t, db, seller, "海之眷顾")[0], 3, 10, now)
+	if err != nil || l1.ID != 1 || l1.Number != 3 {
+		t.Fatal(l1, err)
+	}
+	if ps := pack(t, db, seller, "海之眷顾"); len(ps) != 1 || ps[0].Number != 2 {
+		t.Fatal(ps)
+	}
+	if _, err = db.addListing(seller, pack(t, db, seller, "海之眷顾")[0], 3, 10, now); err != errThingGone {
+		t.Fatal(err)
+	}
+	l2, err := db.addListing(seller, pack(t, db, seller, "木竿")[0], 1, 100, now)
+	if err != nil || l2.ID != 2 || l2.Other != rod.Other || len(pack(t, db, seller, "木竿")) != 0 {
+		t.Fatal(l2, err)
+	}
+
+	// 只有卖家或强制下架才能下架, 编号不复用
+	if _, err = db.removeListing(other, l2.ID, false, now); err == nil {
+		t.Fatal("removed by other")
+	}
+	if _, err = db.removeListing(other, l2.ID, true, now); err != nil {
+		t.Fatal(err)
+	}
+	if ps := pack(t, db, seller, "木竿"); len(ps) != 1 || ps[0].Other != rod.Other {
+		t.Fatal(ps)
+	}
+	if _, err = db.removeListing(seller, l2.ID, false, now); err != errListingGone {
+		t.Fatal(err)
+	}
+	l3, err := db.addListing(seller, pack(t, db, seller, "木竿")[0], 1, 100, now)
+	if err != nil || l3.ID != 3 {
+		t.Fatal(l3, err)
+	}
+	if _, err = db.removeListing(seller, l3.ID, false, now); err != nil {
+		t.Fatal(err)
+	}
+	// 重新打开数据库后编号继续递增
+	db = newFishdb(t, file)
+	l4, err := db.addListing(seller, pack(t, db, seller, "木竿")[0], 1, 100, now)
+	if err != nil || l4.ID != 4 {
+		t.Fatal(l4, err)
+	}
+
+	// 购买: 货款从买家转给卖家, 物品进入买家背包
+	if err = ledger.InsertWalletOf(buyer, 100, "test", "income", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.buyListing(seller, 0, l1.ID, 1, now); err == nil {
+		t.Fatal("bought own listing")
+	}
+	if _, err = db.buyListing(buyer, 0, l1.ID, 4, now); err != errListingNumber {
+		t.Fatal(err)
+	}
+	l, err := db.buyListing(buyer, 0, l1.ID, 2, now)
+	if err != nil || l.Number != 2 || ledger.GetWalletOf(buyer) != 80 || ledger.GetWalletOf(seller) != 20 {
+		t.Fatal(l, err, ledger.GetWalletOf(buyer), ledger.GetWalletOf(seller))
+	}
+	if ps := pack(t, db, buyer, "海之眷顾"); len(ps) != 1 || ps[0].Number != 2 {
+		t.Fatal(ps)
+	}
+	// 总价溢出时拒绝, 不扣款
+	if err = db.db.Insert("market", &listing{ID: 99, Seller: seller, Name: "海之眷顾", Type: "article", Number: 3, Price: math.MaxInt/2 + 1, Expire: now.Add(time.Hour).Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.buyListing(buyer, 0, 99, 2, now); err != errListingTotal || ledger.GetWalletOf(buyer) != 80 {
+		t.Fatal(err, ledger.GetWalletOf(buyer))
+	}
+	if err = db.db.Del("market", "WHERE ID = 99"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 过期后剩余物品退回卖家
+	ls, err := db.getListings(now.AddDate(0, 0, listingDays))
+	if err != nil || len(ls) != 0 {
+		t.Fatal(ls, err)
+	}
+	if ps := pack(t, db, seller, "海之眷顾"); len(ps) != 1 || ps[0].Number != 3 {
+		t.Fatal(ps)
+	}
+	if ps := pack(t, db, seller, "木竿"); len(ps) != 1 || ps[0].Other != rod.Other {
+		t.Fatal(ps)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	"github.com/FloatTech/floatbox/file"
 	"github.com/FloatTech/floatbox/math"
 	"github.com/FloatTech/gg"
@@ -298,7 +299,7 @@ func init() {
 			}
 		}
 		pice = pice * 8 / 10
-		err = wallet.InsertWalletOf(uid, pice*number)
+		err = ledger.InsertWalletOf(uid, pice*number, "mcfish", "出售"+strconv.Itoa(number)+"个"+thingName, ctx.Event.GroupID)
 		if err != nil {
 			ctx.SendChain(message.Text("[ERROR at store.go.10]:", err))
 			return
@@ -386,7 +387,7 @@ func init() {
 				return
 			}
 		}
-		err = wallet.InsertWalletOf(uid, pice)
+		err = ledger.InsertWalletOf(uid, pice, "mcfish", "出售所有垃圾", ctx.Event.GroupID)
 		if err != nil {
 			ctx.SendChain(message.Text("[ERROR，出售垃圾失败，回收站卷款跑路了]:", err))
 			return
@@ -607,7 +608,7 @@ func init() {
 			ctx.SendChain(message.Text("[ERROR at store.go.12]:", err))
 			return
 		}
-		err = wallet.InsertWalletOf(uid, -price)
+		err = ledger.InsertWalletOf(uid, -price, "mcfish", "购买"+strconv.Itoa(number)+"个"+thingName, ctx.Event.GroupID)
 		if err != nil {
 			ctx.SendChain(message.Text("[ERROR at store.go.13]:", err))
 			return
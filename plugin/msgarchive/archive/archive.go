@@ -0,0 +1,298 @@
+// Package archive 本地群聊记录存档, 供其它插件代替 GetGroupMessageHistory 查询
+package archive
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	// DefaultRetention 未设置时的保留天数
+	DefaultRetention = 30
+	// MaxRetention 最长保留天数
+	MaxRetention = 365
+)
+
+// ErrNotReady 存档数据库尚未打开
+var ErrNotReady = errors.New("聊天记录存档未启用")
+
+// Message 存档的一条群消息
+type Message struct {
+	ID      int64  `db:"id"`
+	MsgID   int64  `db:"msgid"` // 协议端的 message_id
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Name    string `db:"name"` // 发送时的群名片或昵称
+	Raw     string `db:"raw"`  // 含 CQ 码的原始消息
+	Text    string `db:"text"` // 纯文本部分
+	Time    int64  `db:"time"`
+	// RecallBy 撤回者, 未撤回时为 0
+	RecallBy int64 `db:"recallby,DEFAULT 0"`
+	RecallAt int64 `db:"recallat,DEFAULT 0"`
+}
+
+// retention 群的保留天数, 为 0 时不存档
+type retention struct {
+	GroupID int64 `db:"gid"`
+	Days    int   `db:"days"`
+}
+
+type archivedb struct {
+	sync.RWMutex
+	sql.Sqlite
+	lastID  int64
+	enabled func(gid int64) bool
+}
+
+var adb = &archivedb{}
+
+// Open 打开存档数据库, enabled 判断插件是否在群内启用
+func Open(path string, enabled func(gid int64) bool) error {
+	adb.Lock()
+	defer adb.Unlock()
+	adb.Sqlite = sql.New(path)
+	err := adb.Sqlite.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = adb.Create("message", &Message{})
+	if err != nil {
+		return err
+	}
+	err = adb.Create("retention", &retention{})
+	if err != nil {
+		return err
+	}
+	for _, q := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_message_gid_time ON [message](gid, time);",
+		"CREATE INDEX IF NOT EXISTS idx_message_gid_msgid ON [message](gid, msgid);",
+		// 三元组分词, 中文无需额外分词即可全文检索, 但关键词至少要 3 个字
+		"CREATE VIRTUAL TABLE IF NOT EXISTS message_fts USING fts5(text, tokenize='trigram');",
+	} {
+		if _, err = adb.Exec(q); err != nil {
+			return err
+		}
+	}
+	var last struct {
+		ID int64 `db:"id"`
+	}
+	err = adb.Query("SELECT IFNULL(MAX(id), 0) FROM [message];", &last)
+	if err != nil {
+		return err
+	}
+	adb.lastID = last.ID
+	adb.enabled = enabled
+	return nil
+}
+
+func (db *archivedb) ready() bool {
+	return db.enabled != nil
+}
+
+// Covered 本群的消息是否正在存档, 为 false 时存档中的记录可能不完整
+func Covered(gid int64) bool {
+	adb.RLock()
+	defer adb.RUnlock()
+	return adb.ready() && adb.enabled(gid) && adb.retention(gid) > 0
+}
+
+// Save 存档一条消息, 本群不存档时忽略
+func Save(m *Message) error {
+	adb.Lock()
+	defer adb.Unlock()
+	if !adb.ready() {
+		return ErrNotReady
+	}
+	if adb.retention(m.GroupID) == 0 {
+		return nil
+	}
+	adb.lastID++
+	m.ID = adb.lastID
+	err := adb.Insert("message", m)
+	if err != nil || m.Text == "" {
+		return err
+	}
+	_, err = adb.Exec("INSERT INTO message_fts(rowid, text) VALUES (?, ?);", m.ID, m.Text)
+	return err
+}
+
+// Recall 标记消息被撤回并返回原消息, 没有存档时返回 nil
+func Recall(gid, msgid, operator int64, at time.Time) (*Message, error) {
+	adb.Lock()
+	defer adb.Unlock()
+	if !adb.ready() {
+		return nil, ErrNotReady
+	}
+	m := &Message{}
+	err := adb.Find("message", m, "WHERE gid = ? AND msgid = ? ORDER BY id DESC", gid, msgid)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.RecallBy = operator
+	m.RecallAt = at.Unix()
+	return m, adb.Insert("message", m)
+}
+
+// Latest 本群最近的 n 条消息, 按时间先后排列
+func Latest(gid int64, n int) ([]*Message, error) {
+	ms, err := query("SELECT * FROM [message] WHERE gid = ? ORDER BY id DESC LIMIT ?;", gid, n)
+	reverse(ms)
+	return ms, err
+}
+
+// Between 本群 [from, to) 内的消息, 按时间先后排列, n 不大于 0 时不限制条数
+func Between(gid int64, from, to time.Time, n int) ([]*Message, error) {
+	if n <= 0 {
+		n = -1
+	}
+	ms, err := query("SELECT * FROM [message] WHERE gid = ? AND time >= ? AND time < ? ORDER BY id DESC LIMIT ?;",
+		gid, from.Unix(), to.Unix(), n)
+	reverse(ms)
+	return ms, err
+}
+
+// Search 在本群搜索包含关键词且未被撤回的消息, uid 不为 0 时只搜索该成员, 关键词为空时返回该成员最近的消息, 新消息在前
+func Search(gid, uid int64, keyword string, n int) ([]*Message, error) {
+	// 撤回的消息只有管理员可以通过 "查看撤回" 看到
+	cond := "m.gid = ? AND m.recallby = 0"
+	args := []any{gid}
+	if uid != 0 {
+		cond += " AND m.uid = ?"
+		args = append(args, uid)
+	}
+	switch {
+	case keyword == "":
+		if uid == 0 {
+			return nil, nil
+		}
+		return query("SELECT m.* FROM [message] m WHERE "+cond+" ORDER BY m.id DESC LIMIT ?;", append(args, n)...)
+	case utf8.RuneCountInString(keyword) < 3:
+		// 三元组索引无法匹配过短的关键词, 退回逐条匹配
+		args = append(args, "%"+escapeLike(keyword)+"%", n)
+		return query("SELECT m.* FROM [message] m WHERE "+cond+" AND m.text LIKE ? ESCAPE '\\' ORDER BY m.id DESC LIMIT ?;", args...)
+	}
+	args = append([]any{`"` + strings.ReplaceAll(keyword, `"`, `""`) + `"`}, args...)
+	return query("SELECT m.* FROM message_fts f JOIN [message] m ON m.id = f.rowid WHERE message_fts MATCH ? AND "+cond+
+		" ORDER BY m.id DESC LIMIT ?;", append(args, n)...)
+}
+
+// Recalled 本群最近被撤回的 n 条消息, 新消息在前
+func Recalled(gid int64, n int) ([]*Message, error) {
+	return query("SELECT * FROM [message] WHERE gid = ? AND recallby != 0 ORDER BY recallat DESC LIMIT ?;", gid, n)
+}
+
+// Count 本群存档的消息数与最早一条的时间
+func Count(gid int64) (n int64, since time.Time, err error) {
+	adb.RLock()
+	defer adb.RUnlock()
+	if !adb.ready() {
+		return 0, time.Time{}, ErrNotReady
+	}
+	var c struct {
+		N     int64 `db:"n"`
+		First int64 `db:"first"`
+	}
+	err = adb.Query("SELECT COUNT(*), IFNULL(MIN(time), 0) FROM [message] WHERE gid = ?;", &c, gid)
+	return c.N, time.Unix(c.First, 0), err
+}
+
+// Retention 本群的保留天数
+func Retention(gid int64) int {
+	adb.RLock()
+	defer adb.RUnlock()
+	if !adb.ready() {
+		return 0
+	}
+	return adb.retention(gid)
+}
+
+func (db *archivedb) retention(gid int64) int {
+	r := retention{}
+	if db.Find("retention", &r, "WHERE gid = ?", gid) != nil {
+		return DefaultRetention
+	}
+	return r.Days
+}
+
+// SetRetention 设置本群的保留天数, 为 0 时停止存档并删除已有记录
+func SetRetention(gid int64, days int, now time.Time) error {
+	adb.Lock()
+	defer adb.Unlock()
+	if !adb.ready() {
+		return ErrNotReady
+	}
+	err := adb.Insert("retention", &retention{GroupID: gid, Days: days})
+	if err != nil {
+		return err
+	}
+	return adb.prune("gid = ? AND time < ?", gid, expireBefore(now, days))
+}
+
+// Prune 删除所有群中超过保留天数的消息
+func Prune(now time.Time) error {
+	adb.Lock()
+	defer adb.Unlock()
+	if !adb.ready() {
+		return ErrNotReady
+	}
+	rs, err := sql.FindAll[retention](&adb.Sqlite, "retention", "")
+	if err != nil && err != sql.ErrNullResult {
+		return err
+	}
+	for _, r := range rs {
+		err = adb.prune("gid = ? AND time < ?", r.GroupID, expireBefore(now, r.Days))
+		if err != nil {
+			return err
+		}
+	}
+	return adb.prune("gid NOT IN (SELECT gid FROM [retention]) AND time < ?", expireBefore(now, DefaultRetention))
+}
+
+// prune 删除满足条件的消息及其索引, 调用者需持有写锁
+func (db *archivedb) prune(cond string, args ...any) error {
+	_, err := db.Exec("DELETE FROM message_fts WHERE rowid IN (SELECT id FROM [message] WHERE "+cond+");", args...)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM [message] WHERE "+cond+";", args...)
+	return err
+}
+
+// expireBefore 保留 days 天时, 早于该时间戳的消息过期
+func expireBefore(now time.Time, days int) int64 {
+	if days <= 0 {
+		return now.Unix() + 1
+	}
+	return now.AddDate(0, 0, -days).Unix()
+}
+
+func query(q string, args ...any) ([]*Message, error) {
+	adb.RLock()
+	defer adb.RUnlock()
+	if !adb.ready() {
+		return nil, ErrNotReady
+	}
+	ms, err := sql.QueryAll[Message](&adb.Sqlite, q, args...)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return ms, err
+}
+
+func reverse(ms []*Message) {
+	for i, j := 0, len(ms)-1; i < j; i, j = i+1, j-1 {
+		ms[i], ms[j] = ms[j], ms[i]
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	err := Open(t.TempDir()+"/archive.db", func(int64) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, s := range []struct {
+		gid, uid int64
+		text     string
+		ago      time.Duration
+	}{
+		{1, 10, "今天天气真不错", 40 * 24 * time.Hour},
+		{1, 11, "天气预报说明天下雨", time.Hour},
+		{1, 10, "晚饭吃什么", time.Minute},
+		{2, 10, "天气真不错啊", time.Minute},
+	} {
+		err = Save(&Message{MsgID: int64(100 + i), GroupID: s.gid, UserID: s.uid, Text: s.text, Time: now.Add(-s.ago).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(name string, ms []*Message, err error, want ...int64) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if len(ms) != len(want) {
+			t.Fatal(name, "got", len(ms), "messages, want", len(want))
+		}
+		for i, m := range ms {
+			if m.MsgID != want[i] {
+				t.Fatal(name, "got", m.MsgID, "at", i, "want", want[i])
+			}
+		}
+	}
+	ms, err := Search(1, 0, "天气真", 10)
+	check("fts", ms, err, 100)
+	ms, err = Search(1, 0, "天气", 10)
+	check("like", ms, err, 101, 100)
+	ms, err = Search(1, 10, "", 10)
+	check("user", ms, err, 102, 100)
+	ms, err = Latest(1, 2)
+	check("latest", ms, err, 101, 102)
+	ms, err = Between(1, now.Add(-2*time.Hour), now, 0)
+	check("between", ms, err, 101, 102)
+
+	m, err := Recall(1, 101, 11, now)
+	if err != nil || m == nil || m.Text != "天气预报说明天下雨" {
+		t.Fatal("recall", m, err)
+	}
+	ms, err = Recalled(1, 10)
+	check("recalled", ms, err, 101)
+	// 撤回的消息不会被普通搜索找到
+	ms, err = Search(1, 0, "天气", 10)
+	check("like recalled", ms, err, 100)
+	ms, err = Search(1, 11, "", 10)
+	check("user recalled", ms, err)
+	ms, err = Search(1, 0, "明天下雨", 10)
+	check("fts recalled", ms, err)
+
+	if err = Prune(now); err != nil {
+		t.Fatal(err)
+	}
+	ms, err = Search(1, 0, "天气真", 10)
+	check("pruned", ms, err)
+	if err = SetRetention(2, 0, now); err != nil {
+		t.Fatal(err)
+	}
+	ms, err = Latest(2, 10)
+	check("disabled", ms, err)
+	if err = Save(&Message{MsgID: 200, GroupID: 2, Text: "不会存档", Time: now.Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	ms, err = Latest(2, 10)
+	check("not saved", ms, err)
+}
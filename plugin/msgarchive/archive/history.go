@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// fallbackCount 存档不完整时向协议端拉取的消息数
+const fallbackCount = 1000
+
+// History 本群最近 n 条消息, 按时间先后排列
+//
+// 存档不足 n 条时 (如刚开始存档) 改为调用 GetGroupMessageHistory
+func History(ctx *zero.Ctx, gid int64, n int) []*Message {
+	if Covered(gid) {
+		ms, err := Latest(gid, n)
+		if err == nil && len(ms) >= n {
+			return ms
+		}
+	}
+	return fetch(ctx, gid, n, func(*Message) bool { return true })
+}
+
+// HistoryBetween 本群 [from, to) 内最近的 n 条消息, 按时间先后排列
+//
+// 存档开始的时间晚于 from 时改为调用 GetGroupMessageHistory
+func HistoryBetween(ctx *zero.Ctx, gid int64, from, to time.Time, n int) []*Message {
+	if Covered(gid) {
+		c, since, err := Count(gid)
+		if err == nil && c > 0 && !since.After(from) {
+			ms, err := Between(gid, from, to, n)
+			if err == nil {
+				return ms
+			}
+		}
+	}
+	return fetch(ctx, gid, max(n, fallbackCount), func(m *Message) bool {
+		return m.Time >= from.Unix() && m.Time < to.Unix()
+	})
+}
+
+// fetch 从协议端拉取最近 n 条消息中满足 keep 的部分
+func fetch(ctx *zero.Ctx, gid int64, n int, keep func(*Message) bool) (ms []*Message) {
+	h := ctx.GetGroupMessageHistory(gid, 0, int64(n), false)
+	h.Get("messages").ForEach(func(_, msgObj gjson.Result) bool {
+		name := msgObj.Get("sender.card").Str
+		if name == "" {
+			name = msgObj.Get("sender.nickname").Str
+		}
+		raw := msgObj.Get("raw_message").Str
+		m := &Message{
+			MsgID:   msgObj.Get("message_id").Int(),
+			GroupID: gid,
+			UserID:  msgObj.Get("sender.user_id").Int(),
+			Name:    name,
+			Raw:     raw,
+			Text:    strings.TrimSpace(message.ParseMessageFromString(raw).ExtractPlainText()),
+			Time:    msgObj.Get("time").Int(),
+		}
+		if keep(m) {
+			ms = append(ms, m)
+		}
+		return true
+	})
+	if len(ms) > n {
+		ms = ms[len(ms)-n:]
+	}
+	return
+}
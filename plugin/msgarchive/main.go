@@ -0,0 +1,200 @@
+// Package msgarchive 群聊记录存档
+package msgarchive
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/msgarchive/archive"
+)
+
+const (
+	searchLimit = 20
+	recallLimit = 10
+	maxLimit    = 50
+)
+
+func init() {
+	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+		DisableOnDefault: false,
+		Brief:            "群聊记录存档",
+		Help: "- 搜索聊天记录 关键词 [@xxx]\n" +
+			"- 查看撤回 [条数] (仅管理员)\n" +
+			"- 设置聊天记录保留 30 天 (仅管理员, 0 天为不存档并清空记录)\n" +
+			"- 聊天记录存档状态\n" +
+			"Tips: 默认保留" + strconv.Itoa(archive.DefaultRetention) + "天, 关键词不足3个字时搜索较慢",
+		PrivateDataFolder: "msgarchive",
+	})
+	err := archive.Open(engine.DataFolder()+"archive.db", engine.IsEnabledIn)
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		for range time.NewTicker(time.Hour).C {
+			if err := archive.Prune(time.Now()); err != nil {
+				logrus.Warnln("[msgarchive] 清理过期聊天记录失败:", err)
+			}
+		}
+	}()
+	engine.OnMessage(zero.OnlyGroup).SetBlock(false).
+		Handle(func(ctx *zero.Ctx) {
+			id, ok := ctx.Event.MessageID.(int64)
+			if !ok {
+				return
+			}
+			name := ""
+			if ctx.Event.Sender != nil {
+				name = ctx.Event.Sender.Name()
+			}
+			err := archive.Save(&archive.Message{
+				MsgID:   id,
+				GroupID: ctx.Event.GroupID,
+				UserID:  ctx.Event.UserID,
+				Name:    name,
+				Raw:     ctx.Event.RawMessage,
+				Text:    strings.TrimSpace(ctx.Event.Message.ExtractPlainText()),
+				Time:    ctx.Event.Time,
+			})
+			if err != nil {
+				logrus.Warnln("[msgarchive] 存档消息失败:", err)
+			}
+		})
+	engine.OnNotice(func(ctx *zero.Ctx) bool {
+		return ctx.Event.NoticeType == "group_recall"
+	}).SetBlock(false).Handle(func(ctx *zero.Ctx) {
+		id, ok := ctx.Event.MessageID.(int64)
+		if !ok {
+			return
+		}
+		_, err := archive.Recall(ctx.Event.GroupID, id, ctx.Event.OperatorID, time.Unix(ctx.Event.Time, 0))
+		if err != nil {
+			logrus.Warnln("[msgarchive] 记录撤回失败:", err)
+		}
+	})
+	engine.OnRegex(`^搜索聊天记录\s*(?:\[CQ:at,qq=(\d+)\])?\s*(.*?)\s*(?:\[CQ:at,qq=(\d+)\])?\s*$`, zero.OnlyGroup).
+		SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		matched := ctx.State["regex_matched"].([]string)
+		uid, _ := strconv.ParseInt(matched[1]+matched[3], 10, 64)
+		keyword := matched[2]
+		if keyword == "" && uid == 0 {
+			ctx.SendChain(message.Text("请输入要搜索的关键词"))
+			return
+		}
+		ms, err := archive.Search(ctx.Event.GroupID, uid, keyword, searchLimit+1)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		// 搜索指令本身也已存档, 不计入结果
+		if len(ms) > 0 && ms[0].MsgID == ctx.Event.MessageID {
+			ms = ms[1:]
+		}
+		if len(ms) > searchLimit {
+			ms = ms[:searchLimit]
+		}
+		if len(ms) == 0 {
+			ctx.SendChain(message.Text("没有找到相关的聊天记录"))
+			return
+		}
+		msg := make(message.Message, 0, len(ms)+1)
+		msg = append(msg, ctxext.FakeSenderForwardNode(ctx,
+			message.Text("找到", len(ms), "条聊天记录", func() string {
+				if len(ms) == searchLimit {
+					return ", 仅显示最近的" + strconv.Itoa(searchLimit) + "条"
+				}
+				return ""
+			}())))
+		for _, m := range ms {
+			msg = append(msg, node(m, time.Unix(m.Time, 0).Format("2006-01-02 15:04:05")))
+		}
+		if id := ctx.Send(msg).ID(); id == 0 {
+			ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+		}
+	})
+	engine.OnRegex(`^查看撤回\s*(\d*)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			n, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			if n <= 0 {
+				n = recallLimit
+			}
+			if n > maxLimit {
+				n = maxLimit
+			}
+			ms, err := archive.Recalled(ctx.Event.GroupID, n)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ms) == 0 {
+				ctx.SendChain(message.Text("最近没有被撤回的消息"))
+				return
+			}
+			msg := make(message.Message, 0, len(ms))
+			for _, m := range ms {
+				head := time.Unix(m.Time, 0).Format("01-02 15:04:05") + " 发送, " +
+					time.Unix(m.RecallAt, 0).Format("01-02 15:04:05") + " 被"
+				if m.RecallBy == m.UserID {
+					head += "本人撤回"
+				} else {
+					head += "管理员(" + strconv.FormatInt(m.RecallBy, 10) + ")撤回"
+				}
+				msg = append(msg, node(m, head))
+			}
+			if id := ctx.Send(msg).ID(); id == 0 {
+				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			}
+		})
+	engine.OnRegex(`^设置聊天记录保留\s*(\d+)\s*天$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			days, err := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			if err != nil || days > archive.MaxRetention {
+				ctx.SendChain(message.Text("ERROR: 保留天数应在 0~", archive.MaxRetention, " 之间"))
+				return
+			}
+			err = archive.SetRetention(ctx.Event.GroupID, days, time.Now())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if days == 0 {
+				ctx.SendChain(message.Text("已停止存档本群聊天记录, 并清空了已有记录"))
+				return
+			}
+			ctx.SendChain(message.Text("本群聊天记录将保留", days, "天"))
+		})
+	engine.OnFullMatch("聊天记录存档状态", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			days := archive.Retention(gid)
+			if days == 0 {
+				ctx.SendChain(message.Text("本群未开启聊天记录存档"))
+				return
+			}
+			n, since, err := archive.Count(gid)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			text := "本群聊天记录保留" + strconv.Itoa(days) + "天, 已存档" + strconv.FormatInt(n, 10) + "条"
+			if n > 0 {
+				text += ", 最早一条发送于" + since.Format("2006-01-02 15:04")
+			}
+			ctx.SendChain(message.Text(text))
+		})
+}
+
+// node 把存档的消息转为合并转发节点, head 为附加在消息前的说明
+func node(m *archive.Message, head string) message.Segment {
+	content := message.Message{message.Text(head, "\n")}
+	content = append(content, message.ParseMessageFromString(m.Raw)...)
+	return message.CustomNode(m.Name, m.UserID, content)
+}
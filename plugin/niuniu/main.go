@@ -11,6 +11,7 @@ import (
 
 	"github.com/FloatTech/AnimeAPI/niu"
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
@@ -409,7 +410,7 @@ func init() {
 				Count:     1,
 			}
 		default:
-			if err := wallet.InsertWalletOf(uid, -data.Count*50); err != nil {
+			if err := ledger.InsertWalletOf(uid, -data.Count*50, "niuniu", "注销牛牛", gid); err != nil {
 				ctx.SendChain(message.Text("你的钱不够你注销牛牛了，这次注销需要", data.Count*50, wallet.GetWalletName()))
 				return
 			}
@@ -0,0 +1,143 @@
+package ping
+
+import (
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+// monitordb 监控项与探测记录
+type monitordb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// monitor 一个定时探测的目标
+type monitor struct {
+	ID       int64  `db:"id"`
+	GID      int64  `db:"gid"`
+	SelfID   int64  `db:"selfid"` // 添加监控的 bot, 用于发送通知
+	Target   string `db:"target"` // host:port 或 http(s) 地址
+	Interval int64  `db:"interval"`
+	State    int    `db:"state"` // 0 未知, 1 正常, -1 中断
+	Since    int64  `db:"since"` // 进入当前状态的时间
+	Creator  int64  `db:"creator"`
+}
+
+// probeRecord 一次探测结果
+type probeRecord struct {
+	ID      int64 `db:"id"` // unix nano
+	MID     int64 `db:"mid"`
+	Time    int64 `db:"time"`
+	Up      bool  `db:"up"`
+	Latency int64 `db:"latency"` // 毫秒
+}
+
+// uptimeStat 一段时间内的探测统计
+type uptimeStat struct {
+	Total   int64   `db:"total"`
+	Up      int64   `db:"up"`
+	Latency float64 `db:"latency"` // 成功探测的平均延迟, 毫秒
+}
+
+var mdb = &monitordb{}
+
+// initDatabase 打开数据库, 清理过期的探测记录
+func initDatabase(path string) error {
+	mdb.Sqlite = sql.New(path)
+	err := mdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = mdb.Create("monitor", &monitor{})
+	if err != nil {
+		return err
+	}
+	err = mdb.Create("probe", &probeRecord{})
+	if err != nil {
+		return err
+	}
+	return pruneProbes(time.Now())
+}
+
+// listMonitors 列出监控项, gid 为 0 时列出全部
+func listMonitors(gid int64) ([]*monitor, error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	var (
+		ms  []*monitor
+		err error
+	)
+	if gid == 0 {
+		ms, err = sql.FindAll[monitor](&mdb.Sqlite, "monitor", "ORDER BY id")
+	} else {
+		ms, err = sql.FindAll[monitor](&mdb.Sqlite, "monitor", "WHERE gid = ? ORDER BY id", gid)
+	}
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return ms, err
+}
+
+// addMonitor 添加监控项并分配编号
+func addMonitor(m *monitor) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	var next struct {
+		ID int64 `db:"id"`
+	}
+	err := mdb.Query("SELECT IFNULL(MAX(id), 0) + 1 FROM [monitor];", &next)
+	if err != nil {
+		return err
+	}
+	m.ID = next.ID
+	return mdb.Insert("monitor", m)
+}
+
+// removeMonitor 删除本群的监控项及其探测记录
+func removeMonitor(gid, id int64) (bool, error) {
+	mdb.Lock()
+	defer mdb.Unlock()
+	if !mdb.CanFind("monitor", "WHERE id = ? AND gid = ?", id, gid) {
+		return false, nil
+	}
+	err := mdb.Del("monitor", "WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	return true, mdb.Del("probe", "WHERE mid = ?", id)
+}
+
+// saveProbe 保存一次探测结果, 状态变化时同时更新监控项; 监控项已被删除时忽略
+func saveProbe(m *monitor, p *probeRecord, changed bool) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	if !mdb.CanFind("monitor", "WHERE id = ?", m.ID) {
+		return nil
+	}
+	if changed {
+		err := mdb.Insert("monitor", m)
+		if err != nil {
+			return err
+		}
+	}
+	return mdb.Insert("probe", p)
+}
+
+// getUptime 监控项自 since 以来的统计
+func getUptime(id int64, since time.Time) (*uptimeStat, error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	st, err := sql.Query[uptimeStat](&mdb.Sqlite,
+		"SELECT COUNT(1), IFNULL(SUM(up), 0), IFNULL(AVG(CASE WHEN up THEN latency END), 0) FROM [probe] WHERE mid = ? AND time >= ?;",
+		id, since.Unix())
+	return &st, err
+}
+
+// pruneProbes 删除超出统计窗口的探测记录
+func pruneProbes(now time.Time) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Del("probe", "WHERE time < ?", now.Add(-statWindow).Unix())
+}
@@ -31,9 +31,20 @@ func init() {
 			"- /ping <地址> - Ping 指定地址（默认4次）\n" +
 			"- /ping <地址> -c <次数> - Ping 指定次数\n" +
 			"- /ping <地址> -t <超时秒数> - 设置超时时间\n" +
-			"- /ping <地址> -c <次数> -t <超时秒数> - 指定次数和超时\n",
+			"- /ping <地址> -c <次数> -t <超时秒数> - 指定次数和超时\n" +
+			"- 监控 host:port [间隔] - 定时建立 TCP 连接检测, 间隔默认 60 秒, 如 监控 example.com:443 5m\n" +
+			"- 监控 https://example.com [间隔] - 定时发送 HTTP GET 检测\n" +
+			"- 监控列表 - 查看本群监控项最近 24 小时的可用率与延迟\n" +
+			"- 取消监控 #编号\n" +
+			"Tips: 目标在正常与中断之间切换时才会通知本群",
+		PrivateDataFolder: "ping",
 	}).ApplySingle(ctxext.DefaultSingle)
 
+	if err := initDatabase(engine.DataFolder() + "monitor.db"); err != nil {
+		panic(err)
+	}
+	runMonitors()
+
 	engine.OnRegex(`^/ping\s+(.+?)(?:\s+-c\s+(\d+))?(?:\s+-t\s+(\d+))?$`).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
 			matches := ctx.State["regex_matched"].([]string)
@@ -65,6 +76,90 @@ func init() {
 
 			sendPingResult(ctx, target, output)
 		})
+
+	engine.OnRegex(`^监控\s+(\S+)(?:\s+(\S+))?$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			matches := ctx.State["regex_matched"].([]string)
+			target, err := parseTarget(matches[1])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			interval, err := parseInterval(matches[2])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			gid := ctx.Event.GroupID
+			ms, err := listMonitors(gid)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ms) >= maxMonitorsInGroup {
+				ctx.SendChain(message.Text("本群监控项已达上限 ", maxMonitorsInGroup, " 个, 请先取消不需要的监控"))
+				return
+			}
+			for _, m := range ms {
+				if m.Target == target {
+					ctx.SendChain(message.Text("本群已在监控 ", target, " (#", m.ID, ")"))
+					return
+				}
+			}
+			now := time.Now()
+			latency, perr := probe(target)
+			m := &monitor{
+				GID:      gid,
+				SelfID:   ctx.Event.SelfID,
+				Target:   target,
+				Interval: int64(interval / time.Second),
+				State:    stateUp,
+				Since:    now.Unix(),
+				Creator:  ctx.Event.UserID,
+			}
+			if perr != nil {
+				m.State = stateDown
+			}
+			if err = addMonitor(m); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if err = saveProbe(m, &probeRecord{ID: now.UnixNano(), MID: m.ID, Time: now.Unix(), Up: perr == nil, Latency: latency.Milliseconds()}, false); err != nil {
+				logrus.Warnln("[ping] 保存监控", m.ID, "的探测结果失败:", err)
+			}
+			startMonitor(m)
+			status := fmt.Sprint("当前状态: 正常, 延迟 ", latency.Milliseconds(), "ms")
+			if perr != nil {
+				status = fmt.Sprint("当前状态: 无法访问\n原因: ", perr)
+			}
+			ctx.SendChain(message.Text("已添加监控 #", m.ID, " ", target, ", 每 ", formatDuration(interval), " 检测一次\n", status))
+		})
+
+	engine.OnFullMatch("监控列表", zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			msg, err := monitorList(ctx.Event.GroupID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text(msg))
+		})
+
+	engine.OnRegex(`^取消监控\s*#?(\d+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			ok, err := removeMonitor(ctx.Event.GroupID, id)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if !ok {
+				ctx.SendChain(message.Text("本群没有编号为 #", id, " 的监控"))
+				return
+			}
+			stopMonitor(id)
+			ctx.SendChain(message.Text("已取消监控 #", id))
+		})
 }
 
 func doPing(target string, count int, timeout int) (string, error) {
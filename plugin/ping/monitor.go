@@ -0,0 +1,269 @@
+package ping
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/zbputils/control"
+	"github.com/RomiChan/syncx"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	defaultInterval    = time.Minute
+	minInterval        = 30 * time.Second
+	maxInterval        = time.Hour
+	probeTimeout       = 10 * time.Second
+	statWindow         = 24 * time.Hour
+	maxMonitorsInGroup = 10
+
+	stateUnknown = 0
+	stateUp      = 1
+	stateDown    = -1
+)
+
+var (
+	// tasks 正在运行的监控, 关闭通道即停止
+	tasks syncx.Map[int64, chan struct{}]
+
+	errTarget   = errors.New("监控目标应为 host:port 或 http(s):// 地址")
+	errInterval = errors.New("间隔应在 30 秒 ~ 1 小时之间, 如 60 或 5m")
+
+	httpClient = &http.Client{Timeout: probeTimeout}
+)
+
+// parseTarget 校验监控目标, 返回规范化后的目标
+func parseTarget(s string) (string, error) {
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return "", errTarget
+		}
+		return u.String(), nil
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil || host == "" {
+		return "", errTarget
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return "", errTarget
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// parseInterval 解析探测间隔, 纯数字视为秒
+func parseInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultInterval, nil
+	}
+	var d time.Duration
+	if n, err := strconv.Atoi(s); err == nil {
+		d = time.Duration(n) * time.Second
+	} else if d, err = time.ParseDuration(s); err != nil {
+		return 0, errInterval
+	}
+	if d < minInterval || d > maxInterval {
+		return 0, errInterval
+	}
+	return d.Round(time.Second), nil
+}
+
+// probe 探测一次目标, 返回延迟; http(s) 目标发送 GET, 其余建立 TCP 连接
+func probe(target string) (time.Duration, error) {
+	start := time.Now()
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		resp, err := httpClient.Get(target)
+		if err != nil {
+			return 0, err
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		_ = resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return 0, errors.New("HTTP " + resp.Status)
+		}
+		return time.Since(start), nil
+	}
+	conn, err := net.DialTimeout("tcp", target, probeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	_ = conn.Close()
+	return time.Since(start), nil
+}
+
+// check 探测一次并保存结果, 状态发生翻转时返回通知
+func check(m *monitor, now time.Time) (message.Message, error) {
+	latency, err := probe(m.Target)
+	state := stateUp
+	if err != nil {
+		state = stateDown
+	}
+	prev, since := m.State, m.Since
+	changed := state != prev
+	if changed {
+		m.State = state
+		m.Since = now.Unix()
+	}
+	serr := saveProbe(m, &probeRecord{
+		ID:      now.UnixNano(),
+		MID:     m.ID,
+		Time:    now.Unix(),
+		Up:      err == nil,
+		Latency: latency.Milliseconds(),
+	}, changed)
+	if !changed || prev == stateUnknown {
+		return nil, serr
+	}
+	if state == stateDown {
+		return message.Message{message.Text("[监控] #", m.ID, " ", m.Target, " 无法访问\n原因: ", err)}, serr
+	}
+	outage := now.Sub(time.Unix(since, 0))
+	return message.Message{message.Text("[监控] #", m.ID, " ", m.Target, " 已恢复, 延迟 ", latency.Milliseconds(), "ms\n中断时长: ", formatDuration(outage))}, serr
+}
+
+// startMonitor 启动后台探测, 每隔 m.Interval 秒探测一次
+func startMonitor(m *monitor) {
+	stop := make(chan struct{})
+	if old, ok := tasks.LoadAndDelete(m.ID); ok {
+		close(old)
+	}
+	tasks.Store(m.ID, stop)
+	go func() {
+		ticker := time.NewTicker(time.Duration(m.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			msg, err := check(m, time.Now())
+			if err != nil {
+				logrus.Warnln("[ping] 保存监控", m.ID, "的探测结果失败:", err)
+			}
+			if msg == nil {
+				continue
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			notify(m, msg)
+		}
+	}()
+}
+
+// stopMonitor 停止后台探测
+func stopMonitor(id int64) {
+	if stop, ok := tasks.LoadAndDelete(id); ok {
+		close(stop)
+	}
+}
+
+// notify 向监控所在群发送状态变化通知
+func notify(m *monitor, msg message.Message) {
+	if c, ok := control.Lookup("ping"); ok && !c.IsEnabledIn(m.GID) {
+		return
+	}
+	if ctx := zero.GetBot(m.SelfID); ctx != nil {
+		ctx.SendGroupMessage(m.GID, msg)
+		return
+	}
+	zero.RangeBot(func(_ int64, ctx *zero.Ctx) bool {
+		ctx.SendGroupMessage(m.GID, msg)
+		return false
+	})
+}
+
+// runMonitors 启动所有已保存的监控, 并定时清理过期的探测记录
+func runMonitors() {
+	ms, err := listMonitors(0)
+	if err != nil {
+		logrus.Errorln("[ping] 读取监控列表失败:", err)
+		return
+	}
+	for _, m := range ms {
+		startMonitor(m)
+	}
+	go func() {
+		for range time.NewTicker(time.Hour).C {
+			if err := pruneProbes(time.Now()); err != nil {
+				logrus.Warnln("[ping] 清理探测记录失败:", err)
+			}
+		}
+	}()
+}
+
+// monitorList 本群监控项最近 24 小时的可用率与平均延迟
+func monitorList(gid int64) (string, error) {
+	ms, err := listMonitors(gid)
+	if err != nil {
+		return "", err
+	}
+	if len(ms) == 0 {
+		return "本群还没有监控项, 发送「监控 host:port [间隔]」添加", nil
+	}
+	now := time.Now()
+	var sb strings.Builder
+	sb.WriteString("监控列表 (最近 24 小时)\n")
+	for _, m := range ms {
+		st, err := getUptime(m.ID, now.Add(-statWindow))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(fmt.Sprintf("\n#%d %s\n", m.ID, m.Target))
+		switch m.State {
+		case stateUp:
+			sb.WriteString("状态: 正常")
+		case stateDown:
+			sb.WriteString("状态: 中断")
+		default:
+			sb.WriteString("状态: 未知")
+		}
+		if m.State != stateUnknown {
+			sb.WriteString(", 已持续 " + formatDuration(now.Sub(time.Unix(m.Since, 0))))
+		}
+		sb.WriteString("\n间隔: " + formatDuration(time.Duration(m.Interval)*time.Second))
+		if st.Total == 0 {
+			sb.WriteString(" | 暂无探测记录\n")
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(" | 可用率: %.2f%% (%d/%d)", float64(st.Up)*100/float64(st.Total), st.Up, st.Total))
+		if st.Up > 0 {
+			sb.WriteString(fmt.Sprintf(" | 平均延迟: %.0fms", st.Latency))
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// formatDuration 将时长格式化为 x天x小时x分x秒
+func formatDuration(d time.Duration) string {
+	sec := int64(d / time.Second)
+	if sec <= 0 {
+		return "0秒"
+	}
+	var sb strings.Builder
+	for _, u := range []struct {
+		n    int64
+		name string
+	}{{86400, "天"}, {3600, "小时"}, {60, "分"}, {1, "秒"}} {
+		if sec >= u.n {
+			sb.WriteString(strconv.FormatInt(sec/u.n, 10))
+			sb.WriteString(u.name)
+			sec %= u.n
+		}
+	}
+	return sb.String()
+}
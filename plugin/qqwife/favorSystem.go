@@ -22,6 +22,7 @@ import (
 
 	// 货币系统
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 )
 
 // 好感度系统
@@ -102,7 +103,7 @@ func init() {
 				newFavor = -newFavor
 			}
 			// 记录结果
-			err = wallet.InsertWalletOf(uid, -moneyToFavor)
+			err = ledger.InsertWalletOf(uid, -moneyToFavor, "qqwife", "给"+strconv.FormatInt(gay, 10)+"买礼物", ctx.Event.GroupID)
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:钱包坏掉力:\n", err))
 				return
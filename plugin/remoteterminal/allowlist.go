@@ -0,0 +1,293 @@
+package remoteterminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	allowlistFile = "allowlist.txt"
+	configFile    = "config.json"
+)
+
+// terminalConfig 需要持久化的插件设置
+type terminalConfig struct {
+	AllowlistMode bool `json:"allowlist_mode"`
+}
+
+var (
+	config          terminalConfig
+	allowedBinaries = map[string]struct{}{}
+	allowedPaths    = map[string]struct{}{} // 允许列表解析出的程序绝对路径
+
+	// 允许列表模式下始终可用的 shell 内建命令, 不能写文件也不能改变环境变量
+	linuxBuiltins   = []string{"cd", "pwd", "true", "false"}
+	windowsBuiltins = []string{"cd", "chdir", "dir", "type"}
+
+	linuxSeparators   = regexp.MustCompile(`\|\||&&|[;|&\n]`)
+	windowsSeparators = regexp.MustCompile(`\|\||&&|[|&\n]`)
+	envAssignment     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	binaryName        = regexp.MustCompile(`^[\w.+/\\:-]+$`)
+
+	errSubstitution = errors.New("允许列表模式下不支持命令替换与变量赋值展开")
+	errRedirection  = errors.New("允许列表模式下不支持重定向")
+	errAssignment   = errors.New("允许列表模式下不支持设置环境变量")
+)
+
+func loadConfig(folder string) error {
+	data, err := os.ReadFile(filepath.Join(folder, configFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			config = terminalConfig{}
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &config)
+}
+
+func saveConfig(folder string) error {
+	data, err := json.MarshalIndent(&config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(folder, configFile), data, 0600)
+}
+
+func loadAllowlist(folder string) error {
+	filePath := filepath.Join(folder, allowlistFile)
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			allowedBinaries = map[string]struct{}{}
+			allowedPaths = map[string]struct{}{}
+			if err := createAllowlistTemplate(filePath); err != nil {
+				logrus.Warnf("[remoteterminal] 创建允许列表模板文件失败: %v", err)
+			}
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	allowed := map[string]struct{}{}
+	paths := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.Trim(strings.TrimSpace(scanner.Text()), `"'`)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// 程序名按 bot 的 PATH 解析为绝对路径, 执行时只认这个路径
+		path, err := resolveBinary(line, "", nil)
+		if err != nil {
+			logrus.Warnf("[remoteterminal] 允许列表中的「%s」无法解析: %v", line, err)
+			continue
+		}
+		allowed[normalizeBinary(line)] = struct{}{}
+		paths[normalizePath(path)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	allowedBinaries = allowed
+	allowedPaths = paths
+	logrus.Infof("[remoteterminal] 已加载 %d 条允许列表规则", len(allowedBinaries))
+	return nil
+}
+
+func createAllowlistTemplate(filePath string) error {
+	content := `# 远程终端允许列表配置文件
+# 开启允许列表模式 (/terminal allowlist on) 后, 只有此处列出的程序可以执行
+# 每行一个程序名或绝对路径, 以 # 开头的行为注释
+# 程序名在加载时按 PATH 解析为绝对路径, 其他位置的同名程序不会被放行
+#
+# 示例:
+# ls
+# cat
+# git
+# docker
+`
+	return os.WriteFile(filePath, []byte(content), 0644)
+}
+
+// normalizeBinary 取程序名, 去掉路径与引号, Windows 下忽略大小写与扩展名
+func normalizeBinary(s string) string {
+	s = strings.Trim(s, `"'`)
+	if isWindows {
+		s = strings.ToLower(filepath.Base(strings.ReplaceAll(s, "/", `\`)))
+		return strings.TrimSuffix(strings.TrimSuffix(s, ".exe"), ".cmd")
+	}
+	return filepath.Base(s)
+}
+
+// normalizePath 用于比较的程序路径, Windows 下忽略大小写
+func normalizePath(path string) string {
+	path = filepath.Clean(path)
+	if isWindows {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// resolveBinary 按会话的工作目录与 PATH 找到 shell 实际会执行的程序, env 为空时使用 bot 的环境变量
+func resolveBinary(bin, dir string, env []string) (string, error) {
+	if env == nil {
+		env = os.Environ()
+	}
+	var path, pathext string
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		switch {
+		case k == "PATH" || isWindows && strings.EqualFold(k, "PATH"):
+			path = v
+		case isWindows && strings.EqualFold(k, "PATHEXT"):
+			pathext = v
+		}
+	}
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	exts := []string{""}
+	if isWindows && filepath.Ext(bin) == "" {
+		if pathext == "" {
+			pathext = ".com;.exe;.bat;.cmd"
+		}
+		exts = strings.Split(strings.ToLower(pathext), ";")
+	}
+	var dirs []string
+	switch {
+	case strings.ContainsAny(bin, `/\`):
+		dirs = []string{""}
+	case isWindows:
+		// cmd 会先在当前目录查找
+		dirs = append([]string{dir}, filepath.SplitList(path)...)
+	default:
+		dirs = filepath.SplitList(path)
+	}
+	for _, d := range dirs {
+		for _, ext := range exts {
+			p := filepath.Join(d, bin+ext)
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			if isExecutable(p) {
+				return p, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("找不到程序「%s」", bin)
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return isWindows || info.Mode()&0111 != 0
+}
+
+// commandBinaries 拆分管道与命令序列, 返回其中每条命令调用的程序
+//
+// 重定向、命令替换与环境变量赋值都可能绕过允许列表, 一律拒绝
+func commandBinaries(command string) ([]string, error) {
+	for _, s := range []string{"`", "$(", "${", "<(", ">("} {
+		if strings.Contains(command, s) {
+			return nil, errSubstitution
+		}
+	}
+	if strings.ContainsAny(command, "<>") {
+		return nil, errRedirection
+	}
+	separators := linuxSeparators
+	if isWindows {
+		separators = windowsSeparators
+	}
+	var bins []string
+	for _, seg := range separators.Split(command, -1) {
+		fields := strings.Fields(seg)
+		if len(fields) == 0 {
+			continue
+		}
+		bin := strings.TrimLeft(fields[0], "({")
+		if bin == "" && len(fields) > 1 {
+			bin = fields[1]
+		}
+		if envAssignment.MatchString(bin) {
+			return nil, errAssignment
+		}
+		bins = append(bins, bin)
+	}
+	return bins, nil
+}
+
+// checkAllowlist 允许列表模式下检查命令调用的程序是否都在列表中, dir 与 env 为会话状态
+func checkAllowlist(command, dir string, env []string) error {
+	if !config.AllowlistMode {
+		return nil
+	}
+	bins, err := commandBinaries(command)
+	if err != nil {
+		return err
+	}
+	builtins := linuxBuiltins
+	if isWindows {
+		builtins = windowsBuiltins
+	}
+next:
+	for _, bin := range bins {
+		for _, b := range builtins {
+			if bin == b || isWindows && strings.EqualFold(bin, b) {
+				continue next
+			}
+		}
+		if !binaryName.MatchString(bin) {
+			return fmt.Errorf("「%s」不是允许列表模式下支持的程序名", bin)
+		}
+		path, err := resolveBinary(bin, dir, env)
+		if err != nil {
+			return err
+		}
+		if _, ok := allowedPaths[normalizePath(path)]; !ok {
+			return fmt.Errorf("「%s」(%s)不在允许列表中", bin, path)
+		}
+	}
+	return nil
+}
+
+func listAllowlist() string {
+	var sb strings.Builder
+	sb.WriteString("=== 允许列表 ===\n\n")
+	if config.AllowlistMode {
+		sb.WriteString("当前模式: 允许列表 (仅允许下列程序)\n")
+	} else {
+		sb.WriteString("当前模式: 黑名单 (允许列表未启用)\n")
+	}
+	names := make([]string, 0, len(allowedBinaries))
+	for name := range allowedBinaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sb.WriteString(fmt.Sprintf("程序数: %d\n\n", len(names)))
+	if len(names) > 0 {
+		sb.WriteString(strings.Join(names, ", "))
+		sb.WriteString("\n\n")
+	}
+	builtins := linuxBuiltins
+	if isWindows {
+		builtins = windowsBuiltins
+	}
+	sb.WriteString("始终允许的内建命令: ")
+	sb.WriteString(strings.Join(builtins, ", "))
+	sb.WriteString(fmt.Sprintf("\n配置文件: %s", filepath.Join(dataFolder, allowlistFile)))
+	return sb.String()
+}
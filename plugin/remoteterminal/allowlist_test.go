@@ -0,0 +1,75 @@
+package remoteterminal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckAllowlist(t *testing.T) {
+	if isWindows {
+		t.Skip("uses sh semantics")
+	}
+	folder := t.TempDir()
+	err := os.WriteFile(filepath.Join(folder, allowlistFile), []byte("# test\nls\ncat\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = loadAllowlist(folder); err != nil {
+		t.Fatal(err)
+	}
+	if len(allowedPaths) != 2 {
+		t.Skip("ls or cat not found in PATH")
+	}
+	// 工作目录与另一个 PATH 目录里都放一个假的 ls
+	fake := t.TempDir()
+	if err = os.WriteFile(filepath.Join(fake, "ls"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config.AllowlistMode = true
+	defer func() { config.AllowlistMode = false }()
+
+	tests := []struct {
+		command string
+		env     []string
+		ok      bool
+	}{
+		{"ls -la", nil, true},
+		{"ls | cat", nil, true},
+		{"cd /tmp && ls; pwd", nil, true},
+		{"rm -rf x", nil, false},
+		{"echo key >> ~/.ssh/authorized_keys", nil, false},
+		{"ls > /tmp/out", nil, false},
+		{"cat < /etc/passwd", nil, false},
+		{"ls 2>&1", nil, false},
+		{"export PATH=/tmp/x:$PATH; ls", nil, false},
+		{"PATH=/tmp/x ls", nil, false},
+		{"LD_PRELOAD=/tmp/x.so ls", nil, false},
+		{"ls $(rm -rf /)", nil, false},
+		{"ls `id`", nil, false},
+		{"ls ${PATH:=/tmp/x}", nil, false},
+		{"cat <(id)", nil, false},
+		{"./ls", nil, false},
+		{fake + "/ls", nil, false},
+		{"ls", []string{"PATH=" + fake + ":" + os.Getenv("PATH")}, false},
+		{"/???/rm -rf x", nil, false},
+		{"'rm' x", nil, false},
+		{"eval ls", nil, false},
+	}
+	for _, tc := range tests {
+		err := checkAllowlist(tc.command, fake, tc.env)
+		if (err == nil) != tc.ok {
+			t.Errorf("checkAllowlist(%q) = %v, want ok=%v", tc.command, err, tc.ok)
+		}
+	}
+}
+
+func TestResetEnv(t *testing.T) {
+	s := getSession(1)
+	s.env = []string{"LD_PRELOAD=/tmp/x.so"}
+	resetEnv()
+	if s.env != nil {
+		t.Fatal(s.env)
+	}
+	sessions.Delete(1)
+}
@@ -0,0 +1,98 @@
+package remoteterminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditFile           = "audit.log"
+	defaultHistoryLines = 20
+	maxHistoryLines     = 100
+)
+
+// auditEntry 审计日志中的一条记录, 以 json 行追加写入
+type auditEntry struct {
+	Time     int64  `json:"time"`
+	UserID   int64  `json:"uid"`
+	Command  string `json:"cmd"`
+	Dir      string `json:"dir"`
+	ExitCode int    `json:"code"`
+	Millis   int64  `json:"ms"`
+	Note     string `json:"note,omitempty"` // 拦截原因或执行错误
+}
+
+var auditMu sync.Mutex
+
+// audit 追加一条审计记录, 文件只以追加方式打开, 不会改写已有内容
+func audit(entry *auditEntry) {
+	entry.Time = time.Now().Unix()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(dataFolder, auditFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(append(data, '\n'))
+}
+
+// readAudit 读取最近 n 条审计记录
+func readAudit(n int) ([]auditEntry, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.Open(filepath.Join(dataFolder, auditFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	ring := make([]auditEntry, 0, n)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e auditEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if len(ring) == n {
+			copy(ring, ring[1:])
+			ring = ring[:n-1]
+		}
+		ring = append(ring, e)
+	}
+	return ring, scanner.Err()
+}
+
+func formatAudit(entries []auditEntry) string {
+	if len(entries) == 0 {
+		return "暂无终端执行记录"
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("=== 最近 %d 条终端记录 ===\n", len(entries)))
+	for _, e := range entries {
+		sb.WriteString(fmt.Sprintf("\n%s %d [%d] %dms\n%s$ %s",
+			time.Unix(e.Time, 0).Format("01-02 15:04:05"), e.UserID, e.ExitCode, e.Millis, e.Dir, e.Command))
+		if e.Note != "" {
+			sb.WriteString("\n  ")
+			sb.WriteString(e.Note)
+		}
+	}
+	result := sb.String()
+	if len(result) > 4000 {
+		result = result[:4000] + "\n... (内容过长，已截断)"
+	}
+	return result
+}
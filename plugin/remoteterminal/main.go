@@ -6,10 +6,10 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -185,9 +185,14 @@ func init() {
 			"- /terminal pwd - 显示当前目录\n" +
 			"- /terminal ls - 列出当前目录文件\n" +
 			"- /terminal timeout <秒> - 设置命令超时时间（默认30秒）\n" +
-			"- /terminal reload - 重新加载黑名单配置\n" +
+			"- /terminal env - 显示会话中设置的环境变量\n" +
+			"- /terminal reset - 重置会话\n" +
+			"- /terminal reload - 重新加载黑名单与允许列表配置\n" +
 			"- /terminal list_blacklist - 列出当前黑名单\n" +
-			"- /terminal help - 显示帮助",
+			"- /terminal allowlist [on|off] - 开关允许列表模式\n" +
+			"- /terminal list_allowlist - 列出允许列表\n" +
+			"- /terminal help - 显示帮助\n" +
+			"- 终端历史 [条数] - 查看终端审计日志",
 		PrivateDataFolder: "remoteterminal",
 	}).ApplySingle(ctxext.DefaultSingle)
 
@@ -199,11 +204,14 @@ func init() {
 		if err := loadCustomBlacklist(dataFolder); err != nil {
 			logrus.Errorf("[remoteterminal] 加载自定义黑名单失败: %v", err)
 		}
+		if err := loadConfig(dataFolder); err != nil {
+			logrus.Errorf("[remoteterminal] 加载配置失败: %v", err)
+		}
+		if err := loadAllowlist(dataFolder); err != nil {
+			logrus.Errorf("[remoteterminal] 加载允许列表失败: %v", err)
+		}
 	}()
 
-	var currentDir string
-	cmdTimeout := defaultTimeout
-
 	engine.OnPrefix("/terminal").SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
 			if !zero.SuperUserPermission(ctx) {
@@ -219,6 +227,7 @@ func init() {
 			}
 
 			cmd := parts[0]
+			sess := getSession(ctx.Event.UserID)
 
 			switch cmd {
 			case "exec":
@@ -226,12 +235,12 @@ func init() {
 					ctx.SendChain(message.Text("错误: 请指定要执行的命令\n使用 /terminal help 查看帮助"))
 					return
 				}
-				command := strings.Join(parts[1:], " ")
-				output, err := executeCommand(command, currentDir, time.Duration(cmdTimeout)*time.Second)
+				command := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(args), "exec"))
+				r, err := runCommand(ctx.Event.UserID, sess, command)
 				if err != nil {
 					ctx.SendChain(message.Text("执行失败: ", err.Error()))
 				} else {
-					sendOutput(ctx, output)
+					sendOutput(ctx, r.output)
 				}
 
 			case "cd":
@@ -240,12 +249,18 @@ func init() {
 					return
 				}
 				path := strings.Join(parts[1:], " ")
-				newDir, err := changeDirectory(path, currentDir)
-				if err != nil {
+				cdCmd := "cd " + path
+				if isWindows {
+					cdCmd = "cd /d " + path
+				}
+				r, err := runCommand(ctx.Event.UserID, sess, cdCmd)
+				switch {
+				case err != nil:
 					ctx.SendChain(message.Text("切换目录失败: ", err.Error()))
-				} else {
-					currentDir = newDir
-					ctx.SendChain(message.Text("当前目录: ", currentDir))
+				case r.exitCode != 0:
+					ctx.SendChain(message.Text("切换目录失败: ", strings.TrimSpace(r.output)))
+				default:
+					ctx.SendChain(message.Text("当前目录: ", sess.dir))
 				}
 
 			case "pwd":
@@ -255,30 +270,30 @@ func init() {
 				} else {
 					cmd = "pwd"
 				}
-				output, err := executeCommand(cmd, currentDir, 5*time.Second)
+				r, err := runCommand(ctx.Event.UserID, sess, cmd)
 				if err != nil {
 					ctx.SendChain(message.Text("获取当前目录失败: ", err.Error()))
 				} else {
-					ctx.SendChain(message.Text(strings.TrimSpace(output)))
+					ctx.SendChain(message.Text(strings.TrimSpace(r.output)))
 				}
 
-			case "ls":
+			case "ls", "dir":
 				var cmd string
 				if isWindows {
 					cmd = "dir"
 				} else {
 					cmd = "ls -la"
 				}
-				output, err := executeCommand(cmd, currentDir, 10*time.Second)
+				r, err := runCommand(ctx.Event.UserID, sess, cmd)
 				if err != nil {
 					ctx.SendChain(message.Text("列出文件失败: ", err.Error()))
 				} else {
-					sendOutput(ctx, output)
+					sendOutput(ctx, r.output)
 				}
 
 			case "timeout":
 				if len(parts) < 2 {
-					ctx.SendChain(message.Text("当前超时设置: ", cmdTimeout, " 秒\n使用 /terminal timeout <秒> 设置超时时间"))
+					ctx.SendChain(message.Text("当前超时设置: ", sess.timeout.Seconds(), " 秒\n使用 /terminal timeout <秒> 设置超时时间"))
 					return
 				}
 				var timeout int
@@ -287,20 +302,73 @@ func init() {
 					ctx.SendChain(message.Text("错误: 超时时间必须是1-300之间的整数"))
 					return
 				}
-				cmdTimeout = timeout
-				ctx.SendChain(message.Text("命令超时已设置为 ", cmdTimeout, " 秒"))
+				sess.Lock()
+				sess.timeout = time.Duration(timeout) * time.Second
+				sess.Unlock()
+				ctx.SendChain(message.Text("命令超时已设置为 ", timeout, " 秒"))
+
+			case "env":
+				env := sess.changedEnv()
+				if len(env) == 0 {
+					ctx.SendChain(message.Text("会话中没有设置过环境变量"))
+					return
+				}
+				sendOutput(ctx, strings.Join(env, "\n"))
+
+			case "reset":
+				sessions.Delete(ctx.Event.UserID)
+				ctx.SendChain(message.Text("会话已重置，工作目录与环境变量已恢复默认"))
 
 			case "reload":
 				dangerousCommands = getDefaultBlacklist()
 				if err := loadCustomBlacklist(dataFolder); err != nil {
 					ctx.SendChain(message.Text("重新加载黑名单失败: ", err.Error()))
-				} else {
-					ctx.SendChain(message.Text("黑名单已重新加载，当前共 ", len(dangerousCommands), " 条规则"))
+					return
 				}
+				if err := loadAllowlist(dataFolder); err != nil {
+					ctx.SendChain(message.Text("重新加载允许列表失败: ", err.Error()))
+					return
+				}
+				ctx.SendChain(message.Text("配置已重新加载，当前共 ", len(dangerousCommands), " 条黑名单规则，", len(allowedBinaries), " 个允许的程序"))
 
 			case "list_blacklist":
 				listBlacklist(ctx)
 
+			case "allowlist":
+				if len(parts) < 2 {
+					ctx.SendChain(message.Text(listAllowlist()))
+					return
+				}
+				switch parts[1] {
+				case "on":
+					config.AllowlistMode = true
+				case "off":
+					config.AllowlistMode = false
+				default:
+					ctx.SendChain(message.Text("错误: 请使用 /terminal allowlist on 或 /terminal allowlist off"))
+					return
+				}
+				resetEnv()
+				if err := saveConfig(dataFolder); err != nil {
+					ctx.SendChain(message.Text("保存配置失败: ", err.Error()))
+					return
+				}
+				if config.AllowlistMode {
+					ctx.SendChain(message.Text("允许列表模式已开启，仅允许执行列表中的 ", len(allowedBinaries), " 个程序，会话中设置的环境变量已清除"))
+				} else {
+					ctx.SendChain(message.Text("允许列表模式已关闭，恢复使用黑名单，会话中设置的环境变量已清除"))
+				}
+
+			case "list_allowlist":
+				ctx.SendChain(message.Text(listAllowlist()))
+
+			case "history":
+				n := defaultHistoryLines
+				if len(parts) > 1 {
+					n, _ = strconv.Atoi(parts[1])
+				}
+				sendHistory(ctx, n)
+
 			case "help":
 				ctx.SendChain(message.Text(getHelp()))
 
@@ -308,6 +376,49 @@ func init() {
 				ctx.SendChain(message.Text("未知命令: ", cmd, "\n使用 /terminal help 查看帮助"))
 			}
 		})
+
+	engine.OnRegex(`^终端历史\s*(\d*)$`, zero.SuperUserPermission).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			n, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			sendHistory(ctx, n)
+		})
+}
+
+// runCommand 检查命令后在会话中执行, 并写入审计日志
+func runCommand(uid int64, sess *session, command string) (*result, error) {
+	entry := &auditEntry{UserID: uid, Command: command, Dir: sess.dir, ExitCode: -1}
+	defer audit(entry)
+	if dangerous, reason := isDangerousCommand(command); dangerous {
+		entry.Note = "拦截: " + reason
+		return nil, fmt.Errorf("危险命令被拦截: %s (原因: %s)", command, reason)
+	}
+	if err := checkAllowlist(command, sess.dir, sess.env); err != nil {
+		entry.Note = "拦截: " + err.Error()
+		return nil, fmt.Errorf("命令被允许列表拦截: %w", err)
+	}
+	r, err := sess.run(command)
+	if err != nil {
+		entry.Note = err.Error()
+		return nil, err
+	}
+	entry.ExitCode = r.exitCode
+	entry.Millis = r.duration.Milliseconds()
+	return r, nil
+}
+
+func sendHistory(ctx *zero.Ctx, n int) {
+	if n <= 0 {
+		n = defaultHistoryLines
+	}
+	if n > maxHistoryLines {
+		n = maxHistoryLines
+	}
+	entries, err := readAudit(n)
+	if err != nil {
+		ctx.SendChain(message.Text("读取审计日志失败: ", err.Error()))
+		return
+	}
+	ctx.SendChain(message.Text(formatAudit(entries)))
 }
 
 func listBlacklist(ctx *zero.Ctx) {
@@ -386,126 +497,6 @@ func gbkToUtf8(data []byte) string {
 	return string(data)
 }
 
-func executeCommand(command, dir string, timeout time.Duration) (string, error) {
-	if dangerous, reason := isDangerousCommand(command); dangerous {
-		return "", fmt.Errorf("危险命令被拦截: %s (原因: %s)", command, reason)
-	}
-
-	logrus.Infoln("[remoteterminal] 执行命令:", command, "在目录:", dir, "操作系统:", runtime.GOOS)
-
-	var cmd *exec.Cmd
-	if isWindows {
-		cmd = exec.Command("cmd", "/c", command)
-	} else {
-		cmd = exec.Command("sh", "-c", command)
-	}
-
-	if dir != "" {
-		cmd.Dir = dir
-	}
-
-	if isWindows {
-		cmd.Env = append(os.Environ(), "PYTHONIOENCODING=utf-8")
-	}
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- cmd.Run()
-	}()
-
-	select {
-	case err := <-errChan:
-		if err != nil {
-			if stderr.Len() > 0 {
-				return fmt.Sprintf("%s\n执行错误: %v\n\nstderr输出:\n%s", gbkToUtf8(stdout.Bytes()), err, gbkToUtf8(stderr.Bytes())), err
-			}
-			if stdout.Len() > 0 {
-				return fmt.Sprintf("%s\n执行错误: %v", gbkToUtf8(stdout.Bytes()), err), err
-			}
-			return "", err
-		}
-		if stderr.Len() > 0 {
-			return gbkToUtf8(stdout.Bytes()) + "\n[stderr]\n" + gbkToUtf8(stderr.Bytes()), nil
-		}
-		return gbkToUtf8(stdout.Bytes()), nil
-	case <-time.After(timeout):
-		if cmd.Process != nil {
-			cmd.Process.Kill()
-		}
-		return "", fmt.Errorf("命令执行超时（超过 %v 秒）", timeout.Seconds())
-	}
-}
-
-func changeDirectory(path, currentDir string) (string, error) {
-	var newDir string
-
-	if isWindows {
-		if len(path) >= 2 && strings.ToUpper(path[0:2]) == ":" {
-			newDir = path
-		} else if len(path) >= 1 && path[0] == '/' {
-			if len(currentDir) >= 2 && currentDir[1] == ':' {
-				newDir = string(currentDir[0]) + ":" + path
-			} else {
-				newDir = path
-			}
-		} else if currentDir == "" {
-			newDir = path
-		} else {
-			if !strings.HasSuffix(currentDir, "\\") && !strings.HasSuffix(currentDir, "/") {
-				newDir = currentDir + "\\" + path
-			} else {
-				newDir = currentDir + path
-			}
-		}
-
-		cmd := exec.Command("cmd", "/c", "cd /d "+newDir+" && cd")
-		var stdout, stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
-
-		err := cmd.Run()
-		if err != nil {
-			return "", fmt.Errorf("切换目录失败: %w\nstderr: %s", err, gbkToUtf8(stderr.Bytes()))
-		}
-
-		result := strings.TrimSpace(gbkToUtf8(stdout.Bytes()))
-		if result == "" {
-			return "", fmt.Errorf("无法访问目录: %s", newDir)
-		}
-
-		return result, nil
-	} else {
-		if strings.HasPrefix(path, "/") {
-			newDir = path
-		} else if currentDir == "" {
-			newDir = path
-		} else {
-			newDir = currentDir + "/" + path
-		}
-
-		cmd := exec.Command("sh", "-c", "cd "+newDir+" && pwd")
-		var stdout, stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
-
-		err := cmd.Run()
-		if err != nil {
-			return "", fmt.Errorf("切换目录失败: %w\nstderr: %s", err, stderr.String())
-		}
-
-		result := strings.TrimSpace(stdout.String())
-		if result == "" {
-			return "", fmt.Errorf("无法访问目录: %s", newDir)
-		}
-
-		return result, nil
-	}
-}
-
 func sendOutput(ctx *zero.Ctx, output string) {
 	lines := strings.Split(output, "\n")
 
@@ -540,13 +531,24 @@ func getHelp() string {
 /terminal pwd                 - 显示当前工作目录 (使用 cd 命令)
 /terminal dir                 - 列出当前目录文件
 /terminal timeout <秒>        - 设置命令超时时间 (1-300秒，默认30秒)
-/terminal reload              - 重新加载黑名单配置
+/terminal env                 - 显示会话中设置的环境变量
+/terminal reset               - 重置会话 (工作目录与环境变量)
+/terminal reload              - 重新加载黑名单与允许列表配置
 /terminal list_blacklist      - 列出当前危险命令黑名单
+/terminal allowlist [on|off]  - 开关允许列表模式
+/terminal list_allowlist      - 列出允许列表
+/terminal history [条数]      - 查看终端审计日志 (也可发送「终端历史 [条数]」)
 /terminal help                - 显示此帮助信息
 
+会话:
+- 每个超级用户拥有独立会话，命令之间保留工作目录与环境变量
+- exec 中的 cd、set 会作用于之后的命令
+
 安全限制:
 - 仅超级用户可使用
 - 命令执行有超时限制
+- 所有执行与拦截都会追加写入审计日志 audit.log
+- 开启允许列表模式后，只能执行 allowlist.txt 中列出的程序，且不支持命令替换；切换模式时清除会话中设置的环境变量
 - 输出过长会被截断
 - 禁止执行危险命令，包括:
   * del/erase (删除系统文件)
@@ -585,13 +587,24 @@ func getHelp() string {
 /terminal pwd                 - 显示当前工作目录
 /terminal ls                  - 列出当前目录文件
 /terminal timeout <秒>        - 设置命令超时时间 (1-300秒，默认30秒)
-/terminal reload              - 重新加载黑名单配置
+/terminal env                 - 显示会话中设置的环境变量
+/terminal reset               - 重置会话 (工作目录与环境变量)
+/terminal reload              - 重新加载黑名单与允许列表配置
 /terminal list_blacklist      - 列出当前危险命令黑名单
+/terminal allowlist [on|off]  - 开关允许列表模式
+/terminal list_allowlist      - 列出允许列表
+/terminal history [条数]      - 查看终端审计日志 (也可发送「终端历史 [条数]」)
 /terminal help                - 显示此帮助信息
 
+会话:
+- 每个超级用户拥有独立会话，命令之间保留工作目录与环境变量
+- exec 中的 cd、export 会作用于之后的命令
+
 安全限制:
 - 仅超级用户可使用
 - 命令执行有超时限制
+- 所有执行与拦截都会追加写入审计日志 audit.log
+- 开启允许列表模式后，只能执行 allowlist.txt 中列出的程序，且不支持命令替换；切换模式时清除会话中设置的环境变量
 - 输出过长会被截断
 - 禁止执行危险命令，包括:
   * rm -rf (强制删除系统文件)
@@ -0,0 +1,189 @@
+package remoteterminal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RomiChan/syncx"
+	"github.com/sirupsen/logrus"
+)
+
+// session 每个超级用户独立的终端会话, 在命令之间保留工作目录与环境变量
+type session struct {
+	sync.Mutex
+	dir     string   // 为空时使用 bot 的工作目录
+	env     []string // 为空时继承 bot 的环境变量
+	timeout time.Duration
+	marker  string // 用于分隔命令输出与会话状态
+}
+
+// result 一次命令执行的结果
+type result struct {
+	output   string
+	exitCode int
+	duration time.Duration
+}
+
+var (
+	sessions   syncx.Map[int64, *session]
+	errTimeout = errors.New("命令执行超时")
+
+	// 由 shell 自动维护, 不视为会话中设置的环境变量
+	shellManagedEnv = []string{"PWD=", "OLDPWD=", "SHLVL=", "_="}
+)
+
+func getSession(uid int64) *session {
+	s, _ := sessions.LoadOrStore(uid, newSession())
+	return s
+}
+
+// resetEnv 清除所有会话中设置的环境变量, 允许列表模式切换时调用, 以免之前设置的 LD_PRELOAD 等继续生效
+func resetEnv() {
+	sessions.Range(func(_ int64, s *session) bool {
+		s.Lock()
+		s.env = nil
+		s.Unlock()
+		return true
+	})
+}
+
+func newSession() *session {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &session{
+		timeout: defaultTimeout * time.Second,
+		marker:  "__zbp_terminal_" + hex.EncodeToString(b),
+	}
+}
+
+// wrap 在命令后追加退出码、工作目录与环境变量的输出
+func (s *session) wrap(command string) *exec.Cmd {
+	if isWindows {
+		return exec.Command("cmd", "/c", command+" & call echo "+s.marker+" %^errorlevel% & cd & set")
+	}
+	return exec.Command("sh", "-c", "{ "+command+"\n}; __zbp_rc=$?; printf '\\n%s %d\\n' '"+s.marker+"' \"$__zbp_rc\"; pwd; env")
+}
+
+// run 在会话中执行命令, 命令结束后更新会话的工作目录与环境变量
+func (s *session) run(command string) (*result, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	logrus.Infoln("[remoteterminal] 执行命令:", command, "在目录:", s.dir, "操作系统:", runtime.GOOS)
+
+	cmd := s.wrap(command)
+	if s.dir != "" {
+		cmd.Dir = s.dir
+	}
+	cmd.Env = s.env
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+		if isWindows {
+			cmd.Env = append(cmd.Env, "PYTHONIOENCODING=utf-8")
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// shell 与其启动的子进程在同一进程组, 超时后一并结束
+	setProcessGroup(cmd)
+	start := time.Now()
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-errChan:
+	case <-time.After(s.timeout):
+		killProcessGroup(cmd)
+		return nil, fmt.Errorf("%w（超过 %v 秒）", errTimeout, s.timeout.Seconds())
+	}
+
+	r := &result{duration: time.Since(start)}
+	out := gbkToUtf8(stdout.Bytes())
+	if code, dir, env, ok := s.parseTrailer(&out); ok {
+		r.exitCode = code
+		s.dir = dir
+		s.env = env
+	} else {
+		// 没有会话状态, 说明命令自行退出了 shell, 会话保持不变
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			r.exitCode = exitErr.ExitCode()
+		case err != nil:
+			return nil, err
+		}
+	}
+	if stderr.Len() > 0 {
+		out += "\n[stderr]\n" + gbkToUtf8(stderr.Bytes())
+	}
+	r.output = out
+	return r, nil
+}
+
+// parseTrailer 从输出中切下会话状态, 返回退出码、工作目录与环境变量
+func (s *session) parseTrailer(out *string) (code int, dir string, env []string, ok bool) {
+	idx := strings.LastIndex(*out, s.marker+" ")
+	if idx < 0 {
+		return
+	}
+	trailer := strings.Split(strings.ReplaceAll((*out)[idx:], "\r\n", "\n"), "\n")
+	*out = strings.TrimRight((*out)[:idx], "\r\n")
+	if len(trailer) < 2 {
+		return
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(trailer[0], s.marker)))
+	if err != nil {
+		return
+	}
+	dir = strings.TrimSpace(trailer[1])
+	env = make([]string, 0, len(trailer))
+	for _, line := range trailer[2:] {
+		if i := strings.IndexByte(line, '='); i > 0 {
+			env = append(env, line)
+		}
+	}
+	return code, dir, env, dir != ""
+}
+
+// changedEnv 返回会话中与 bot 进程不同的环境变量
+func (s *session) changedEnv() []string {
+	s.Lock()
+	defer s.Unlock()
+	base := make(map[string]struct{}, 64)
+	for _, kv := range os.Environ() {
+		base[kv] = struct{}{}
+	}
+	changed := make([]string, 0, 8)
+next:
+	for _, kv := range s.env {
+		if _, ok := base[kv]; ok {
+			continue
+		}
+		for _, p := range shellManagedEnv {
+			if strings.HasPrefix(kv, p) {
+				continue next
+			}
+		}
+		changed = append(changed, kv)
+	}
+	return changed
+}
@@ -0,0 +1,19 @@
+package remoteterminal
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// killProcessGroup 结束 cmd 及其启动的整个进程树
+func killProcessGroup(cmd *exec.Cmd) {
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	if err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,276 @@
+package robbery
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+// rules 群打劫规则
+type rules struct {
+	GroupID     int64 `db:"gid"`
+	SuccessRate int   `db:"success_rate"` // 成功率, 百分比
+	Fine        int   `db:"fine"`         // 失败罚款, 钱不够时钱包归零
+	PovertyLine int   `db:"poverty_line"` // 受害者钱包少于此数不能被打劫
+	LootPercent int   `db:"loot_percent"` // 成功时随机抢走对方 0~此百分比的财产
+	LootBase    int   `db:"loot_base"`    // 另加的固定金额
+	LootMax     int   `db:"loot_max"`
+	DailyLimit  int   `db:"daily_limit"` // 每人每日可打劫或被打劫的次数
+	JailHours   int   `db:"jail_hours"`  // 失败后坐牢的小时数
+}
+
+var defaultRules = rules{
+	SuccessRate: 40,
+	Fine:        1000,
+	PovertyLine: 1000,
+	LootPercent: 5,
+	LootBase:    500,
+	LootMax:     10000,
+	DailyLimit:  1,
+	JailHours:   2,
+}
+
+// globalDailyLimit 每人每日在所有群合计可成功打劫或被打劫的次数
+const globalDailyLimit = 3
+
+// loot 打劫成功时抢走的金额: 对方财产的 0~抢夺比例 加抢夺底数, 不超过抢夺上限与对方的全部财产
+//
+// roll 返回 [0, n) 的随机数
+func (r *rules) loot(victimWallet int, roll func(n int) int) int {
+	return max(min(roll(victimWallet*r.LootPercent/100+1)+r.LootBase, r.LootMax, victimWallet), 0)
+}
+
+// ruleItem 可由管理员设置的一项规则, 取值限制在 [min, max] 内
+//
+// 钱包是全局的, 不加限制时管理员能在自己的群里把别的群的人洗劫一空
+type ruleItem struct {
+	name     string
+	unit     string
+	min, max int
+	ptr      func(r *rules) *int
+}
+
+var ruleItems = []ruleItem{
+	{"成功率", "%", 0, 60, func(r *rules) *int { return &r.SuccessRate }},
+	{"罚款", "", 100, 100000, func(r *rules) *int { return &r.Fine }},
+	{"贫困线", "", 100, 1000000, func(r *rules) *int { return &r.PovertyLine }},
+	{"抢夺比例", "%", 0, 20, func(r *rules) *int { return &r.LootPercent }},
+	{"抢夺底数", "", 0, 2000, func(r *rules) *int { return &r.LootBase }},
+	{"抢夺上限", "", 0, 20000, func(r *rules) *int { return &r.LootMax }},
+	{"每日次数", "次", 0, globalDailyLimit, func(r *rules) *int { return &r.DailyLimit }},
+	{"坐牢时长", "小时", 1, 72, func(r *rules) *int { return &r.JailHours }},
+}
+
+// policy 可购买的打劫保险
+type policy struct {
+	name     string
+	price    int
+	coverage int // 赔付比例, 百分比
+	days     int
+}
+
+var policies = []policy{
+	{"基础保险", 200, 30, 3},
+	{"标准保险", 500, 60, 7},
+	{"全额保险", 1500, 90, 7},
+}
+
+// insurance 用户在群内生效的保险
+type insurance struct {
+	ID       string `db:"id"` // uid, 钱包在所有群通用, 保险也一样
+	Name     string `db:"name"`
+	Coverage int    `db:"coverage"`
+	Expire   int64  `db:"expire"`
+}
+
+// payout 被抢走 loot 时的赔付
+func (ins *insurance) payout(loot int) int {
+	return loot * ins.Coverage / 100
+}
+
+// jail 坐牢到何时, 期间不能打劫也不能被打劫
+type jail struct {
+	ID    string `db:"id"` // uid, 在所有群都不能打劫也不能被打劫
+	Until int64  `db:"until"`
+}
+
+// history 打劫记录
+type history struct {
+	ID       int64 `db:"id"`
+	GroupID  int64 `db:"gid"`
+	UserID   int64 `db:"uid"`    // 劫匪
+	VictimID int64 `db:"victim"` // 受害者
+	Success  bool  `db:"success"`
+	Amount   int   `db:"amount"` // 成功时为抢得的金额, 失败时为罚款
+	Payout   int   `db:"payout"` // 受害者获得的保险赔付
+	Time     int64 `db:"time"`
+}
+
+type robberyRepo struct {
+	sync.RWMutex
+	db     sql.Sqlite
+	lastID int64
+}
+
+func (repo *robberyRepo) open(path string) error {
+	repo.Lock()
+	defer repo.Unlock()
+	repo.db = sql.New(path)
+	err := repo.db.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	for name, obj := range map[string]any{
+		"rules":     &rules{},
+		"insurance": &insurance{},
+		"jail":      &jail{},
+		"history":   &history{},
+	} {
+		if err = repo.db.Create(name, obj); err != nil {
+			return err
+		}
+	}
+	_, err = repo.db.Exec("CREATE INDEX IF NOT EXISTS idx_history_gid_time ON [history](gid, time);")
+	if err != nil {
+		return err
+	}
+	// 坐牢与保险以前按 gid_uid 分群记录, 合并为按 uid 记录, 保留最晚到期的一条
+	for _, stmt := range []string{
+		"INSERT OR REPLACE INTO [jail] SELECT substr(id, instr(id, '_') + 1), MAX(until) FROM [jail] WHERE instr(id, '_') > 0 GROUP BY substr(id, instr(id, '_') + 1);",
+		"DELETE FROM [jail] WHERE instr(id, '_') > 0;",
+		"INSERT OR REPLACE INTO [insurance] SELECT substr(id, instr(id, '_') + 1), name, coverage, MAX(expire) FROM [insurance] WHERE instr(id, '_') > 0 GROUP BY substr(id, instr(id, '_') + 1);",
+		"DELETE FROM [insurance] WHERE instr(id, '_') > 0;",
+	} {
+		if _, err = repo.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	var last struct {
+		ID int64 `db:"id"`
+	}
+	err = repo.db.Query("SELECT IFNULL(MAX(id), 0) FROM [history];", &last)
+	if err != nil {
+		return err
+	}
+	repo.lastID = last.ID
+	return nil
+}
+
+// getRules 群打劫规则
+func (repo *robberyRepo) getRules(gid int64) rules {
+	repo.RLock()
+	defer repo.RUnlock()
+	r, err := sql.Find[rules](&repo.db, "rules", "WHERE gid = ?", gid)
+	if err != nil {
+		r = defaultRules
+		r.GroupID = gid
+	}
+	return r
+}
+
+// setRule 设置群打劫规则的一项
+func (repo *robberyRepo) setRule(gid int64, name string, value int) error {
+	r := repo.getRules(gid)
+	for _, item := range ruleItems {
+		if item.name == name {
+			if value < item.min || value > item.max {
+				return errors.New(name + "只能设置为" + strconv.Itoa(item.min) + "~" + strconv.Itoa(item.max) + item.unit)
+			}
+			*item.ptr(&r) = value
+			repo.Lock()
+			defer repo.Unlock()
+			return repo.db.Insert("rules", &r)
+		}
+	}
+	return errors.New("没有这项规则: " + name)
+}
+
+// jailedUntil 坐牢到何时, 没有坐牢时返回 0
+func (repo *robberyRepo) jailedUntil(uid int64, now time.Time) int64 {
+	repo.RLock()
+	defer repo.RUnlock()
+	j, err := sql.Find[jail](&repo.db, "jail", "WHERE id = ?", strconv.FormatInt(uid, 10))
+	if err != nil || j.Until <= now.Unix() {
+		return 0
+	}
+	return j.Until
+}
+
+// imprison 坐牢到 until
+func (repo *robberyRepo) imprison(uid int64, until time.Time) error {
+	repo.Lock()
+	defer repo.Unlock()
+	return repo.db.Insert("jail", &jail{ID: strconv.FormatInt(uid, 10), Until: until.Unix()})
+}
+
+// insuranceOf 生效中的保险, 没有时返回 nil
+func (repo *robberyRepo) insuranceOf(uid int64, now time.Time) *insurance {
+	repo.RLock()
+	defer repo.RUnlock()
+	ins, err := sql.Find[insurance](&repo.db, "insurance", "WHERE id = ?", strconv.FormatInt(uid, 10))
+	if err != nil || ins.Expire <= now.Unix() {
+		return nil
+	}
+	return &ins
+}
+
+// insure 投保, 覆盖之前的保险
+func (repo *robberyRepo) insure(uid int64, p *policy, now time.Time) (insurance, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	ins := insurance{
+		ID:       strconv.FormatInt(uid, 10),
+		Name:     p.name,
+		Coverage: p.coverage,
+		Expire:   now.AddDate(0, 0, p.days).Unix(),
+	}
+	return ins, repo.db.Insert("insurance", &ins)
+}
+
+// countToday 今天本群成功打劫的次数, robber 为 true 时按劫匪计, 否则按受害者计, gid 为 0 时合计所有群
+func (repo *robberyRepo) countToday(gid, uid int64, robber bool, now time.Time) (int, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	y, m, d := now.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).Unix()
+	col := "victim"
+	if robber {
+		col = "uid"
+	}
+	var n struct {
+		N int `db:"n"`
+	}
+	if gid == 0 {
+		err := repo.db.Query("SELECT COUNT(*) FROM [history] WHERE "+col+" = ? AND success = 1 AND time >= ?;", &n, uid, start)
+		return n.N, err
+	}
+	err := repo.db.Query("SELECT COUNT(*) FROM [history] WHERE gid = ? AND "+col+" = ? AND success = 1 AND time >= ?;", &n, gid, uid, start)
+	return n.N, err
+}
+
+// addHistory 写入打劫记录
+func (repo *robberyRepo) addHistory(h *history) error {
+	repo.Lock()
+	defer repo.Unlock()
+	h.ID = repo.lastID + 1
+	err := repo.db.Insert("history", h)
+	if err != nil {
+		return err
+	}
+	repo.lastID = h.ID
+	return nil
+}
+
+// historyOf 用户在本群作为劫匪或受害者的最近 n 条记录
+func (repo *robberyRepo) historyOf(gid, uid int64, n int) ([]*history, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	hs, err := sql.FindAll[history](&repo.db, "history", "WHERE gid = ? AND (uid = ? OR victim = ?) ORDER BY id DESC LIMIT ?", gid, uid, uid, n)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	return hs, err
+}
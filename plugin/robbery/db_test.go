@@ -0,0 +1,140 @@
+package robbery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoot(t *testing.T) {
+	r := defaultRules // 5%, 底数 500, 上限 10000
+	for _, c := range []struct {
+		wallet, roll, want int
+	}{
+		{1000, 0, 500},
+		{1000, 50, 550},
+		{300, 0, 300},           // 不超过对方的全部财产
+		{1000000, 50000, 10000}, // 不超过抢夺上限
+		{0, 0, 0},
+	} {
+		got := r.loot(c.wallet, func(n int) int {
+			if c.roll >= n {
+				t.Fatal(c, "roll out of range", n)
+			}
+			return c.roll
+		})
+		if got != c.want {
+			t.Fatal(c, "got", got)
+		}
+	}
+	for _, p := range policies {
+		ins := insurance{Coverage: p.coverage}
+		if got := ins.payout(1000); got != p.coverage*10 {
+			t.Fatal(p.name, "got", got)
+		}
+	}
+}
+
+func TestRepo(t *testing.T) {
+	var repo robberyRepo
+	file := t.TempDir() + "/robbery.db"
+	if err := repo.open(file); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	// 规则有上下限
+	for _, c := range []struct {
+		name  string
+		value int
+		ok    bool
+	}{
+		{"成功率", 100, false},
+		{"成功率", 60, true},
+		{"抢夺比例", 100, false},
+		{"抢夺上限", 1 << 40, false},
+		{"罚款", 0, false},
+		{"每日次数", globalDailyLimit + 1, false},
+		{"每日次数", 2, true},
+		{"坐牢时长", 0, false},
+		{"不存在", 1, false},
+	} {
+		if err := repo.setRule(1, c.name, c.value); (err == nil) != c.ok {
+			t.Fatal(c, "got", err)
+		}
+	}
+	if r := repo.getRules(1); r.SuccessRate != 60 || r.DailyLimit != 2 || r.Fine != defaultRules.Fine {
+		t.Fatal(r)
+	}
+	if r := repo.getRules(2); r != (rules{GroupID: 2, SuccessRate: 40, Fine: 1000, PovertyLine: 1000, LootPercent: 5, LootBase: 500, LootMax: 10000, DailyLimit: 1, JailHours: 2}) {
+		t.Fatal(r)
+	}
+
+	// 每日次数按群与所有群合计
+	yesterday := now.AddDate(0, 0, -1).Unix()
+	for _, h := range []history{
+		{GroupID: 1, UserID: 10, VictimID: 20, Success: true, Amount: 500, Time: now.Unix()},
+		{GroupID: 2, UserID: 10, VictimID: 21, Success: true, Amount: 500, Time: now.Unix()},
+		{GroupID: 2, UserID: 10, VictimID: 20, Success: false, Amount: 1000, Time: now.Unix()},
+		{GroupID: 1, UserID: 10, VictimID: 20, Success: true, Amount: 500, Time: yesterday},
+	} {
+		if err := repo.addHistory(&h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		gid, uid int64
+		robber   bool
+		want     int
+	}{
+		{1, 10, true, 1},
+		{2, 10, true, 1}, // 失败不计
+		{0, 10, true, 2},
+		{0, 20, false, 1},
+		{2, 20, false, 0},
+	} {
+		if n, err := repo.countToday(c.gid, c.uid, c.robber, now); err != nil || n != c.want {
+			t.Fatal(c, "got", n, err)
+		}
+	}
+	if hs, err := repo.historyOf(1, 20, 10); err != nil || len(hs) != 2 || hs[0].ID < hs[1].ID {
+		t.Fatal(hs, err)
+	}
+	if hs, err := repo.historyOf(3, 20, 10); err != nil || len(hs) != 0 {
+		t.Fatal(hs, err)
+	}
+
+	// 坐牢与保险在所有群通用, 到期后失效
+	if err := repo.imprison(10, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if repo.jailedUntil(10, now) == 0 || repo.jailedUntil(20, now) != 0 || repo.jailedUntil(10, now.Add(2*time.Hour)) != 0 {
+		t.Fatal("jail")
+	}
+	ins, err := repo.insure(20, &policies[1], now)
+	if err != nil || ins.Coverage != policies[1].coverage {
+		t.Fatal(ins, err)
+	}
+	if repo.insuranceOf(20, now) == nil || repo.insuranceOf(10, now) != nil ||
+		repo.insuranceOf(20, now.AddDate(0, 0, policies[1].days)) != nil {
+		t.Fatal("insurance")
+	}
+
+	// 以前按群记录的坐牢与保险在重新打开时合并
+	for _, j := range []jail{{"1_30", now.Add(time.Hour).Unix()}, {"2_30", now.Add(3 * time.Hour).Unix()}} {
+		if err = repo.db.Insert("jail", &j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = repo.db.Insert("insurance", &insurance{ID: "1_31", Name: "基础保险", Coverage: 30, Expire: now.Add(time.Hour).Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.open(file); err != nil {
+		t.Fatal(err)
+	}
+	if repo.jailedUntil(30, now) != now.Add(3*time.Hour).Unix() || repo.insuranceOf(31, now) == nil || repo.jailedUntil(10, now) == 0 {
+		t.Fatal("migrate")
+	}
+	if repo.db.CanFind("jail", "WHERE id = ?", "1_30") {
+		t.Fatal("old jail kept")
+	}
+}
@@ -4,179 +4,287 @@ package robbery
 import (
 	"math/rand"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	fcext "github.com/FloatTech/floatbox/ctxext"
-	sql "github.com/FloatTech/sqlite"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 
 	"github.com/FloatTech/AnimeAPI/wallet"
-	"github.com/FloatTech/floatbox/math"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	"github.com/FloatTech/zbputils/ctxext"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
 )
 
-type robberyRepo struct {
-	sync.RWMutex
-	db sql.Sqlite
-}
-
-type robberyRecord struct {
-	UserID   int64  `db:"user_id"`   // 劫匪
-	VictimID int64  `db:"victim_id"` // 受害者
-	Time     string `db:"time"`      // 时间
-}
-
 func init() {
 	var police robberyRepo
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "打劫别人的钱包",
 		Help: "- 打劫[对方Q号|@对方QQ]\n" +
-			"1. 受害者钱包少于1000不能被打劫\n" +
-			"2. 打劫成功率 40%\n" +
-			"4. 打劫失败罚款1000（钱不够，钱包归零）\n" +
-			"5. 保险赔付0-80%\n" +
-			"6. 打劫成功获得对方0-5%+500的财产（最高1W）\n" +
-			"7. 每日可打劫或被打劫一次\n" +
-			"8. 打劫失败不计入次数\n",
+			"- 犯罪记录[@xxx]\n" +
+			"- 打劫保险\n" +
+			"- 购买打劫保险[基础保险|标准保险|全额保险]\n" +
+			"- 打劫规则\n" +
+			"- 设置打劫规则[成功率|罚款|贫困线|抢夺比例|抢夺底数|抢夺上限|每日次数|坐牢时长][数值] (仅管理员)\n" +
+			"1. 受害者钱包少于贫困线不能被打劫\n" +
+			"2. 打劫失败罚款（钱不够，钱包归零）并坐牢，坐牢期间在所有群都不能打劫也不能被打劫\n" +
+			"3. 打劫成功获得对方0~抢夺比例的财产加抢夺底数（不超过抢夺上限）\n" +
+			"4. 受害者有保险时按保险比例赔付, 保险在所有群通用\n" +
+			"5. 每日可成功打劫或被打劫的次数有限, 所有群合计不超过" + strconv.Itoa(globalDailyLimit) + "次, 打劫失败不计入次数\n" +
+			"6. 只能打劫本群成员, 规则的取值有上下限\n",
 		PrivateDataFolder: "robbery",
 	}).ApplySingle(ctxext.NewGroupSingle("别着急，警察局门口排长队了！"))
 	getdb := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
-		police.db = sql.New(engine.DataFolder() + "robbery.db")
-		err := police.db.Open(time.Hour)
-		if err == nil {
-			// 创建CD表
-			err = police.db.Create("criminal_record", &robberyRecord{})
-			if err != nil {
-				ctx.SendChain(message.Text("[ERROR]:", err))
-				return false
-			}
-			return true
+		err := police.open(engine.DataFolder() + "robbery.db")
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR]:", err))
+			return false
 		}
-		ctx.SendChain(message.Text("[ERROR]:", err))
-		return false
+		return true
 	})
 
 	// 打劫功能
-	engine.OnRegex(`^打劫\s?(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\]|(\d+))`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+	engine.OnRegex(`^打劫\s?(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\]|(\d+))`, zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
 			uid := ctx.Event.UserID
+			gid := ctx.Event.GroupID
 			fiancee := ctx.State["regex_matched"].([]string)
 			victimID, _ := strconv.ParseInt(fiancee[2]+fiancee[3], 10, 64)
 			if victimID == uid {
 				ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.At(uid), message.Text("不能打劫自己")))
 				return
 			}
-
-			// 查询记录
-			ok, err := police.getRecord(victimID, uid)
-			if err != nil {
-				ctx.SendChain(message.Text("[ERROR]:", err))
+			if ctx.GetThisGroupMemberInfo(victimID, true).Get("user_id").Int() != victimID {
+				ctx.SendChain(message.Text("对方不在本群，打劫失败"))
 				return
 			}
+			now := time.Now()
 
-			if ok == 1 {
-				ctx.SendChain(message.Text("对方今天已经被打劫了，给人家留点后路吧"))
+			// 坐牢期间不能打劫也不能被打劫
+			if until := police.jailedUntil(uid, now); until != 0 {
+				ctx.SendChain(message.Text("你还在坐牢，", time.Unix(until, 0).Format("01-02 15:04"), "才能出狱"))
 				return
 			}
-			if ok >= 2 {
-				ctx.SendChain(message.Text("你今天已经成功打劫过了，贪心没有好果汁吃！"))
+			if police.jailedUntil(victimID, now) != 0 {
+				ctx.SendChain(message.Text("对方正在坐牢，狱警不让你进去"))
 				return
 			}
 
+			// 查询记录, 本群与所有群合计都不能超过每日次数
+			r := police.getRules(gid)
+			for _, c := range []struct {
+				gid, limit int64
+			}{{gid, int64(r.DailyLimit)}, {0, globalDailyLimit}} {
+				n, err := police.countToday(c.gid, victimID, false, now)
+				if err != nil {
+					ctx.SendChain(message.Text("[ERROR]:", err))
+					return
+				}
+				if int64(n) >= c.limit {
+					ctx.SendChain(message.Text("对方今天已经被打劫了，给人家留点后路吧"))
+					return
+				}
+				n, err = police.countToday(c.gid, uid, true, now)
+				if err != nil {
+					ctx.SendChain(message.Text("[ERROR]:", err))
+					return
+				}
+				if int64(n) >= c.limit {
+					ctx.SendChain(message.Text("你今天已经成功打劫过了，贪心没有好果汁吃！"))
+					return
+				}
+			}
+
 			// 穷人保护
 			victimWallet := wallet.GetWalletOf(victimID)
-			if victimWallet < 1000 {
+			if victimWallet < r.PovertyLine || victimWallet <= 0 {
 				ctx.SendChain(message.Text("对方太穷了！打劫失败"))
 				return
 			}
 
 			// 判断打劫是否成功
-			if rand.Intn(100) > 60 {
-				updateMoney := wallet.GetWalletOf(uid)
-				if updateMoney >= 1000 {
-					updateMoney = 1000
-				}
-				ctx.SendChain(message.Text("打劫失败,罚款1000"))
-				err := wallet.InsertWalletOf(uid, -updateMoney)
+			if rand.Intn(100) >= r.SuccessRate {
+				fine := min(wallet.GetWalletOf(uid), r.Fine)
+				err := ledger.InsertWalletOf(uid, -fine, "robbery", "打劫"+strconv.FormatInt(victimID, 10)+"失败罚款", gid)
 				if err != nil {
 					ctx.SendChain(message.Text("[ERROR]:罚款失败，钱包坏掉力:\n", err))
 					return
 				}
+				until := now.Add(time.Duration(r.JailHours) * time.Hour)
+				if r.JailHours > 0 {
+					err = police.imprison(uid, until)
+					if err != nil {
+						ctx.SendChain(message.Text("[ERROR]:", err))
+					}
+				}
+				err = police.addHistory(&history{GroupID: gid, UserID: uid, VictimID: victimID, Amount: fine, Time: now.Unix()})
+				if err != nil {
+					ctx.SendChain(message.At(uid), message.Text("[ERROR]:犯罪记录写入失败\n", err))
+				}
+				if r.JailHours > 0 {
+					ctx.SendChain(message.Text("打劫失败,罚款", fine, ",坐牢", r.JailHours, "小时,", until.Format("01-02 15:04"), "出狱"))
+					return
+				}
+				ctx.SendChain(message.Text("打劫失败,罚款", fine))
 				return
 			}
-			userIncrMoney := math.Min(rand.Intn(victimWallet/20)+500, 10000)
-			victimDecrMoney := userIncrMoney / (rand.Intn(4) + 1)
+			loot := r.loot(victimWallet, rand.Intn)
 
 			// 记录结果
-			err = wallet.InsertWalletOf(victimID, -victimDecrMoney)
+			err := ledger.InsertWalletOf(victimID, -loot, "robbery", "被"+strconv.FormatInt(uid, 10)+"打劫", gid)
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:钱包坏掉力:\n", err))
 				return
 			}
-			err = wallet.InsertWalletOf(uid, +userIncrMoney)
+			err = ledger.InsertWalletOf(uid, +loot, "robbery", "打劫"+strconv.FormatInt(victimID, 10), gid)
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:打劫失败，脏款掉入虚无\n", err))
 				return
 			}
+			payout := 0
+			ins := police.insuranceOf(victimID, now)
+			if ins != nil {
+				payout = ins.payout(loot)
+				if payout > 0 {
+					err = ledger.InsertWalletOf(victimID, payout, "robbery", ins.Name+"赔付", gid)
+					if err != nil {
+						ctx.SendChain(message.Text("[ERROR]:保险赔付失败\n", err))
+						payout = 0
+					}
+				}
+			}
 
 			// 写入记录
-			err = police.insertRecord(victimID, uid)
+			err = police.addHistory(&history{GroupID: gid, UserID: uid, VictimID: victimID, Success: true, Amount: loot, Payout: payout, Time: now.Unix()})
 			if err != nil {
 				ctx.SendChain(message.At(uid), message.Text("[ERROR]:犯罪记录写入失败\n", err))
 			}
 
-			ctx.SendChain(message.At(uid), message.Text("打劫成功，钱包增加：", userIncrMoney, wallet.GetWalletName()))
-			ctx.SendChain(message.At(victimID), message.Text("保险公司对您进行了赔付，您实际损失：", victimDecrMoney, wallet.GetWalletName()))
+			ctx.SendChain(message.At(uid), message.Text("打劫成功，钱包增加：", loot, wallet.GetWalletName()))
+			if ins == nil {
+				ctx.SendChain(message.At(victimID), message.Text("您被打劫了，损失：", loot, wallet.GetWalletName(), "，发送“打劫保险”了解如何投保"))
+				return
+			}
+			ctx.SendChain(message.At(victimID), message.Text(ins.Name, "对您进行了赔付：", payout, "，您实际损失：", loot-payout, wallet.GetWalletName()))
 		})
-}
 
-// ok==0 可以打劫；ok==1 程序错误 or 受害者进入CD；ok==2 用户进入CD; ok==3 用户和受害者都进入CD；
-func (sql *robberyRepo) getRecord(victimID, uid int64) (ok int, err error) {
-	sql.Lock()
-	defer sql.Unlock()
-	// 创建群表格
-	err = sql.db.Create("criminal_record", &robberyRecord{})
-	if err != nil {
-		return 1, err
-	}
-	// 拼接查询SQL
-	limitID := "WHERE victim_id = ? OR user_id = ?"
-	if !sql.db.CanFind("criminal_record", limitID, victimID, uid) {
-		// 没有记录即不用比较
-		return 0, nil
+	engine.OnRegex(`^犯罪记录\s*(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\])?$`, zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			uid := ctx.Event.UserID
+			if qq := ctx.State["regex_matched"].([]string)[2]; qq != "" {
+				uid, _ = strconv.ParseInt(qq, 10, 64)
+			}
+			hs, err := police.historyOf(gid, uid, 10)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			name := ctx.CardOrNickName(uid)
+			if len(hs) == 0 {
+				ctx.SendChain(message.Text(name, " 在本群清清白白，没有犯罪记录"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString(name + " 在本群最近的打劫记录:")
+			for _, h := range hs {
+				sb.WriteString("\n" + time.Unix(h.Time, 0).Format("01-02 15:04") + " ")
+				switch {
+				case h.UserID == uid && h.Success:
+					sb.WriteString("打劫 " + ctx.CardOrNickName(h.VictimID) + " 成功，抢得" + strconv.Itoa(h.Amount))
+				case h.UserID == uid:
+					sb.WriteString("打劫 " + ctx.CardOrNickName(h.VictimID) + " 失败，罚款" + strconv.Itoa(h.Amount))
+				case h.Success:
+					sb.WriteString("被 " + ctx.CardOrNickName(h.UserID) + " 打劫，损失" + strconv.Itoa(h.Amount-h.Payout))
+					if h.Payout > 0 {
+						sb.WriteString("(保险赔付" + strconv.Itoa(h.Payout) + ")")
+					}
+				default:
+					sb.WriteString(ctx.CardOrNickName(h.UserID) + " 打劫未遂")
+				}
+			}
+			if until := police.jailedUntil(uid, time.Now()); until != 0 {
+				sb.WriteString("\n正在坐牢，" + time.Unix(until, 0).Format("01-02 15:04") + "出狱")
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+
+	engine.OnFullMatch("打劫保险", zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			var sb strings.Builder
+			sb.WriteString("可购买的打劫保险:")
+			for _, p := range policies {
+				sb.WriteString("\n" + p.name + ": " + strconv.Itoa(p.price) + wallet.GetWalletName() + "，赔付" +
+					strconv.Itoa(p.coverage) + "%，有效" + strconv.Itoa(p.days) + "天")
+			}
+			if ins := police.insuranceOf(ctx.Event.UserID, time.Now()); ins != nil {
+				sb.WriteString("\n你当前的保险: " + ins.Name + "，" + time.Unix(ins.Expire, 0).Format("01-02 15:04") + "到期")
+			} else {
+				sb.WriteString("\n你当前没有保险")
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+
+	names := make([]string, len(policies))
+	for i, p := range policies {
+		names[i] = p.name
 	}
-	cdInfo := robberyRecord{}
+	engine.OnRegex(`^购买打劫保险\s*(`+strings.Join(names, "|")+`)$`, zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			name := ctx.State["regex_matched"].([]string)[1]
+			var p *policy
+			for i := range policies {
+				if policies[i].name == name {
+					p = &policies[i]
+				}
+			}
+			gid, uid := ctx.Event.GroupID, ctx.Event.UserID
+			err := ledger.Debit(uid, p.price, "robbery", "购买"+p.name, gid)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:投保失败，", err))
+				return
+			}
+			ins, err := police.insure(uid, p, time.Now())
+			if err != nil {
+				_ = ledger.InsertWalletOf(uid, p.price, "robbery", "投保失败退回", gid)
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("投保成功，", ins.Name, "将在", time.Unix(ins.Expire, 0).Format("01-02 15:04"), "到期，被打劫时赔付", ins.Coverage, "%"))
+		})
 
-	err = sql.db.FindFor("criminal_record", &cdInfo, limitID, func() error {
-		if time.Now().Format("2006/01/02") != cdInfo.Time {
-			// // 如果跨天了就删除
-			err = sql.db.Del("criminal_record", limitID, victimID, uid)
-			return nil
-		}
-		// 俩个if是为了保证，重复打劫同一个人，ok == 3
-		if cdInfo.UserID == uid {
-			ok += 2
-		}
-		if cdInfo.VictimID == victimID {
-			// lint 不允许使用 ok += 1
-			ok++
-		}
-		return nil
-	}, victimID, uid)
-	return ok, err
-}
+	engine.OnFullMatch("打劫规则", zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			r := police.getRules(ctx.Event.GroupID)
+			var sb strings.Builder
+			sb.WriteString("本群打劫规则:")
+			for _, item := range ruleItems {
+				sb.WriteString("\n" + item.name + ": " + strconv.Itoa(*item.ptr(&r)) + item.unit +
+					" (可设" + strconv.Itoa(item.min) + "~" + strconv.Itoa(item.max) + ")")
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
 
-func (sql *robberyRepo) insertRecord(vid int64, uid int64) error {
-	sql.Lock()
-	defer sql.Unlock()
-	return sql.db.Insert("criminal_record", &robberyRecord{
-		UserID:   uid,
-		VictimID: vid,
-		Time:     time.Now().Format("2006/01/02"),
-	})
+	items := make([]string, len(ruleItems))
+	for i, item := range ruleItems {
+		items[i] = item.name
+	}
+	engine.OnRegex(`^设置打劫规则\s*(`+strings.Join(items, "|")+`)\s*(\d+)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			value, err := strconv.Atoi(matched[2])
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			err = police.setRule(ctx.Event.GroupID, matched[1], value)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.Text("本群打劫", matched[1], "已设置为", value))
+		})
 }
@@ -487,3 +487,109 @@ func customtext(a *scdata, fontdata []byte, cw, ch, aw float64, textcolor color.
 	img = canvas.Image()
 	return
 }
+
+// drawCalendar 本月签到日历, 签到的日子画实心圆, 补签的用另一种颜色
+func drawCalendar(nickname string, si *signintable, streak int, records []signinday, now time.Time) (image.Image, error) {
+	const (
+		cell    = 100.0
+		margin  = 40.0
+		headerH = 190.0
+		weekH   = 60.0
+		footerH = 60.0
+	)
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	days := first.AddDate(0, 1, -1).Day()
+	offset := int(first.Weekday())
+	rows := (offset + days + 6) / 7
+	w := int(margin*2 + cell*7)
+	h := int(headerH + weekH + cell*float64(rows) + footerH)
+	signed := make(map[int]bool, len(records)) // 日 -> 是否为补签
+	for _, r := range records {
+		signed[r.Day%100] = r.Makeup
+	}
+
+	canvas := gg.NewContext(w, h)
+	canvas.SetRGB255(250, 248, 245)
+	canvas.Clear()
+	data, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	if err = canvas.ParseFontFace(data, 44); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB255(40, 40, 40)
+	canvas.DrawStringAnchored(nickname+" 的签到日历", margin, 70, 0, 0.5)
+	canvas.SetRGB255(231, 111, 81)
+	canvas.DrawStringAnchored(now.Format("2006/01"), float64(w)-margin, 70, 1, 0.5)
+	data, err = file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	if err = canvas.ParseFontFace(data, 26); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB255(90, 90, 90)
+	canvas.DrawStringAnchored("连续签到 "+strconv.Itoa(streak)+" 天    最长连续 "+strconv.Itoa(si.Longest)+
+		" 天    累计签到 "+strconv.Itoa(si.Total)+" 天", margin, 130, 0, 0.5)
+	canvas.DrawStringAnchored("本月已签 "+strconv.Itoa(len(records))+"/"+strconv.Itoa(days)+" 天    补签卡 "+strconv.Itoa(si.Cards)+" 张",
+		margin, 168, 0, 0.5)
+
+	for i, wd := range []string{"日", "一", "二", "三", "四", "五", "六"} {
+		if i == 0 || i == 6 {
+			canvas.SetRGB255(231, 111, 81)
+		} else {
+			canvas.SetRGB255(90, 90, 90)
+		}
+		canvas.DrawStringAnchored(wd, margin+cell*(float64(i)+0.5), headerH+weekH/2, 0.5, 0.5)
+	}
+	if err = canvas.ParseFontFace(data, 34); err != nil {
+		return nil, err
+	}
+	for d := 1; d <= days; d++ {
+		pos := offset + d - 1
+		x := margin + cell*(float64(pos%7)+0.5)
+		y := headerH + weekH + cell*(float64(pos/7)+0.5)
+		makeup, ok := signed[d]
+		switch {
+		case ok && makeup:
+			canvas.DrawCircle(x, y, cell*0.4)
+			canvas.SetRGB255(244, 162, 97)
+			canvas.Fill()
+			canvas.SetRGB255(255, 255, 255)
+		case ok:
+			canvas.DrawCircle(x, y, cell*0.4)
+			canvas.SetRGB255(42, 157, 143)
+			canvas.Fill()
+			canvas.SetRGB255(255, 255, 255)
+		case d > now.Day():
+			canvas.SetRGB255(190, 190, 190)
+		default:
+			canvas.SetRGB255(60, 60, 60)
+		}
+		canvas.DrawStringAnchored(strconv.Itoa(d), x, y, 0.5, 0.5)
+		if d == now.Day() {
+			canvas.DrawCircle(x, y, cell*0.44)
+			canvas.SetRGB255(231, 111, 81)
+			canvas.SetLineWidth(3)
+			canvas.Stroke()
+		}
+	}
+
+	if err = canvas.ParseFontFace(data, 20); err != nil {
+		return nil, err
+	}
+	legendY := float64(h) - footerH/2
+	canvas.DrawCircle(margin+10, legendY, 10)
+	canvas.SetRGB255(42, 157, 143)
+	canvas.Fill()
+	canvas.SetRGB255(90, 90, 90)
+	canvas.DrawStringAnchored("已签到", margin+28, legendY, 0, 0.5)
+	canvas.DrawCircle(margin+130, legendY, 10)
+	canvas.SetRGB255(244, 162, 97)
+	canvas.Fill()
+	canvas.SetRGB255(90, 90, 90)
+	canvas.DrawStringAnchored("补签", margin+148, legendY, 0, 0.5)
+	canvas.DrawStringAnchored("Created By Zerobot-Plugin "+banner.Version, float64(w)-margin, legendY, 1, 0.5) // zbp
+	return canvas.Image(), nil
+}
@@ -32,6 +32,10 @@ func (scoretable) TableName() string {
 type signintable struct {
 	UID       int64 `gorm:"column:uid;primary_key"`
 	Count     int   `gorm:"column:count;default:0"`
+	Streak    int   `gorm:"column:streak;default:0"`  // 当前连续签到天数
+	Longest   int   `gorm:"column:longest;default:0"` // 最长连续签到天数
+	Total     int   `gorm:"column:total;default:0"`   // 累计签到天数
+	Cards     int   `gorm:"column:cards;default:0"`   // 补签卡数量
 	UpdatedAt time.Time
 }
 
@@ -40,6 +44,18 @@ func (signintable) TableName() string {
 	return "sign_in"
 }
 
+// signinday 每天的签到记录
+type signinday struct {
+	UID    int64 `gorm:"column:uid;primary_key;auto_increment:false"`
+	Day    int   `gorm:"column:day;primary_key;auto_increment:false"` // 20060102
+	Makeup bool  `gorm:"column:makeup;default:false"`                 // 是否为补签
+}
+
+// TableName ...
+func (signinday) TableName() string {
+	return "sign_in_day"
+}
+
 // initialize 初始化ScoreDB数据库
 func initialize(dbpath string) *scoredb {
 	var err error
@@ -55,7 +71,7 @@ func initialize(dbpath string) *scoredb {
 	if err != nil {
 		panic(err)
 	}
-	gdb.AutoMigrate(&scoretable{}).AutoMigrate(&signintable{})
+	gdb.AutoMigrate(&scoretable{}).AutoMigrate(&signintable{}).AutoMigrate(&signinday{})
 	return &scoredb{
 		db: gdb,
 	}
@@ -131,6 +147,34 @@ func (sdb *scoredb) InsertOrUpdateSignInCountByUID(uid int64, count int) (err er
 	return
 }
 
+// AddSignInDay 记录某天的签到
+func (sdb *scoredb) AddSignInDay(uid int64, day int, makeup bool) error {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	return sdb.db.Model(&signinday{}).Create(&signinday{UID: uid, Day: day, Makeup: makeup}).Error
+}
+
+// GetSignInDays 取得 from 到 to 之间(含)的签到记录, 按日期升序
+func (sdb *scoredb) GetSignInDays(uid int64, from, to int) (days []signinday, err error) {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	err = sdb.db.Model(&signinday{}).Where("uid = ? AND day >= ? AND day <= ?", uid, from, to).Order("day").Find(&days).Error
+	return
+}
+
+// UpdateSignInStatsByUID 更新连续签到等统计, 不改动签到时间
+func (sdb *scoredb) UpdateSignInStatsByUID(uid int64, streak, longest, total, cards int) error {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	return sdb.db.Model(&signintable{}).Where("uid = ? ", uid).UpdateColumns(
+		map[string]any{
+			"streak":  streak,
+			"longest": longest,
+			"total":   total,
+			"cards":   cards,
+		}).Error
+}
+
 func (sdb *scoredb) GetScoreRankByTopN(n int) (st []scoretable, err error) {
 	sdb.scoremu.Lock()
 	defer sdb.scoremu.Unlock()
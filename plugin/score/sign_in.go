@@ -14,6 +14,7 @@ import (
 
 	"github.com/FloatTech/AnimeAPI/bilibili"
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	"github.com/FloatTech/floatbox/file"
 	"github.com/FloatTech/floatbox/process"
 	"github.com/FloatTech/floatbox/web"
@@ -42,7 +43,7 @@ var (
 	engine    = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault:  false,
 		Brief:             "签到",
-		Help:              "- 签到\n- 获得签到背景[@xxx] | 获得签到背景\n- 设置签到预设(0~3)\n- 查看等级排名\n注:为跨群排名\n- 查看我的钱包\n- 查看钱包排名\n注:为本群排行，若群人数太多不建议使用该功能!!!",
+		Help:              "- 签到\n- 签到日历\n- 购买补签卡[数量]\n- 补签[本月几号]\n注:不指定日期时补签最近漏签的一天, 连续签到7/30/100/365天有额外奖励\n- 获得签到背景[@xxx] | 获得签到背景\n- 设置签到预设(0~3)\n- 查看等级排名\n注:为跨群排名\n- 查看我的钱包\n- 查看钱包排名\n注:为本群排行，若群人数太多不建议使用该功能!!!",
 		PrivateDataFolder: "score",
 	})
 	styles = []scoredrawer{
@@ -141,11 +142,18 @@ func init() {
 		// 更新钱包
 		rank := getrank(level)
 		add := 1 + rand.Intn(10) + rank*5 // 等级越高获得的钱越高
-		err = wallet.InsertWalletOf(uid, add)
+		err = ledger.InsertWalletOf(uid, add, "score", "签到", ctx.Event.GroupID)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return
 		}
+		// 更新连续签到, 达到里程碑的奖励在签到图之后发送
+		bonus, reached, err := recordSignIn(&si, dayOf(time.Now()), false, time.Now())
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		defer payMilestone(ctx, uid, bonus, reached)
 		alldata := &scdata{
 			drawedfile: drawedFile,
 			picfile:    picFile,
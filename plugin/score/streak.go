@@ -0,0 +1,276 @@
+package score
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+	"github.com/FloatTech/imgfactory"
+	"github.com/FloatTech/zbputils/ctxext"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	// makeupCardPrice 补签卡单价
+	makeupCardPrice = 100
+	// makeupDays 最多能补签多少天前
+	makeupDays = 30
+	// maxCardsPerBuy 一次最多购买的补签卡数
+	maxCardsPerBuy = 100
+)
+
+// milestones 连续签到达到天数时的额外奖励
+var milestones = []struct {
+	days  int
+	bonus int
+}{
+	{7, 50},
+	{30, 300},
+	{100, 1000},
+	{365, 5000},
+}
+
+var errNoMissedDay = errors.New("最近" + strconv.Itoa(makeupDays) + "天没有漏签的日子")
+
+// dayOf t 的日期, 如 20060102
+func dayOf(t time.Time) int {
+	y, m, d := t.Date()
+	return y*10000 + int(m)*100 + d
+}
+
+// dateOf dayOf 的逆运算
+func dateOf(day int, loc *time.Location) time.Time {
+	return time.Date(day/10000, time.Month(day/100%100), day%100, 0, 0, 0, 0, loc)
+}
+
+// ordinal 日期的序号, 相邻两天相差 1
+func ordinal(day int) int {
+	return int(dateOf(day, time.UTC).Unix() / 86400)
+}
+
+// streaks 由升序的签到日期计算截至 today 的当前连续天数与最长连续天数
+//
+// 今天还没签到时, 截至昨天的连续天数仍算作当前连续
+func streaks(days []int, today int) (current, longest int) {
+	run, last := 0, 0
+	for i, d := range days {
+		if i > 0 && ordinal(d) == ordinal(last)+1 {
+			run++
+		} else {
+			run = 1
+		}
+		last = d
+		longest = max(longest, run)
+	}
+	if len(days) > 0 && ordinal(today)-ordinal(last) <= 1 {
+		current = run
+	}
+	return
+}
+
+// around 紧挨 day 之前与之后已经连续签到的天数, days 为升序且不含 day
+func around(days []int, day int) (before, after int) {
+	i := sort.SearchInts(days, day)
+	for j := i - 1; j >= 0 && ordinal(days[j]) == ordinal(day)-(i-j); j-- {
+		before++
+	}
+	for j := i; j < len(days) && ordinal(days[j]) == ordinal(day)+(j-i+1); j++ {
+		after++
+	}
+	return
+}
+
+// signInBonus 在 days (升序, 不含 day) 的基础上签到 day 后应发的里程碑奖励
+//
+// 只有 day 所在的一段是当前连续时才发, 且从被连起来的两段中较长的一段算起,
+// 断签后补签不会把已经领过的里程碑再发一次
+func signInBonus(days []int, day, today int) (bonus, reached int) {
+	before, after := around(days, day)
+	if ordinal(today)-(ordinal(day)+after) > 1 {
+		return
+	}
+	return milestoneBonus(max(before, after), before+1+after)
+}
+
+// milestoneBonus 连续天数由 from 增至 to 时跨过的里程碑奖励
+func milestoneBonus(from, to int) (bonus, reached int) {
+	for _, m := range milestones {
+		if from < m.days && m.days <= to {
+			bonus += m.bonus
+			reached = m.days
+		}
+	}
+	return
+}
+
+// missedDay 最近一个漏签的日子, days 为升序的签到日期
+func missedDay(days []int, today time.Time) (int, error) {
+	for i := 1; i <= makeupDays; i++ {
+		d := dayOf(today.AddDate(0, 0, -i))
+		j := sort.SearchInts(days, d)
+		if j == len(days) || days[j] != d {
+			return d, nil
+		}
+	}
+	return 0, errNoMissedDay
+}
+
+// recordSignIn 记录 day 的签到并更新统计, 返回跨过里程碑的奖励与达到的天数
+func recordSignIn(si *signintable, day int, makeup bool, now time.Time) (bonus, reached int, err error) {
+	today := dayOf(now)
+	records, err := sdb.GetSignInDays(si.UID, 0, today)
+	if err != nil {
+		return
+	}
+	days := make([]int, 0, len(records)+1)
+	for _, r := range records {
+		days = append(days, r.Day)
+	}
+	bonus, reached = signInBonus(days, day, today)
+	err = sdb.AddSignInDay(si.UID, day, makeup)
+	if err != nil {
+		return 0, 0, err
+	}
+	i := sort.SearchInts(days, day)
+	days = append(days[:i], append([]int{day}, days[i:]...)...)
+	current, longest := streaks(days, today)
+	si.Streak = current
+	si.Longest = max(si.Longest, longest)
+	si.Total++
+	err = sdb.UpdateSignInStatsByUID(si.UID, si.Streak, si.Longest, si.Total, si.Cards)
+	if err != nil {
+		return 0, 0, err
+	}
+	return
+}
+
+// payMilestone 发放连续签到奖励
+func payMilestone(ctx *zero.Ctx, uid int64, bonus, reached int) {
+	if bonus <= 0 {
+		return
+	}
+	err := ledger.InsertWalletOf(uid, bonus, "score", "连续签到"+strconv.Itoa(reached)+"天奖励", ctx.Event.GroupID)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	ctx.SendChain(message.At(uid), message.Text("\n已连续签到", reached, "天, 额外获得", bonus, wallet.GetWalletName()))
+}
+
+func init() {
+	engine.OnRegex(`^购买补签卡\s*(\d*)$`).Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		n, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+		if n <= 0 {
+			n = 1
+		}
+		if n > maxCardsPerBuy {
+			ctx.SendChain(message.Text("ERROR: 一次最多购买", maxCardsPerBuy, "张补签卡"))
+			return
+		}
+		uid := ctx.Event.UserID
+		price := n * makeupCardPrice
+		err := ledger.Debit(uid, price, "score", "购买"+strconv.Itoa(n)+"张补签卡", ctx.Event.GroupID)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err, ", 补签卡", makeupCardPrice, wallet.GetWalletName(), "一张"))
+			return
+		}
+		si := sdb.GetSignInByUID(uid)
+		si.Cards += n
+		err = sdb.UpdateSignInStatsByUID(uid, si.Streak, si.Longest, si.Total, si.Cards)
+		if err != nil {
+			_ = ledger.InsertWalletOf(uid, price, "score", "购买补签卡失败退回", ctx.Event.GroupID)
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("花费", price, wallet.GetWalletName(), "购买了", n, "张补签卡, 现有", si.Cards, "张"))
+	})
+	engine.OnRegex(`^补签\s*(\d{1,2})?$`).Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		si := sdb.GetSignInByUID(uid)
+		if si.Cards <= 0 {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你没有补签卡, 发送\"购买补签卡\"购买, ", makeupCardPrice, wallet.GetWalletName(), "一张"))
+			return
+		}
+		now := time.Now()
+		today := dayOf(now)
+		records, err := sdb.GetSignInDays(uid, dayOf(now.AddDate(0, 0, -makeupDays)), today)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		days := make([]int, len(records))
+		for i, r := range records {
+			days[i] = r.Day
+		}
+		var day int
+		if arg := ctx.State["regex_matched"].([]string)[1]; arg != "" {
+			// 补签本月的某一天
+			d, _ := strconv.Atoi(arg)
+			day = today/100*100 + d
+			t := dateOf(day, now.Location())
+			switch {
+			case d < 1 || t.Month() != now.Month():
+				ctx.SendChain(message.Text("ERROR: 本月没有", d, "号"))
+				return
+			case day >= today:
+				ctx.SendChain(message.Text("ERROR: 只能补签今天之前的日子"))
+				return
+			case day < dayOf(now.AddDate(0, 0, -makeupDays)):
+				ctx.SendChain(message.Text("ERROR: 最多补签", makeupDays, "天前"))
+				return
+			}
+			if i := sort.SearchInts(days, day); i < len(days) && days[i] == day {
+				ctx.SendChain(message.Text("ERROR: ", d, "号已经签到过了"))
+				return
+			}
+		} else if day, err = missedDay(days, now); err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		si.Cards--
+		bonus, reached, err := recordSignIn(&si, day, true, now)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(
+			"已补签", dateOf(day, now.Location()).Format("01月02日"), ", 当前连续签到", si.Streak, "天, 剩余补签卡", si.Cards, "张"))
+		payMilestone(ctx, uid, bonus, reached)
+	})
+	engine.OnFullMatch("签到日历").Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		now := time.Now()
+		today := dayOf(now)
+		all, err := sdb.GetSignInDays(uid, 0, today)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		days := make([]int, len(all))
+		month := make([]signinday, 0, 31)
+		for i, r := range all {
+			days[i] = r.Day
+			if r.Day/100 == today/100 {
+				month = append(month, r)
+			}
+		}
+		// 记录的连续天数在断签后不会归零, 按签到记录重新计算
+		streak, _ := streaks(days, today)
+		si := sdb.GetSignInByUID(uid)
+		img, err := drawCalendar(ctx.CardOrNickName(uid), &si, streak, month, now)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		data, err := imgfactory.ToBytes(img)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.ImageBytes(data))
+	})
+}
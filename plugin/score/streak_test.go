@@ -0,0 +1,82 @@
+package score
+
+import (
+	"testing"
+	"time"
+)
+
+// seq 从 start 起连续 n 天的签到日期
+func seq(start, n int) []int {
+	t := dateOf(start, time.UTC)
+	days := make([]int, n)
+	for i := range days {
+		days[i] = dayOf(t.AddDate(0, 0, i))
+	}
+	return days
+}
+
+func TestStreaks(t *testing.T) {
+	for _, c := range []struct {
+		days             []int
+		today            int
+		current, longest int
+	}{
+		{nil, 20240301, 0, 0},
+		{[]int{20240301}, 20240301, 1, 1},
+		{[]int{20240229}, 20240301, 1, 1}, // 今天还没签到
+		{[]int{20240228}, 20240301, 0, 1},
+		{seq(20240227, 4), 20240301, 4, 4}, // 跨过闰日
+		{append(seq(20231201, 10), seq(20231231, 3)...), 20240102, 3, 10},
+		{append(seq(20231201, 10), 20231212), 20240101, 0, 10},
+	} {
+		current, longest := streaks(c.days, c.today)
+		if current != c.current || longest != c.longest {
+			t.Fatal(c.days, c.today, "got", current, longest)
+		}
+	}
+}
+
+func TestMilestoneBonus(t *testing.T) {
+	for _, c := range []struct {
+		from, to       int
+		bonus, reached int
+	}{
+		{0, 1, 0, 0},
+		{6, 7, 50, 7},
+		{7, 8, 0, 0},
+		{0, 30, 350, 30},
+		{1, 367, 6350, 365},
+		{365, 367, 0, 0},
+		{99, 100, 1000, 100},
+	} {
+		bonus, reached := milestoneBonus(c.from, c.to)
+		if bonus != c.bonus || reached != c.reached {
+			t.Fatal(c.from, c.to, "got", bonus, reached)
+		}
+	}
+}
+
+func TestSignInBonus(t *testing.T) {
+	// 连续 365 天后断签一天, 次日签到, 再补签断掉的那天
+	year := seq(20230101, 365)
+	gap := dayOf(dateOf(year[364], time.UTC).AddDate(0, 0, 1))
+	next := dayOf(dateOf(gap, time.UTC).AddDate(0, 0, 1))
+	for _, c := range []struct {
+		name           string
+		days           []int
+		day, today     int
+		bonus, reached int
+	}{
+		{"第7天", seq(20240101, 6), 20240107, 20240107, 50, 7},
+		{"第8天", seq(20240101, 7), 20240108, 20240108, 0, 0},
+		{"断签后重新签到", year, next, next, 0, 0},
+		{"补签连起两段", append(year, next), gap, next, 0, 0},
+		{"补签连起较短的两段", append(seq(20240101, 3), seq(20240105, 3)...), 20240104, 20240107, 50, 7},
+		{"补签不在当前连续中", append(seq(20240101, 3), seq(20240105, 3)...), 20240104, 20240110, 0, 0},
+	} {
+		bonus, reached := signInBonus(c.days, c.day, c.today)
+		if bonus != c.bonus || reached != c.reached {
+			t.Fatal(c.name, "got", bonus, reached)
+		}
+	}
+}
@@ -8,6 +8,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// maxSleepLength 晚安后超过这个时长才早安, 不计入作息记录
+const maxSleepLength = 18 * time.Hour
+
 // sdb 睡眠数据库全局变量
 var sdb *sleepdb
 
@@ -29,7 +32,7 @@ func initialize(dbpath string) *sleepdb {
 	if err != nil {
 		panic(err)
 	}
-	gdb.AutoMigrate(&SleepManage{})
+	gdb.AutoMigrate(&SleepManage{}, &SleepLog{}, &SleepConfig{}, &UserZone{})
 	return (*sleepdb)(gdb)
 }
 
@@ -52,16 +55,28 @@ func (SleepManage) TableName() string {
 	return "sleep_manage"
 }
 
-// sleep 更新睡眠时间
-func (sdb *sleepdb) sleep(gid, uid int64) (position int, awakeTime time.Duration) {
+// SleepLog 一次晚安到早安的作息记录
+type SleepLog struct {
+	ID      uint       `gorm:"primary_key"`
+	GroupID int64      `gorm:"column:group_id;index:idx_sleep_log"`
+	UserID  int64      `gorm:"column:user_id;index:idx_sleep_log"`
+	SleepAt time.Time  `gorm:"column:sleep_at"`
+	WakeAt  *time.Time `gorm:"column:wake_at"`
+	// Zone 晚安时使用的时区, 按当地时间统计作息
+	Zone string `gorm:"column:zone"`
+}
+
+// TableName 表名
+func (SleepLog) TableName() string {
+	return "sleep_log"
+}
+
+// sleep 更新睡眠时间, 并开始一条作息记录
+func (sdb *sleepdb) sleep(gid, uid int64, c SleepConfig, zone string) (position int, awakeTime time.Duration) {
 	db := (*gorm.DB)(sdb)
 	now := time.Now()
-	var today time.Time
-	if now.Hour() >= 21 {
-		today = now.Add(-time.Hour*time.Duration(-21+now.Hour()) - time.Minute*time.Duration(now.Minute()) - time.Second*time.Duration(now.Second()))
-	} else if now.Hour() <= 3 {
-		today = now.Add(-time.Hour*time.Duration(3+now.Hour()) - time.Minute*time.Duration(now.Minute()) - time.Second*time.Duration(now.Second()))
-	}
+	// 驱动按字符串比较时间, 须与库中一样使用本地时区
+	today := windowStart(now.In(location(zone)), c.EveningStart).In(time.Local)
 	st := SleepManage{
 		GroupID:   gid,
 		UserID:    uid,
@@ -80,15 +95,25 @@ func (sdb *sleepdb) sleep(gid, uid int64) (position int, awakeTime time.Duration
 				"sleep_time": now,
 			})
 	}
+	// 同一晚多次晚安以最后一次为准
+	sl := SleepLog{}
+	err := db.Model(&SleepLog{}).Where("group_id = ? and user_id = ? and wake_at is null and sleep_at >= ?", gid, uid, today).
+		Order("sleep_at desc").First(&sl).Error
+	if err == nil {
+		db.Model(&sl).Updates(map[string]any{"sleep_at": now, "zone": zone})
+	} else {
+		db.Create(&SleepLog{GroupID: gid, UserID: uid, SleepAt: now, Zone: zone})
+	}
 	db.Model(&SleepManage{}).Where("group_id = ? and sleep_time <= ? and sleep_time >= ?", gid, now, today).Count(&position)
 	return position, awakeTime
 }
 
-// getUp 更新起床时间
-func (sdb *sleepdb) getUp(gid, uid int64) (position int, sleepTime time.Duration) {
+// getUp 更新起床时间, 并结束最近一条作息记录, 返回这次的睡眠时长
+func (sdb *sleepdb) getUp(gid, uid int64, c SleepConfig, zone string) (position int, sleepTime time.Duration) {
 	db := (*gorm.DB)(sdb)
 	now := time.Now()
-	today := now.Add(-time.Hour*time.Duration(-6+now.Hour()) - time.Minute*time.Duration(now.Minute()) - time.Second*time.Duration(now.Second()))
+	// 驱动按字符串比较时间, 须与库中一样使用本地时区
+	today := windowStart(now.In(location(zone)), c.MorningStart).In(time.Local)
 	st := SleepManage{
 		GroupID:   gid,
 		UserID:    uid,
@@ -101,12 +126,18 @@ func (sdb *sleepdb) getUp(gid, uid int64) (position int, sleepTime time.Duration
 		}
 	} else {
 		log.Debugln("sleeptime为", st)
-		sleepTime = now.Sub(st.SleepTime)
 		db.Model(&SleepManage{}).Where("group_id = ? and user_id = ?", gid, uid).Update(
 			map[string]any{
 				"sleep_time": now,
 			})
 	}
+	sl := SleepLog{}
+	err := db.Model(&SleepLog{}).Where("group_id = ? and user_id = ? and wake_at is null and sleep_at >= ?", gid, uid, now.Add(-maxSleepLength)).
+		Order("sleep_at desc").First(&sl).Error
+	if err == nil {
+		sleepTime = now.Sub(sl.SleepAt)
+		db.Model(&sl).Update("wake_at", now)
+	}
 	db.Model(&SleepManage{}).Where("group_id = ? and sleep_time <= ? and sleep_time >= ?", gid, now, today).Count(&position)
 	return position, sleepTime
 }
@@ -0,0 +1,341 @@
+package sleepmanage
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/golang/freetype"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"github.com/wcharczuk/go-chart/v2"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	statDays   = 30 // 我的作息统计的天数
+	chartDays  = 7  // 入睡时间图表的天数
+	reportSize = 10 // 熬夜榜人数
+	reportHour = 10 // 每周一当地时间 10 点发送上周熬夜榜
+	dateLayout = "01-02"
+	nightShift = 12 * time.Hour
+)
+
+// sleepSummary 一段时间内的作息统计
+type sleepSummary struct {
+	Nights   int           // 有晚安记录的晚数
+	Slept    int           // 晚安后又早安的晚数
+	AvgSleep time.Duration // 平均睡眠时长
+	AvgBed   float64       // 平均入睡时间, 距当晚 12 点的小时数
+	AvgWake  float64       // 平均起床时间, 距当天 0 点的小时数
+}
+
+// reportEntry 熬夜榜中一个人的统计
+type reportEntry struct {
+	UserID  int64
+	Nights  int
+	Latest  float64 // 最晚入睡时间, 距当晚 12 点的小时数
+	LatestT time.Time
+	AvgBed  float64
+}
+
+// nightOf 入睡时间属于哪一晚, 返回当晚 12 点, 凌晨入睡算前一晚
+func nightOf(t time.Time) time.Time {
+	d := t.Add(-nightShift)
+	return time.Date(d.Year(), d.Month(), d.Day(), 12, 0, 0, 0, t.Location())
+}
+
+// bedHour 入睡时间距当晚 12 点的小时数, 23:30 为 11.5, 次日 01:00 为 13
+func bedHour(t time.Time) float64 {
+	return t.Sub(nightOf(t)).Hours()
+}
+
+// daysBetween 两个日期相差的天数, 忽略时区
+func daysBetween(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+// clockString 将距当晚 12 点的小时数格式化为 hh:mm
+func clockString(h float64) string {
+	m := int(math.Round(h*60)) + 12*60
+	return fmt.Sprintf("%02d:%02d", m/60%24, m%60)
+}
+
+// local 记录在其时区的当地时间
+func (sl *SleepLog) local(t time.Time) time.Time {
+	return t.In(location(sl.Zone))
+}
+
+// getLogs 获得群内 since 之后的作息记录, uid 为 0 时不限成员
+func (sdb *sleepdb) getLogs(gid, uid int64, since time.Time) (logs []SleepLog, err error) {
+	db := (*gorm.DB)(sdb).Model(&SleepLog{}).Where("group_id = ? and sleep_at >= ?", gid, since.In(time.Local))
+	if uid != 0 {
+		db = db.Where("user_id = ?", uid)
+	}
+	err = db.Order("sleep_at").Find(&logs).Error
+	return
+}
+
+// getReportGroups 最近有作息记录的群
+func (sdb *sleepdb) getReportGroups(since time.Time) (gids []int64, err error) {
+	db := (*gorm.DB)(sdb)
+	err = db.Model(&SleepLog{}).Where("sleep_at >= ?", since.In(time.Local)).Pluck("distinct(group_id)", &gids).Error
+	return
+}
+
+// summarize 统计作息记录
+func summarize(logs []SleepLog) (s sleepSummary) {
+	var sleep time.Duration
+	var bed, wake float64
+	for i := range logs {
+		sl := &logs[i]
+		s.Nights++
+		bed += bedHour(sl.local(sl.SleepAt))
+		if sl.WakeAt == nil {
+			continue
+		}
+		s.Slept++
+		sleep += sl.WakeAt.Sub(sl.SleepAt)
+		w := sl.local(*sl.WakeAt)
+		wake += float64(w.Hour()) + float64(w.Minute())/60
+	}
+	if s.Nights > 0 {
+		s.AvgBed = bed / float64(s.Nights)
+	}
+	if s.Slept > 0 {
+		s.AvgSleep = sleep / time.Duration(s.Slept)
+		s.AvgWake = wake / float64(s.Slept)
+	}
+	return
+}
+
+// weeklyReport 按最晚入睡时间排序的熬夜榜
+func weeklyReport(logs []SleepLog) []*reportEntry {
+	m := make(map[int64]*reportEntry, 16)
+	for i := range logs {
+		sl := &logs[i]
+		t := sl.local(sl.SleepAt)
+		h := bedHour(t)
+		e, ok := m[sl.UserID]
+		if !ok {
+			e = &reportEntry{UserID: sl.UserID, Latest: h, LatestT: t}
+			m[sl.UserID] = e
+		}
+		e.Nights++
+		e.AvgBed += h
+		if h > e.Latest {
+			e.Latest, e.LatestT = h, t
+		}
+	}
+	entries := make([]*reportEntry, 0, len(m))
+	for _, e := range m {
+		e.AvgBed /= float64(e.Nights)
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Latest == entries[j].Latest {
+			return entries[i].AvgBed > entries[j].AvgBed
+		}
+		return entries[i].Latest > entries[j].Latest
+	})
+	if len(entries) > reportSize {
+		entries = entries[:reportSize]
+	}
+	return entries
+}
+
+// formatReport 熬夜榜文本, name 用于获取成员名称
+func formatReport(title string, entries []*reportEntry, name func(uid int64) string) string {
+	var sb strings.Builder
+	sb.WriteString(title)
+	weekdays := [...]string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+	for i, e := range entries {
+		night := nightOf(e.LatestT)
+		sb.WriteString(fmt.Sprintf("\n%d. %s 最晚 %s (%s %s), 平均 %s, 共 %d 晚",
+			i+1, name(e.UserID), clockString(e.Latest), night.Format(dateLayout), weekdays[night.Weekday()],
+			clockString(e.AvgBed), e.Nights))
+	}
+	return sb.String()
+}
+
+// drawBedtime 绘制最近几晚的入睡时间
+func drawBedtime(title string, logs []SleepLog, now time.Time) ([]byte, error) {
+	b, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	font, err := freetype.ParseFont(b)
+	if err != nil {
+		return nil, err
+	}
+	last := nightOf(now)
+	first := last.AddDate(0, 0, 1-chartDays)
+	// 同一晚多条记录时取最晚的一次
+	bed := make(map[int]float64, chartDays)
+	for i := range logs {
+		sl := &logs[i]
+		t := sl.local(sl.SleepAt)
+		day := daysBetween(first, nightOf(t))
+		if day < 0 || day >= chartDays {
+			continue
+		}
+		if h := bedHour(t); h > bed[day] {
+			bed[day] = h
+		}
+	}
+	xs := make([]float64, 0, chartDays)
+	ys := make([]float64, 0, chartDays)
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for day := 0; day < chartDays; day++ {
+		if h, ok := bed[day]; ok {
+			xs = append(xs, float64(day))
+			ys = append(ys, h)
+			lo, hi = math.Min(lo, h), math.Max(hi, h)
+		}
+	}
+	ticks := make([]chart.Tick, chartDays)
+	for day := range ticks {
+		ticks[day] = chart.Tick{Value: float64(day), Label: first.AddDate(0, 0, day).Format(dateLayout)}
+	}
+	lo, hi = math.Floor(lo-0.5), math.Ceil(hi+0.5)
+	yticks := make([]chart.Tick, 0, int(hi-lo)+1)
+	for h := lo; h <= hi; h++ {
+		yticks = append(yticks, chart.Tick{Value: h, Label: clockString(h)})
+	}
+	graph := chart.Chart{
+		Font:   font,
+		Title:  title,
+		Width:  800,
+		Height: 450,
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:  60,
+				Left: 20,
+			},
+		},
+		XAxis: chart.XAxis{
+			Ticks: ticks,
+			Range: &chart.ContinuousRange{Min: -0.5, Max: chartDays - 0.5},
+		},
+		YAxis: chart.YAxis{
+			Name:  "入睡时间",
+			Range: &chart.ContinuousRange{Min: lo, Max: hi},
+			Ticks: yticks,
+		},
+		Series: []chart.Series{
+			chart.ContinuousSeries{
+				XValues: xs,
+				YValues: ys,
+				Style: chart.Style{
+					StrokeColor: chart.ColorBlue,
+					StrokeWidth: 3,
+					DotColor:    chart.ColorBlue,
+					DotWidth:    5,
+				},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	err = graph.Render(chart.PNG, &buf)
+	return buf.Bytes(), err
+}
+
+// myRoutine 我的作息: 最近 30 天的平均作息与最近 7 晚的入睡时间图
+func myRoutine(ctx *zero.Ctx) (message.Message, error) {
+	gid, uid := ctx.Event.GroupID, ctx.Event.UserID
+	now := time.Now()
+	logs, err := sdb.getLogs(gid, uid, now.AddDate(0, 0, -statDays))
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return message.Message{message.Reply(ctx.Event.MessageID), message.Text("最近", statDays, "天还没有你的晚安记录哦")}, nil
+	}
+	_, zone := sdb.userClock(gid, uid)
+	s := summarize(logs)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("最近%d天共记录%d晚 (%s)\n平均入睡: %s", statDays, s.Nights, zoneName(zone), clockString(s.AvgBed)))
+	if s.Slept > 0 {
+		hour, minute, _ := timeDuration(s.AvgSleep)
+		w := int(math.Round(s.AvgWake * 60))
+		sb.WriteString(fmt.Sprintf("\n平均起床: %02d:%02d\n平均睡眠: %d时%d分 (%d晚)", w/60%24, w%60, hour, minute, s.Slept))
+	}
+	msg := message.Message{message.Reply(ctx.Event.MessageID), message.Text(sb.String())}
+	recent := make([]SleepLog, 0, chartDays)
+	first := nightOf(now.In(location(zone))).AddDate(0, 0, 1-chartDays)
+	for _, sl := range logs {
+		if !sl.SleepAt.Before(first) {
+			recent = append(recent, sl)
+		}
+	}
+	if len(recent) == 0 {
+		return msg, nil
+	}
+	img, err := drawBedtime(fmt.Sprintf("%s最近%d晚的入睡时间", ctx.CardOrNickName(uid), chartDays), recent, now.In(location(zone)))
+	if err != nil {
+		return nil, err
+	}
+	return append(msg, message.ImageBytes(img)), nil
+}
+
+// groupReport 群内最近 7 天的熬夜榜
+func groupReport(ctx *zero.Ctx, gid int64, now time.Time) (string, error) {
+	logs, err := sdb.getLogs(gid, 0, now.AddDate(0, 0, -7))
+	if err != nil || len(logs) == 0 {
+		return "", err
+	}
+	entries := weeklyReport(logs)
+	return formatReport("本周熬夜榜 (按最晚入睡时间)", entries, func(uid int64) string {
+		name := ctx.GetGroupMemberInfo(gid, uid, false).Get("card").String()
+		if name == "" {
+			name = ctx.GetStrangerInfo(uid, false).Get("nickname").String()
+		}
+		if name == "" {
+			name = fmt.Sprint(uid)
+		}
+		return name
+	}), nil
+}
+
+// runWeeklyReport 每小时检查一次, 在各群当地时间周一 10 点发送上周熬夜榜
+func runWeeklyReport(engine *control.Engine) {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Hour).Add(time.Hour).Sub(now))
+		if sdb == nil {
+			continue
+		}
+		now = time.Now()
+		gids, err := sdb.getReportGroups(now.AddDate(0, 0, -7))
+		if err != nil {
+			log.Warnln("[sleepmanage] 获取作息记录失败:", err)
+			continue
+		}
+		for _, gid := range gids {
+			local := now.In(location(sdb.getConfig(gid).Zone))
+			if local.Weekday() != time.Monday || local.Hour() != reportHour || !engine.IsEnabledIn(gid) {
+				continue
+			}
+			zero.RangeBot(func(_ int64, ctx *zero.Ctx) bool {
+				report, err := groupReport(ctx, gid, now)
+				if err != nil {
+					log.Warnln("[sleepmanage] 生成熬夜榜失败:", err)
+					return false
+				}
+				if report != "" {
+					ctx.SendGroupMessage(gid, message.Text(report))
+				}
+				return false
+			})
+		}
+	}
+}
@@ -3,6 +3,7 @@ package sleepmanage
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -11,21 +12,27 @@ import (
 
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
 )
 
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
-		DisableOnDefault:  false,
-		Brief:             "睡眠小助手",
-		Help:              "- 早安\n- 晚安",
+		DisableOnDefault: false,
+		Brief:            "睡眠小助手",
+		Help: "- 早安\n- 晚安\n- 我的作息\n- 本周熬夜榜\n" +
+			"- [群管理] 设置早安时段 6-12\n- [群管理] 设置晚安时段 21-3\n" +
+			"- [群管理] 设置本群时区 UTC+8\n- 设置我的时区 UTC-5 | 默认\n- 查看作息设置\n" +
+			"Tips: 时段与时区按当地时间计算, 个人时区优先于本群时区; 每周一当地时间10点发送上周熬夜榜",
 		PrivateDataFolder: "sleep",
 	})
 	go func() {
 		sdb = initialize(engine.DataFolder() + "manage.db")
 	}()
+	go runWeeklyReport(engine)
 	engine.OnFullMatch("早安", isMorning, zero.OnlyGroup).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			position, getUpTime := sdb.getUp(ctx.Event.GroupID, ctx.Event.UserID)
+			c, zone := sdb.userClock(ctx.Event.GroupID, ctx.Event.UserID)
+			position, getUpTime := sdb.getUp(ctx.Event.GroupID, ctx.Event.UserID, c, zone)
 			log.Debugln(position, getUpTime)
 			hour, minute, second := timeDuration(getUpTime)
 			if (hour == 0 && minute == 0 && second == 0) || hour >= 24 {
@@ -36,7 +43,8 @@ func init() {
 		})
 	engine.OnFullMatch("晚安", isEvening, zero.OnlyGroup).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			position, sleepTime := sdb.sleep(ctx.Event.GroupID, ctx.Event.UserID)
+			c, zone := sdb.userClock(ctx.Event.GroupID, ctx.Event.UserID)
+			position, sleepTime := sdb.sleep(ctx.Event.GroupID, ctx.Event.UserID, c, zone)
 			log.Debugln(position, sleepTime)
 			hour, minute, second := timeDuration(sleepTime)
 			if (hour == 0 && minute == 0 && second == 0) || hour >= 24 {
@@ -45,6 +53,96 @@ func init() {
 				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(fmt.Sprintf("晚安成功！你的清醒时长为%d时%d分%d秒,你是今天第%d个睡觉的", hour, minute, second, position)))
 			}
 		})
+	engine.OnFullMatch("我的作息", zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			msg, err := myRoutine(ctx)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(msg)
+		})
+	engine.OnFullMatch("本周熬夜榜", zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			report, err := groupReport(ctx, ctx.Event.GroupID, time.Now())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if report == "" {
+				ctx.SendChain(message.Text("本周还没有人道晚安哦"))
+				return
+			}
+			ctx.SendChain(message.Text(report))
+		})
+	engine.OnRegex(`^设置(早安|晚安)时段\s*(\d{1,2})\s*[-~到]\s*(\d{1,2})$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			start, _ := strconv.Atoi(matched[2])
+			end, _ := strconv.Atoi(matched[3])
+			if start > 23 || end > 23 || start == end {
+				ctx.SendChain(message.Text("ERROR: ", errHour))
+				return
+			}
+			c := sdb.getConfig(ctx.Event.GroupID)
+			if matched[1] == "早安" {
+				c.MorningStart, c.MorningEnd = start, end
+			} else {
+				c.EveningStart, c.EveningEnd = start, end
+			}
+			if err := sdb.setConfig(&c); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已将本群", matched[1], "时段设置为 ", start, " 点到 ", end, " 点 (", zoneName(c.Zone), ")"))
+		})
+	engine.OnRegex(`^设置本群时区\s*(?:UTC|GMT)?\s*([+-]\d{1,2}(?::?\d{2})?|默认)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			zone, err := matchedZone(ctx)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			c := sdb.getConfig(ctx.Event.GroupID)
+			c.Zone = zone
+			if err = sdb.setConfig(&c); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已将本群时区设置为 ", zoneName(zone), ", 当地时间 ", time.Now().In(location(zone)).Format("15:04")))
+		})
+	engine.OnRegex(`^设置我的时区\s*(?:UTC|GMT)?\s*([+-]\d{1,2}(?::?\d{2})?|默认)$`).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			zone, err := matchedZone(ctx)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if err = sdb.setUserZone(ctx.Event.UserID, zone); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if zone == "" {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("已清除你的时区设置, 将使用所在群的时区"))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("已将你的时区设置为 ", zoneName(zone), ", 当地时间 ", time.Now().In(location(zone)).Format("15:04")))
+		})
+	engine.OnFullMatch("查看作息设置", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c, zone := sdb.userClock(ctx.Event.GroupID, ctx.Event.UserID)
+			ctx.SendChain(message.Text(fmt.Sprintf("本群时区: %s\n你的时区: %s\n早安时段: %d 点到 %d 点\n晚安时段: %d 点到 %d 点",
+				zoneName(c.Zone), zoneName(zone), c.MorningStart, c.MorningEnd, c.EveningStart, c.EveningEnd)))
+		})
+}
+
+// matchedZone 解析指令中的时区, 默认返回空串
+func matchedZone(ctx *zero.Ctx) (string, error) {
+	s := ctx.State["regex_matched"].([]string)[1]
+	if s == "默认" {
+		return "", nil
+	}
+	return parseZone(s)
 }
 
 func timeDuration(time time.Duration) (hour, minute, second int64) {
@@ -53,15 +151,3 @@ func timeDuration(time time.Duration) (hour, minute, second int64) {
 	second = (int64(time) - hour*(1000*1000*1000*60*60) - minute*(1000*1000*1000*60)) / (1000 * 1000 * 1000)
 	return hour, minute, second
 }
-
-// 只统计6点到12点的早安
-func isMorning(*zero.Ctx) bool {
-	now := time.Now().Hour()
-	return now >= 6 && now <= 12
-}
-
-// 只统计21点到凌晨3点的晚安
-func isEvening(*zero.Ctx) bool {
-	now := time.Now().Hour()
-	return now >= 21 || now <= 3
-}
@@ -0,0 +1,173 @@
+package sleepmanage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+var (
+	zoneRe  = regexp.MustCompile(`^([+-])(\d{1,2})(?::?(\d{2}))?$`)
+	errZone = errors.New("时区格式应为 UTC+8、UTC-5、UTC+5:30 等, 范围 UTC-12 ~ UTC+14")
+	errHour = errors.New("时段应为 0~23 点之间的两个整点, 如 6-12")
+)
+
+// SleepConfig 群作息设置, 时段两端均为当地时间的整点且包含结束的那个小时
+type SleepConfig struct {
+	GroupID      int64 `gorm:"primary_key;auto_increment:false;column:group_id"`
+	MorningStart int   `gorm:"column:morning_start"`
+	MorningEnd   int   `gorm:"column:morning_end"`
+	EveningStart int   `gorm:"column:evening_start"`
+	EveningEnd   int   `gorm:"column:evening_end"`
+	// Zone 群时区, 如 +08:00, 为空时使用服务器时区
+	Zone string `gorm:"column:zone"`
+}
+
+// TableName 表名
+func (SleepConfig) TableName() string {
+	return "sleep_config"
+}
+
+// UserZone 个人时区, 优先于群时区
+type UserZone struct {
+	UserID int64  `gorm:"primary_key;auto_increment:false;column:user_id"`
+	Zone   string `gorm:"column:zone"`
+}
+
+// TableName 表名
+func (UserZone) TableName() string {
+	return "sleep_user_zone"
+}
+
+// defaultConfig 未设置时的作息时段: 6点到12点早安, 21点到凌晨3点晚安
+func defaultConfig(gid int64) SleepConfig {
+	return SleepConfig{GroupID: gid, MorningStart: 6, MorningEnd: 12, EveningStart: 21, EveningEnd: 3}
+}
+
+// parseZone 将 +8、-5:30、+0530 等解析为规范的 ±hh:mm
+func parseZone(s string) (string, error) {
+	m := zoneRe.FindStringSubmatch(s)
+	if m == nil {
+		return "", errZone
+	}
+	h, _ := strconv.Atoi(m[2])
+	minute := 0
+	if m[3] != "" {
+		minute, _ = strconv.Atoi(m[3])
+	}
+	offset := h*60 + minute
+	if m[1] == "-" {
+		offset = -offset
+	}
+	if minute >= 60 || offset < -12*60 || offset > 14*60 {
+		return "", errZone
+	}
+	return fmt.Sprintf("%s%02d:%02d", m[1], h, minute), nil
+}
+
+// location 时区对应的 Location, 空串为服务器时区
+func location(zone string) *time.Location {
+	if zone == "" {
+		return time.Local
+	}
+	m := zoneRe.FindStringSubmatch(zone)
+	if m == nil {
+		return time.Local
+	}
+	h, _ := strconv.Atoi(m[2])
+	minute, _ := strconv.Atoi(m[3])
+	offset := (h*60 + minute) * 60
+	if m[1] == "-" {
+		offset = -offset
+	}
+	return time.FixedZone("UTC"+zone, offset)
+}
+
+// zoneName 用于展示的时区名
+func zoneName(zone string) string {
+	if zone == "" {
+		return "服务器时区"
+	}
+	return "UTC" + zone
+}
+
+// inWindow 当地时间的小时是否在时段内, 支持跨越零点的时段
+func inWindow(hour, start, end int) bool {
+	if start <= end {
+		return hour >= start && hour <= end
+	}
+	return hour >= start || hour <= end
+}
+
+// windowStart 时段在 now 之前最近一次开始的时刻
+func windowStart(now time.Time, start int) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), start, 0, 0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+// getConfig 获得群作息设置, 未设置时返回默认值
+func (sdb *sleepdb) getConfig(gid int64) SleepConfig {
+	db := (*gorm.DB)(sdb)
+	c := defaultConfig(gid)
+	db.Model(&SleepConfig{}).Where("group_id = ?", gid).First(&c)
+	return c
+}
+
+// setConfig 保存群作息设置
+func (sdb *sleepdb) setConfig(c *SleepConfig) error {
+	db := (*gorm.DB)(sdb)
+	return db.Save(c).Error
+}
+
+// getUserZone 获得个人时区, 未设置时返回空串
+func (sdb *sleepdb) getUserZone(uid int64) string {
+	db := (*gorm.DB)(sdb)
+	z := UserZone{}
+	db.Model(&UserZone{}).Where("user_id = ?", uid).First(&z)
+	return z.Zone
+}
+
+// setUserZone 保存个人时区, zone 为空时删除设置
+func (sdb *sleepdb) setUserZone(uid int64, zone string) error {
+	db := (*gorm.DB)(sdb)
+	if zone == "" {
+		return db.Where("user_id = ?", uid).Delete(&UserZone{}).Error
+	}
+	return db.Save(&UserZone{UserID: uid, Zone: zone}).Error
+}
+
+// userClock 用户所在群的作息设置, 以及用户实际使用的时区
+func (sdb *sleepdb) userClock(gid, uid int64) (c SleepConfig, zone string) {
+	c = sdb.getConfig(gid)
+	zone = sdb.getUserZone(uid)
+	if zone == "" {
+		zone = c.Zone
+	}
+	return
+}
+
+// 只统计当地时间早安时段内的早安, 默认6点到12点
+func isMorning(ctx *zero.Ctx) bool {
+	if sdb == nil {
+		return false
+	}
+	c, zone := sdb.userClock(ctx.Event.GroupID, ctx.Event.UserID)
+	return inWindow(time.Now().In(location(zone)).Hour(), c.MorningStart, c.MorningEnd)
+}
+
+// 只统计当地时间晚安时段内的晚安, 默认21点到凌晨3点
+func isEvening(ctx *zero.Ctx) bool {
+	if sdb == nil {
+		return false
+	}
+	c, zone := sdb.userClock(ctx.Event.GroupID, ctx.Event.UserID)
+	return inWindow(time.Now().In(location(zone)).Hour(), c.EveningStart, c.EveningEnd)
+}
@@ -0,0 +1,149 @@
+package wallet
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// registerBank 群银行: 存取款, 每日复利, 借款与罚息
+func registerBank(en *control.Engine) {
+	err := initBank(en.DataFolder() + "bank.db")
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		// 结算按天补算, 重复执行不会重复计息
+		for {
+			if err := settleBank(time.Now()); err != nil {
+				logrus.Warnln("[wallet] 银行结算失败:", err)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+
+	en.OnRegex(`^存款\s*(\d+)$`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			amount, err := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			if err != nil || amount <= 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("输入的金额异常"))
+				return
+			}
+			balance, err := deposit(ctx.Event.GroupID, ctx.Event.UserID, amount)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:存款失败，", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功存入", amount, wallet.GetWalletName(), "，本群银行存款：", balance))
+		})
+
+	en.OnRegex(`^取款\s*(\d+|全部)$`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			param := ctx.State["regex_matched"].([]string)[1]
+			amount := 0
+			if param != "全部" {
+				amount, _ = strconv.Atoi(param)
+				if amount <= 0 {
+					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("输入的金额异常"))
+					return
+				}
+			}
+			amount, balance, err := withdraw(ctx.Event.GroupID, ctx.Event.UserID, amount)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:取款失败，", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功取出", amount, wallet.GetWalletName(), "，本群银行存款：", balance))
+		})
+
+	en.OnRegex(`^借款\s*(\d+)$`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			amount, err := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			if err != nil || amount <= 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("输入的金额异常"))
+				return
+			}
+			l, err := borrow(ctx.Event.GroupID, ctx.Event.UserID, amount, time.Now())
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:借款失败，", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(
+				"成功借到", amount, wallet.GetWalletName(), "，需在", time.Unix(l.Due, 0).Format("01-02 15:04"),
+				"前还款", l.Owed, "，逾期将自动扣款并计罚息"))
+		})
+
+	en.OnRegex(`^还款\s*(\d+)?$`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			amount, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			paid, owed, err := repay(ctx.Event.GroupID, ctx.Event.UserID, amount)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:还款失败，", err))
+				return
+			}
+			if owed == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功还款", paid, wallet.GetWalletName(), "，借款已还清"))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功还款", paid, wallet.GetWalletName(), "，还欠", owed))
+		})
+
+	en.OnFullMatchGroup([]string{"我的银行", "银行"}, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			a, l := bankOf(ctx.Event.GroupID, ctx.Event.UserID)
+			c := bankConfigOf(ctx.Event.GroupID)
+			var sb strings.Builder
+			sb.WriteString("本群银行存款：" + strconv.Itoa(a.Deposit) + wallet.GetWalletName())
+			sb.WriteString("\n存款日利率：" + strconv.Itoa(c.Interest) + "‰, 每日零点复利")
+			sb.WriteString("\n钱包余额：" + strconv.Itoa(wallet.GetWalletOf(ctx.Event.UserID)))
+			switch {
+			case l == nil:
+				sb.WriteString("\n借款：无")
+			case time.Now().Unix() > l.Due:
+				sb.WriteString("\n借款：欠" + strconv.Itoa(l.Owed) + ", 已于" + time.Unix(l.Due, 0).Format("01-02 15:04") +
+					"逾期, 每日罚息" + strconv.Itoa(c.Penalty) + "‰")
+			default:
+				sb.WriteString("\n借款：欠" + strconv.Itoa(l.Owed) + ", " + time.Unix(l.Due, 0).Format("01-02 15:04") + "到期")
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(sb.String()))
+		})
+
+	en.OnFullMatch("查看银行设置", zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			c := bankConfigOf(ctx.Event.GroupID)
+			var sb strings.Builder
+			sb.WriteString("本群银行设置:")
+			for _, item := range configItems {
+				sb.WriteString("\n" + item.name + ": " + strconv.Itoa(*item.ptr(&c)) + item.unit)
+			}
+			sb.WriteString("\n注: 上限与额度为0时不限, 借款上限为0时不放贷")
+			ctx.SendChain(message.Text(sb.String()))
+		})
+
+	names := make([]string, len(configItems))
+	for i, item := range configItems {
+		names[i] = item.name
+	}
+	en.OnRegex(`^设置银行\s*(`+strings.Join(names, "|")+`)\s*(\d+)$`, zero.OnlyGroup, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			value, err := strconv.Atoi(matched[2])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			err = setBankConfig(ctx.Event.GroupID, matched[1], value)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("本群", matched[1], "已设置为", value))
+		})
+}
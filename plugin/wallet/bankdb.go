@@ -0,0 +1,427 @@
+package wallet
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+	sql "github.com/FloatTech/sqlite"
+)
+
+// maxSettleDays 一次最多补算的天数, 防止长时间停机后循环过久
+const maxSettleDays = 366
+
+var (
+	errNoAccount = errors.New("你在本群银行还没有存款")
+	errNoLoan    = errors.New("你在本群银行没有借款")
+	errHasLoan   = errors.New("你在本群银行还有借款没有还清")
+	errNoLending = errors.New("本群银行不放贷")
+)
+
+// bankConfig 群银行设置, 比率均为千分比
+type bankConfig struct {
+	GroupID     int64 `db:"gid"`
+	TransferMin int   `db:"transfer_min"`
+	TransferMax int   `db:"transfer_max"` // 0 为不限
+	DailyLimit  int   `db:"daily_limit"`  // 每人每日转出总额, 0 为不限
+	Fee         int   `db:"fee"`          // 转账手续费
+	Interest    int   `db:"interest"`     // 存款日利率, 按日复利
+	LoanMax     int   `db:"loan_max"`     // 0 为不放贷
+	LoanRate    int   `db:"loan_rate"`    // 借款利息, 借款时一次计入
+	LoanDays    int   `db:"loan_days"`
+	Penalty     int   `db:"penalty"` // 逾期后每日罚息, 按欠款复利
+}
+
+var defaultBankConfig = bankConfig{
+	TransferMin: 1,
+	TransferMax: 10000,
+	DailyLimit:  50000,
+	Interest:    1,
+	LoanMax:     5000,
+	LoanRate:    50,
+	LoanDays:    7,
+	Penalty:     10,
+}
+
+// configItem 可由超级用户设置的一项
+type configItem struct {
+	name string
+	unit string
+	ptr  func(c *bankConfig) *int
+}
+
+var configItems = []configItem{
+	{"转账下限", "", func(c *bankConfig) *int { return &c.TransferMin }},
+	{"转账上限", "", func(c *bankConfig) *int { return &c.TransferMax }},
+	{"每日转账额度", "", func(c *bankConfig) *int { return &c.DailyLimit }},
+	{"转账手续费", "‰", func(c *bankConfig) *int { return &c.Fee }},
+	{"存款利率", "‰/天", func(c *bankConfig) *int { return &c.Interest }},
+	{"借款上限", "", func(c *bankConfig) *int { return &c.LoanMax }},
+	{"借款利率", "‰", func(c *bankConfig) *int { return &c.LoanRate }},
+	{"借款期限", "天", func(c *bankConfig) *int { return &c.LoanDays }},
+	{"逾期罚息", "‰/天", func(c *bankConfig) *int { return &c.Penalty }},
+}
+
+// fee 转出 amount 应收的手续费
+func (c *bankConfig) fee(amount int) int {
+	return amount * c.Fee / 1000
+}
+
+// account 群银行的存款
+type account struct {
+	ID      string `db:"id"` // gid_uid
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Deposit int    `db:"deposit"`
+	Settled int64  `db:"settled"` // 已计息到哪天的零点
+}
+
+// loan 群银行的借款, 每人每群最多一笔
+type loan struct {
+	ID        string `db:"id"` // gid_uid
+	GroupID   int64  `db:"gid"`
+	UserID    int64  `db:"uid"`
+	Principal int    `db:"principal"`
+	Owed      int    `db:"owed"` // 尚欠的本息
+	Due       int64  `db:"due"`
+	Settled   int64  `db:"settled"` // 已计罚息到哪天的零点
+	Time      int64  `db:"time"`
+}
+
+// outflow 每人每日在群内的转出总额
+type outflow struct {
+	ID     string `db:"id"` // gid_uid
+	Day    int64  `db:"day"`
+	Amount int    `db:"amount"`
+}
+
+type bankdb struct {
+	sync.Mutex
+	sql.Sqlite
+}
+
+var bdb = &bankdb{}
+
+func initBank(path string) error {
+	bdb.Sqlite = sql.New(path)
+	err := bdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	for name, obj := range map[string]any{
+		"config":  &bankConfig{},
+		"account": &account{},
+		"loan":    &loan{},
+		"outflow": &outflow{},
+	} {
+		if err = bdb.Create(name, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func idOf(gid, uid int64) string {
+	return strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10)
+}
+
+// dayOf t 当天零点
+func dayOf(t time.Time) int64 {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Unix()
+}
+
+// daysBetween from 到 to 两个零点间的天数
+func daysBetween(from, to int64) int {
+	n := int((to - from + 43200) / 86400)
+	if n > maxSettleDays {
+		return maxSettleDays
+	}
+	return n
+}
+
+// compound 按千分比 rate 复利 days 天, 每天的利息向下取整
+func compound(money, rate, days int) int {
+	for i := 0; i < days; i++ {
+		money += money * rate / 1000
+	}
+	return money
+}
+
+// getConfig 群银行设置 no lock
+func (db *bankdb) getConfig(gid int64) bankConfig {
+	c, err := sql.Find[bankConfig](&db.Sqlite, "config", "WHERE gid = ?", gid)
+	if err != nil {
+		c = defaultBankConfig
+		c.GroupID = gid
+	}
+	return c
+}
+
+// bankConfigOf 群银行设置
+func bankConfigOf(gid int64) bankConfig {
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.getConfig(gid)
+}
+
+// setBankConfig 设置群银行的一项
+func setBankConfig(gid int64, name string, value int) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.getConfig(gid)
+	for _, item := range configItems {
+		if item.name == name {
+			*item.ptr(&c) = value
+			return bdb.Insert("config", &c)
+		}
+	}
+	return errors.New("没有这项设置: " + name)
+}
+
+// getAccount 取存款并补算利息, 不存在时返回空账户 no lock
+func (db *bankdb) getAccount(c *bankConfig, uid int64, today int64) account {
+	a, err := sql.Find[account](&db.Sqlite, "account", "WHERE id = ?", idOf(c.GroupID, uid))
+	if err != nil {
+		return account{ID: idOf(c.GroupID, uid), GroupID: c.GroupID, UserID: uid, Settled: today}
+	}
+	if a.Settled < today {
+		a.Deposit = compound(a.Deposit, c.Interest, daysBetween(a.Settled, today))
+		a.Settled = today
+	}
+	return a
+}
+
+// getLoan 取借款并补算罚息 no lock
+func (db *bankdb) getLoan(c *bankConfig, uid int64, today int64) (loan, error) {
+	l, err := sql.Find[loan](&db.Sqlite, "loan", "WHERE id = ?", idOf(c.GroupID, uid))
+	if err != nil {
+		return l, err
+	}
+	if due := dayOf(time.Unix(l.Due, 0)); l.Settled < due {
+		l.Settled = due
+	}
+	if l.Settled < today {
+		l.Owed = compound(l.Owed, c.Penalty, daysBetween(l.Settled, today))
+		l.Settled = today
+	}
+	return l, nil
+}
+
+// saveLoan 还清时删除 no lock
+func (db *bankdb) saveLoan(l *loan) error {
+	if l.Owed <= 0 {
+		return db.Del("loan", "WHERE id = ?", l.ID)
+	}
+	return db.Insert("loan", l)
+}
+
+// bankOf 用户在群银行的存款与借款, 没有借款时 l 为 nil
+func bankOf(gid, uid int64) (a account, l *loan) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.getConfig(gid)
+	today := dayOf(time.Now())
+	a = bdb.getAccount(&c, uid, today)
+	if ln, err := bdb.getLoan(&c, uid, today); err == nil {
+		l = &ln
+	}
+	return
+}
+
+// transfer 按群设置的限额与手续费转账, 返回收取的手续费
+func transfer(gid, from, to int64, amount int) (int, error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.getConfig(gid)
+	if amount < c.TransferMin {
+		return 0, errors.New("单笔转账不能少于" + strconv.Itoa(c.TransferMin))
+	}
+	if c.TransferMax > 0 && amount > c.TransferMax {
+		return 0, errors.New("单笔转账不能超过" + strconv.Itoa(c.TransferMax))
+	}
+	today := dayOf(time.Now())
+	o, err := sql.Find[outflow](&bdb.Sqlite, "outflow", "WHERE id = ?", idOf(gid, from))
+	if err != nil || o.Day != today {
+		o = outflow{ID: idOf(gid, from), Day: today}
+	}
+	if c.DailyLimit > 0 && o.Amount+amount > c.DailyLimit {
+		return 0, errors.New("今日还能转出" + strconv.Itoa(c.DailyLimit-o.Amount))
+	}
+	fee := c.fee(amount)
+	err = ledger.Transfer(from, to, amount, fee, "wallet", gid)
+	if err != nil {
+		return 0, err
+	}
+	o.Amount += amount
+	// 转账已完成, 额度记录失败不影响结果
+	_ = bdb.Insert("outflow", &o)
+	return fee, nil
+}
+
+// deposit 从钱包存入群银行, 返回存款余额
+func deposit(gid, uid int64, amount int) (int, error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.getConfig(gid)
+	a := bdb.getAccount(&c, uid, dayOf(time.Now()))
+	err := ledger.Debit(uid, amount, "wallet", "存入银行", gid)
+	if err != nil {
+		return 0, err
+	}
+	a.Deposit += amount
+	err = bdb.Insert("account", &a)
+	if err != nil {
+		_ = ledger.InsertWalletOf(uid, amount, "wallet", "存款失败退回", gid)
+		return 0, err
+	}
+	return a.Deposit, nil
+}
+
+// withdraw 从群银行取回钱包, amount <= 0 时全部取出, 返回取出的金额与存款余额
+func withdraw(gid, uid int64, amount int) (int, int, error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.getConfig(gid)
+	a := bdb.getAccount(&c, uid, dayOf(time.Now()))
+	if a.Deposit == 0 {
+		return 0, 0, errNoAccount
+	}
+	if amount <= 0 {
+		amount = a.Deposit
+	}
+	if amount > a.Deposit {
+		return 0, a.Deposit, errors.New("存款只有" + strconv.Itoa(a.Deposit))
+	}
+	a.Deposit -= amount
+	err := bdb.Insert("account", &a)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = ledger.InsertWalletOf(uid, amount, "wallet", "从银行取出", gid)
+	if err != nil {
+		a.Deposit += amount
+		_ = bdb.Insert("account", &a)
+		return 0, 0, err
+	}
+	return amount, a.Deposit, nil
+}
+
+// borrow 向群银行借款
+func borrow(gid, uid int64, amount int, now time.Time) (loan, error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.getConfig(gid)
+	if c.LoanMax <= 0 {
+		return loan{}, errNoLending
+	}
+	if amount > c.LoanMax {
+		return loan{}, errors.New("单次最多借" + strconv.Itoa(c.LoanMax))
+	}
+	if bdb.CanFind("loan", "WHERE id = ?", idOf(gid, uid)) {
+		return loan{}, errHasLoan
+	}
+	due := now.AddDate(0, 0, c.LoanDays)
+	l := loan{
+		ID:        idOf(gid, uid),
+		GroupID:   gid,
+		UserID:    uid,
+		Principal: amount,
+		Owed:      amount + amount*c.LoanRate/1000,
+		Due:       due.Unix(),
+		Settled:   dayOf(due),
+		Time:      now.Unix(),
+	}
+	err := bdb.Insert("loan", &l)
+	if err != nil {
+		return loan{}, err
+	}
+	err = ledger.InsertWalletOf(uid, amount, "wallet", "银行借款", gid)
+	if err != nil {
+		_ = bdb.Del("loan", "WHERE id = ?", l.ID)
+		return loan{}, err
+	}
+	return l, nil
+}
+
+// repay 用钱包还款, amount <= 0 时全部还清, 返回还款金额与剩余欠款
+func repay(gid, uid int64, amount int) (int, int, error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.getConfig(gid)
+	l, err := bdb.getLoan(&c, uid, dayOf(time.Now()))
+	if err != nil {
+		return 0, 0, errNoLoan
+	}
+	if amount <= 0 || amount > l.Owed {
+		amount = l.Owed
+	}
+	err = ledger.Debit(uid, amount, "wallet", "偿还银行借款", gid)
+	if err != nil {
+		return 0, l.Owed, err
+	}
+	l.Owed -= amount
+	err = bdb.saveLoan(&l)
+	if err != nil {
+		_ = ledger.InsertWalletOf(uid, amount, "wallet", "还款失败退回", gid)
+		return 0, 0, err
+	}
+	return amount, l.Owed, nil
+}
+
+// settleBank 每日结算: 为所有存款计息, 到期的借款先用本群存款再用钱包自动还款, 还不清的计罚息
+func settleBank(now time.Time) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	today := dayOf(now)
+	configs := make(map[int64]*bankConfig, 16)
+	configOf := func(gid int64) *bankConfig {
+		c, ok := configs[gid]
+		if !ok {
+			cfg := bdb.getConfig(gid)
+			c = &cfg
+			configs[gid] = c
+		}
+		return c
+	}
+	as, err := sql.FindAll[account](&bdb.Sqlite, "account", "WHERE settled < ?", today)
+	if err != nil && err != sql.ErrNullResult {
+		return err
+	}
+	for _, a := range as {
+		acc := bdb.getAccount(configOf(a.GroupID), a.UserID, today)
+		if err = bdb.Insert("account", &acc); err != nil {
+			return err
+		}
+	}
+	ls, err := sql.FindAll[loan](&bdb.Sqlite, "loan", "WHERE due <= ?", now.Unix())
+	if err != nil && err != sql.ErrNullResult {
+		return err
+	}
+	for _, ln := range ls {
+		c := configOf(ln.GroupID)
+		l, err := bdb.getLoan(c, ln.UserID, today)
+		if err != nil {
+			return err
+		}
+		a := bdb.getAccount(c, l.UserID, today)
+		if pay := min(a.Deposit, l.Owed); pay > 0 {
+			a.Deposit -= pay
+			l.Owed -= pay
+			if err = bdb.Insert("account", &a); err != nil {
+				return err
+			}
+		}
+		if pay := min(ledger.GetWalletOf(l.UserID), l.Owed); pay > 0 {
+			if ledger.Debit(l.UserID, pay, "wallet", "到期自动还款", l.GroupID) == nil {
+				l.Owed -= pay
+			}
+		}
+		if err = bdb.saveLoan(&l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+func TestCompound(t *testing.T) {
+	for _, c := range []struct {
+		money, rate, days, want int
+	}{
+		{1000, 1, 0, 1000},
+		{1000, 1, 1, 1001},
+		{1000, 10, 3, 1030}, // 1010, 1020, 1030
+		{999, 1, 5, 999},    // 每天的利息不足 1 时不计
+		{0, 10, 100, 0},
+		{525, 10, 2, 535},
+	} {
+		if got := compound(c.money, c.rate, c.days); got != c.want {
+			t.Fatal(c, "got", got)
+		}
+	}
+	day := dayOf(time.Date(2024, 3, 9, 15, 0, 0, 0, time.Local))
+	for _, c := range []struct {
+		to   time.Time
+		want int
+	}{
+		{time.Date(2024, 3, 9, 23, 0, 0, 0, time.Local), 0},
+		{time.Date(2024, 3, 11, 1, 0, 0, 0, time.Local), 2},
+		{time.Date(2024, 4, 9, 0, 0, 0, 0, time.Local), 31},
+		{time.Date(2030, 1, 1, 0, 0, 0, 0, time.Local), maxSettleDays},
+	} {
+		if got := daysBetween(day, dayOf(c.to)); got != c.want {
+			t.Fatal(c.to, "got", got)
+		}
+	}
+}
+
+func TestBank(t *testing.T) {
+	dir := t.TempDir()
+	if err := initBank(dir + "/bank.db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	gid := int64(1)
+	rich, poor, other := int64(1), int64(2), int64(3)
+	if err := ledger.InsertWalletOf(rich, 1000, "test", "income", gid); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cfg := defaultBankConfig
+	cfg.GroupID = gid
+
+	// 存款按日复利
+	if n, err := deposit(gid, rich, 1000); err != nil || n != 1000 || ledger.GetWalletOf(rich) != 0 {
+		t.Fatal(n, err, ledger.GetWalletOf(rich))
+	}
+	if err := settleBank(now.AddDate(0, 0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if a := bdb.getAccount(&cfg, rich, dayOf(now.AddDate(0, 0, 2))); a.Deposit != 1002 {
+		t.Fatal(a)
+	}
+	// 重复结算不重复计息
+	if err := settleBank(now.AddDate(0, 0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if a := bdb.getAccount(&cfg, rich, dayOf(now.AddDate(0, 0, 2))); a.Deposit != 1002 {
+		t.Fatal(a)
+	}
+
+	// 借款: 利息一次计入, 到期后先用存款还
+	l, err := borrow(gid, rich, 500, now)
+	if err != nil || l.Owed != 525 || ledger.GetWalletOf(rich) != 500 {
+		t.Fatal(l, err)
+	}
+	if _, err = borrow(gid, rich, 100, now); err != errHasLoan {
+		t.Fatal(err)
+	}
+	if _, err = borrow(gid, poor, defaultBankConfig.LoanMax+1, now); err == nil {
+		t.Fatal("borrowed over the limit")
+	}
+	if err = settleBank(now.AddDate(0, 0, 9)); err != nil {
+		t.Fatal(err)
+	}
+	// 逾期 2 天罚息: 525 -> 530 -> 535, 存款 1000 计息 9 天为 1009
+	if a := bdb.getAccount(&cfg, rich, dayOf(now.AddDate(0, 0, 9))); a.Deposit != 1009-535 {
+		t.Fatal(a)
+	}
+	if bdb.CanFind("loan", "WHERE id = ?", idOf(gid, rich)) || ledger.GetWalletOf(rich) != 500 {
+		t.Fatal("loan not repaid from deposit", ledger.GetWalletOf(rich))
+	}
+
+	// 没有存款时从钱包扣, 还不清的继续计罚息
+	if _, err = borrow(gid, poor, 500, now); err != nil {
+		t.Fatal(err)
+	}
+	if err = ledger.Debit(poor, 400, "test", "spend", gid); err != nil {
+		t.Fatal(err)
+	}
+	if err = settleBank(now.AddDate(0, 0, 8)); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := bdb.getLoan(&cfg, poor, dayOf(now.AddDate(0, 0, 8)))
+	if err != nil || ln.Owed != 430 || ledger.GetWalletOf(poor) != 0 {
+		t.Fatal(ln, err, ledger.GetWalletOf(poor))
+	}
+	if ln, err = bdb.getLoan(&cfg, poor, dayOf(now.AddDate(0, 0, 10))); err != nil || ln.Owed != 438 {
+		t.Fatal(ln, err)
+	}
+
+	// 转账限额与手续费
+	if err = setBankConfig(gid, "转账手续费", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err = setBankConfig(gid, "每日转账额度", 300); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		amount, fee int
+		ok          bool
+	}{
+		{0, 0, false},
+		{200, 2, true},
+		{101, 0, false},
+		{100, 1, true},
+	} {
+		fee, err := transfer(gid, rich, other, c.amount)
+		if (err == nil) != c.ok || fee != c.fee {
+			t.Fatal(c, "got", fee, err)
+		}
+	}
+	if ledger.GetWalletOf(rich) != 500-303 || ledger.GetWalletOf(other) != 300 {
+		t.Fatal(ledger.GetWalletOf(rich), ledger.GetWalletOf(other))
+	}
+}
@@ -0,0 +1,303 @@
+// Package ledger 钱包流水, 所有改动钱包余额的插件都经由此处记账
+package ledger
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/floatbox/file"
+	sql "github.com/FloatTech/sqlite"
+)
+
+var (
+	// ErrNotFound 没有这条流水
+	ErrNotFound = errors.New("没有这条流水")
+	// ErrReversed 流水已被冲正
+	ErrReversed = errors.New("这条流水已经冲正过了")
+	// ErrIsReversal 冲正流水本身不能再冲正
+	ErrIsReversal = errors.New("冲正流水不能再冲正")
+	// ErrInsufficient 余额不足
+	ErrInsufficient = errors.New("余额不足")
+	// ErrAmount 扣款或转账的金额不是正数
+	ErrAmount = errors.New("金额必须大于0")
+)
+
+// Entry 一条流水
+type Entry struct {
+	ID      int64  `db:"id"`
+	UserID  int64  `db:"uid"`
+	Delta   int    `db:"delta"`   // 实际变动的金额, 扣款时余额最少扣到 0
+	Balance int    `db:"balance"` // 变动后的余额
+	Plugin  string `db:"plugin"`
+	Reason  string `db:"reason"`
+	GroupID int64  `db:"gid"` // 私聊或定时任务时为 0
+	Time    int64  `db:"time"`
+	// Reversal 冲正了哪条流水, Reversed 被哪条流水冲正, 0 为无
+	Reversal int64 `db:"reversal"`
+	Reversed int64 `db:"reversed"`
+}
+
+type ledgerdb struct {
+	sync.Mutex
+	sql.Sqlite
+	lastID int64
+	purse  purse // 为 nil 时尚未打开
+}
+
+// purse 钱包余额
+type purse interface {
+	get(uid int64) int
+	add(uid int64, money int) error
+}
+
+// animePurse AnimeAPI 的钱包, 即各插件共用的 data/wallet/wallet.db
+type animePurse struct{}
+
+func (animePurse) get(uid int64) int { return wallet.GetWalletOf(uid) }
+
+func (animePurse) add(uid int64, money int) error { return wallet.InsertWalletOf(uid, money) }
+
+// sqlPurse 独立的钱包库, 与 AnimeAPI 的钱包同样在余额不足时扣到 0
+type sqlPurse struct {
+	sql.Sqlite
+}
+
+func (p *sqlPurse) get(uid int64) int {
+	w, _ := sql.Find[wallet.Wallet](&p.Sqlite, "storage", "WHERE uid = ?", uid)
+	return w.Money
+}
+
+func (p *sqlPurse) add(uid int64, money int) error {
+	return p.Insert("storage", &wallet.Wallet{UID: uid, Money: max(p.get(uid)+money, 0)})
+}
+
+var ldb = &ledgerdb{}
+
+// record 写入一条流水, 测试时替换以模拟记账失败
+var record = func(db *ledgerdb, e *Entry) error {
+	return db.Insert("entry", e)
+}
+
+// Open 使用 dir 下独立的流水与钱包数据库, 供测试传入 t.TempDir()
+//
+// 不调用时在第一次记账前打开 data/wallet/ledger.db, 余额存于 AnimeAPI 的钱包
+func Open(dir string) error {
+	ldb.Lock()
+	defer ldb.Unlock()
+	p := &sqlPurse{Sqlite: sql.New(filepath.Join(dir, "wallet.db"))}
+	err := p.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = p.Create("storage", &wallet.Wallet{})
+	if err != nil {
+		return err
+	}
+	return ldb.open(filepath.Join(dir, "ledger.db"), p)
+}
+
+// open 打开流水库 no lock
+func (db *ledgerdb) open(path string, p purse) error {
+	db.Sqlite = sql.New(path)
+	err := db.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = db.Create("entry", &Entry{})
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_entry_uid ON [entry](uid, id);")
+	if err != nil {
+		return err
+	}
+	var last struct {
+		ID int64 `db:"id"`
+	}
+	err = db.Query("SELECT IFNULL(MAX(id), 0) FROM [entry];", &last)
+	if err != nil {
+		return err
+	}
+	db.lastID = last.ID
+	db.purse = p
+	return nil
+}
+
+// ready 需要时打开默认的数据库 no lock
+func (db *ledgerdb) ready() error {
+	if db.purse != nil {
+		return nil
+	}
+	if file.IsNotExist("data/wallet") {
+		err := os.MkdirAll("data/wallet", 0755)
+		if err != nil {
+			return err
+		}
+	}
+	return db.open("data/wallet/ledger.db", animePurse{})
+}
+
+// GetWalletOf 钱包余额, 与记账使用同一个钱包
+func GetWalletOf(uid int64) int {
+	ldb.Lock()
+	defer ldb.Unlock()
+	if ldb.ready() != nil {
+		return 0
+	}
+	return ldb.purse.get(uid)
+}
+
+// InsertWalletOf 更新钱包并记一条流水(money > 0 增加, money < 0 减少)
+//
+// plugin 为发起变动的插件名, reason 为变动原因, gid 为发生的群, 私聊时为 0
+func InsertWalletOf(uid int64, money int, plugin, reason string, gid int64) error {
+	ldb.Lock()
+	defer ldb.Unlock()
+	if err := ldb.ready(); err != nil {
+		return err
+	}
+	_, err := ldb.insert(uid, money, plugin, reason, gid, 0)
+	return err
+}
+
+// Debit 从钱包扣除 money(> 0) 并记账, 余额不足时不做改动并返回 ErrInsufficient
+func Debit(uid int64, money int, plugin, reason string, gid int64) error {
+	if money <= 0 {
+		return ErrAmount
+	}
+	ldb.Lock()
+	defer ldb.Unlock()
+	if err := ldb.ready(); err != nil {
+		return err
+	}
+	if ldb.purse.get(uid) < money {
+		return ErrInsufficient
+	}
+	_, err := ldb.insert(uid, -money, plugin, reason, gid, 0)
+	return err
+}
+
+// Transfer 从 from 转 amount 给 to, from 另付 fee 手续费
+//
+// 两边的变动在同一把锁内完成, 任一步失败时撤回已做的变动, 余额不足时返回 ErrInsufficient
+func Transfer(from, to int64, amount, fee int, plugin string, gid int64) error {
+	if amount <= 0 || fee < 0 || amount > math.MaxInt-fee {
+		return ErrAmount
+	}
+	ldb.Lock()
+	defer ldb.Unlock()
+	if err := ldb.ready(); err != nil {
+		return err
+	}
+	if ldb.purse.get(from) < amount+fee {
+		return ErrInsufficient
+	}
+	reason := "转账给" + strconv.FormatInt(to, 10)
+	if fee > 0 {
+		reason += "(手续费" + strconv.Itoa(fee) + ")"
+	}
+	out, err := ldb.insert(from, -(amount + fee), plugin, reason, gid, 0)
+	if err != nil {
+		return err
+	}
+	_, err = ldb.insert(to, amount, plugin, "收到"+strconv.FormatInt(from, 10)+"的转账", gid, 0)
+	if err != nil {
+		// 退回转出方, 冲正失败时保留原错误
+		r, err1 := ldb.insert(from, -out.Delta, plugin, "转账失败退回", gid, out.ID)
+		if err1 == nil {
+			out.Reversed = r.ID
+			_ = ldb.Insert("entry", out)
+		}
+		return err
+	}
+	return nil
+}
+
+// insert 更新钱包并记账, 记账失败时撤回余额变动 no lock
+func (db *ledgerdb) insert(uid int64, money int, plugin, reason string, gid, reversal int64) (*Entry, error) {
+	before := db.purse.get(uid)
+	err := db.purse.add(uid, money)
+	if err != nil {
+		return nil, err
+	}
+	after := db.purse.get(uid)
+	e := &Entry{
+		ID:       db.lastID + 1,
+		UserID:   uid,
+		Delta:    after - before,
+		Balance:  after,
+		Plugin:   plugin,
+		Reason:   reason,
+		GroupID:  gid,
+		Time:     time.Now().Unix(),
+		Reversal: reversal,
+	}
+	err = record(db, e)
+	if err != nil {
+		_ = db.purse.add(uid, before-after)
+		return nil, err
+	}
+	db.lastID = e.ID
+	return e, nil
+}
+
+// Reverse 冲正一条流水, 按原金额反向变动余额, 返回新记的冲正流水
+func Reverse(id int64, gid int64) (*Entry, error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	if err := ldb.ready(); err != nil {
+		return nil, err
+	}
+	e, err := sql.Find[Entry](&ldb.Sqlite, "entry", "WHERE id = ?", id)
+	if err == sql.ErrNullResult {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case e.Reversed != 0:
+		return nil, ErrReversed
+	case e.Reversal != 0:
+		return nil, ErrIsReversal
+	case ldb.purse.get(e.UserID)-e.Delta < 0:
+		return nil, ErrInsufficient
+	}
+	r, err := ldb.insert(e.UserID, -e.Delta, "wallet", "冲正 #"+strconv.FormatInt(id, 10), gid, id)
+	if err != nil {
+		return nil, err
+	}
+	e.Reversed = r.ID
+	err = ldb.Insert("entry", &e)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Entries 用户的流水, 由新到旧, 同时返回总条数
+func Entries(uid int64, offset, limit int) ([]*Entry, int, error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	if err := ldb.ready(); err != nil {
+		return nil, 0, err
+	}
+	var n struct {
+		N int `db:"n"`
+	}
+	err := ldb.Query("SELECT COUNT(*) FROM [entry] WHERE uid = ?;", &n, uid)
+	if err != nil {
+		return nil, 0, err
+	}
+	es, err := sql.FindAll[Entry](&ldb.Sqlite, "entry", "WHERE uid = ? ORDER BY id DESC LIMIT ? OFFSET ?", uid, limit, offset)
+	if err == sql.ErrNullResult {
+		return nil, n.N, nil
+	}
+	return es, n.N, err
+}
@@ -0,0 +1,128 @@
+package ledger
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// newUsers 在临时目录中打开流水与钱包, 返回余额依次为 money 的用户
+func newUsers(t *testing.T, money ...int) []int64 {
+	if err := Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	uids := make([]int64, len(money))
+	for i, m := range money {
+		uids[i] = int64(i + 1)
+		if err := ldb.purse.add(uids[i], m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return uids
+}
+
+func TestDebit(t *testing.T) {
+	u := newUsers(t, 100)[0]
+	for _, c := range []struct {
+		money   int
+		err     error
+		balance int
+	}{
+		{0, ErrAmount, 100},
+		{-50, ErrAmount, 100},
+		{math.MinInt, ErrAmount, 100},
+		{101, ErrInsufficient, 100},
+		{30, nil, 70},
+		{70, nil, 0},
+		{1, ErrInsufficient, 0},
+	} {
+		err := Debit(u, c.money, "test", "debit", 0)
+		if !errors.Is(err, c.err) || GetWalletOf(u) != c.balance {
+			t.Fatal(c.money, "got", err, GetWalletOf(u), "want", c.err, c.balance)
+		}
+	}
+	es, n, err := Entries(u, 0, 10)
+	if err != nil || n != 2 || es[0].Delta != -70 || es[0].Balance != 0 || es[1].Delta != -30 {
+		t.Fatal(es, n, err)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	uids := newUsers(t, 1000, 0)
+	from, to := uids[0], uids[1]
+	for _, c := range []struct {
+		amount, fee int
+		err         error
+		a, b        int
+	}{
+		{0, 0, ErrAmount, 1000, 0},
+		{-100, 0, ErrAmount, 1000, 0},
+		{100, -10, ErrAmount, 1000, 0},
+		{math.MaxInt, 10, ErrAmount, 1000, 0},
+		{995, 10, ErrInsufficient, 1000, 0},
+		{500, 10, nil, 490, 500},
+	} {
+		err := Transfer(from, to, c.amount, c.fee, "test", 0)
+		if !errors.Is(err, c.err) || GetWalletOf(from) != c.a || GetWalletOf(to) != c.b {
+			t.Fatal(c.amount, c.fee, "got", err, GetWalletOf(from), GetWalletOf(to))
+		}
+	}
+
+	// 收款方记账失败时退回转出方
+	errDisk := errors.New("disk full")
+	old := record
+	record = func(db *ledgerdb, e *Entry) error {
+		if e.UserID == to {
+			return errDisk
+		}
+		return old(db, e)
+	}
+	err := Transfer(from, to, 100, 0, "test", 0)
+	record = old
+	if !errors.Is(err, errDisk) || GetWalletOf(from) != 490 || GetWalletOf(to) != 500 {
+		t.Fatal(err, GetWalletOf(from), GetWalletOf(to))
+	}
+	es, n, err := Entries(from, 0, 10)
+	if err != nil || n != 3 {
+		t.Fatal(es, n, err)
+	}
+	// 新到旧: 退回, 转出 100, 转出 510
+	if es[0].Delta != 100 || es[0].Reversal != es[1].ID || es[1].Delta != -100 || es[1].Reversed != es[0].ID || es[2].Delta != -510 {
+		t.Fatal(*es[0], *es[1], *es[2])
+	}
+}
+
+func TestReverse(t *testing.T) {
+	u := newUsers(t, 0)[0]
+	if err := InsertWalletOf(u, 300, "test", "income", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := Debit(u, 100, "test", "spend", 0); err != nil {
+		t.Fatal(err)
+	}
+	es, _, err := Entries(u, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend, income := es[0], es[1]
+	r, err := Reverse(spend.ID, 0)
+	if err != nil || r.Delta != 100 || r.Reversal != spend.ID || GetWalletOf(u) != 300 {
+		t.Fatal(r, err, GetWalletOf(u))
+	}
+	if _, err = Reverse(spend.ID, 0); err != ErrReversed {
+		t.Fatal(err)
+	}
+	if _, err = Reverse(r.ID, 0); err != ErrIsReversal {
+		t.Fatal(err)
+	}
+	if _, err = Reverse(math.MaxInt64, 0); err != ErrNotFound {
+		t.Fatal(err)
+	}
+	// 收入已经花掉时不能冲正
+	if err = Debit(u, 250, "test", "spend", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Reverse(income.ID, 0); err != ErrInsufficient || GetWalletOf(u) != 50 {
+		t.Fatal(err, GetWalletOf(u))
+	}
+}
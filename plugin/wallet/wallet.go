@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	"github.com/FloatTech/floatbox/binary"
 	"github.com/FloatTech/floatbox/file"
 	ctrl "github.com/FloatTech/zbpctrl"
@@ -23,6 +24,9 @@ import (
 	"github.com/wdvxdr1123/ZeroBot/message"
 )
 
+// pageSize 钱包流水每页条数
+const pageSize = 10
+
 func init() {
 	en := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
@@ -32,7 +36,14 @@ func init() {
 			"- 管理钱包余额[+金额|-金额][@xxx]\n" +
 			"- 查看我的钱包|查看钱包余额[@xxx]\n" +
 			"- 钱包转账[金额][@xxx]\n" +
-			"注：仅超级用户能“管理钱包余额”\n",
+			"- 钱包流水[@xxx][页]\n" +
+			"- 存款[金额] | 取款[金额|全部]\n" +
+			"- 借款[金额] | 还款[金额]\n" +
+			"- 我的银行\n" +
+			"- 查看银行设置\n" +
+			"- 设置银行[转账下限|转账上限|每日转账额度|转账手续费|存款利率|借款上限|借款利率|借款期限|逾期罚息][数值]\n" +
+			"- 冲正 #流水号\n" +
+			"注：仅超级用户能“管理钱包余额”、“冲正”和“设置银行”; 银行按群独立, 每日零点计复利, 借款到期后先用存款再用钱包自动还款, 还不清的每日计罚息\n",
 		PrivateDataFolder: "wallet",
 	})
 	cachePath := en.DataFolder() + "cache/"
@@ -194,7 +205,7 @@ func init() {
 				ctx.SendChain(message.Text("管理失败:对方钱包余额不足，扣款失败"))
 				return
 			}
-			err = wallet.InsertWalletOf(uidInt, amount)
+			err = ledger.InsertWalletOf(uidInt, amount, "wallet", "管理员调整", ctx.Event.GroupID)
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:管理失败，钱包坏掉了:\n", err))
 				return
@@ -248,23 +259,77 @@ func init() {
 				return
 			}
 
-			// 开始转账流程
-			if amount > wallet.GetWalletOf(ctx.Event.UserID) {
-				ctx.SendChain(message.Text("[ERROR]:钱包余额不足，转账失败"))
+			if uidInt == ctx.Event.UserID {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("不能给自己转账"))
 				return
 			}
 
-			err = wallet.InsertWalletOf(ctx.Event.UserID, -amount)
+			// 开始转账流程, 扣款与入账在同一次操作内完成
+			fee, err := transfer(ctx.Event.GroupID, ctx.Event.UserID, uidInt, amount)
 			if err != nil {
-				ctx.SendChain(message.Text("[ERROR]:转账失败，扣款异常:\n", err))
+				ctx.SendChain(message.Text("[ERROR]:转账失败，", err))
+				return
+			}
+			if fee > 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("转账成功:成功给"), message.At(uidInt), message.Text(",转账:", amount, wallet.GetWalletName(), ",手续费:", fee))
 				return
 			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("转账成功:成功给"), message.At(uidInt), message.Text(",转账:", amount, wallet.GetWalletName()))
+		})
 
-			err = wallet.InsertWalletOf(uidInt, amount)
+	en.OnRegex(`^钱包流水\s*(\[CQ:at,qq=(\d+)\])?\s*(\d+)?$`).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			uid := ctx.Event.UserID
+			if matched[2] != "" {
+				uid, _ = strconv.ParseInt(matched[2], 10, 64)
+			}
+			page := 1
+			if matched[3] != "" {
+				page, _ = strconv.Atoi(matched[3])
+				if page < 1 {
+					page = 1
+				}
+			}
+			es, total, err := ledger.Entries(uid, (page-1)*pageSize, pageSize)
 			if err != nil {
-				ctx.SendChain(message.Text("[ERROR]:转账失败，转账时银行被打劫:\n", err))
+				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("转账成功:成功给"), message.At(uidInt), message.Text(",转账:", amount, wallet.GetWalletName()))
+			pages := (total + pageSize - 1) / pageSize
+			if len(es) == 0 {
+				if total == 0 {
+					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("QQ号：", uid, "，还没有钱包流水"))
+					return
+				}
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("流水只有", pages, "页"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("QQ号：" + strconv.FormatInt(uid, 10) + "，的钱包流水(第" + strconv.Itoa(page) + "/" + strconv.Itoa(pages) + "页)")
+			for _, e := range es {
+				sb.WriteString("\n#" + strconv.FormatInt(e.ID, 10) + " " + time.Unix(e.Time, 0).Format("01-02 15:04") + " ")
+				if e.Delta >= 0 {
+					sb.WriteString("+")
+				}
+				sb.WriteString(strconv.Itoa(e.Delta) + " 余额" + strconv.Itoa(e.Balance) + " [" + e.Plugin + "] " + e.Reason)
+				if e.Reversed != 0 {
+					sb.WriteString(" (已被#" + strconv.FormatInt(e.Reversed, 10) + "冲正)")
+				}
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(sb.String()))
 		})
+
+	en.OnRegex(`^冲正\s*#?(\d+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			r, err := ledger.Reverse(id, ctx.Event.GroupID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("已冲正#", id, "，QQ号：", r.UserID, "，变动", r.Delta, wallet.GetWalletName(), "，余额", r.Balance, "，冲正流水#", r.ID))
+		})
+
+	registerBank(en)
 }
@@ -0,0 +1,174 @@
+package wordcount
+
+import (
+	"hash/crc32"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+	"golang.org/x/image/font"
+)
+
+const (
+	cloudW       = 1000.0
+	cloudH       = 700.0
+	cloudTitleH  = 70.0
+	cloudMinSize = 16.0
+	cloudMaxSize = 100.0
+	cloudPadding = 4.0
+	// cloudWords 词云最多显示的词数
+	cloudWords = 120
+)
+
+// cloudPalette 词云的配色
+var cloudPalette = []color.RGBA{
+	{R: 0x1f, G: 0x77, B: 0xb4, A: 0xff},
+	{R: 0xff, G: 0x7f, B: 0x0e, A: 0xff},
+	{R: 0x2c, G: 0xa0, B: 0x2c, A: 0xff},
+	{R: 0xd6, G: 0x27, B: 0x28, A: 0xff},
+	{R: 0x94, G: 0x67, B: 0xbd, A: 0xff},
+	{R: 0x8c, G: 0x56, B: 0x4b, A: 0xff},
+	{R: 0xe3, G: 0x77, B: 0xc2, A: 0xff},
+	{R: 0x17, G: 0xbe, B: 0xcf, A: 0xff},
+}
+
+// placement 词在词云中的位置, (X, Y) 为中心
+type placement struct {
+	Word     string
+	Size     float64
+	X, Y     float64
+	Vertical bool
+}
+
+// rect 已占用的区域
+type rect struct {
+	x0, y0, x1, y1 float64
+}
+
+func (r rect) overlaps(o rect) bool {
+	return r.x0 < o.x1 && o.x0 < r.x1 && r.y0 < o.y1 && o.y0 < r.y1
+}
+
+// fontSize 按词频在最小与最大字号之间取值, 取平方根使小词不至于太小
+func fontSize(n, lo, hi int) float64 {
+	if hi <= lo {
+		return cloudMaxSize
+	}
+	t := math.Sqrt(float64(n-lo) / float64(hi-lo))
+	return math.Round(cloudMinSize + (cloudMaxSize-cloudMinSize)*t)
+}
+
+// layout 从中心沿螺线为每个词找到不与已放置的词重叠的位置, 放不下的词会被舍弃.
+// wc 需按词频从大到小排列, measure 返回词在该字号下的宽度
+func layout(wc pairlist, w, h float64, measure func(word string, size float64) float64) []placement {
+	if len(wc) == 0 {
+		return nil
+	}
+	lo, hi := wc[len(wc)-1].Value, wc[0].Value
+	placed := make([]rect, 0, len(wc))
+	ps := make([]placement, 0, len(wc))
+	// 画布不是正方形, 螺线按宽高比拉伸
+	ratio := w / h
+	for i, p := range wc {
+		size := fontSize(p.Value, lo, hi)
+		bw, bh := measure(p.Key, size)+cloudPadding, size+cloudPadding
+		// 约四分之一的词竖排, 按词本身决定, 同样的数据总是得到同样的图
+		vertical := i > 0 && crc32.ChecksumIEEE([]byte(p.Key))%4 == 0
+		if vertical {
+			bw, bh = bh, bw
+		}
+		if bw > w || bh > h {
+			continue
+		}
+		for t := 0.0; t < 200*math.Pi; t += 0.1 {
+			r := 2 * t
+			x := w/2 + r*math.Cos(t)*ratio
+			y := h/2 + r*math.Sin(t)
+			if math.Abs(x-w/2) > w/2+bw && math.Abs(y-h/2) > h/2+bh {
+				break
+			}
+			box := rect{x - bw/2, y - bh/2, x + bw/2, y + bh/2}
+			if box.x0 < 0 || box.y0 < 0 || box.x1 > w || box.y1 > h {
+				continue
+			}
+			free := true
+			for _, o := range placed {
+				if box.overlaps(o) {
+					free = false
+					break
+				}
+			}
+			if free {
+				placed = append(placed, box)
+				ps = append(ps, placement{Word: p.Key, Size: size, X: x, Y: y, Vertical: vertical})
+				break
+			}
+		}
+	}
+	return ps
+}
+
+// drawCloud 绘制词云
+func drawCloud(title string, wc pairlist) (image.Image, error) {
+	b, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	faces := make(map[float64]font.Face, 32)
+	faceOf := func(size float64) (font.Face, error) {
+		if f, ok := faces[size]; ok {
+			return f, nil
+		}
+		f, err := gg.ParseFontFace(b, size)
+		if err != nil {
+			return nil, err
+		}
+		faces[size] = f
+		return f, nil
+	}
+	canvas := gg.NewContext(int(cloudW), int(cloudH+cloudTitleH))
+	canvas.SetRGB(1, 1, 1)
+	canvas.Clear()
+	if err = canvas.ParseFontFace(b, 28); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB(0.2, 0.2, 0.2)
+	canvas.DrawStringAnchored(title, cloudW/2, cloudTitleH/2, 0.5, 0.5)
+
+	var ferr error
+	ps := layout(wc, cloudW, cloudH, func(word string, size float64) float64 {
+		f, err := faceOf(size)
+		if err != nil {
+			ferr = err
+			return cloudW * 2
+		}
+		canvas.SetFontFace(f)
+		w, _ := canvas.MeasureString(word)
+		return w
+	})
+	if ferr != nil {
+		return nil, ferr
+	}
+	for _, p := range ps {
+		f, err := faceOf(p.Size)
+		if err != nil {
+			return nil, err
+		}
+		canvas.SetFontFace(f)
+		canvas.SetColor(cloudPalette[crc32.ChecksumIEEE([]byte(p.Word))%uint32(len(cloudPalette))])
+		x, y := p.X, p.Y+cloudTitleH
+		if p.Vertical {
+			canvas.Push()
+			canvas.RotateAbout(gg.Radians(-90), x, y)
+			canvas.DrawStringAnchored(p.Word, x, y, 0.5, 0.5)
+			canvas.Pop()
+			continue
+		}
+		canvas.DrawStringAnchored(p.Word, x, y, 0.5, 0.5)
+	}
+	return canvas.Image(), nil
+}
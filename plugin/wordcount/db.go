@@ -0,0 +1,228 @@
+package wordcount
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// keepDays 词频保留的天数, 与最长的统计区间一致
+	keepDays = 30
+	// flushInterval 缓存的词频写入数据库的间隔
+	flushInterval = time.Minute
+)
+
+// wordStat 某人某天在某群说某个词的次数
+type wordStat struct {
+	ID      string `db:"id"`   // date_gid_uid_word
+	Date    int    `db:"date"` // 20060102
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Word    string `db:"word"`
+	Count   int64  `db:"count"`
+}
+
+// stopword 群自定义的停用词
+type stopword struct {
+	ID      string `db:"id"` // gid_word
+	GroupID int64  `db:"gid"`
+	Word    string `db:"word"`
+}
+
+// wordKey 缓存中的一项
+type wordKey struct {
+	date int
+	gid  int64
+	uid  int64
+	word string
+}
+
+type worddb struct {
+	sync.RWMutex
+	sql.Sqlite
+	mu      sync.Mutex // 保护 pending
+	pending map[wordKey]int64
+}
+
+var wdb = &worddb{pending: make(map[wordKey]int64, 1024)}
+
+func initDatabase(path string) error {
+	wdb.Sqlite = sql.New(path)
+	err := wdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = wdb.Create("word", &wordStat{})
+	if err != nil {
+		return err
+	}
+	err = wdb.Create("stopword", &stopword{})
+	if err != nil {
+		return err
+	}
+	for _, q := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_word_gid_date ON [word](gid, date);",
+		"CREATE INDEX IF NOT EXISTS idx_word_uid_date ON [word](uid, date);",
+	} {
+		if _, err = wdb.Exec(q); err != nil {
+			return err
+		}
+	}
+	go func() {
+		pruned := 0
+		for range time.NewTicker(flushInterval).C {
+			if err := flush(); err != nil {
+				logrus.Warnln("[wordcount] 写入词频失败:", err)
+			}
+			// 每天清理一次
+			now := time.Now()
+			if dateOf(now) == pruned {
+				continue
+			}
+			if err := prune(now); err != nil {
+				logrus.Warnln("[wordcount] 清理过期词频失败:", err)
+				continue
+			}
+			pruned = dateOf(now)
+		}
+	}()
+	return nil
+}
+
+// dateOf 20060102 形式的日期
+func dateOf(t time.Time) int {
+	y, m, d := t.Date()
+	return y*10000 + int(m)*100 + d
+}
+
+// since 包含今天在内最近 days 天的第一天
+func since(now time.Time, days int) int {
+	return dateOf(now.AddDate(0, 0, 1-days))
+}
+
+// count 记录一条消息中的词, 先写入缓存
+func count(gid, uid int64, t time.Time, words []string) {
+	if len(words) == 0 {
+		return
+	}
+	date := dateOf(t)
+	wdb.mu.Lock()
+	defer wdb.mu.Unlock()
+	for _, w := range words {
+		wdb.pending[wordKey{date: date, gid: gid, uid: uid, word: w}]++
+	}
+}
+
+// flush 把缓存的词频累加进数据库
+func flush() error {
+	wdb.mu.Lock()
+	pending := wdb.pending
+	wdb.pending = make(map[wordKey]int64, len(pending))
+	wdb.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	wdb.Lock()
+	defer wdb.Unlock()
+	for k, n := range pending {
+		id := strconv.Itoa(k.date) + "_" + strconv.FormatInt(k.gid, 10) + "_" + strconv.FormatInt(k.uid, 10) + "_" + k.word
+		_, err := wdb.Exec("INSERT INTO [word](id, date, gid, uid, word, count) VALUES (?, ?, ?, ?, ?, ?) "+
+			"ON CONFLICT(id) DO UPDATE SET count = count + excluded.count;", id, k.date, k.gid, k.uid, k.word, n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune 删除超过保留天数的词频
+func prune(now time.Time) error {
+	wdb.Lock()
+	defer wdb.Unlock()
+	return wdb.Del("word", "WHERE date < ?", since(now, keepDays))
+}
+
+// topWords 群内 (uid 不为 0 时为某人) 自 from 起出现最多的 n 个词, 不含本群的停用词
+func topWords(gid, uid int64, from, n int) (pairlist, error) {
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	wdb.RLock()
+	defer wdb.RUnlock()
+	q := "SELECT word, SUM(count) AS n FROM [word] WHERE gid = ? AND date >= ?"
+	args := []any{gid, from}
+	if uid != 0 {
+		q += " AND uid = ?"
+		args = append(args, uid)
+	}
+	q += " AND word NOT IN (SELECT word FROM [stopword] WHERE gid = ?) GROUP BY word ORDER BY n DESC LIMIT ?;"
+	args = append(args, gid, n)
+	rows, err := sql.QueryAll[pair](&wdb.Sqlite, q, args...)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pl := make(pairlist, len(rows))
+	for i, r := range rows {
+		pl[i] = *r
+	}
+	return pl, nil
+}
+
+func stopwordKey(gid int64, word string) string {
+	return strconv.FormatInt(gid, 10) + "_" + word
+}
+
+// addStopwords 添加本群的停用词
+func addStopwords(gid int64, words []string) error {
+	wdb.Lock()
+	defer wdb.Unlock()
+	for _, w := range words {
+		err := wdb.Insert("stopword", &stopword{ID: stopwordKey(gid, w), GroupID: gid, Word: w})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delStopwords 删除本群的停用词, 返回实际删除的数量
+func delStopwords(gid int64, words []string) (int, error) {
+	wdb.Lock()
+	defer wdb.Unlock()
+	n := 0
+	for _, w := range words {
+		if !wdb.CanFind("stopword", "WHERE id = ?", stopwordKey(gid, w)) {
+			continue
+		}
+		if err := wdb.Del("stopword", "WHERE id = ?", stopwordKey(gid, w)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// listStopwords 本群的停用词
+func listStopwords(gid int64) ([]string, error) {
+	wdb.RLock()
+	defer wdb.RUnlock()
+	ss, err := sql.FindAll[stopword](&wdb.Sqlite, "stopword", "WHERE gid = ? ORDER BY word", gid)
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	words := make([]string, len(ss))
+	for i, s := range ss {
+		words[i] = s.Word
+	}
+	return words, nil
+}
@@ -3,42 +3,64 @@ package wordcount
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fumiama/jieba"
 	"github.com/golang/freetype"
 	"github.com/sirupsen/logrus"
-	"github.com/tidwall/gjson"
 	"github.com/wcharczuk/go-chart/v2"
 
 	"github.com/FloatTech/floatbox/binary"
-	fcext "github.com/FloatTech/floatbox/ctxext"
 	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/imgfactory"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
 	"github.com/FloatTech/zbputils/img/text"
 
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/msgarchive/archive"
+
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
 )
 
+const (
+	// topN 热词图显示的词数
+	topN = 20
+	// stopwordsRetry 停用词下载失败后重试的间隔
+	stopwordsRetry = 10 * time.Minute
+)
+
 var (
 	re        = regexp.MustCompile(`^[一-龥]+$`)
 	stopwords []string
+	// stopmu 保护 stopwords 的加载
+	stopmu    sync.Mutex
+	stoptried time.Time
+
+	errStopwords = errors.New("停用词加载失败, 请稍后再试")
 )
 
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "聊天热词",
-		Help:             "- 热词 [消息数目]|热词 1000",
+		Help: "- 热词 [今天|7天|30天]\n" +
+			"- 热词 [消息数目]|热词 1000 (分析最近的消息)\n" +
+			"- 我的热词 [今天|7天|30天]\n" +
+			"- 词云 [今天|7天|30天]\n" +
+			"- 添加停用词 xxx [yyy] (仅管理员)\n" +
+			"- 删除停用词 xxx [yyy] (仅管理员)\n" +
+			"- 查看停用词\n" +
+			"Tips: 插件启用后开始统计群内每个人说过的词, 最多保留30天",
 		PublicDataFolder: "WordCount",
 	})
 	cachePath := engine.DataFolder() + "cache/"
@@ -52,48 +74,86 @@ func init() {
 	}
 	_ = os.RemoveAll(cachePath)
 	_ = os.MkdirAll(cachePath, 0755)
-	engine.OnRegex(`^热词\s?(\d*)$`, zero.OnlyGroup, fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+	err = initDatabase(engine.DataFolder() + "wordcount.db")
+	if err != nil {
+		panic(err)
+	}
+	// loadStopwords 加载公共停用词, 失败后一段时间内不再重试
+	loadStopwords := func() error {
+		stopmu.Lock()
+		defer stopmu.Unlock()
+		if stopwords != nil {
+			return nil
+		}
+		if time.Since(stoptried) < stopwordsRetry {
+			return errStopwords
+		}
+		stoptried = time.Now()
 		_, err := engine.GetLazyData("stopwords.txt", false)
 		if err != nil {
-			ctx.SendChain(message.Text("ERROR: ", err))
-			return false
+			return err
 		}
 		data, err := os.ReadFile(engine.DataFolder() + "stopwords.txt")
 		if err != nil {
+			return err
+		}
+		words := strings.Split(strings.ReplaceAll(binary.BytesToString(data), "\r", ""), "\n")
+		sort.Strings(words)
+		stopwords = words
+		logrus.Infoln("[wordcount]加载", len(stopwords), "条停用词")
+		return nil
+	}
+	// cut 切分并过滤出有意义的词
+	cut := func(tex string) (words []string) {
+		for _, word := range seg.Cut(tex, true) {
+			word = strings.TrimSpace(word)
+			i := sort.SearchStrings(stopwords, word)
+			if re.MatchString(word) && (i >= len(stopwords) || stopwords[i] != word) {
+				words = append(words, word)
+			}
+		}
+		return
+	}
+	stopwordsLoaded := func(ctx *zero.Ctx) bool {
+		if err := loadStopwords(); err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return false
 		}
-		stopwords = strings.Split(strings.ReplaceAll(binary.BytesToString(data), "\r", ""), "\n")
-		sort.Strings(stopwords)
-		logrus.Infoln("[wordcount]加载", len(stopwords), "条停用词")
 		return true
-	})).Limit(ctxext.LimitByUser).SetBlock(true).
+	}
+
+	engine.OnRegex(`^热词\s*(今天|今日|7天|30天|\d+)?$`, zero.OnlyGroup, stopwordsLoaded).Limit(ctxext.LimitByUser).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			_, err := file.GetLazyData(text.FontFile, control.Md5File, true)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return
-			}
-			b, err := os.ReadFile(text.FontFile)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return
-			}
-			font, err := freetype.ParseFont(b)
+			arg := ctx.State["regex_matched"].([]string)[1]
+			gid := ctx.Event.GroupID
+			p, err := strconv.ParseInt(arg, 10, 64)
 			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
+				days, name := parsePeriod(arg)
+				wc, err := topWords(gid, 0, since(time.Now(), days), topN)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				if len(wc) == 0 {
+					ctx.SendChain(message.Text("本群", name, "还没有统计到热词"))
+					return
+				}
+				data, err := drawBars(fmt.Sprintf("本群%s的热词top%d", name, topN), wc)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				ctx.SendChain(message.ImageBytes(data))
 				return
 			}
 
 			ctx.SendChain(message.Text("少女祈祷中..."))
-			p, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
 			if p > 10000 {
 				p = 10000
 			}
 			if p == 0 {
 				p = 1000
 			}
-			gid := ctx.Event.GroupID
 			group := ctx.GetGroupInfo(gid, false)
 			if group.MemberCount == 0 {
 				ctx.SendChain(message.Text(zero.BotConfig.NickName[0], "未加入", group.Name, "(", gid, "),无法获得热词呢"))
@@ -106,66 +166,190 @@ func init() {
 				return
 			}
 			messageMap := make(map[string]int, 256)
-			h := ctx.GetGroupMessageHistory(gid, 0, p, false)
-			h.Get("messages").ForEach(func(_, msgObj gjson.Result) bool {
-				tex := strings.TrimSpace(message.ParseMessageFromString(msgObj.Get("raw_message").Str).ExtractPlainText())
-				if tex != "" {
-					words := seg.Cut(tex, true)
-					for _, word := range words {
-						word = strings.TrimSpace(word)
-						i := sort.SearchStrings(stopwords, word)
-						if re.MatchString(word) && (i >= len(stopwords) || stopwords[i] != word) {
-							messageMap[word]++
-						}
-					}
+			for _, tex := range history(ctx, gid, p) {
+				for _, word := range cut(tex) {
+					messageMap[word]++
 				}
-				return true
-			})
+			}
 
 			wc := rankByWordCount(messageMap)
-			if len(wc) > 20 {
-				wc = wc[:20]
+			if len(wc) > topN {
+				wc = wc[:topN]
 			}
 			// 绘图
 			if len(wc) == 0 {
 				ctx.SendChain(message.Text("ERROR: 历史消息为空或者无法获得历史消息"))
 				return
 			}
-			bars := make([]chart.Value, len(wc))
-			for i, v := range wc {
-				bars[i] = chart.Value{
-					Value: float64(v.Value),
-					Label: v.Key,
+			data, err := drawBars(fmt.Sprintf("%s(%d)在%s号的%d条消息的热词top%d", group.Name, gid, time.Now().Format("2006-01-02"), p, topN), wc)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			err = os.WriteFile(drawedFile, data, 0644)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Image("file:///" + file.BOTPATH + "/" + drawedFile))
+		})
+	engine.OnRegex(`^我的热词\s*(今天|今日|7天|30天)?$`, zero.OnlyGroup).Limit(ctxext.LimitByUser).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			days, name := parsePeriod(ctx.State["regex_matched"].([]string)[1])
+			wc, err := topWords(ctx.Event.GroupID, ctx.Event.UserID, since(time.Now(), days), topN)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(wc) == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你", name, "在本群还没有统计到热词"))
+				return
+			}
+			data, err := drawBars(fmt.Sprintf("%s%s的热词top%d", ctx.CardOrNickName(ctx.Event.UserID), name, topN), wc)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.ImageBytes(data))
+		})
+	engine.OnRegex(`^词云\s*(今天|今日|7天|30天)?$`, zero.OnlyGroup).Limit(ctxext.LimitByGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			days, name := parsePeriod(ctx.State["regex_matched"].([]string)[1])
+			wc, err := topWords(ctx.Event.GroupID, 0, since(time.Now(), days), cloudWords)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(wc) == 0 {
+				ctx.SendChain(message.Text("本群", name, "还没有统计到热词"))
+				return
+			}
+			img, err := drawCloud(ctx.GetGroupInfo(ctx.Event.GroupID, false).Name+" "+name+"的词云", wc)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			data, err := imgfactory.ToBytes(img)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if id := ctx.SendChain(message.ImageBytes(data)); id.ID() == 0 {
+				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			}
+		})
+	engine.OnRegex(`^(添加|删除)停用词\s*(.+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			words := strings.FieldsFunc(matched[2], func(r rune) bool {
+				return r == ' ' || r == ',' || r == '，' || r == '、' || r == '\n'
+			})
+			if len(words) == 0 {
+				ctx.SendChain(message.Text("请输入停用词"))
+				return
+			}
+			gid := ctx.Event.GroupID
+			if matched[1] == "添加" {
+				if err := addStopwords(gid, words); err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
 				}
+				ctx.SendChain(message.Text("已添加", len(words), "个停用词, 统计热词时将不再显示"))
+				return
 			}
-			graph := chart.BarChart{
-				Font:  font,
-				Title: fmt.Sprintf("%s(%d)在%s号的%d条消息的热词top20", group.Name, gid, time.Now().Format("2006-01-02"), p),
-				Background: chart.Style{
-					Padding: chart.Box{
-						Top: 40,
-					},
-				},
-				Height:   500,
-				BarWidth: 25,
-				Bars:     bars,
-			}
-			f, err := os.Create(drawedFile)
+			n, err := delStopwords(gid, words)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			err = graph.Render(chart.PNG, f)
-			_ = f.Close()
+			ctx.SendChain(message.Text("已删除", n, "个停用词"))
+		})
+	engine.OnFullMatch("查看停用词", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			words, err := listStopwords(ctx.Event.GroupID)
 			if err != nil {
-				_ = os.Remove(drawedFile)
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			ctx.SendChain(message.Image("file:///" + file.BOTPATH + "/" + drawedFile))
+			if len(words) == 0 {
+				ctx.SendChain(message.Text("本群没有自定义停用词"))
+				return
+			}
+			ctx.SendChain(message.Text("本群的停用词: ", strings.Join(words, " ")))
+		})
+	// 统计需在指令之后注册, 以免把指令也算进去
+	engine.OnMessage(zero.OnlyGroup).SetBlock(false).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.UserID == ctx.Event.SelfID {
+				return
+			}
+			tex := strings.TrimSpace(ctx.ExtractPlainText())
+			if tex == "" {
+				return
+			}
+			if err := loadStopwords(); err != nil {
+				return
+			}
+			count(ctx.Event.GroupID, ctx.Event.UserID, time.Unix(ctx.Event.Time, 0), cut(tex))
 		})
 }
 
+// parsePeriod 统计区间的天数与名称, 默认为今天
+func parsePeriod(s string) (int, string) {
+	switch s {
+	case "7天":
+		return 7, "近7天"
+	case "30天":
+		return 30, "近30天"
+	default:
+		return 1, "今天"
+	}
+}
+
+// drawBars 绘制热词柱状图
+func drawBars(title string, wc pairlist) ([]byte, error) {
+	b, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	font, err := freetype.ParseFont(b)
+	if err != nil {
+		return nil, err
+	}
+	bars := make([]chart.Value, len(wc))
+	for i, v := range wc {
+		bars[i] = chart.Value{
+			Value: float64(v.Value),
+			Label: v.Key,
+		}
+	}
+	graph := chart.BarChart{
+		Font:  font,
+		Title: title,
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top: 40,
+			},
+		},
+		Height:   500,
+		BarWidth: 25,
+		Bars:     bars,
+	}
+	var buf bytes.Buffer
+	err = graph.Render(chart.PNG, &buf)
+	return buf.Bytes(), err
+}
+
+// history 群内最近 n 条消息的文字部分
+func history(ctx *zero.Ctx, gid, n int64) (texts []string) {
+	for _, m := range archive.History(ctx, gid, int(n)) {
+		if m.Text != "" {
+			texts = append(texts, m.Text)
+		}
+	}
+	return
+}
+
 func rankByWordCount(wordFrequencies map[string]int) pairlist {
 	pl := make(pairlist, len(wordFrequencies))
 	i := 0